@@ -1,82 +1,395 @@
 package api
 
 import (
+	"code/tech-test/application/config"
 	"code/tech-test/application/handlers"
+	"code/tech-test/application/lifecycle"
+	"code/tech-test/application/middleware"
+	authModels "code/tech-test/domain/auth/models"
+	authServices "code/tech-test/domain/auth/services"
+	"code/tech-test/domain/auth/tokens"
+	"code/tech-test/domain/health"
+	"code/tech-test/domain/metrics"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/domain/users/passwords"
+	"code/tech-test/domain/users/privacy"
+	"code/tech-test/domain/users/replay"
 	"code/tech-test/domain/users/services"
-	"code/tech-test/repositories/json"
-	kafkaPub "code/tech-test/repositories/kafka"
+	"code/tech-test/repositories/memory"
 	"code/tech-test/repositories/postgresql"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
-
-	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
 	_ "github.com/jackc/pgx/stdlib"
 )
 
-var (
-	pgsqlAddr = ""
-	pgsqlPort = 0
-	kafkaAddr = ""
-	kafkaPort = 0
+// SetupAPI runs the API until SIGINT or SIGTERM. The components start in
+// dependency order, the tracer, the stores, the publishers, the outbox relay
+// and the HTTP server, and stop in the reverse one: the server drains its
+// requests, the relay stops, the producer flushes, the database pool closes
+// and the last spans are exported.
+func SetupAPI(cfg config.Config) error {
+	manager := lifecycle.NewManager(newLifecycleConfig(cfg))
+
+	if err := addAPI(manager, cfg); err != nil {
+		// the components added before the failure hold opened resources,
+		// which Run would otherwise close on shutdown
+		manager.Close()
+
+		return err
+	}
+
+	ctx, stop := lifecycle.WithSignals(context.Background())
+	defer stop()
+
+	return manager.Run(ctx)
+}
+
+// HTTP server timeouts, bounding the connections of slow or idle clients.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
 )
 
-//SetupAPI ...
-func SetupAPI() {
+// addAPI adds the components of the API to the manager, in dependency order.
+func addAPI(manager *lifecycle.Manager, cfg config.Config) error {
+	checks := health.NewRegistry(newHealthConfig(cfg))
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.NewRuntimeCollector())
 
-	getEnvironmentVariables()
+	tracer, tracerComponent, err := newTracer(cfg)
+	if err != nil {
+		return err
+	}
+	if tracer != nil {
+		manager.Add(tracerComponent)
+	}
 
-	connString := fmt.Sprintf("host=%s port=%d user=postgres password=postgres dbname=postgres sslmode=disable", pgsqlAddr, pgsqlPort)
+	stores, closeStores, err := openStores(cfg, registry)
+	if err != nil {
+		return err
+	}
+	manager.Add(closer("stores", closeStores))
+
+	if stores.ping != nil {
+		checks.Register("postgres", stores.ping)
+	}
+
+	encoder, err := newEncoder(cfg)
+	if err != nil {
+		return err
+	}
 
-	pool, err := sql.Open("pgx", connString)
+	publisher, closePublisher, err := newPublisher(cfg, encoder, checks, registry)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer pool.Close()
+	manager.Add(closer("publishers", closePublisher))
+
+	outboxConfig := outbox.DefaultRelayConfig()
+	outboxConfig.Interval = cfg.OutboxInterval
+	outboxConfig.Retention = cfg.OutboxRetention
+
+	relay := outbox.NewRelay(stores.outbox, publisher, outboxConfig)
+	manager.Add(lifecycle.Component{
+		Name: "outbox relay",
+		Run: func(ctx context.Context) error {
+			if tracer != nil {
+				ctx = tracing.WithTracer(ctx, tracer)
+			}
+			relay.Run(ctx)
+
+			return nil
+		},
+	})
 
-	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": fmt.Sprintf("%s:%d", kafkaAddr, kafkaPort)})
+	hasher, err := newHasher(cfg)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	publisher := kafkaPub.NewUserProducer(producer, "users", json.UserSerializer{})
+	service := services.NewUserService(stores.users, stores.roles, hasher)
+	roleService := services.NewRoleService(stores.roles)
+	handler := handlers.NewUserHandler(service, roleService)
+	roleHandler := handlers.NewRoleHandler(roleService)
+	historyHandler := handlers.NewHistoryHandler(services.NewHistoryService(stores.history))
+	privacyHandler := handlers.NewPrivacyHandler(privacy.NewService(stores.privacy, stores.tokens, stores.messages))
 
-	store := postgresql.NewUserStore(pool)
-	service := services.NewUserService(store)
-	handler := handlers.NewUserHandler(service, publisher)
+	signer, err := newSigner(cfg.JWT)
+	if err != nil {
+		return err
+	}
+
+	authService := authServices.NewAuthService(service, stores.tokens, signer, newAuthConfig(cfg))
+	authHandler := handlers.NewAuthHandler(authService)
 
 	router := mux.NewRouter().StrictSlash(true)
+	if tracer != nil {
+		router.Use(middleware.Trace(tracer))
+	}
+	router.Use(middleware.Metrics(registry))
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Authenticate(authService))
+
+	selfOrAdmin := middleware.AnyOf(middleware.Self("id"), middleware.Admin)
+	readUsers := middleware.Scope("users:read")
 
-	router.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
-	router.HandleFunc("/users", handler.ListUsers).Methods("GET")
+	router.HandleFunc("/users/{id}", middleware.Require(middleware.AnyOf(middleware.Self("id"), readUsers), handler.GetUser)).Methods("GET")
+	router.HandleFunc("/users", middleware.Require(readUsers, handler.ListUsers)).Methods("GET")
 	router.HandleFunc("/users", handler.CreateUser).Methods("POST")
-	router.HandleFunc("/users/{id}", handler.UpdateUser).Methods("PUT")
-	router.HandleFunc("/users/{id}", handler.DeleteUser).Methods("DELETE")
+	router.HandleFunc("/users/{id}", middleware.Require(selfOrAdmin, handler.UpdateUser)).Methods("PUT")
+	router.HandleFunc("/users/{id}", middleware.Require(middleware.Admin, handler.PurgeUser)).Methods("DELETE").Queries("purge", "true")
+	router.HandleFunc("/users/{id}", middleware.Require(selfOrAdmin, handler.DeleteUser)).Methods("DELETE")
+	router.HandleFunc("/users/{id}/restore", middleware.Require(middleware.Admin, handler.RestoreUser)).Methods("POST")
+	router.HandleFunc("/users/{id}/export", middleware.Require(selfOrAdmin, privacyHandler.ExportUser)).Methods("GET")
+	router.HandleFunc("/users/{id}/erasure", middleware.Require(selfOrAdmin, privacyHandler.EraseUser)).Methods("POST")
+	router.HandleFunc("/users/{id}/history", middleware.Require(selfOrAdmin, historyHandler.GetUserHistory)).Methods("GET")
+
+	manageRoles := middleware.Permission(service, "roles:manage")
+
+	router.HandleFunc("/users/{id}/roles", middleware.Require(middleware.AnyOf(middleware.Self("id"), manageRoles), handler.ListUserRoles)).Methods("GET")
+	router.HandleFunc("/users/{id}/roles/{role}", middleware.Require(manageRoles, handler.AssignRole)).Methods("PUT")
+	router.HandleFunc("/users/{id}/roles/{role}", middleware.Require(manageRoles, handler.RevokeRole)).Methods("DELETE")
+
+	router.HandleFunc("/roles", middleware.Require(manageRoles, roleHandler.ListRoles)).Methods("GET")
+	router.HandleFunc("/roles", middleware.Require(manageRoles, roleHandler.CreateRole)).Methods("POST")
+	router.HandleFunc("/roles/{name}", middleware.Require(manageRoles, roleHandler.GetRole)).Methods("GET")
+	router.HandleFunc("/roles/{name}", middleware.Require(manageRoles, roleHandler.UpdateRole)).Methods("PUT")
+	router.HandleFunc("/roles/{name}", middleware.Require(manageRoles, roleHandler.DeleteRole)).Methods("DELETE")
+
+	router.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+	router.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
+
+	healthHandler := handlers.NewHealthHandler(manager, checks)
 
 	router.HandleFunc("/_/health", handlers.HealthCheck).Methods("GET")
+	router.HandleFunc("/_/live", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/_/ready", healthHandler.Ready).Methods("GET")
 	router.HandleFunc("/_/runtime", handlers.RuntimeCheck).Methods("GET")
+	router.HandleFunc("/_/metrics", handlers.NewMetricsHandler(registry).Metrics).Methods("GET")
+	// the last error of the relay may hold details of the brokers
+	router.HandleFunc("/_/outbox", middleware.Require(middleware.Admin, handlers.NewOutboxHandler(relay).Lag)).Methods("GET")
 
-	log.Println("starting users API")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	// listening before running the components fails the start rather than
+	// the server when the address is taken
+	listener, err := net.Listen("tcp", cfg.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           router,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	manager.Add(lifecycle.Component{
+		Name: "HTTP server",
+		Run: func(ctx context.Context) error {
+			log.Printf("users API listening on %s", listener.Addr())
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				return err
+			}
+
+			return nil
+		},
+		Stop: server.Shutdown,
+	})
+
+	return nil
 }
 
-func getEnvironmentVariables() {
-	env := os.Getenv("env")
-
-	if env == "docker" {
-		fmt.Println("HERE")
-		pgsqlAddr = "psql"
-		pgsqlPort = 5432
-		kafkaAddr = "kafka"
-		kafkaPort = 29092
-	} else {
-		pgsqlAddr = "localhost"
-		pgsqlPort = 5434
-		kafkaAddr = "localhost"
-		kafkaPort = 9092
+func newLifecycleConfig(cfg config.Config) lifecycle.Config {
+	lifecycleConfig := lifecycle.DefaultConfig()
+	lifecycleConfig.DrainTimeout = cfg.Shutdown.DrainTimeout
+	lifecycleConfig.ReadinessDelay = cfg.Shutdown.ReadinessDelay
+
+	return lifecycleConfig
+}
+
+func newHealthConfig(cfg config.Config) health.Config {
+	healthConfig := health.DefaultConfig()
+	healthConfig.Timeout = cfg.Health.Timeout
+	healthConfig.CacheTTL = cfg.Health.CacheTTL
+
+	return healthConfig
+}
+
+// closer makes a component of a resource closed on shutdown.
+func closer(name string, close func()) lifecycle.Component {
+	return lifecycle.Component{
+		Name: name,
+		Stop: func(ctx context.Context) error {
+			close()
+
+			return nil
+		},
 	}
 }
+
+type stores struct {
+	users    services.UserStore
+	history  services.HistoryStore
+	privacy  privacy.UserStore
+	replay   replay.UserStore
+	roles    services.RoleStore
+	tokens   refreshTokenStore
+	outbox   outbox.Store
+	messages privacy.MessageStore
+	// ping checks the database, the in-memory store having none.
+	ping health.Checker
+}
+
+// refreshTokenStore is used both to authenticate users and to answer their
+// access and erasure requests.
+type refreshTokenStore interface {
+	authServices.RefreshTokenStore
+	privacy.TokenStore
+}
+
+// openStores opens the stores of the configured kind, the returned function
+// closes the database pool. When given the registry, the statistics of the
+// pool and the durations of the queries are exposed as metrics.
+func openStores(cfg config.Config, registry *metrics.Registry) (stores, func(), error) {
+	if cfg.Store == "memory" {
+		log.Println("using in-memory store, data is lost on restart")
+		users := memory.NewUserStore()
+
+		return stores{
+			users:    users,
+			history:  users,
+			privacy:  users,
+			replay:   users,
+			roles:    memory.NewRoleStore(users),
+			tokens:   memory.NewRefreshTokenStore(),
+			outbox:   users.Outbox(),
+			messages: users.Outbox(),
+		}, func() {}, nil
+	}
+
+	pool, err := OpenDatabase(cfg.Postgres)
+	if err != nil {
+		return stores{}, nil, err
+	}
+
+	var durations postgresql.Durations
+	if registry != nil {
+		registry.Register(metrics.NewPoolCollector(pool))
+		durations = registry.Histogram("store_query_duration_seconds", "Duration of the store methods.", metrics.DefaultBuckets, "store", "method")
+	}
+
+	users := postgresql.NewUserStore(pool).WithDurations(durations)
+	messages := postgresql.NewOutboxStore(pool).WithDurations(durations)
+
+	return stores{
+		users:    users,
+		history:  users,
+		privacy:  users,
+		replay:   users,
+		roles:    postgresql.NewRoleStore(pool).WithDurations(durations),
+		tokens:   postgresql.NewRefreshTokenStore(pool).WithDurations(durations),
+		outbox:   messages,
+		messages: messages,
+		ping:     health.CheckerFunc(users.Ping),
+	}, func() { pool.Close() }, nil
+}
+
+// OpenDatabase opens the PostgreSQL pool of the configuration.
+func OpenDatabase(cfg config.Postgres) (*sql.DB, error) {
+	return sql.Open("pgx", cfg.ConnString())
+}
+
+func newHasher(cfg config.Config) (passwords.Hasher, error) {
+	passwordConfig := passwords.DefaultConfig()
+	passwordConfig.Algorithm = passwords.Algorithm(cfg.PasswordHash)
+
+	return passwords.NewHasher(passwordConfig)
+}
+
+func newAuthConfig(cfg config.Config) authServices.Config {
+	authConfig := authServices.DefaultConfig()
+	authConfig.Issuer = cfg.JWT.Issuer
+	authConfig.AccessTTL = cfg.JWT.AccessTTL
+	authConfig.RefreshTTL = cfg.JWT.RefreshTTL
+	authConfig.Scopes = cfg.JWT.Scopes
+	authConfig.APIKeys = parseAPIKeys(cfg.APIKeys)
+
+	return authConfig
+}
+
+// newSigner builds the token signer of the jwt settings. The key is the HMAC
+// secret or the base64 Ed25519 seed, without one a random key is used and
+// tokens do not survive a restart.
+func newSigner(cfg config.JWT) (tokens.Signer, error) {
+	switch cfg.Algorithm {
+	case "HS256":
+		secret := []byte(cfg.Key)
+		if cfg.Key == "" {
+			log.Println("no jwt_key set, signing tokens with a random secret")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+
+		return tokens.NewHMACSigner(secret)
+	case "EdDSA":
+		if cfg.Key == "" {
+			log.Println("no jwt_key set, signing tokens with a random key")
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+
+			return tokens.NewEd25519Signer(key)
+		}
+
+		seed, err := base64.StdEncoding.DecodeString(cfg.Key)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, tokens.ErrInvalidKey
+		}
+
+		return tokens.NewEd25519Signer(ed25519.NewKeyFromSeed(seed))
+	}
+
+	return nil, fmt.Errorf("unknown jwt algorithm %q", cfg.Algorithm)
+}
+
+// parseAPIKeys reads comma separated `name:key:scopes` entries, the scopes
+// being space separated, e.g. `reporting:s3cr3t:users:read`.
+func parseAPIKeys(value string) []authModels.APIKey {
+	var keys []authModels.APIKey = make([]authModels.APIKey, 0)
+
+	for i, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) < 2 || parts[1] == "" {
+			log.Printf("ignoring malformed api_keys entry %d", i+1)
+			continue
+		}
+
+		var scopes []string
+		if len(parts) == 3 {
+			scopes = strings.Fields(parts[2])
+		}
+
+		keys = append(keys, authModels.NewAPIKey(parts[0], parts[1], scopes))
+	}
+
+	return keys
+}
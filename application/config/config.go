@@ -0,0 +1,530 @@
+package config
+
+import (
+	"code/tech-test/domain/users/passwords"
+	"code/tech-test/repositories/cloudevents"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// The configuration is layered, each source overriding the previous ones:
+// the defaults, the YAML file, the environment variables and the flags.
+const (
+	// FlagFile and EnvFile point to the YAML file, none is read by default.
+	FlagFile = "config"
+	EnvFile  = "config_file"
+
+	// fileSuffix is appended to the keys and variables of the secrets to
+	// read them from a file, e.g. `jwt_key_file=/run/secrets/jwt`, the flags
+	// taking flagFileSuffix.
+	fileSuffix     = "_file"
+	flagFileSuffix = "-file"
+
+	redacted = "[redacted]"
+)
+
+type Config struct {
+	// Store is `postgresql` or `memory`.
+	Store           string
+	HTTP            HTTP
+	Postgres        Postgres
+	Kafka           Kafka
+	PasswordHash    string
+	JWT             JWT
+	APIKeys         string
+	Publishers      []string
+	PublisherFile   string
+	Serializer      string
+	SchemaRegistry  string
+	Tombstones      string
+	Consume         Consume
+	OutboxInterval  time.Duration
+	OutboxRetention time.Duration
+	Shutdown        Shutdown
+	Health          Health
+	Tracing         Tracing
+}
+
+type HTTP struct {
+	Addr string
+}
+
+type Postgres struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	SSLMode  string
+}
+
+// ConnString is the connection URL of the pgx driver, escaping the user and
+// the password, which may come from a secret file.
+func (p Postgres) ConnString() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.User, p.Password),
+		Host:     net.JoinHostPort(p.Host, strconv.Itoa(p.Port)),
+		Path:     "/" + p.Database,
+		RawQuery: url.Values{"sslmode": {p.SSLMode}}.Encode(),
+	}
+
+	return u.String()
+}
+
+type Kafka struct {
+	Brokers []string
+	Topic   string
+	// Mode is the CloudEvents mode of the produced messages, `structured` or
+	// `binary`.
+	Mode string
+}
+
+type JWT struct {
+	Algorithm  string
+	Key        string
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Scopes     []string
+}
+
+type Consume struct {
+	Topic           string
+	DeadLetterTopic string
+	Group           string
+}
+
+type Health struct {
+	// Timeout bounds each check of the readiness.
+	Timeout time.Duration
+	// CacheTTL is how long the result of a check is reused.
+	CacheTTL time.Duration
+}
+
+type Tracing struct {
+	// Exporter is `none`, `otlp`, `stdout` or `file`.
+	Exporter string
+	// Endpoint is the OTLP/HTTP endpoint of the otlp exporter.
+	Endpoint string
+	// File is the file of the file exporter.
+	File string
+	// Service names the API in the traces.
+	Service string
+	// Interval is how often the spans are exported.
+	Interval time.Duration
+}
+
+type Shutdown struct {
+	// DrainTimeout bounds the shutdown, in-flight requests included.
+	DrainTimeout time.Duration
+	// ReadinessDelay is waited once the readiness fails, before stopping.
+	ReadinessDelay time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Store: "postgresql",
+		HTTP:  HTTP{Addr: ":8080"},
+		Postgres: Postgres{
+			Host:     "localhost",
+			Port:     5434,
+			User:     "postgres",
+			Password: "postgres",
+			Database: "postgres",
+			SSLMode:  "disable",
+		},
+		Kafka: Kafka{
+			Brokers: []string{"localhost:9092"},
+			Topic:   "users",
+			Mode:    "structured",
+		},
+		PasswordHash: string(passwords.Argon2id),
+		JWT: JWT{
+			Algorithm:  "HS256",
+			Issuer:     "users",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+			Scopes:     []string{},
+		},
+		Publishers:     []string{"kafka"},
+		PublisherFile:  "users.ndjson",
+		Serializer:     "json",
+		SchemaRegistry: "schemas.json",
+		Tombstones:     cloudevents.TombstoneOnErasure,
+		Consume: Consume{
+			Topic:           "users-commands",
+			DeadLetterTopic: "users-commands-dlq",
+			Group:           "users",
+		},
+		OutboxInterval:  time.Second,
+		OutboxRetention: 7 * 24 * time.Hour,
+		Shutdown: Shutdown{
+			DrainTimeout: 30 * time.Second,
+		},
+		Health: Health{
+			Timeout:  2 * time.Second,
+			CacheTTL: 5 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+			Endpoint: "http://localhost:4318",
+			File:     "traces.ndjson",
+			Service:  "users",
+			Interval: 5 * time.Second,
+		},
+	}
+}
+
+// field is a setting of the configuration. Its key names it in the file,
+// nested by dots, its variable is the key with underscores, the name the
+// settings had before the file, and its flag the key with dashes.
+type field struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	set    func(string) error
+	get    func() interface{}
+}
+
+func (f field) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.key)
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		stringField("store", "store", "store of the users, postgresql or memory", &c.Store),
+		stringField("http.addr", "http_addr", "address the API listens on", &c.HTTP.Addr),
+		stringField("postgres.host", "postgres_host", "host of the database", &c.Postgres.Host),
+		intField("postgres.port", "postgres_port", "port of the database", &c.Postgres.Port),
+		stringField("postgres.user", "postgres_user", "user of the database", &c.Postgres.User),
+		secret(stringField("postgres.password", "postgres_password", "password of the database user", &c.Postgres.Password)),
+		stringField("postgres.database", "postgres_database", "name of the database", &c.Postgres.Database),
+		stringField("postgres.sslmode", "postgres_sslmode", "SSL mode of the database connections", &c.Postgres.SSLMode),
+		listField("kafka.brokers", "kafka_brokers", "comma separated host:port of the Kafka brokers", &c.Kafka.Brokers),
+		stringField("kafka.topic", "kafka_topic", "topic the events are published to", &c.Kafka.Topic),
+		stringField("kafka.mode", "kafka_mode", "CloudEvents mode of the Kafka messages, structured or binary", &c.Kafka.Mode),
+		stringField("password_hash", "password_hash", "password hashing algorithm, argon2id or bcrypt", &c.PasswordHash),
+		stringField("jwt.algorithm", "jwt_algorithm", "signing algorithm of the access tokens, HS256 or EdDSA", &c.JWT.Algorithm),
+		secret(stringField("jwt.key", "jwt_key", "HMAC secret or base64 Ed25519 seed, random when empty", &c.JWT.Key)),
+		stringField("jwt.issuer", "jwt_issuer", "issuer of the access tokens", &c.JWT.Issuer),
+		durationField("jwt.access_ttl", "jwt_access_ttl", "lifetime of the access tokens", &c.JWT.AccessTTL),
+		durationField("jwt.refresh_ttl", "jwt_refresh_ttl", "lifetime of the refresh tokens", &c.JWT.RefreshTTL),
+		listField("jwt.scopes", "jwt_scopes", "scopes granted to the users logging in", &c.JWT.Scopes),
+		secret(stringField("api_keys", "api_keys", "comma separated name:key:scopes API keys", &c.APIKeys)),
+		listField("publishers", "publishers", "comma separated publishers, kafka, file or noop", &c.Publishers),
+		stringField("publisher_file", "publisher_file", "file of the file publisher", &c.PublisherFile),
+		stringField("serializer", "serializer", "serializer of the event data, json, avro or protobuf", &c.Serializer),
+		stringField("schema_registry", "schema_registry", "file of the schema registry", &c.SchemaRegistry),
+		stringField("tombstones", "tombstones", "users followed by a tombstone, erasure or delete", &c.Tombstones),
+		stringField("consume.topic", "consume_topic", "topic holding the user commands", &c.Consume.Topic),
+		stringField("consume.dead_letter_topic", "consume_dead_letter_topic", "topic receiving the commands which cannot be applied", &c.Consume.DeadLetterTopic),
+		stringField("consume.group", "consume_group", "consumer group of the commands", &c.Consume.Group),
+		durationField("outbox.interval", "outbox_interval", "interval between two polls of the outbox", &c.OutboxInterval),
+		durationField("outbox.retention", "outbox_retention", "how long the sent outbox messages are kept, 0 keeps them", &c.OutboxRetention),
+		durationField("shutdown.drain_timeout", "shutdown_drain_timeout", "longest wait for the components to stop", &c.Shutdown.DrainTimeout),
+		durationField("shutdown.readiness_delay", "shutdown_readiness_delay", "wait between failing the readiness and stopping", &c.Shutdown.ReadinessDelay),
+		durationField("health.timeout", "health_timeout", "longest wait for a readiness check", &c.Health.Timeout),
+		durationField("health.cache_ttl", "health_cache_ttl", "how long the result of a readiness check is reused", &c.Health.CacheTTL),
+		stringField("tracing.exporter", "tracing_exporter", "exporter of the traces, none, otlp, stdout or file", &c.Tracing.Exporter),
+		stringField("tracing.endpoint", "tracing_endpoint", "OTLP/HTTP endpoint of the otlp exporter", &c.Tracing.Endpoint),
+		stringField("tracing.file", "tracing_file", "file of the file exporter", &c.Tracing.File),
+		stringField("tracing.service", "tracing_service", "service name of the traces", &c.Tracing.Service),
+		durationField("tracing.interval", "tracing_interval", "interval between two exports of the spans", &c.Tracing.Interval),
+	}
+}
+
+func secret(f field) field {
+	f.secret = true
+
+	return f
+}
+
+func stringField(key, env, usage string, value *string) field {
+	return field{
+		key:   key,
+		env:   env,
+		usage: usage,
+		set: func(s string) error {
+			*value = s
+
+			return nil
+		},
+		get: func() interface{} { return *value },
+	}
+}
+
+func intField(key, env, usage string, value *int) field {
+	return field{
+		key:   key,
+		env:   env,
+		usage: usage,
+		set: func(s string) error {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer, got %q", key, s)
+			}
+			*value = i
+
+			return nil
+		},
+		get: func() interface{} { return *value },
+	}
+}
+
+func durationField(key, env, usage string, value *time.Duration) field {
+	return field{
+		key:   key,
+		env:   env,
+		usage: usage,
+		set: func(s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration such as 15m, got %q", key, s)
+			}
+			*value = d
+
+			return nil
+		},
+		get: func() interface{} { return value.String() },
+	}
+}
+
+// listField splits its value on commas and spaces, an empty value clearing
+// the list.
+func listField(key, env, usage string, value *[]string) field {
+	return field{
+		key:   key,
+		env:   env,
+		usage: usage,
+		set: func(s string) error {
+			*value = strings.FieldsFunc(s, func(r rune) bool {
+				return r == ',' || r == ' '
+			})
+
+			return nil
+		},
+		get: func() interface{} { return append([]string{}, *value...) },
+	}
+}
+
+// Sources are the layers read over the defaults. The file is read when set,
+// the environment and the flags when not nil.
+type Sources struct {
+	File  string
+	Env   func(key string) (string, bool)
+	Flags *pflag.FlagSet
+}
+
+// Load reads the configuration from its sources and validates it.
+func Load(sources Sources) (Config, error) {
+	c := DefaultConfig()
+	fields := c.fields()
+
+	if sources.File != "" {
+		values, err := readFile(sources.File)
+		if err != nil {
+			return Config{}, err
+		}
+
+		if err := apply(fields, values, func(f field) string { return f.key }, fileSuffix, true); err != nil {
+			return Config{}, fmt.Errorf("%w in %s", err, sources.File)
+		}
+	}
+
+	if sources.Env != nil {
+		values := make(map[string]string)
+		for _, f := range fields {
+			for _, name := range []string{f.env, f.env + fileSuffix} {
+				if value, ok := sources.Env(name); ok {
+					values[name] = value
+				}
+			}
+		}
+
+		if err := apply(fields, values, func(f field) string { return f.env }, fileSuffix, false); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if sources.Flags != nil {
+		values := make(map[string]string)
+		sources.Flags.Visit(func(flag *pflag.Flag) {
+			values[flag.Name] = flag.Value.String()
+		})
+
+		if err := apply(fields, values, field.flag, flagFileSuffix, false); err != nil {
+			return Config{}, err
+		}
+	}
+
+	return c, c.Validate()
+}
+
+// apply sets the fields named in the values of a source, reading the secrets
+// from their file when named with the suffix. Strict sources reject the names
+// unknown to the configuration, the environment and the flags holding more
+// than the configuration.
+func apply(fields []field, values map[string]string, name func(field) string, suffix string, strict bool) error {
+	known := make(map[string]bool)
+
+	for _, f := range fields {
+		n := name(f)
+		known[n] = true
+
+		value, ok := values[n]
+
+		if f.secret {
+			fileName := n + suffix
+			known[fileName] = true
+
+			if path, found := values[fileName]; found {
+				if ok {
+					return fmt.Errorf("%s and %s cannot both be set", n, fileName)
+				}
+
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("%w failed to read %s", err, fileName)
+				}
+				value, ok = strings.TrimRight(string(content), "\r\n"), true
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := f.set(value); err != nil {
+			return err
+		}
+	}
+
+	if strict {
+		for n := range values {
+			if !known[n] {
+				return fmt.Errorf("unknown setting %s", n)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readFile flattens the YAML file into the keys of the fields, the lists
+// being joined with commas.
+func readFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to read configuration file", err)
+	}
+
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("%w failed to parse %s", err, path)
+	}
+
+	values := make(map[string]string)
+
+	var flatten func(prefix string, items yaml.MapSlice)
+	flatten = func(prefix string, items yaml.MapSlice) {
+		for _, item := range items {
+			key := prefix + fmt.Sprint(item.Key)
+
+			switch value := item.Value.(type) {
+			case yaml.MapSlice:
+				flatten(key+".", value)
+			case []interface{}:
+				entries := make([]string, 0, len(value))
+				for _, entry := range value {
+					entries = append(entries, fmt.Sprint(entry))
+				}
+				values[key] = strings.Join(entries, ",")
+			case nil:
+				values[key] = ""
+			default:
+				values[key] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	flatten("", document)
+
+	return values, nil
+}
+
+// RegisterFlags adds the flags of the configuration, secrets only being
+// read from files so they do not show in the processes.
+func RegisterFlags(flags *pflag.FlagSet) {
+	flags.String(FlagFile, "", fmt.Sprintf("YAML configuration file, or the %s variable", EnvFile))
+
+	var c Config
+	for _, f := range c.fields() {
+		if f.secret {
+			flags.String(f.flag()+flagFileSuffix, "", fmt.Sprintf("file holding the %s, or the %s%s variable", f.usage, f.env, fileSuffix))
+			continue
+		}
+
+		flags.String(f.flag(), "", fmt.Sprintf("%s, or the %s variable", f.usage, f.env))
+	}
+}
+
+// FromFlags loads the configuration of a command, from the file of its
+// flags or of the environment, the environment and its flags.
+func FromFlags(flags *pflag.FlagSet) (Config, error) {
+	file, _ := os.LookupEnv(EnvFile)
+	if flag := flags.Lookup(FlagFile); flag != nil && flag.Changed {
+		file = flag.Value.String()
+	}
+
+	return Load(Sources{
+		File:  file,
+		Env:   os.LookupEnv,
+		Flags: flags,
+	})
+}
+
+// YAML writes the configuration as the file it could be read from, the
+// secrets being redacted.
+func (c Config) YAML() ([]byte, error) {
+	var document yaml.MapSlice
+
+	for _, f := range c.fields() {
+		value := f.get()
+		if f.secret && value != "" {
+			value = redacted
+		}
+
+		document = insert(document, strings.Split(f.key, "."), value)
+	}
+
+	return yaml.Marshal(document)
+}
+
+// insert sets the value at the path of the document, keeping the order the
+// keys were inserted in.
+func insert(document yaml.MapSlice, path []string, value interface{}) yaml.MapSlice {
+	if len(path) == 1 {
+		return append(document, yaml.MapItem{Key: path[0], Value: value})
+	}
+
+	for i, item := range document {
+		if item.Key == path[0] {
+			document[i].Value = insert(item.Value.(yaml.MapSlice), path[1:], value)
+
+			return document
+		}
+	}
+
+	return append(document, yaml.MapItem{Key: path[0], Value: insert(nil, path[1:], value)})
+}
@@ -0,0 +1,243 @@
+//+build unit
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/spf13/pflag"
+
+	. "github.com/onsi/gomega"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+
+		return value, ok
+	}
+}
+
+func flags(t *testing.T, args ...string) *pflag.FlagSet {
+	set := pflag.NewFlagSet("users", pflag.ContinueOnError)
+	RegisterFlags(set)
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return set
+}
+
+func Test_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "users.yaml", `
+store: memory
+http:
+  addr: ":9090"
+postgres:
+  host: file-host
+  port: 5432
+kafka:
+  brokers: [kafka-1:9092, kafka-2:9092]
+jwt:
+  access_ttl: 5m
+  scopes: [users:read]
+publishers:
+  - file
+  - noop
+`)
+	secret := writeFile(t, dir, "jwt", "s3cr3t\n")
+
+	testCases := []struct {
+		description string
+		sources     Sources
+		expected    func(g *WithT, c Config)
+	}{
+		{
+			description: "when there is no source",
+			sources:     Sources{},
+			expected: func(g *WithT, c Config) {
+				g.Expect(c).To(Equal(DefaultConfig()), "should use the defaults")
+			},
+		},
+		{
+			description: "when there is a file",
+			sources:     Sources{File: file},
+			expected: func(g *WithT, c Config) {
+				g.Expect(c.Store).To(Equal("memory"), "should read the file")
+				g.Expect(c.HTTP.Addr).To(Equal(":9090"), "should read the nested settings")
+				g.Expect(c.Postgres.Port).To(Equal(5432), "should parse the integers")
+				g.Expect(c.Postgres.User).To(Equal("postgres"), "should keep the defaults of the settings left out")
+				g.Expect(c.Kafka.Brokers).To(Equal([]string{"kafka-1:9092", "kafka-2:9092"}), "should read the inline lists")
+				g.Expect(c.Publishers).To(Equal([]string{"file", "noop"}), "should read the lists")
+				g.Expect(c.JWT.AccessTTL).To(Equal(5*time.Minute), "should parse the durations")
+				g.Expect(c.JWT.Scopes).To(Equal([]string{"users:read"}), "should read the nested lists")
+			},
+		},
+		{
+			description: "when the environment overrides the file",
+			sources: Sources{
+				File: file,
+				Env:  env(map[string]string{"postgres_host": "env-host", "jwt_scopes": "", "publishers": "kafka"}),
+			},
+			expected: func(g *WithT, c Config) {
+				g.Expect(c.Store).To(Equal("memory"), "should keep the settings of the file")
+				g.Expect(c.Postgres.Host).To(Equal("env-host"), "should override the file")
+				g.Expect(c.JWT.Scopes).To(BeEmpty(), "should clear the lists set to nothing")
+				g.Expect(c.Publishers).To(Equal([]string{"kafka"}), "should override the lists")
+			},
+		},
+		{
+			description: "when the flags override the environment",
+			sources: Sources{
+				File:  file,
+				Env:   env(map[string]string{"postgres_host": "env-host", "store": "postgresql"}),
+				Flags: flags(t, "--postgres-host", "flag-host"),
+			},
+			expected: func(g *WithT, c Config) {
+				g.Expect(c.Store).To(Equal("postgresql"), "should keep the environment")
+				g.Expect(c.Postgres.Host).To(Equal("flag-host"), "should override the environment")
+			},
+		},
+		{
+			description: "when a secret is read from a file",
+			sources: Sources{
+				Env:   env(map[string]string{"jwt_key_file": secret}),
+				Flags: flags(t, "--postgres-password-file", secret),
+			},
+			expected: func(g *WithT, c Config) {
+				g.Expect(c.JWT.Key).To(Equal("s3cr3t"), "should read the variable file without its newline")
+				g.Expect(c.Postgres.Password).To(Equal("s3cr3t"), "should read the flag file")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c, err := Load(tc.sources)
+			g.Expect(err).ToNot(HaveOccurred(), "should load the configuration")
+
+			tc.expected(g, c)
+		})
+	}
+}
+
+func Test_Load_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		description string
+		sources     Sources
+		expected    string
+	}{
+		{
+			description: "when the file is missing",
+			sources:     Sources{File: filepath.Join(dir, "missing.yaml")},
+			expected:    "failed to read configuration file",
+		},
+		{
+			description: "when the file has an unknown setting",
+			sources:     Sources{File: writeFile(t, dir, "unknown.yaml", "postgres:\n  hots: localhost\n")},
+			expected:    "unknown setting postgres.hots",
+		},
+		{
+			description: "when a value cannot be parsed",
+			sources:     Sources{Env: env(map[string]string{"postgres_port": "five"})},
+			expected:    `postgres.port must be an integer, got "five"`,
+		},
+		{
+			description: "when a secret is set along with its file",
+			sources:     Sources{Env: env(map[string]string{"jwt_key": "key", "jwt_key_file": "key.txt"})},
+			expected:    "jwt_key and jwt_key_file cannot both be set",
+		},
+		{
+			description: "when the settings are invalid",
+			sources:     Sources{Env: env(map[string]string{"store": "mongodb", "jwt_access_ttl": "0s", "publishers": "kafka,pigeon"})},
+			expected:    `invalid configuration: store must be one of postgresql, memory, got "mongodb"; jwt.access_ttl must be positive; publishers must be one of kafka, file, noop, got "pigeon"`,
+		},
+		{
+			description: "when the tracing endpoint is not a URL",
+			sources:     Sources{Env: env(map[string]string{"tracing_exporter": "otlp", "tracing_endpoint": "localhost:4318"})},
+			expected:    `invalid configuration: tracing.endpoint must be an http or https URL, got "localhost:4318"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := Load(tc.sources)
+			g.Expect(err).To(MatchError(ContainSubstring(tc.expected)), "should return the expected error")
+		})
+	}
+}
+
+func Test_YAML(t *testing.T) {
+	g := NewWithT(t)
+
+	c := DefaultConfig()
+	c.JWT.Key = "s3cr3t"
+	c.APIKeys = ""
+
+	out, err := c.YAML()
+	g.Expect(err).ToNot(HaveOccurred(), "should write the configuration")
+	g.Expect(string(out)).ToNot(ContainSubstring("s3cr3t"), "should redact the secrets")
+	g.Expect(string(out)).To(ContainSubstring("key: '[redacted]'"), "should tell the secret is set")
+	g.Expect(string(out)).To(ContainSubstring(`api_keys: ""`), "should tell the secret is not set")
+
+	dir, err := ioutil.TempDir("", "config")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	c.JWT.Key = ""
+	c.Postgres.Password = ""
+	out, err = c.YAML()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	loaded, err := Load(Sources{File: writeFile(t, dir, "printed.yaml", string(out))})
+	g.Expect(err).ToNot(HaveOccurred(), "should read the printed configuration back")
+	g.Expect(loaded).To(Equal(c), "should print the effective configuration")
+}
+
+func Test_Postgres_ConnString(t *testing.T) {
+	g := NewWithT(t)
+
+	p := DefaultConfig().Postgres
+	p.User = "users api"
+	p.Password = `it's a s3cr3t\ with @:/?#`
+
+	parsed, err := pgx.ParseConnectionString(p.ConnString())
+	g.Expect(err).ToNot(HaveOccurred(), "should build a connection string the driver reads")
+	g.Expect(parsed.User).To(Equal(p.User), "should escape the user")
+	g.Expect(parsed.Password).To(Equal(p.Password), "should escape the password")
+	g.Expect(parsed.Host).To(Equal(p.Host))
+	g.Expect(parsed.Port).To(Equal(uint16(p.Port)))
+	g.Expect(parsed.Database).To(Equal(p.Database))
+	g.Expect(parsed.TLSConfig).To(BeNil(), "should keep the SSL mode")
+}
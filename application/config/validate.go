@@ -0,0 +1,111 @@
+package config
+
+import (
+	"code/tech-test/domain/users/passwords"
+	"code/tech-test/repositories/cloudevents"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ValidationError lists every invalid setting, so they can all be fixed at
+// once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the settings the services cannot start without.
+func (c Config) Validate() error {
+	var problems []string
+
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+
+		check(false, "%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+	}
+
+	oneOf("store", c.Store, "postgresql", "memory")
+
+	_, _, err := net.SplitHostPort(c.HTTP.Addr)
+	check(err == nil, "http.addr must be host:port, got %q", c.HTTP.Addr)
+
+	if c.Store == "postgresql" {
+		check(c.Postgres.Host != "", "postgres.host must be set")
+		check(c.Postgres.Port > 0 && c.Postgres.Port < 65536, "postgres.port must be between 1 and 65535, got %d", c.Postgres.Port)
+		check(c.Postgres.User != "", "postgres.user must be set")
+		check(c.Postgres.Database != "", "postgres.database must be set")
+		oneOf("postgres.sslmode", c.Postgres.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	}
+
+	check(len(c.Kafka.Brokers) > 0, "kafka.brokers must be set")
+	check(c.Kafka.Topic != "", "kafka.topic must be set")
+	// the modes of repositories/kafka, which needs cgo to be imported
+	oneOf("kafka.mode", c.Kafka.Mode, "structured", "binary")
+
+	oneOf("password_hash", c.PasswordHash, string(passwords.Argon2id), string(passwords.Bcrypt))
+
+	oneOf("jwt.algorithm", c.JWT.Algorithm, "HS256", "EdDSA")
+	check(c.JWT.Issuer != "", "jwt.issuer must be set")
+	check(c.JWT.AccessTTL > 0, "jwt.access_ttl must be positive")
+	check(c.JWT.RefreshTTL > c.JWT.AccessTTL, "jwt.refresh_ttl must be longer than jwt.access_ttl")
+
+	check(len(c.Publishers) > 0, "publishers must be set")
+	for _, publisher := range c.Publishers {
+		oneOf("publishers", publisher, "kafka", "file", "noop")
+		if publisher == "file" {
+			check(c.PublisherFile != "", "publisher_file must be set for the file publisher")
+		}
+	}
+
+	oneOf("serializer", c.Serializer, "json", "avro", "protobuf")
+	if c.Serializer != "json" {
+		check(c.SchemaRegistry != "", "schema_registry must be set for the %s serializer", c.Serializer)
+	}
+	oneOf("tombstones", c.Tombstones, cloudevents.TombstoneOnErasure, cloudevents.TombstoneOnDelete)
+
+	check(c.Consume.Topic != "", "consume.topic must be set")
+	check(c.Consume.DeadLetterTopic != "", "consume.dead_letter_topic must be set")
+	check(c.Consume.Topic != c.Consume.DeadLetterTopic, "consume.dead_letter_topic must differ from consume.topic")
+	check(c.Consume.Group != "", "consume.group must be set")
+
+	check(c.OutboxInterval > 0, "outbox.interval must be positive")
+	check(c.OutboxRetention >= 0, "outbox.retention cannot be negative")
+
+	check(c.Shutdown.DrainTimeout > 0, "shutdown.drain_timeout must be positive")
+	check(c.Shutdown.ReadinessDelay >= 0, "shutdown.readiness_delay cannot be negative")
+
+	check(c.Health.Timeout > 0, "health.timeout must be positive")
+	check(c.Health.CacheTTL >= 0, "health.cache_ttl cannot be negative")
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout", "file")
+	switch c.Tracing.Exporter {
+	case "otlp":
+		check(strings.HasPrefix(c.Tracing.Endpoint, "http://") || strings.HasPrefix(c.Tracing.Endpoint, "https://"), "tracing.endpoint must be an http or https URL, got %q", c.Tracing.Endpoint)
+	case "file":
+		check(c.Tracing.File != "", "tracing.file must be set for the file exporter")
+	}
+	if c.Tracing.Exporter != "none" {
+		check(c.Tracing.Service != "", "tracing.service must be set")
+		check(c.Tracing.Interval > 0, "tracing.interval must be positive")
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+
+	return nil
+}
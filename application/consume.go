@@ -0,0 +1,80 @@
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/application/lifecycle"
+	"code/tech-test/domain/users/commands"
+	"code/tech-test/domain/users/services"
+	"context"
+	"log"
+)
+
+// ConsumeOptions overrides the consume settings when set.
+type ConsumeOptions struct {
+	Topic           string
+	DeadLetterTopic string
+	Group           string
+}
+
+type commandSource interface {
+	commands.Source
+	commands.DeadLetters
+}
+
+// Consume applies the user commands of the upstream topic until SIGINT or
+// SIGTERM. The changes go through the user service and are published by the
+// outbox relay of the API. On shutdown the consumer stops before the source
+// leaves the group and the database pool closes.
+func Consume(cfg config.Config, options ConsumeOptions) error {
+	if options.Topic != "" {
+		cfg.Consume.Topic = options.Topic
+	}
+	if options.DeadLetterTopic != "" {
+		cfg.Consume.DeadLetterTopic = options.DeadLetterTopic
+	}
+	if options.Group != "" {
+		cfg.Consume.Group = options.Group
+	}
+
+	hasher, err := newHasher(cfg)
+	if err != nil {
+		return err
+	}
+
+	manager := lifecycle.NewManager(newLifecycleConfig(cfg))
+
+	stores, closeStores, err := openStores(cfg, nil)
+	if err != nil {
+		return err
+	}
+	manager.Add(closer("stores", closeStores))
+
+	service := services.NewUserService(stores.users, stores.roles, hasher)
+
+	source, closeSource, err := newCommandSource(cfg)
+	if err != nil {
+		manager.Close()
+
+		return err
+	}
+	manager.Add(closer("command source", closeSource))
+
+	consumer := commands.NewConsumer(source, commands.NewHandler(service), source, commands.DefaultConsumerConfig())
+	manager.Add(lifecycle.Component{
+		Name: "consumer",
+		Run: func(ctx context.Context) error {
+			log.Println("starting users consumer")
+			err := consumer.Run(ctx)
+
+			stats := consumer.Stats()
+			log.Printf("applied %d commands, %d dead-lettered, %d retried", stats.Applied, stats.DeadLettered, stats.Retried)
+
+			return err
+		},
+	})
+
+	ctx, stop := lifecycle.WithSignals(context.Background())
+	defer stop()
+
+	return manager.Run(ctx)
+}
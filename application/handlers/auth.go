@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"code/tech-test/domain/auth/models"
+	"code/tech-test/domain/auth/services"
+	"code/tech-test/domain/auth/tokens"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+type AuthService interface {
+	Login(ctx context.Context, login, password string) (models.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	JWKS() tokens.JWKS
+}
+
+type AuthHandler struct {
+	service AuthService
+}
+
+func NewAuthHandler(service AuthService) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+	}
+}
+
+type loginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+
+	var request loginRequest
+	if err := readJSON(r, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	pair, err := h.service.Login(r.Context(), request.Login, request.Password)
+	if err != nil {
+		writeAuthError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainTokens(pair))
+}
+
+func (h AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+
+	var request refreshRequest
+	if err := readJSON(r, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	pair, err := h.service.Refresh(r.Context(), request.RefreshToken)
+	if err != nil {
+		writeAuthError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainTokens(pair))
+}
+
+func (h AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+
+	var request refreshRequest
+	if err := readJSON(r, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), request.RefreshToken); err != nil {
+		writeAuthError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.JWKS())
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch err {
+	case services.ErrInvalidCredentials, services.ErrInvalidToken, services.ErrTokenReused:
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	log.Println(err)
+}
+
+func fromDomainTokens(pair models.TokenPair) TokenResponse {
+	return TokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(pair.ExpiresIn.Seconds()),
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(reqBody, v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(response); err != nil {
+		log.Println(err)
+	}
+}
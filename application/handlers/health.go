@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"code/tech-test/domain/health"
 	"encoding/json"
 	"log"
 	"net/http"
 	"runtime"
+	"time"
 )
 
 type runtimeCheckResponse struct {
@@ -12,6 +14,94 @@ type runtimeCheckResponse struct {
 	AllocatedMemory      uint64 `json:"allocated_memory_MB"`
 }
 
+// Readiness tells whether the process takes requests, it stops before
+// shutting down.
+type Readiness interface {
+	Ready() bool
+}
+
+type HealthChecks interface {
+	Check() health.Report
+}
+
+type HealthHandler struct {
+	readiness Readiness
+	checks    HealthChecks
+}
+
+func NewHealthHandler(readiness Readiness, checks HealthChecks) *HealthHandler {
+	return &HealthHandler{
+		readiness: readiness,
+		checks:    checks,
+	}
+}
+
+type CheckResponse struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type HealthResponse struct {
+	Status string          `json:"status"`
+	Checks []CheckResponse `json:"checks,omitempty"`
+}
+
+// Live answers as long as the process serves requests, whatever the state of
+// its dependencies, restarting it not fixing them.
+func (h HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: health.StatusUp})
+}
+
+// Ready checks the dependencies of the process, answering `503 Service
+// Unavailable` when one of them is down, or while the process starts or shuts
+// down, for load balancers to send the requests elsewhere.
+func (h HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if !h.readiness.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{
+			Status: health.StatusDown,
+			Checks: []CheckResponse{{
+				Name:      "lifecycle",
+				Status:    health.StatusDown,
+				Error:     "starting or shutting down",
+				CheckedAt: time.Now().UTC(),
+			}},
+		})
+
+		return
+	}
+
+	report := h.checks.Check()
+
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, fromDomainReport(report))
+}
+
+func fromDomainReport(report health.Report) HealthResponse {
+	response := HealthResponse{
+		Status: report.Status,
+		Checks: make([]CheckResponse, 0, len(report.Checks)),
+	}
+
+	for _, result := range report.Checks {
+		response.Checks = append(response.Checks, CheckResponse{
+			Name:      result.Name,
+			Status:    result.Status,
+			LatencyMS: float64(result.Latency) / float64(time.Millisecond),
+			Error:     result.Error,
+			CheckedAt: result.CheckedAt.UTC(),
+		})
+	}
+
+	return response
+}
+
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	_, err := w.Write([]byte("OK"))
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/services"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type HistoryService interface {
+	History(ctx context.Context, q services.HistoryQuery) (services.HistoryPage, error)
+	UserAt(ctx context.Context, id int, version uint32) (models.HistoryEntry, error)
+}
+
+type HistoryHandler struct {
+	service HistoryService
+}
+
+func NewHistoryHandler(service HistoryService) *HistoryHandler {
+	return &HistoryHandler{
+		service: service,
+	}
+}
+
+type HistoryEntryResponse struct {
+	Version   uint32        `json:"version"`
+	Changes   []string      `json:"changes"`
+	Actor     string        `json:"actor"`
+	RequestID string        `json:"request_id,omitempty"`
+	At        time.Time     `json:"at"`
+	User      *UserResponse `json:"user,omitempty"`
+}
+
+type HistoryResponse struct {
+	History   []HistoryEntryResponse `json:"history"`
+	NextAfter uint32                 `json:"next_after,omitempty"`
+	Limit     int                    `json:"limit"`
+}
+
+// GetUserHistory lists the versions of the user, oldest first, paginated with
+// the `limit` and `after` parameters. With the `version` parameter it returns
+// that version only, along with the user as of it.
+func (h HistoryHandler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	if version := r.FormValue("version"); version != "" {
+		h.getVersion(w, r, id, version)
+
+		return
+	}
+
+	q := services.HistoryQuery{
+		ID:    id,
+		Limit: services.DefaultHistoryLimit,
+	}
+
+	if limit := r.FormValue("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println(err)
+
+			return
+		}
+	}
+
+	if after := r.FormValue("after"); after != "" {
+		v, err := strconv.ParseUint(after, 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println(err)
+
+			return
+		}
+		q.After = uint32(v)
+	}
+
+	page, err := h.service.History(r.Context(), q)
+	if err != nil {
+		writeHistoryError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainHistory(page))
+}
+
+func (h HistoryHandler) getVersion(w http.ResponseWriter, r *http.Request, id int, version string) {
+	v, err := strconv.ParseUint(version, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	entry, err := h.service.UserAt(r.Context(), id, uint32(v))
+	if err != nil {
+		writeHistoryError(w, err)
+
+		return
+	}
+
+	response := fromDomainHistoryEntry(entry)
+	user := fromDomain(entry.User)
+	response.User = &user
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeHistoryError(w http.ResponseWriter, err error) {
+	switch err {
+	case services.ErrUserNotFound, services.ErrVersionNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case services.ErrInvalidQuery:
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	log.Println(err)
+}
+
+func fromDomainHistoryEntry(entry models.HistoryEntry) HistoryEntryResponse {
+	return HistoryEntryResponse{
+		Version:   entry.Version(),
+		Changes:   entry.Changes,
+		Actor:     entry.Actor,
+		RequestID: entry.RequestID,
+		At:        entry.At,
+	}
+}
+
+func fromDomainHistory(page services.HistoryPage) HistoryResponse {
+	var entries []HistoryEntryResponse = make([]HistoryEntryResponse, 0)
+
+	for _, entry := range page.Entries {
+		entries = append(entries, fromDomainHistoryEntry(entry))
+	}
+
+	return HistoryResponse{
+		History:   entries,
+		NextAfter: page.Next,
+		Limit:     page.Limit,
+	}
+}
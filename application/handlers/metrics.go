@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"bytes"
+	"code/tech-test/domain/metrics"
+	"io"
+	"log"
+	"net/http"
+)
+
+type Metrics interface {
+	WriteText(w io.Writer) error
+}
+
+type MetricsHandler struct {
+	metrics Metrics
+}
+
+func NewMetricsHandler(metrics Metrics) *MetricsHandler {
+	return &MetricsHandler{
+		metrics: metrics,
+	}
+}
+
+// Metrics exposes the metrics of the process in the Prometheus text format,
+// for Prometheus to scrape.
+func (h MetricsHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	var out bytes.Buffer
+	if err := h.metrics.WriteText(&out); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := out.WriteTo(w); err != nil {
+		log.Println(err)
+	}
+}
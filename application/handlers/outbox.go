@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"code/tech-test/domain/outbox"
+	"context"
+	"log"
+	"net/http"
+)
+
+type OutboxRelay interface {
+	Lag(ctx context.Context) (outbox.Lag, error)
+}
+
+type OutboxHandler struct {
+	relay OutboxRelay
+}
+
+func NewOutboxHandler(relay OutboxRelay) *OutboxHandler {
+	return &OutboxHandler{
+		relay: relay,
+	}
+}
+
+type OutboxLagResponse struct {
+	Pending          int     `json:"pending"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+	Sent             uint64  `json:"sent"`
+	Failed           uint64  `json:"failed"`
+	LastError        string  `json:"last_error,omitempty"`
+}
+
+func (h OutboxHandler) Lag(w http.ResponseWriter, r *http.Request) {
+	lag, err := h.relay.Lag(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, OutboxLagResponse{
+		Pending:          lag.Pending,
+		OldestAgeSeconds: lag.OldestAge.Seconds(),
+		Sent:             lag.Sent,
+		Failed:           lag.Failed,
+		LastError:        lag.LastError,
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/privacy"
+	"code/tech-test/domain/users/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type PrivacyService interface {
+	Export(ctx context.Context, id int) (privacy.Export, error)
+	Erase(ctx context.Context, id int, version uint32) (models.Erasure, error)
+}
+
+type PrivacyHandler struct {
+	service PrivacyService
+}
+
+func NewPrivacyHandler(service PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		service: service,
+	}
+}
+
+type eraseUserRequest struct {
+	Version uint32 `json:"version"`
+}
+
+type RefreshTokenResponse struct {
+	FamilyID  string     `json:"family_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type EventResponse struct {
+	MessageID  int64      `json:"message_id"`
+	Type       string     `json:"type"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	SentAt     *time.Time `json:"sent_at,omitempty"`
+}
+
+type ErasureResponse struct {
+	UserID         int       `json:"user_id"`
+	Version        uint32    `json:"version"`
+	Fields         []string  `json:"fields"`
+	HistoryEntries int       `json:"history_entries"`
+	Actor          string    `json:"actor"`
+	RequestID      string    `json:"request_id,omitempty"`
+	ErasedAt       time.Time `json:"erased_at"`
+}
+
+type ExportResponse struct {
+	ExportedAt    time.Time              `json:"exported_at"`
+	User          UserResponse           `json:"user"`
+	History       []HistoryEntryResponse `json:"history"`
+	RefreshTokens []RefreshTokenResponse `json:"refresh_tokens"`
+	Events        []EventResponse        `json:"events"`
+	Erasures      []ErasureResponse      `json:"erasures"`
+}
+
+// ExportUser answers a subject access request with every data held about the
+// user, as a JSON file to download.
+func (h PrivacyHandler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	export, err := h.service.Export(r.Context(), id)
+	if err != nil {
+		writePrivacyError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d.json"`, id))
+	writeJSON(w, http.StatusOK, fromDomainExport(export))
+}
+
+// EraseUser anonymizes the user for good and answers with the proof of the
+// erasure. The body is optional, its version is checked against the one of
+// the user when given.
+func (h PrivacyHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	var request eraseUserRequest
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	if len(reqBody) > 0 {
+		if err := json.Unmarshal(reqBody, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println(err)
+
+			return
+		}
+	}
+
+	erasure, err := h.service.Erase(r.Context(), id, request.Version)
+	if err != nil {
+		writePrivacyError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainErasure(erasure))
+}
+
+func writePrivacyError(w http.ResponseWriter, err error) {
+	switch err {
+	case services.ErrUserNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case services.ErrWrongVersion, services.ErrUserErased:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	log.Println(err)
+}
+
+// optionalTime leaves out the times that did not happen.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func fromDomainErasure(erasure models.Erasure) ErasureResponse {
+	return ErasureResponse{
+		UserID:         erasure.UserID,
+		Version:        erasure.Version,
+		Fields:         erasure.Fields,
+		HistoryEntries: erasure.HistoryEntries,
+		Actor:          erasure.Actor,
+		RequestID:      erasure.RequestID,
+		ErasedAt:       erasure.At,
+	}
+}
+
+func fromDomainExport(export privacy.Export) ExportResponse {
+	response := ExportResponse{
+		ExportedAt:    export.ExportedAt,
+		User:          fromDomain(export.User),
+		History:       make([]HistoryEntryResponse, 0, len(export.History)),
+		RefreshTokens: make([]RefreshTokenResponse, 0, len(export.Tokens)),
+		Events:        make([]EventResponse, 0, len(export.Events)),
+		Erasures:      make([]ErasureResponse, 0, len(export.Erasures)),
+	}
+
+	for _, entry := range export.History {
+		e := fromDomainHistoryEntry(entry)
+		user := fromDomain(entry.User)
+		e.User = &user
+
+		response.History = append(response.History, e)
+	}
+
+	for _, token := range export.Tokens {
+		response.RefreshTokens = append(response.RefreshTokens, RefreshTokenResponse{
+			FamilyID:  token.FamilyID,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			RotatedAt: optionalTime(token.RotatedAt),
+			RevokedAt: optionalTime(token.RevokedAt),
+		})
+	}
+
+	for _, event := range export.Events {
+		response.Events = append(response.Events, EventResponse{
+			MessageID:  event.MessageID,
+			Type:       event.Type,
+			OccurredAt: event.OccurredAt,
+			QueuedAt:   event.QueuedAt,
+			SentAt:     optionalTime(event.SentAt),
+		})
+	}
+
+	for _, erasure := range export.Erasures {
+		response.Erasures = append(response.Erasures, fromDomainErasure(erasure))
+	}
+
+	return response
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/services"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type RoleService interface {
+	GetRole(ctx context.Context, name string) (models.Role, error)
+	ListRoles(ctx context.Context) ([]models.Role, error)
+	CreateRole(ctx context.Context, params services.CreateRoleParams) (models.Role, error)
+	UpdateRole(ctx context.Context, params services.UpdateRoleParams) (models.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+}
+
+type RoleHandler struct {
+	service RoleService
+}
+
+func NewRoleHandler(service RoleService) *RoleHandler {
+	return &RoleHandler{
+		service: service,
+	}
+}
+
+type createRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type updateRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Version     uint32   `json:"version"`
+}
+
+type RoleResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     uint32    `json:"version"`
+}
+
+type RolesResponse struct {
+	Roles []RoleResponse `json:"roles"`
+}
+
+func (h RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
+	role, err := h.service.GetRole(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainRole(role))
+}
+
+func (h RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.ListRoles(r.Context())
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainRoles(roles))
+}
+
+func (h RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+
+	var request createRoleRequest
+	if err := readJSON(r, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	role, err := h.service.CreateRole(r.Context(), services.CreateRoleParams{
+		Name:        request.Name,
+		Description: request.Description,
+		Permissions: request.Permissions,
+	})
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, fromDomainRole(role))
+}
+
+func (h RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+
+	var request updateRoleRequest
+	if err := readJSON(r, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	role, err := h.service.UpdateRole(r.Context(), services.UpdateRoleParams{
+		Name:        mux.Vars(r)["name"],
+		Description: request.Description,
+		Permissions: request.Permissions,
+		Version:     request.Version,
+	})
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainRole(role))
+}
+
+func (h RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteRole(r.Context(), mux.Vars(r)["name"]); err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListUserRoles returns the roles assigned to the user.
+func (h UserHandler) ListUserRoles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	user, err := h.service.GetUser(r.Context(), id)
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	roles := make([]models.Role, 0, len(user.Roles))
+	for _, name := range user.Roles {
+		role, err := h.roles.GetRole(r.Context(), name)
+		if err == services.ErrRoleNotFound {
+			continue
+		}
+		if err != nil {
+			writeRoleError(w, err)
+
+			return
+		}
+
+		roles = append(roles, role)
+	}
+
+	writeJSON(w, http.StatusOK, fromDomainRoles(roles))
+}
+
+func (h UserHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, h.service.AssignRole)
+}
+
+func (h UserHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, h.service.RevokeRole)
+}
+
+func (h UserHandler) changeRole(w http.ResponseWriter, r *http.Request, change func(context.Context, services.RoleAssignmentParams) (models.User, error)) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	user, err := change(r.Context(), services.RoleAssignmentParams{
+		ID:   id,
+		Role: vars["role"],
+	})
+	if err != nil {
+		writeRoleError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomain(user))
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch err {
+	case services.ErrRoleNotFound, services.ErrUserNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case services.ErrRoleExists, services.ErrRoleInUse, services.ErrWrongVersion:
+		w.WriteHeader(http.StatusConflict)
+	case services.ErrInvalidRole:
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	log.Println(err)
+}
+
+func fromDomainRole(role models.Role) RoleResponse {
+	return RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   role.Meta.GetCreatedAt(),
+		UpdatedAt:   role.Meta.GetUpdatedAt(),
+		Version:     role.Meta.GetVersion(),
+	}
+}
+
+func fromDomainRoles(roles []models.Role) RolesResponse {
+	var roleResponse []RoleResponse = make([]RoleResponse, 0)
+
+	for _, elem := range roles {
+		roleResponse = append(roleResponse, fromDomainRole(elem))
+	}
+
+	return RolesResponse{
+		Roles: roleResponse,
+	}
+}
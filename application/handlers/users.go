@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
 	"code/tech-test/domain/users/services"
 	"context"
 	"encoding/json"
@@ -16,25 +17,27 @@ import (
 
 type UserService interface {
 	GetUser(ctx context.Context, id int) (models.User, error)
-	ListUsers(ctx context.Context, queryTerms map[string]string) ([]models.User, error)
+	ListUsers(ctx context.Context, q query.Query) (query.Page, error)
 	CreateUser(ctx context.Context, params services.CreateUserParams) (models.User, error)
 	UpdateUser(ctx context.Context, params services.UpdateUserParams) (models.User, error)
 	DeleteUser(ctx context.Context, params services.DeleteUserParams) (models.User, error)
+	RestoreUser(ctx context.Context, params services.RestoreUserParams) (models.User, error)
+	PurgeUser(ctx context.Context, params services.PurgeUserParams) (models.User, error)
+	AssignRole(ctx context.Context, params services.RoleAssignmentParams) (models.User, error)
+	RevokeRole(ctx context.Context, params services.RoleAssignmentParams) (models.User, error)
 }
 
-type UserProducer interface {
-	Publish(user models.User) error
-}
-
+// UserHandler serves the users. The changes are published by the outbox
+// relay, the stores write them to the outbox along with the change.
 type UserHandler struct {
-	service  UserService
-	producer UserProducer
+	service UserService
+	roles   RoleService
 }
 
-func NewUserHandler(service UserService, producer UserProducer) *UserHandler {
+func NewUserHandler(service UserService, roles RoleService) *UserHandler {
 	return &UserHandler{
-		service:  service,
-		producer: producer,
+		service: service,
+		roles:   roles,
 	}
 }
 
@@ -57,6 +60,10 @@ type createUserRequest struct {
 	Country   string `json:"country"`
 }
 
+type restoreUserRequest struct {
+	Version uint32 `json:"version"`
+}
+
 type UserResponse struct {
 	ID        int       `json:"id"`
 	FirstName string    `json:"first_name"`
@@ -64,6 +71,7 @@ type UserResponse struct {
 	Nickname  string    `json:"nickname"`
 	Email     string    `json:"email"`
 	Country   string    `json:"country"`
+	Roles     []string  `json:"roles,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Active    bool      `json:"active"`
@@ -71,7 +79,10 @@ type UserResponse struct {
 }
 
 type UsersResponse struct {
-	Users []UserResponse `json:"users"`
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Limit      int            `json:"limit"`
+	Total      *int           `json:"total,omitempty"`
 }
 
 func (h UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -84,7 +95,7 @@ func (h UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 	}
 
-	user, err := h.service.GetUser(context.Background(), i)
+	user, err := h.service.GetUser(r.Context(), i)
 	if err != nil {
 		switch err {
 		case services.ErrUserNotFound:
@@ -116,39 +127,28 @@ func (h UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 func (h UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 
-	var queryTerms map[string]string = make(map[string]string, 0)
-
-	country := r.FormValue("country")
-	firstName := r.FormValue("first_name")
-	lastName := r.FormValue("last_name")
-	email := r.FormValue("email")
-	nickname := r.FormValue("nickname")
+	q, err := pageQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
 
-	if country != "" {
-		queryTerms["country"] = country
-	}
-	if firstName != "" {
-		queryTerms["first_name"] = firstName
-	}
-	if lastName != "" {
-		queryTerms["last_name"] = lastName
-	}
-	if email != "" {
-		queryTerms["email"] = email
-	}
-	if nickname != "" {
-		queryTerms["nickname"] = nickname
+		return
 	}
 
-	users, err := h.service.ListUsers(context.Background(), queryTerms)
+	page, err := h.service.ListUsers(r.Context(), q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		switch err {
+		case services.ErrInvalidQuery:
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		log.Println(err)
 
 		return
 	}
 
-	response, err := json.Marshal(fromDomainSlice(users))
+	response, err := json.Marshal(fromDomainPage(page))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Println(err)
@@ -194,7 +194,7 @@ func (h UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Password:  request.Password,
 	}
 
-	user, err := h.service.CreateUser(context.Background(), params)
+	user, err := h.service.CreateUser(r.Context(), params)
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -202,13 +202,6 @@ func (h UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.producer.Publish(user)
-	if err != nil {
-		log.Println(err)
-
-		return
-	}
-
 	response, err := json.Marshal(fromDomain(user))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -267,7 +260,7 @@ func (h UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		ID:        id,
 	}
 
-	user, err := h.service.UpdateUser(context.Background(), params)
+	user, err := h.service.UpdateUser(r.Context(), params)
 	if err != nil {
 		switch err {
 		case services.ErrUserNotFound:
@@ -284,12 +277,6 @@ func (h UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.producer.Publish(user)
-	if err != nil {
-		log.Println(err)
-
-	}
-
 	response, err := json.Marshal(fromDomain(user))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -319,25 +306,113 @@ func (h UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.DeleteUser(context.Background(), services.DeleteUserParams{
+	_, err = h.service.DeleteUser(r.Context(), services.DeleteUserParams{
 		ID: id,
 	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		switch err {
+		case services.ErrUserNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			log.Println(err)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Println(err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RestoreUser brings back a deleted user. The body is optional, its version
+// is checked against the one of the deleted user when given.
+func (h UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		log.Println(err)
 
 		return
 	}
 
-	err = h.producer.Publish(user)
+	var request restoreUserRequest
+	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		log.Println(err)
 
+		return
+	}
+
+	if len(reqBody) > 0 {
+		if err := json.Unmarshal(reqBody, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println(err)
+
+			return
+		}
+	}
+
+	user, err := h.service.RestoreUser(r.Context(), services.RestoreUserParams{
+		ID:      id,
+		Version: request.Version,
+	})
+	if err != nil {
+		writeUserError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromDomain(user))
+}
+
+// PurgeUser erases the user for good, it answers `DELETE /users/{id}` with
+// `purge=true`. The optional `version` parameter is checked against the one
+// of the user.
+func (h UserHandler) PurgeUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+
+		return
+	}
+
+	params := services.PurgeUserParams{ID: id}
+
+	if version := r.FormValue("version"); version != "" {
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println(err)
+
+			return
+		}
+		params.Version = uint32(v)
+	}
+
+	if _, err := h.service.PurgeUser(r.Context(), params); err != nil {
+		writeUserError(w, err)
+
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+func writeUserError(w http.ResponseWriter, err error) {
+	switch err {
+	case services.ErrUserNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case services.ErrWrongVersion, services.ErrUserActive, services.ErrUserTaken, services.ErrUserErased:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	log.Println(err)
+}
+
 func fromDomain(user models.User) UserResponse {
 	return UserResponse{
 		Country:   user.Country,
@@ -347,22 +422,104 @@ func fromDomain(user models.User) UserResponse {
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
 		Nickname:  user.Nickname,
+		Roles:     user.Roles,
 		UpdatedAt: user.Meta.GetUpdatedAt(),
 		Version:   user.Meta.GetVersion(),
 		ID:        user.ID,
 	}
 }
 
-func fromDomainSlice(users []models.User) UsersResponse {
+func fromDomainPage(page query.Page) UsersResponse {
 	var userResponse []UserResponse = make([]UserResponse, 0)
 
-	for _, elem := range users {
+	for _, elem := range page.Users {
 		u := fromDomain(elem)
 
 		userResponse = append(userResponse, u)
 	}
 
 	return UsersResponse{
-		Users: userResponse,
+		Users:      userResponse,
+		NextCursor: page.NextCursor,
+		Limit:      page.Limit,
+		Total:      page.Total,
+	}
+}
+
+// termFields are the fields that can be matched exactly with a plain
+// `field=value` parameter, next to the `filter` parameter.
+var termFields = []string{"country", "first_name", "last_name", "email", "nickname"}
+
+// pageQuery reads the filter, pagination and sorting parameters of a listing.
+func pageQuery(r *http.Request) (query.Query, error) {
+	var err error
+
+	q := query.Query{
+		Limit: query.DefaultLimit,
+	}
+
+	var filters query.And = make(query.And, 0)
+
+	for _, field := range termFields {
+		if value := r.FormValue(field); value != "" {
+			filters = append(filters, query.Equal(field, value))
+		}
+	}
+
+	filter, err := query.ParseFilter(r.FormValue("filter"))
+	if err != nil {
+		return query.Query{}, err
 	}
+	if filter != nil {
+		filters = append(filters, filter)
+	}
+
+	switch len(filters) {
+	case 0:
+	case 1:
+		q.Filter = filters[0]
+	default:
+		q.Filter = filters
+	}
+
+	q.Sort, err = query.ParseSort(r.FormValue("sort"))
+	if err != nil {
+		return query.Query{}, err
+	}
+
+	if limit := r.FormValue("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit <= 0 {
+			return query.Query{}, query.ErrInvalidLimit
+		}
+	}
+
+	if offset := r.FormValue("offset"); offset != "" {
+		q.Offset, err = strconv.Atoi(offset)
+		if err != nil {
+			return query.Query{}, query.ErrInvalidOffset
+		}
+	}
+
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		after, err := query.DecodeCursor(cursor)
+		if err != nil {
+			return query.Query{}, err
+		}
+		q.After = &after
+
+		// the cursor carries its own order, so the sort may be left out
+		if r.FormValue("sort") == "" {
+			q.Sort = after.Sort
+		}
+	}
+
+	if total := r.FormValue("total"); total != "" {
+		q.WithTotal, err = strconv.ParseBool(total)
+		if err != nil {
+			return query.Query{}, err
+		}
+	}
+
+	return q, nil
 }
@@ -0,0 +1,74 @@
+//+build !nokafka
+
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/repositories/cloudevents"
+	kafkaPub "code/tech-test/repositories/kafka"
+	"log"
+	"strings"
+
+	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// newKafkaPublisher connects to the Kafka cluster, the returned function
+// flushes the pending messages and closes the producer. The producer is
+// idempotent, so the messages of a change produced at once keep their order
+// when they are retried.
+func newKafkaPublisher(cfg config.Kafka, encoder cloudevents.Encoder) (outbox.Publisher, func(), error) {
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers":  strings.Join(cfg.Brokers, ","),
+		"enable.idempotence": true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	producerConfig := kafkaPub.DefaultProducerConfig()
+	producerConfig.Topic = cfg.Topic
+	producerConfig.Mode = cfg.Mode
+
+	publisher := kafkaPub.NewUserProducer(producer, encoder, producerConfig)
+
+	return publisher, func() {
+		if remaining := publisher.Close(); remaining > 0 {
+			log.Printf("%d messages were not delivered before closing the producer", remaining)
+		}
+
+		stats := publisher.Stats()
+		log.Printf("delivered %d messages, %d failed", stats.Delivered, stats.Failed)
+	}, nil
+}
+
+// newCommandSource joins the consumer group of the command topic, the
+// returned function leaves it and closes the dead-letter producer.
+func newCommandSource(cfg config.Config) (commandSource, func(), error) {
+	consumerConfig := kafkaPub.DefaultConsumerConfig()
+	consumerConfig.Topic = cfg.Consume.Topic
+	consumerConfig.DeadLetterTopic = cfg.Consume.DeadLetterTopic
+	consumerConfig.Group = cfg.Consume.Group
+
+	servers := strings.Join(cfg.Kafka.Brokers, ",")
+
+	consumer, err := kafka.NewConsumer(kafkaPub.ConsumerConfigMap(servers, consumerConfig))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": servers})
+	if err != nil {
+		consumer.Close()
+		return nil, nil, err
+	}
+
+	source, err := kafkaPub.NewCommandSource(consumer, producer, consumerConfig)
+	if err != nil {
+		consumer.Close()
+		producer.Close()
+		return nil, nil, err
+	}
+
+	return source, source.Close, nil
+}
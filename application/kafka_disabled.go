@@ -0,0 +1,21 @@
+//+build nokafka
+
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/repositories/cloudevents"
+	"errors"
+)
+
+// Built with the nokafka tag the API needs neither cgo nor librdkafka, the
+// events being published by the other publishers.
+
+func newKafkaPublisher(cfg config.Kafka, encoder cloudevents.Encoder) (outbox.Publisher, func(), error) {
+	return nil, nil, errors.New("built without kafka support, use another publisher")
+}
+
+func newCommandSource(cfg config.Config) (commandSource, func(), error) {
+	return nil, nil, errors.New("built without kafka support, the commands cannot be consumed")
+}
@@ -0,0 +1,227 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var ErrDrainTimeout = errors.New("components still running after the drain timeout")
+
+type Config struct {
+	// DrainTimeout bounds the whole shutdown, the components still running
+	// then being abandoned.
+	DrainTimeout time.Duration
+	// ReadinessDelay is waited between failing the readiness and stopping the
+	// components, for load balancers to stop sending requests.
+	ReadinessDelay time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DrainTimeout: 30 * time.Second,
+	}
+}
+
+// Component is a part of the process. Run, when set, runs it until its
+// context is cancelled or it fails, and Stop, when set, asks it to stop,
+// waiting for its in-flight work within the context. A component without Run
+// is a resource only closed by Stop, such as a database pool.
+type Component struct {
+	Name string
+	Run  func(ctx context.Context) error
+	Stop func(ctx context.Context) error
+}
+
+// Manager starts the components in the order they are added, dependencies
+// first, and stops them in the reverse order.
+type Manager struct {
+	config     Config
+	components []Component
+	ready      int32
+}
+
+func NewManager(config Config) *Manager {
+	return &Manager{
+		config: config,
+	}
+}
+
+func (m *Manager) Add(components ...Component) {
+	m.components = append(m.components, components...)
+}
+
+// Ready tells whether every component runs and the process is not shutting
+// down.
+func (m *Manager) Ready() bool {
+	return atomic.LoadInt32(&m.ready) == 1
+}
+
+type running struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type failure struct {
+	name string
+	err  error
+}
+
+// Run starts the components and waits for the context to be done, or for a
+// component to return, to shut them all down. The error is the one of the
+// component which returned first, otherwise the first one of the shutdown.
+func (m *Manager) Run(ctx context.Context) error {
+	var (
+		started  = make([]running, 0, len(m.components))
+		failures = make(chan failure, len(m.components))
+	)
+
+	for _, component := range m.components {
+		started = append(started, m.start(component, failures))
+	}
+
+	atomic.StoreInt32(&m.ready, 1)
+	log.Printf("started %d components", len(m.components))
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		log.Println("shutting down")
+	case f := <-failures:
+		err = fmt.Errorf("%s stopped unexpectedly", f.name)
+		if f.err != nil {
+			err = fmt.Errorf("%w %s failed", f.err, f.name)
+		}
+		log.Printf("shutting down, %s", err)
+	}
+
+	atomic.StoreInt32(&m.ready, 0)
+
+	if m.config.ReadinessDelay > 0 {
+		time.Sleep(m.config.ReadinessDelay)
+	}
+
+	drain, cancel := context.WithTimeout(context.Background(), m.config.DrainTimeout)
+	defer cancel()
+
+	for i := len(m.components) - 1; i >= 0; i-- {
+		if stopErr := m.stop(drain, m.components[i], started[i]); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	return err
+}
+
+// Close stops the components added so far, in the reverse order, without
+// running them. It releases the resources of a start failing before Run.
+func (m *Manager) Close() error {
+	drain, cancel := context.WithTimeout(context.Background(), m.config.DrainTimeout)
+	defer cancel()
+
+	idle := make(chan struct{})
+	close(idle)
+
+	var err error
+
+	for i := len(m.components) - 1; i >= 0; i-- {
+		if stopErr := m.stop(drain, m.components[i], running{cancel: func() {}, done: idle}); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	return err
+}
+
+func (m *Manager) start(component Component, failures chan<- failure) running {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := running{cancel: cancel, done: make(chan struct{})}
+
+	if component.Run == nil {
+		close(r.done)
+
+		return r
+	}
+
+	go func() {
+		defer close(r.done)
+
+		err := component.Run(ctx)
+		if ctx.Err() == nil {
+			failures <- failure{name: component.Name, err: err}
+		}
+	}()
+
+	return r
+}
+
+// stop asks the component to stop, then cancels its context and waits for
+// its Run to return. Components not stopped within the drain context are
+// abandoned, as are the following ones once it is done.
+func (m *Manager) stop(ctx context.Context, component Component, r running) error {
+	stopped := make(chan error, 1)
+
+	go func() {
+		var err error
+		if component.Stop != nil {
+			if err = component.Stop(ctx); err != nil {
+				err = fmt.Errorf("%w failed to stop %s", err, component.Name)
+			}
+		}
+
+		r.cancel()
+		<-r.done
+		stopped <- err
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			log.Println(err)
+
+			return err
+		}
+
+		log.Printf("stopped %s", component.Name)
+
+		return nil
+	case <-ctx.Done():
+		log.Printf("abandoned %s after the drain timeout", component.Name)
+
+		return ErrDrainTimeout
+	}
+}
+
+// WithSignals returns a context cancelled on SIGINT or SIGTERM.
+func WithSignals(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			cancel()
+		})
+	}
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		}
+		stop()
+	}()
+
+	return ctx, stop
+}
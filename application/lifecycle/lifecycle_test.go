@@ -0,0 +1,149 @@
+//+build unit
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+var ERROR = errors.New("expected error")
+
+// recorder keeps the order the components were started and stopped in.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.events...)
+}
+
+// worker runs until stopped, recording whether the manager was ready when it
+// was asked to stop.
+func worker(name string, r *recorder, m *Manager) Component {
+	return Component{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			r.record("run " + name)
+			<-ctx.Done()
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if m.Ready() {
+				r.record("stop " + name + " while ready")
+			} else {
+				r.record("stop " + name)
+			}
+
+			return nil
+		},
+	}
+}
+
+func resource(name string, r *recorder) Component {
+	return Component{
+		Name: name,
+		Stop: func(ctx context.Context) error {
+			r.record("close " + name)
+
+			return nil
+		},
+	}
+}
+
+func testConfig() Config {
+	return Config{DrainTimeout: time.Second}
+}
+
+func Test_Manager_Run(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &recorder{}
+	m := NewManager(testConfig())
+	m.Add(resource("pool", r), worker("relay", r, m), worker("server", r, m))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	g.Expect(m.Ready()).To(BeFalse(), "should not be ready before running")
+
+	go func() { done <- m.Run(ctx) }()
+
+	g.Eventually(m.Ready).Should(BeTrue(), "should be ready once the components run")
+	g.Eventually(r.Events).Should(ConsistOf("run relay", "run server"), "should run the components")
+
+	cancel()
+
+	g.Eventually(done).Should(Receive(BeNil()), "should stop without an error")
+	g.Expect(m.Ready()).To(BeFalse(), "should not be ready once stopped")
+	g.Expect(r.Events()[2:]).To(Equal([]string{"stop server", "stop relay", "close pool"}), "should fail the readiness first and stop in the reverse order")
+}
+
+func Test_Manager_Run_Failure(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &recorder{}
+	m := NewManager(testConfig())
+	m.Add(resource("pool", r), Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			return ERROR
+		},
+	})
+
+	err := m.Run(context.Background())
+	g.Expect(errors.Is(err, ERROR)).To(BeTrue(), "should return the error of the failed component")
+	g.Expect(r.Events()).To(Equal([]string{"close pool"}), "should stop the other components")
+}
+
+func Test_Manager_Run_DrainTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &recorder{}
+	m := NewManager(Config{DrainTimeout: 50 * time.Millisecond})
+	m.Add(resource("pool", r), Component{
+		Name: "server",
+		Stop: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	started := time.Now()
+	err := m.Run(ctx)
+
+	g.Expect(err).To(Equal(ErrDrainTimeout), "should give up on the components still stopping")
+	g.Expect(time.Since(started)).To(BeNumerically("<", time.Second), "should not wait past the drain timeout")
+}
+
+func Test_Manager_Close(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &recorder{}
+	m := NewManager(testConfig())
+	m.Add(resource("exporter", r), resource("pool", r), worker("relay", r, m))
+
+	g.Expect(m.Close()).To(Succeed(), "should stop the components")
+	g.Expect(r.Events()).To(Equal([]string{"stop relay", "close pool", "close exporter"}), "should stop the components in the reverse order without running them")
+}
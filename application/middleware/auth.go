@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/auth/models"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var errUnsupportedScheme = errors.New("unsupported authorization scheme")
+
+type Authenticator interface {
+	VerifyAccessToken(accessToken string) (models.Principal, error)
+	VerifyAPIKey(key string) (models.Principal, error)
+}
+
+// Authenticate puts the principal of the bearer token or API key of the
+// request into its context, along with the actor the changes are recorded
+// under. Requests without credentials go through as
+// anonymous, the route policies decide whether that is enough, while
+// requests with invalid credentials are rejected.
+func Authenticate(auth Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok, err := authenticate(auth, r)
+			if err != nil {
+				unauthorized(w)
+				log.Println(err)
+
+				return
+			}
+
+			if ok {
+				ctx := models.WithPrincipal(r.Context(), principal)
+				r = r.WithContext(domain.WithActor(ctx, principal.Actor()))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func authenticate(auth Authenticator, r *http.Request) (models.Principal, bool, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		principal, err := auth.VerifyAPIKey(key)
+		return principal, err == nil, err
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return models.Principal{}, false, nil
+	}
+
+	scheme, credentials := authorization, ""
+	if i := strings.IndexByte(authorization, ' '); i >= 0 {
+		scheme, credentials = authorization[:i], strings.TrimSpace(authorization[i+1:])
+	}
+
+	var (
+		principal models.Principal
+		err       error
+	)
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		principal, err = auth.VerifyAccessToken(credentials)
+	case "apikey":
+		principal, err = auth.VerifyAPIKey(credentials)
+	default:
+		return models.Principal{}, false, errUnsupportedScheme
+	}
+
+	return principal, err == nil, err
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="users"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,180 @@
+//+build unit
+
+package middleware
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/auth/models"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/gomega"
+)
+
+// fakeAuthenticator knows a token for user 1, a token for an admin and an
+// API key allowed to read users.
+type fakeAuthenticator struct{}
+
+func (a fakeAuthenticator) VerifyAccessToken(accessToken string) (models.Principal, error) {
+	switch accessToken {
+	case "user-1":
+		return models.Principal{UserID: 1, Name: "1"}, nil
+	case "admin":
+		return models.Principal{UserID: 2, Name: "2", Scopes: []string{models.ScopeAdmin}}, nil
+	}
+
+	return models.Principal{}, errors.New("invalid token")
+}
+
+func (a fakeAuthenticator) VerifyAPIKey(key string) (models.Principal, error) {
+	if key == "reader" {
+		return models.Principal{Name: "reader", Scopes: []string{"users:read"}}, nil
+	}
+
+	return models.Principal{}, errors.New("invalid key")
+}
+
+func setupRouter() *mux.Router {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := mux.NewRouter()
+	router.Use(Authenticate(fakeAuthenticator{}))
+
+	router.HandleFunc("/users", ok).Methods("POST")
+	router.HandleFunc("/users", Require(Scope("users:read"), ok)).Methods("GET")
+	router.HandleFunc("/users/{id}", Require(AnyOf(Self("id"), Admin), ok)).Methods("DELETE")
+
+	return router
+}
+
+func Test_Authorization(t *testing.T) {
+
+	type testInput struct {
+		method string
+		path   string
+		header string
+		value  string
+	}
+
+	testCases := []struct {
+		description string
+		input       testInput
+		expected    int
+	}{
+		{
+			description: "when an anonymous request reaches an anonymous route",
+			input:       testInput{method: "POST", path: "/users"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when an anonymous request reaches a protected route",
+			input:       testInput{method: "GET", path: "/users"},
+			expected:    http.StatusUnauthorized,
+		},
+		{
+			description: "when the bearer token is invalid",
+			input:       testInput{method: "POST", path: "/users", header: "Authorization", value: "Bearer forged"},
+			expected:    http.StatusUnauthorized,
+		},
+		{
+			description: "when the authorization scheme is unknown",
+			input:       testInput{method: "GET", path: "/users", header: "Authorization", value: "Basic dXNlcjpwdw=="},
+			expected:    http.StatusUnauthorized,
+		},
+		{
+			description: "when the principal lacks the scope",
+			input:       testInput{method: "GET", path: "/users", header: "Authorization", value: "Bearer user-1"},
+			expected:    http.StatusForbidden,
+		},
+		{
+			description: "when the API key grants the scope",
+			input:       testInput{method: "GET", path: "/users", header: "X-API-Key", value: "reader"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when the API key is passed in the authorization header",
+			input:       testInput{method: "GET", path: "/users", header: "Authorization", value: "ApiKey reader"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when the admin has every scope",
+			input:       testInput{method: "GET", path: "/users", header: "Authorization", value: "Bearer admin"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when a user deletes themselves",
+			input:       testInput{method: "DELETE", path: "/users/1", header: "Authorization", value: "Bearer user-1"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when a user deletes someone else",
+			input:       testInput{method: "DELETE", path: "/users/3", header: "Authorization", value: "Bearer user-1"},
+			expected:    http.StatusForbidden,
+		},
+		{
+			description: "when an admin deletes someone else",
+			input:       testInput{method: "DELETE", path: "/users/3", header: "Authorization", value: "Bearer admin"},
+			expected:    http.StatusOK,
+		},
+		{
+			description: "when a service without a user deletes a user",
+			input:       testInput{method: "DELETE", path: "/users/1", header: "X-API-Key", value: "reader"},
+			expected:    http.StatusForbidden,
+		},
+	}
+
+	router := setupRouter()
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			req := httptest.NewRequest(tc.input.method, tc.input.path, nil)
+			if tc.input.header != "" {
+				req.Header.Set(tc.input.header, tc.input.value)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			g.Expect(rec.Code).To(Equal(tc.expected), "should return the expected status")
+		})
+	}
+}
+
+func Test_Authenticate_Actor(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		header      string
+		value       string
+		expected    string
+	}{
+		{description: "when the request is anonymous", expected: domain.ActorAnonymous},
+		{description: "when a user makes the request", header: "Authorization", value: "Bearer user-1", expected: "user:1"},
+		{description: "when a service makes the request", header: "X-API-Key", value: "reader", expected: "service:reader"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var actor string
+			handler := Authenticate(fakeAuthenticator{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = domain.ActorFrom(r.Context())
+			}))
+
+			req := httptest.NewRequest("POST", "/users", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			g.Expect(actor).To(Equal(tc.expected), "should record the principal as the actor")
+		})
+	}
+}
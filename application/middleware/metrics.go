@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"code/tech-test/domain/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// unknownRoute labels the requests of routes without a path template.
+const unknownRoute = "unknown"
+
+// Metrics counts the requests and measures their latency by method and route.
+// The route is the path template, e.g. `/users/{id}`, rather than the path,
+// so the number of series does not grow with the users.
+func Metrics(registry *metrics.Registry) mux.MiddlewareFunc {
+	requests := registry.Counter("http_requests_total", "Total number of HTTP requests.", "method", "route", "code")
+	durations := registry.Histogram("http_request_duration_seconds", "Latency of the HTTP requests.", metrics.DefaultBuckets, "method", "route")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r)
+
+			route := routeOf(r)
+			requests.Inc(r.Method, route, strconv.Itoa(recorder.status))
+			durations.Observe(time.Since(started).Seconds(), r.Method, route)
+		})
+	}
+}
+
+func routeOf(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unknownRoute
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return unknownRoute
+	}
+
+	return template
+}
+
+// statusRecorder keeps the status of the response, which is 200 when the
+// handler writes without setting one.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+
+	return s.ResponseWriter.Write(b)
+}
@@ -0,0 +1,45 @@
+//+build unit
+
+package middleware
+
+import (
+	"bytes"
+	"code/tech-test/domain/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/gomega"
+)
+
+func Test_Metrics(t *testing.T) {
+	g := NewWithT(t)
+
+	registry := metrics.NewRegistry()
+
+	router := mux.NewRouter()
+	router.Use(Metrics(registry))
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "0" {
+			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("{}"))
+	}).Methods("GET")
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var out bytes.Buffer
+	g.Expect(registry.WriteText(&out)).To(Succeed())
+
+	g.Expect(out.String()).To(ContainSubstring(`http_requests_total{method="GET",route="/users/{id}",code="200"} 2`), "should count the requests by route template")
+	g.Expect(out.String()).To(ContainSubstring(`http_requests_total{method="GET",route="/users/{id}",code="404"} 1`), "should count the requests by status")
+	g.Expect(out.String()).To(ContainSubstring(`http_request_duration_seconds_count{method="GET",route="/users/{id}"} 3`), "should measure the latency by route template")
+	g.Expect(out.String()).ToNot(ContainSubstring(`/users/1`), "should not label by path")
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"code/tech-test/domain/auth/models"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Authorizer interface {
+	Authorize(ctx context.Context, id int, permission string) error
+}
+
+// Policy decides whether the principal may access the route of the request.
+type Policy func(r *http.Request, principal models.Principal) bool
+
+// Require answers anonymous requests with 401 and requests the policy denies
+// with 403 before reaching the handler.
+func Require(policy Policy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := models.PrincipalFrom(r.Context())
+		if !ok {
+			unauthorized(w)
+
+			return
+		}
+
+		if !policy(r, principal) {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Authenticated allows any principal.
+func Authenticated(r *http.Request, principal models.Principal) bool {
+	return true
+}
+
+// Admin allows principals holding the admin scope.
+func Admin(r *http.Request, principal models.Principal) bool {
+	return principal.IsAdmin()
+}
+
+// Scope allows principals granted the scope.
+func Scope(scope string) Policy {
+	return func(r *http.Request, principal models.Principal) bool {
+		return principal.HasScope(scope)
+	}
+}
+
+// Self allows users whose id is the route variable.
+func Self(variable string) Policy {
+	return func(r *http.Request, principal models.Principal) bool {
+		return principal.IsUser() && mux.Vars(r)[variable] == strconv.Itoa(principal.UserID)
+	}
+}
+
+// Permission allows principals granted the permission as a scope, or users
+// whose roles currently grant it, so role changes apply before the access
+// token of the user is refreshed.
+func Permission(authorizer Authorizer, permission string) Policy {
+	return func(r *http.Request, principal models.Principal) bool {
+		if principal.HasScope(permission) {
+			return true
+		}
+
+		return principal.IsUser() && authorizer.Authorize(r.Context(), principal.UserID, permission) == nil
+	}
+}
+
+// AnyOf allows principals allowed by at least one of the policies.
+func AnyOf(policies ...Policy) Policy {
+	return func(r *http.Request, principal models.Principal) bool {
+		for _, policy := range policies {
+			if policy(r, principal) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+//+build unit
+
+package middleware
+
+import (
+	"code/tech-test/domain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_RequestID(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		header      string
+		kept        bool
+	}{
+		{description: "when the request has no id"},
+		{description: "when the request has an id", header: "3f2a9c", kept: true},
+		{description: "when the id has spaces", header: "a b"},
+		{description: "when the id is too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = domain.RequestIDFrom(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/users", nil)
+			if tc.header != "" {
+				r.Header.Set(HeaderRequestID, tc.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			g.Expect(seen).ToNot(BeEmpty(), "should put an id in the context")
+			g.Expect(w.Header().Get(HeaderRequestID)).To(Equal(seen), "should echo the id")
+
+			if tc.kept {
+				g.Expect(seen).To(Equal(tc.header), "should keep the id of the request")
+			} else {
+				g.Expect(seen).ToNot(Equal(tc.header), "should generate a new id")
+			}
+		})
+	}
+}
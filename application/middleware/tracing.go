@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"code/tech-test/domain/tracing"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Trace starts a server span per request, named after its method and route.
+// The span continues the trace of the traceparent header of the request when
+// it has a valid one, and is the parent of the spans of the services and the
+// stores.
+func Trace(tracer *tracing.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if parent, err := tracing.ParseTraceParent(r.Header.Get(tracing.HeaderTraceParent)); err == nil {
+				ctx = tracing.WithRemoteParent(ctx, parent)
+			}
+
+			route := routeOf(r)
+
+			ctx, span := tracer.Start(ctx, r.Method+" "+route, tracing.KindServer,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("http.route", route),
+				tracing.String("url.path", r.URL.Path),
+			)
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(tracing.Int("http.response.status_code", recorder.status))
+			if recorder.status >= http.StatusInternalServerError {
+				span.RecordError(errors.New(http.StatusText(recorder.status)))
+			}
+		})
+	}
+}
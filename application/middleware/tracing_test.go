@@ -0,0 +1,67 @@
+//+build unit
+
+package middleware
+
+import (
+	"code/tech-test/domain/tracing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/gomega"
+)
+
+// recorder keeps the exported spans.
+type recorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *recorder) Export(ctx context.Context, service string, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, spans...)
+
+	return nil
+}
+
+func Test_Trace(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := &recorder{}
+	tracer := tracing.NewTracer(exporter, tracing.DefaultConfig())
+
+	var child tracing.SpanContext
+
+	router := mux.NewRouter()
+	router.Use(Trace(tracer))
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "UserService.GetUser", tracing.KindInternal)
+		child = span.SpanContext()
+		span.End()
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(tracing.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	g.Expect(tracer.Flush(context.Background())).To(Succeed())
+	g.Expect(exporter.spans).To(HaveLen(2), "should export the request span and its child")
+
+	server := exporter.spans[1]
+	g.Expect(server.Name).To(Equal("GET /users/{id}"), "should name the span after the route template")
+	g.Expect(server.Kind).To(Equal(tracing.KindServer))
+	g.Expect(server.SpanContext.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"), "should continue the trace of the header")
+	g.Expect(server.Parent.String()).To(Equal("00f067aa0ba902b7"), "should be a child of the caller span")
+	g.Expect(server.Attributes).To(ContainElement(tracing.Int("http.response.status_code", http.StatusInternalServerError)), "should record the status")
+	g.Expect(server.Status).To(Equal(tracing.StatusError), "should mark the server errors")
+	g.Expect(child.TraceID).To(Equal(server.SpanContext.TraceID), "should pass the span to the handlers")
+	g.Expect(exporter.spans[0].Parent).To(Equal(server.SpanContext.SpanID))
+}
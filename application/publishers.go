@@ -0,0 +1,110 @@
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/domain/health"
+	"code/tech-test/domain/metrics"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/repositories/avro"
+	"code/tech-test/repositories/cloudevents"
+	"code/tech-test/repositories/json"
+	"code/tech-test/repositories/ndjson"
+	"code/tech-test/repositories/protobuf"
+	"code/tech-test/repositories/schemas"
+	"fmt"
+	"log"
+)
+
+// schemaSubject follows the topic name strategy of the schema registry.
+const schemaSubject = "users-value"
+
+// newSerializer builds the serializer named by the configuration. The
+// Avro and Protobuf schemas are registered first, which fails when they are
+// not backward compatible with the registered ones.
+func newSerializer(cfg config.Config) (cloudevents.Serializer, error) {
+	switch cfg.Serializer {
+	case "json":
+		return json.UserSerializer{}, nil
+	case "avro":
+		return avro.NewSerializer(schemas.NewFileRegistry(cfg.SchemaRegistry), schemaSubject)
+	case "protobuf":
+		return protobuf.NewSerializer(schemas.NewFileRegistry(cfg.SchemaRegistry), schemaSubject)
+	}
+
+	return nil, fmt.Errorf("unknown serializer %q", cfg.Serializer)
+}
+
+// newEncoder builds the encoder shared by the publishers, with the serializer
+// and the tombstones settings.
+func newEncoder(cfg config.Config) (cloudevents.Encoder, error) {
+	serializer, err := newSerializer(cfg)
+	if err != nil {
+		return cloudevents.Encoder{}, err
+	}
+
+	return cloudevents.NewEncoder(serializer, "/users").WithTombstones(cfg.Tombstones)
+}
+
+// newPublisher builds the publishers named by the configuration, fanning the
+// events out when there are several, and registers the checks and the metrics
+// of those having some when given the registries. The returned function
+// closes them on shutdown.
+func newPublisher(cfg config.Config, encoder cloudevents.Encoder, checks *health.Registry, registry *metrics.Registry) (outbox.Publisher, func(), error) {
+	var (
+		publishers []outbox.Publisher
+		closers    []func()
+	)
+
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	for _, kind := range cfg.Publishers {
+		switch kind {
+		case "kafka":
+			publisher, closer, err := newKafkaPublisher(cfg.Kafka, encoder)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+
+			if checker, ok := publisher.(health.Checker); ok && checks != nil {
+				checks.Register("kafka", checker)
+			}
+			if collector, ok := publisher.(metrics.Collector); ok && registry != nil {
+				registry.Register(collector)
+			}
+
+			publishers = append(publishers, publisher)
+			closers = append(closers, closer)
+		case "file":
+			publisher, err := ndjson.NewPublisher(cfg.PublisherFile, encoder)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+
+			log.Printf("publishing events to %s", cfg.PublisherFile)
+			publishers = append(publishers, publisher)
+			closers = append(closers, func() {
+				if err := publisher.Close(); err != nil {
+					log.Println(err)
+				}
+			})
+		case "noop":
+			log.Println("discarding published events")
+			publishers = append(publishers, outbox.Discard{})
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("unknown publisher %q", kind)
+		}
+	}
+
+	if len(publishers) == 1 {
+		return publishers[0], closeAll, nil
+	}
+
+	return outbox.NewFanOut(publishers...), closeAll, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/domain/users/replay"
+	"code/tech-test/repositories/checkpoints"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReplayOptions selects the users to replay and how.
+type ReplayOptions struct {
+	Config     replay.Config
+	Checkpoint string
+	// Restart ignores the checkpoint of an interrupted replay.
+	Restart bool
+}
+
+// Replay writes a snapshot of every user to the outbox, published by the relay
+// of the API, until done or SIGINT or SIGTERM.
+func Replay(cfg config.Config, options ReplayOptions) (replay.Report, error) {
+	stores, closeStores, err := openStores(cfg, nil)
+	if err != nil {
+		return replay.Report{}, err
+	}
+	defer closeStores()
+
+	checkpointStore := checkpoints.NewFileStore(options.Checkpoint)
+	if options.Restart && !options.Config.DryRun {
+		if err := checkpointStore.Clear(); err != nil {
+			return replay.Report{}, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("stopping replay, it resumes from the checkpoint")
+		cancel()
+	}()
+
+	return replay.NewReplayer(stores.replay, checkpointStore, options.Config).Run(ctx)
+}
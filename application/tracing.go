@@ -0,0 +1,72 @@
+package api
+
+import (
+	"code/tech-test/application/config"
+	"code/tech-test/application/lifecycle"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/repositories/otlp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// newTracer builds the tracer of the configured exporter, nil when tracing is
+// off. Its component exports the spans in the background and flushes the
+// last ones on shutdown, so it is added first to stop last.
+func newTracer(cfg config.Config) (*tracing.Tracer, lifecycle.Component, error) {
+	var (
+		exporter      tracing.Exporter
+		closeExporter = func() error { return nil }
+	)
+
+	switch cfg.Tracing.Exporter {
+	case "none":
+		return nil, lifecycle.Component{}, nil
+	case "otlp":
+		log.Printf("exporting traces to %s", cfg.Tracing.Endpoint)
+		exporter = otlp.NewHTTPExporter(cfg.Tracing.Endpoint, &http.Client{})
+	case "stdout", "file":
+		path := "-"
+		if cfg.Tracing.Exporter == "file" {
+			path = cfg.Tracing.File
+			log.Printf("writing traces to %s", path)
+		}
+
+		file, err := otlp.NewFileExporter(path)
+		if err != nil {
+			return nil, lifecycle.Component{}, err
+		}
+
+		exporter, closeExporter = file, file.Close
+	default:
+		return nil, lifecycle.Component{}, fmt.Errorf("unknown tracing exporter %q", cfg.Tracing.Exporter)
+	}
+
+	tracingConfig := tracing.DefaultConfig()
+	tracingConfig.Service = cfg.Tracing.Service
+	tracingConfig.Interval = cfg.Tracing.Interval
+
+	tracer := tracing.NewTracer(exporter, tracingConfig)
+
+	return tracer, lifecycle.Component{
+		Name: "tracer",
+		Run: func(ctx context.Context) error {
+			tracer.Run(ctx)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			err := tracer.Flush(ctx)
+			if closeErr := closeExporter(); err == nil {
+				err = closeErr
+			}
+
+			if dropped := tracer.Dropped(); dropped > 0 {
+				log.Printf("%d spans were dropped", dropped)
+			}
+
+			return err
+		},
+	}, nil
+}
@@ -4,19 +4,32 @@ package api
 
 import (
 	"bytes"
+	"code/tech-test/application/config"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
 )
 
+// adminKey is the API key the tests authenticate with.
+const adminKey = "integration-tests"
+
 func init() {
-	go SetupAPI()
+	os.Setenv("api_keys", "tests:"+adminKey+":admin")
+
+	cfg, err := config.Load(config.Sources{Env: os.LookupEnv})
+	if err != nil {
+		panic(err)
+	}
+
+	go SetupAPI(cfg)
 
 	<-time.After(time.Second * 1)
 }
@@ -41,6 +54,17 @@ func setupDatabase() {
 	}
 }
 
+func get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-API-Key", adminKey)
+
+	return http.DefaultClient.Do(req)
+}
+
 func Test_UserAPI_Get(t *testing.T) {
 
 	setupDatabase()
@@ -77,7 +101,7 @@ func Test_UserAPI_Get(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			g := NewWithT(t)
 
-			resp, err := http.Get(fmt.Sprintf("http://localhost:8080/users/%d", tc.input))
+			resp, err := get(fmt.Sprintf("http://localhost:8080/users/%d", tc.input))
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -111,7 +135,7 @@ func Test_UserAPI_List(t *testing.T) {
 			description: "when the users are fetched",
 			expected: testExpectation{
 				status: "200 OK",
-				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1},{"id":2,"first_name":"Test","last_name":"Test","nickname":"testuser-2","email":"example-2@example.qqq","country":"ab","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}]}`),
+				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1},{"id":2,"first_name":"Test","last_name":"Test","nickname":"testuser-2","email":"example-2@example.qqq","country":"ab","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}],"limit":50}`),
 			},
 		},
 	}
@@ -120,7 +144,7 @@ func Test_UserAPI_List(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			g := NewWithT(t)
 
-			resp, err := http.Get("http://localhost:8080/users")
+			resp, err := get("http://localhost:8080/users")
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -156,7 +180,7 @@ func Test_UserAPI_List_Params(t *testing.T) {
 			input:       "?country=uk",
 			expected: testExpectation{
 				status: "200 OK",
-				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}]}`),
+				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}],"limit":50}`),
 			},
 		},
 		{
@@ -164,7 +188,7 @@ func Test_UserAPI_List_Params(t *testing.T) {
 			input:       "?country=uk&first_name=Test",
 			expected: testExpectation{
 				status: "200 OK",
-				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}]}`),
+				result: []byte(`{"users":[{"id":1,"first_name":"Test","last_name":"Test","nickname":"testuser","email":"example@example.qqq","country":"uk","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","active":true,"version":1}],"limit":50}`),
 			},
 		},
 		{
@@ -172,7 +196,7 @@ func Test_UserAPI_List_Params(t *testing.T) {
 			input:       "?country=qwertyuuiop",
 			expected: testExpectation{
 				status: "200 OK",
-				result: []byte(`{"users":[]}`),
+				result: []byte(`{"users":[],"limit":50}`),
 			},
 		},
 	}
@@ -181,7 +205,7 @@ func Test_UserAPI_List_Params(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			g := NewWithT(t)
 
-			resp, err := http.Get(fmt.Sprintf("http://localhost:8080/users%s", tc.input))
+			resp, err := get(fmt.Sprintf("http://localhost:8080/users%s", tc.input))
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -320,6 +344,7 @@ func Test_UserAPI_Update(t *testing.T) {
 			}
 
 			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", adminKey)
 
 			response, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -352,6 +377,13 @@ func Test_UserAPI_Delete(t *testing.T) {
 				status: "200 OK",
 			},
 		},
+		{
+			description: "when the user is already deleted",
+			input:       1,
+			expected: testExpectation{
+				status: "404 Not Found",
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -363,6 +395,8 @@ func Test_UserAPI_Delete(t *testing.T) {
 				log.Fatalln(err)
 			}
 
+			req.Header.Set("X-API-Key", adminKey)
+
 			response, err := http.DefaultClient.Do(req)
 			if err != nil {
 				log.Fatalln(err)
@@ -372,3 +406,95 @@ func Test_UserAPI_Delete(t *testing.T) {
 		})
 	}
 }
+
+func Test_UserAPI_Auth(t *testing.T) {
+
+	setupDatabase()
+
+	g := NewWithT(t)
+
+	resp, err := http.Get("http://localhost:8080/users")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g.Expect(resp.Status).To(Equal("401 Unauthorized"), "should reject anonymous listings")
+
+	resp, err = http.Get("http://localhost:8080/_/outbox")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g.Expect(resp.Status).To(Equal("401 Unauthorized"), "should reject anonymous reads of the outbox lag")
+
+	resp, err = http.Post("http://localhost:8080/auth/login", "application/json", bytes.NewBufferString(`{"login":"testuser","password":"qwerty"}`))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g.Expect(resp.Status).To(Equal("200 OK"), "should log the user in")
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g.Expect(json.Unmarshal(body, &tokens)).To(Succeed(), "should return the tokens")
+
+	testCases := []struct {
+		description string
+		method      string
+		path        string
+		expected    string
+	}{
+		{
+			description: "when the user reads themselves",
+			method:      http.MethodGet,
+			path:        "/users/1",
+			expected:    "200 OK",
+		},
+		{
+			description: "when the user lists every user",
+			method:      http.MethodGet,
+			path:        "/users",
+			expected:    "403 Forbidden",
+		},
+		{
+			description: "when the user reads the history of someone else",
+			method:      http.MethodGet,
+			path:        "/users/2/history",
+			expected:    "403 Forbidden",
+		},
+		{
+			description: "when the user reads the outbox lag",
+			method:      http.MethodGet,
+			path:        "/_/outbox",
+			expected:    "403 Forbidden",
+		},
+		{
+			description: "when the user deletes someone else",
+			method:      http.MethodDelete,
+			path:        "/users/2",
+			expected:    "403 Forbidden",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			req, err := http.NewRequest(tc.method, "http://localhost:8080"+tc.path, nil)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+			response, err := http.DefaultClient.Do(req)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			g.Expect(response.Status).To(Equal(tc.expected))
+		})
+	}
+}
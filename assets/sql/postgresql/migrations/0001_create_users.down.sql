@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS unique_active_email;
+DROP INDEX IF EXISTS unique_active_nickname;
+DROP TABLE IF EXISTS users;
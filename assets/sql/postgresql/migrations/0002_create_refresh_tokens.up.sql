@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id              TEXT NOT NULL,
+    family_id       TEXT NOT NULL,
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at      TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    rotated_at      TIMESTAMP,
+    revoked_at      TIMESTAMP,
+
+    PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens (family_id);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name            TEXT NOT NULL,
+    description     TEXT NOT NULL DEFAULT '',
+    permissions     TEXT[] NOT NULL DEFAULT '{}',
+    version         INT DEFAULT 1,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW(),
+
+    PRIMARY KEY(name)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role            TEXT NOT NULL REFERENCES roles(name),
+    created_at      TIMESTAMP DEFAULT NOW(),
+
+    PRIMARY KEY(user_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role ON user_roles (role);
+
+INSERT INTO roles(name, description, permissions)
+VALUES ('admin', 'Full access to every resource', '{admin}')
+ON CONFLICT DO NOTHING;
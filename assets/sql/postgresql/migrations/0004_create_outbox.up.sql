@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL,
+    aggregate_id    INT NOT NULL,
+    payload         JSONB NOT NULL,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    last_error      TEXT,
+    sent_at         TIMESTAMP,
+
+    PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unsent ON outbox (aggregate_id, id) WHERE (sent_at IS NULL);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS user_history (
+    user_id         INT NOT NULL,
+    version         INT NOT NULL,
+    first_name      TEXT NOT NULL,
+    last_name       TEXT NOT NULL,
+    nickname        TEXT NOT NULL,
+    email           TEXT NOT NULL,
+    country         TEXT NOT NULL,
+    roles           TEXT[] NOT NULL DEFAULT '{}',
+    disabled        BOOL NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    changes         TEXT[] NOT NULL DEFAULT '{}',
+    actor           TEXT NOT NULL,
+    request_id      TEXT NOT NULL DEFAULT '',
+    changed_at      TIMESTAMP NOT NULL,
+
+    PRIMARY KEY(user_id, version)
+);
+
+-- the users stored before the history was kept start it at their current version
+INSERT INTO user_history(user_id, version, first_name, last_name, nickname, email, country, roles, disabled, created_at, actor, changed_at)
+SELECT id, version, first_name, last_name, nickname, email, country,
+ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role),
+disabled, created_at, 'migration', updated_at
+FROM users
+ON CONFLICT DO NOTHING;
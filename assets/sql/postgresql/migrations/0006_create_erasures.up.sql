@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS erasures (
+    id              BIGSERIAL,
+    user_id         INT NOT NULL,
+    version         INT NOT NULL,
+    fields          TEXT[] NOT NULL DEFAULT '{}',
+    history_entries INT NOT NULL DEFAULT 0,
+    actor           TEXT NOT NULL,
+    request_id      TEXT NOT NULL DEFAULT '',
+    erased_at       TIMESTAMP NOT NULL,
+
+    PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS erasures_user ON erasures (user_id);
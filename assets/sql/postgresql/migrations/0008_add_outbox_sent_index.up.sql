@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS outbox_sent ON outbox (sent_at) WHERE (sent_at IS NOT NULL);
@@ -2,6 +2,7 @@ package api
 
 import (
 	api "code/tech-test/application"
+	"code/tech-test/application/config"
 
 	"github.com/spf13/cobra"
 )
@@ -19,8 +20,11 @@ func Command() *cobra.Command {
 
 func Run() func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		api.SetupAPI()
+		cfg, err := config.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
 
-		return nil
+		return api.SetupAPI(cfg)
 	}
 }
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"code/tech-test/application/config"
+
+	"github.com/spf13/cobra"
+)
+
+// Command creates cobra command.
+func Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration, secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE:  Print(),
+	})
+
+	return cmd
+}
+
+func Print() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		out, err := cfg.YAML()
+		if err != nil {
+			return err
+		}
+
+		_, err = cmd.OutOrStdout().Write(out)
+
+		return err
+	}
+}
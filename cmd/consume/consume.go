@@ -0,0 +1,37 @@
+package consume
+
+import (
+	api "code/tech-test/application"
+	"code/tech-test/application/config"
+
+	"github.com/spf13/cobra"
+)
+
+// Command creates cobra command.
+func Command() *cobra.Command {
+	var options api.ConsumeOptions
+
+	cmd := &cobra.Command{
+		Use:   "consume",
+		Short: "Apply the user commands of the upstream topic",
+		Args:  cobra.NoArgs,
+		RunE:  Run(&options),
+	}
+
+	cmd.Flags().StringVar(&options.Topic, "topic", "", "topic holding the commands, defaults to the consume.topic setting")
+	cmd.Flags().StringVar(&options.DeadLetterTopic, "dead-letter-topic", "", "topic receiving the commands which cannot be applied, defaults to the consume.dead_letter_topic setting")
+	cmd.Flags().StringVar(&options.Group, "group", "", "consumer group, defaults to the consume.group setting")
+
+	return cmd
+}
+
+func Run(options *api.ConsumeOptions) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		return api.Consume(cfg, *options)
+	}
+}
@@ -3,14 +3,25 @@ package main
 import (
 	"log"
 
+	"code/tech-test/application/config"
 	"code/tech-test/cmd/api"
+	configCmd "code/tech-test/cmd/config"
+	"code/tech-test/cmd/consume"
+	"code/tech-test/cmd/migrate"
+	"code/tech-test/cmd/replay"
 
 	"github.com/spf13/cobra"
 )
 
 func main() {
 	rootCmd := &cobra.Command{Use: "users [SERVICE]"}
+	config.RegisterFlags(rootCmd.PersistentFlags())
+
 	rootCmd.AddCommand(api.Command())
+	rootCmd.AddCommand(migrate.Command())
+	rootCmd.AddCommand(consume.Command())
+	rootCmd.AddCommand(replay.Command())
+	rootCmd.AddCommand(configCmd.Command())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalf("failed to execute %s", err)
@@ -0,0 +1,139 @@
+package migrate
+
+import (
+	api "code/tech-test/application"
+	"code/tech-test/application/config"
+	"code/tech-test/repositories/postgresql/migrations"
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultDir = "assets/sql/postgresql/migrations"
+
+// Command creates cobra command.
+func Command() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema",
+	}
+
+	cmd.PersistentFlags().StringVar(&dir, "dir", defaultDir, "directory holding the migration files")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply every pending migration",
+			Args:  cobra.NoArgs,
+			RunE: Run(&dir, func(ctx context.Context, m *migrations.Migrator, args []string) ([]migrations.Migration, error) {
+				return m.Up(ctx)
+			}),
+		},
+		&cobra.Command{
+			Use:   "down",
+			Short: "Revert the latest applied migration",
+			Args:  cobra.NoArgs,
+			RunE: Run(&dir, func(ctx context.Context, m *migrations.Migrator, args []string) ([]migrations.Migration, error) {
+				return m.Down(ctx)
+			}),
+		},
+		&cobra.Command{
+			Use:   "to <version>",
+			Short: "Migrate up or down to the given version",
+			Args:  cobra.ExactArgs(1),
+			RunE: Run(&dir, func(ctx context.Context, m *migrations.Migrator, args []string) ([]migrations.Migration, error) {
+				version, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w invalid version %q", err, args[0])
+				}
+
+				return m.To(ctx, version)
+			}),
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "List migrations and whether they are applied",
+			Args:  cobra.NoArgs,
+			RunE:  Status(&dir),
+		},
+	)
+
+	return cmd
+}
+
+// Run applies the step of the subcommand to the migrations of the directory,
+// printing the migrations it applied or reverted.
+func Run(dir *string, step func(ctx context.Context, m *migrations.Migrator, args []string) ([]migrations.Migration, error)) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		migrator, closer, err := newMigrator(cmd, *dir)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		done, err := step(cmd.Context(), migrator, args)
+		for _, migration := range done {
+			fmt.Fprintf(cmd.OutOrStdout(), "%d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(done) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no migrations to run")
+		}
+
+		return nil
+	}
+}
+
+// Status prints every migration of the directory along with when it was
+// applied, or pending. It does not wait for a migration in progress.
+func Status(dir *string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		migrator, closer, err := newMigrator(cmd, *dir)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		statuses, err := migrator.Status(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+		return nil
+	}
+}
+
+func newMigrator(cmd *cobra.Command, dir string) (*migrations.Migrator, func(), error) {
+	cfg, err := config.FromFlags(cmd.Flags())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loaded, err := migrations.Load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool, err := api.OpenDatabase(cfg.Postgres)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w failed to open database", err)
+	}
+
+	return migrations.NewMigrator(pool, loaded), func() { pool.Close() }, nil
+}
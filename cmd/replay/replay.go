@@ -0,0 +1,59 @@
+package replay
+
+import (
+	api "code/tech-test/application"
+	"code/tech-test/application/config"
+	"code/tech-test/domain/users/replay"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultCheckpoint = "replay.checkpoint.json"
+
+// Command creates cobra command.
+func Command() *cobra.Command {
+	options := api.ReplayOptions{Config: replay.DefaultConfig()}
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Publish a snapshot of every user",
+		Args:  cobra.NoArgs,
+		RunE:  Run(&options),
+	}
+
+	cmd.Flags().BoolVar(&options.Config.IncludeDisabled, "include-disabled", false, "also publish the deleted users")
+	cmd.Flags().Float64Var(&options.Config.Rate, "rate", options.Config.Rate, "most users published per second, 0 for no limit")
+	cmd.Flags().IntVar(&options.Config.BatchSize, "batch-size", options.Config.BatchSize, "users read per page")
+	cmd.Flags().BoolVar(&options.Config.DryRun, "dry-run", false, "count the users without publishing them")
+	cmd.Flags().StringVar(&options.Checkpoint, "checkpoint", defaultCheckpoint, "file keeping the progress of the replay")
+	cmd.Flags().BoolVar(&options.Restart, "restart", false, "start over instead of resuming from the checkpoint")
+
+	return cmd
+}
+
+func Run(options *api.ReplayOptions) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if options.Config.BatchSize <= 0 {
+			return fmt.Errorf("invalid batch size %d", options.Config.BatchSize)
+		}
+
+		cfg, err := config.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		report, err := api.Replay(cfg, *options)
+
+		if report.Resumed > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "resumed after user %d\n", report.Resumed)
+		}
+		if options.Config.DryRun {
+			fmt.Fprintf(cmd.OutOrStdout(), "%d users to publish, %d of them deleted\n", report.Users, report.Disabled)
+		} else {
+			fmt.Fprintf(cmd.OutOrStdout(), "%d users read, %d of them deleted, %d published\n", report.Users, report.Disabled, report.Published)
+		}
+
+		return err
+	}
+}
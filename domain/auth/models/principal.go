@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strconv"
+)
+
+const ScopeAdmin = "admin"
+
+// Principal is who a request is made on behalf of, a user holding an access
+// token or a service holding an API key.
+type Principal struct {
+	UserID int
+	Name   string
+	Scopes []string
+}
+
+func (p Principal) IsUser() bool {
+	return p.UserID != 0
+}
+
+// Actor names the principal in the history of the changes it makes.
+func (p Principal) Actor() string {
+	if p.IsUser() {
+		return "user:" + strconv.Itoa(p.UserID)
+	}
+
+	return "service:" + p.Name
+}
+
+func (p Principal) IsAdmin() bool {
+	for _, scope := range p.Scopes {
+		if scope == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasScope reports whether the principal was granted the scope, admins are
+// granted every scope.
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal of the request, false for anonymous ones.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+
+	return principal, ok
+}
+
+// APIKey grants scopes to a service. Only the digest of the key is kept.
+type APIKey struct {
+	Name   string
+	Digest [sha256.Size]byte
+	Scopes []string
+}
+
+func NewAPIKey(name, key string, scopes []string) APIKey {
+	return APIKey{
+		Name:   name,
+		Digest: sha256.Sum256([]byte(key)),
+		Scopes: scopes,
+	}
+}
+
+func (k APIKey) Matches(key string) bool {
+	digest := sha256.Sum256([]byte(key))
+
+	return subtle.ConstantTimeCompare(k.Digest[:], digest[:]) == 1
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// RefreshToken is a single refresh token of a family. Every refresh rotates
+// the token into a new one of the same family, so presenting a rotated token
+// again means it leaked.
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	UserID    int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RotatedAt time.Time
+	RevokedAt time.Time
+}
+
+func NewRefreshToken(id, familyID string, userID int, expiresAt time.Time) RefreshToken {
+	return RefreshToken{
+		ID:        id,
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (t RefreshToken) IsRotated() bool {
+	return !t.RotatedAt.IsZero()
+}
+
+func (t RefreshToken) IsRevoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+func (t RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// TokenPair is what a login or a refresh hands out.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
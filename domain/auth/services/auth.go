@@ -0,0 +1,318 @@
+package services
+
+//go:generate mockgen -source=auth.go -destination=mock/auth_mock.go
+
+import (
+	"code/tech-test/domain/auth/models"
+	"code/tech-test/domain/auth/tokens"
+	userModels "code/tech-test/domain/users/models"
+	userServices "code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenReused        = errors.New("refresh token reused")
+)
+
+type UserService interface {
+	GetUser(ctx context.Context, id int) (userModels.User, error)
+	VerifyCredentials(ctx context.Context, login, password string) (userModels.User, error)
+	Permissions(ctx context.Context, user userModels.User) ([]string, error)
+}
+
+type RefreshTokenStore interface {
+	Get(ctx context.Context, id string) (models.RefreshToken, error)
+	Create(ctx context.Context, token models.RefreshToken) error
+	// Rotate marks the token as rotated and stores the next one of the family,
+	// failing when the token was already rotated or revoked.
+	Rotate(ctx context.Context, id string, next models.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string) error
+}
+
+// Config holds the token settings. Scopes are granted to every user logging
+// in on top of the permissions of their roles, none by default as anyone can
+// sign up. API keys grant their own scopes to services.
+type Config struct {
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Scopes     []string
+	APIKeys    []models.APIKey
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Issuer:     "users",
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+}
+
+type AuthService struct {
+	users  UserService
+	store  RefreshTokenStore
+	signer tokens.Signer
+	config Config
+}
+
+func NewAuthService(users UserService, store RefreshTokenStore, signer tokens.Signer, config Config) AuthService {
+	return AuthService{
+		users:  users,
+		store:  store,
+		signer: signer,
+		config: config,
+	}
+}
+
+// Login starts a new refresh token family for the user the credentials belong to.
+func (s AuthService) Login(ctx context.Context, login, password string) (models.TokenPair, error) {
+	user, err := s.users.VerifyCredentials(ctx, login, password)
+	if err != nil {
+		switch err {
+		case userServices.ErrInvalidCredentials:
+			return models.TokenPair{}, ErrInvalidCredentials
+		default:
+			return models.TokenPair{}, fmt.Errorf("%w failed to verify credentials", err)
+		}
+	}
+
+	familyID, err := tokens.NewID()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	pair, refresh, err := s.issue(ctx, user, familyID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if err := s.store.Create(ctx, refresh); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%w failed to store refresh token", err)
+	}
+
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. A refresh token can only
+// be used once, presenting it again revokes its whole family since either
+// the client or an attacker holds a stolen copy.
+func (s AuthService) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	stored, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if stored.IsRevoked() || stored.IsExpired(time.Now()) {
+		return models.TokenPair{}, ErrInvalidToken
+	}
+
+	if stored.IsRotated() {
+		return models.TokenPair{}, s.revokeReused(ctx, stored)
+	}
+
+	user, err := s.users.GetUser(ctx, stored.UserID)
+	if err != nil {
+		switch err {
+		case userServices.ErrUserNotFound:
+			if err := s.store.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				return models.TokenPair{}, fmt.Errorf("%w failed to revoke token family", err)
+			}
+
+			return models.TokenPair{}, ErrInvalidToken
+		default:
+			return models.TokenPair{}, fmt.Errorf("%w failed to get user", err)
+		}
+	}
+
+	pair, next, err := s.issue(ctx, user, stored.FamilyID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	err = s.store.Rotate(ctx, stored.ID, next)
+	if err != nil {
+		switch err {
+		case postgresql.ErrTokenRotated:
+			// lost a race against another refresh with the same token
+			return models.TokenPair{}, s.revokeReused(ctx, stored)
+		default:
+			return models.TokenPair{}, fmt.Errorf("%w failed to rotate refresh token", err)
+		}
+	}
+
+	return pair, nil
+}
+
+// Logout revokes the family of the refresh token, access tokens already
+// handed out stay valid until they expire.
+func (s AuthService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return fmt.Errorf("%w failed to revoke token family", err)
+	}
+
+	return nil
+}
+
+// VerifyAccessToken returns the user an access token was issued to.
+func (s AuthService) VerifyAccessToken(accessToken string) (models.Principal, error) {
+	claims, err := tokens.Decode(s.signer, accessToken, time.Now())
+	if err != nil || claims.Type != tokens.TypeAccess {
+		return models.Principal{}, ErrInvalidToken
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return models.Principal{}, ErrInvalidToken
+	}
+
+	return models.Principal{
+		UserID: userID,
+		Name:   claims.Subject,
+		Scopes: strings.Fields(claims.Scope),
+	}, nil
+}
+
+// VerifyAPIKey returns the service an API key belongs to.
+func (s AuthService) VerifyAPIKey(key string) (models.Principal, error) {
+	for _, apiKey := range s.config.APIKeys {
+		if apiKey.Matches(key) {
+			return models.Principal{
+				Name:   apiKey.Name,
+				Scopes: apiKey.Scopes,
+			}, nil
+		}
+	}
+
+	return models.Principal{}, ErrInvalidToken
+}
+
+// JWKS lists the public keys access tokens can be verified with.
+func (s AuthService) JWKS() tokens.JWKS {
+	return tokens.JWKS{Keys: s.signer.PublicKeys()}
+}
+
+func (s AuthService) lookup(ctx context.Context, refreshToken string) (models.RefreshToken, error) {
+	claims, err := tokens.Decode(s.signer, refreshToken, time.Now())
+	if err != nil || claims.Type != tokens.TypeRefresh {
+		return models.RefreshToken{}, ErrInvalidToken
+	}
+
+	stored, err := s.store.Get(ctx, claims.ID)
+	if err != nil {
+		switch err {
+		case postgresql.ErrTokenNotFound:
+			return models.RefreshToken{}, ErrInvalidToken
+		default:
+			return models.RefreshToken{}, fmt.Errorf("%w failed to get refresh token", err)
+		}
+	}
+
+	if stored.FamilyID != claims.Family || strconv.Itoa(stored.UserID) != claims.Subject {
+		return models.RefreshToken{}, ErrInvalidToken
+	}
+
+	return stored, nil
+}
+
+func (s AuthService) revokeReused(ctx context.Context, stored models.RefreshToken) error {
+	if err := s.store.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return fmt.Errorf("%w failed to revoke token family", err)
+	}
+
+	return ErrTokenReused
+}
+
+// scopes returns the configured scopes along with the permissions of the
+// roles of the user.
+func (s AuthService) scopes(ctx context.Context, user userModels.User) ([]string, error) {
+	permissions, err := s.users.Permissions(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to get permissions", err)
+	}
+
+	var scopes []string = append([]string(nil), s.config.Scopes...)
+	for _, permission := range permissions {
+		if !contains(scopes, permission) {
+			scopes = append(scopes, permission)
+		}
+	}
+
+	return scopes, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s AuthService) issue(ctx context.Context, user userModels.User, familyID string) (models.TokenPair, models.RefreshToken, error) {
+	now := time.Now()
+	userID := user.ID
+
+	scopes, err := s.scopes(ctx, user)
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	accessID, err := tokens.NewID()
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	refreshID, err := tokens.NewID()
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	access, err := tokens.Encode(s.signer, tokens.Claims{
+		Issuer:    s.config.Issuer,
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.config.AccessTTL).Unix(),
+		ID:        accessID,
+		Type:      tokens.TypeAccess,
+		Scope:     strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	refresh := models.NewRefreshToken(refreshID, familyID, userID, now.Add(s.config.RefreshTTL))
+
+	encoded, err := tokens.Encode(s.signer, tokens.Claims{
+		Issuer:    s.config.Issuer,
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: refresh.ExpiresAt.Unix(),
+		ID:        refreshID,
+		Type:      tokens.TypeRefresh,
+		Family:    familyID,
+	})
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: encoded,
+		ExpiresIn:    s.config.AccessTTL,
+	}, refresh, nil
+}
@@ -0,0 +1,261 @@
+//+build unit
+
+package services
+
+import (
+	"code/tech-test/domain/auth/models"
+	"code/tech-test/domain/auth/tokens"
+	userModels "code/tech-test/domain/users/models"
+	userServices "code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	mock_services "code/tech-test/domain/auth/services/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+var testSigner, _ = tokens.NewHMACSigner([]byte(strings.Repeat("s", 32)))
+
+func setupAuthTest(t *testing.T) (context.Context, *mock_services.MockUserService, *mock_services.MockRefreshTokenStore, AuthService) {
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	users := mock_services.NewMockUserService(mockCtrl)
+	store := mock_services.NewMockRefreshTokenStore(mockCtrl)
+	service := NewAuthService(users, store, testSigner, DefaultConfig())
+
+	return ctx, users, store, service
+}
+
+// refreshToken signs a refresh token for the stored token.
+func refreshToken(token models.RefreshToken) string {
+	encoded, err := tokens.Encode(testSigner, tokens.Claims{
+		Subject:   "1",
+		ExpiresAt: token.ExpiresAt.Unix(),
+		ID:        token.ID,
+		Type:      tokens.TypeRefresh,
+		Family:    token.FamilyID,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return encoded
+}
+
+func Test_Login(t *testing.T) {
+
+	user := userModels.NewUser(1, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+
+	testCases := []struct {
+		description string
+		setup       func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore)
+		expected    error
+	}{
+		{
+			description: "when the credentials are valid",
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				users.EXPECT().VerifyCredentials(ctx, "testuser", "qwerty").Return(user, nil)
+				users.EXPECT().Permissions(ctx, user).Return([]string{"roles:manage"}, nil)
+				store.EXPECT().Create(ctx, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			description: "when the credentials are invalid",
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				users.EXPECT().VerifyCredentials(ctx, "testuser", "qwerty").Return(userModels.User{}, userServices.ErrInvalidCredentials)
+			},
+			expected: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, users, store, service := setupAuthTest(t)
+
+			tc.setup(ctx, users, store)
+
+			pair, err := service.Login(ctx, "testuser", "qwerty")
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+
+			access, err := tokens.Decode(testSigner, pair.AccessToken, time.Now())
+			g.Expect(err).ToNot(HaveOccurred(), "should sign the access token")
+			g.Expect(access.Subject).To(Equal("1"), "should issue the access token to the user")
+			g.Expect(access.Type).To(Equal(tokens.TypeAccess), "should issue an access token")
+			g.Expect(access.Scope).To(Equal("roles:manage"), "should only grant the permissions of the roles")
+
+			refresh, err := tokens.Decode(testSigner, pair.RefreshToken, time.Now())
+			g.Expect(err).ToNot(HaveOccurred(), "should sign the refresh token")
+			g.Expect(refresh.Type).To(Equal(tokens.TypeRefresh), "should issue a refresh token")
+			g.Expect(refresh.Family).ToNot(BeEmpty(), "should start a token family")
+		})
+	}
+}
+
+func Test_Refresh(t *testing.T) {
+
+	user := userModels.NewUser(1, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+	stored := models.NewRefreshToken("token", "family", 1, time.Now().Add(time.Hour))
+
+	rotated := stored
+	rotated.RotatedAt = time.Now()
+
+	revoked := stored
+	revoked.RevokedAt = time.Now()
+
+	testCases := []struct {
+		description string
+		input       string
+		setup       func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore)
+		expected    error
+	}{
+		{
+			description: "when the refresh token is current",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(stored, nil)
+				users.EXPECT().GetUser(ctx, 1).Return(user, nil)
+				users.EXPECT().Permissions(ctx, user).Return(nil, nil)
+				store.EXPECT().Rotate(ctx, "token", gomock.Any()).DoAndReturn(
+					func(ctx context.Context, id string, next models.RefreshToken) error {
+						NewWithT(t).Expect(next.FamilyID).To(Equal("family"), "should keep the token family")
+						return nil
+					})
+			},
+		},
+		{
+			description: "when the refresh token was already rotated",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(rotated, nil)
+				store.EXPECT().RevokeFamily(ctx, "family").Return(nil)
+			},
+			expected: ErrTokenReused,
+		},
+		{
+			description: "when the refresh token is rotated concurrently",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(stored, nil)
+				users.EXPECT().GetUser(ctx, 1).Return(user, nil)
+				users.EXPECT().Permissions(ctx, user).Return(nil, nil)
+				store.EXPECT().Rotate(ctx, "token", gomock.Any()).Return(postgresql.ErrTokenRotated)
+				store.EXPECT().RevokeFamily(ctx, "family").Return(nil)
+			},
+			expected: ErrTokenReused,
+		},
+		{
+			description: "when the token family was revoked",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(revoked, nil)
+			},
+			expected: ErrInvalidToken,
+		},
+		{
+			description: "when the user was deleted",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(stored, nil)
+				users.EXPECT().GetUser(ctx, 1).Return(userModels.User{}, userServices.ErrUserNotFound)
+				store.EXPECT().RevokeFamily(ctx, "family").Return(nil)
+			},
+			expected: ErrInvalidToken,
+		},
+		{
+			description: "when the refresh token is unknown",
+			input:       refreshToken(stored),
+			setup: func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {
+				store.EXPECT().Get(ctx, "token").Return(models.RefreshToken{}, postgresql.ErrTokenNotFound)
+			},
+			expected: ErrInvalidToken,
+		},
+		{
+			description: "when the token is not a refresh token",
+			input: func() string {
+				token, _ := tokens.Encode(testSigner, tokens.Claims{Subject: "1", ExpiresAt: time.Now().Add(time.Hour).Unix(), ID: "token", Type: tokens.TypeAccess})
+				return token
+			}(),
+			setup:    func(ctx context.Context, users *mock_services.MockUserService, store *mock_services.MockRefreshTokenStore) {},
+			expected: ErrInvalidToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, users, store, service := setupAuthTest(t)
+
+			tc.setup(ctx, users, store)
+
+			pair, err := service.Refresh(ctx, tc.input)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(pair.RefreshToken).ToNot(Equal(tc.input), "should rotate the refresh token")
+			}
+		})
+	}
+}
+
+func Test_Logout(t *testing.T) {
+	g := NewWithT(t)
+	ctx, _, store, service := setupAuthTest(t)
+
+	stored := models.NewRefreshToken("token", "family", 1, time.Now().Add(time.Hour))
+
+	store.EXPECT().Get(ctx, "token").Return(stored, nil)
+	store.EXPECT().RevokeFamily(ctx, "family").Return(nil)
+
+	g.Expect(service.Logout(ctx, refreshToken(stored))).To(Succeed(), "should revoke the token family")
+}
+
+func Test_VerifyAccessToken(t *testing.T) {
+	g := NewWithT(t)
+	ctx, users, store, service := setupAuthTest(t)
+
+	user := userModels.NewUser(1, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+	users.EXPECT().VerifyCredentials(ctx, "testuser", "qwerty").Return(user, nil)
+	users.EXPECT().Permissions(ctx, user).Return([]string{"users:read"}, nil)
+	store.EXPECT().Create(ctx, gomock.Any()).Return(nil)
+
+	pair, err := service.Login(ctx, "testuser", "qwerty")
+	g.Expect(err).ToNot(HaveOccurred(), "should log in")
+
+	principal, err := service.VerifyAccessToken(pair.AccessToken)
+	g.Expect(err).ToNot(HaveOccurred(), "should accept the access token")
+	g.Expect(principal.UserID).To(Equal(1), "should return the user of the token")
+	g.Expect(principal.Scopes).To(Equal([]string{"users:read"}), "should return the scopes of the token")
+
+	_, err = service.VerifyAccessToken(pair.RefreshToken)
+	g.Expect(err).To(Equal(ErrInvalidToken), "should reject refresh tokens")
+}
+
+func Test_VerifyAPIKey(t *testing.T) {
+	g := NewWithT(t)
+
+	config := DefaultConfig()
+	config.APIKeys = []models.APIKey{models.NewAPIKey("reporting", "s3cr3t", []string{"users:read"})}
+	service := NewAuthService(nil, nil, testSigner, config)
+
+	principal, err := service.VerifyAPIKey("s3cr3t")
+	g.Expect(err).ToNot(HaveOccurred(), "should accept a known key")
+	g.Expect(principal.Name).To(Equal("reporting"), "should return the service of the key")
+	g.Expect(principal.IsUser()).To(BeFalse(), "should not act as a user")
+
+	_, err = service.VerifyAPIKey("guess")
+	g.Expect(err).To(Equal(ErrInvalidToken), "should reject unknown keys")
+}
@@ -0,0 +1,132 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidKey = errors.New("invalid signing key")
+
+// Signer signs and verifies tokens with a single key.
+type Signer interface {
+	Algorithm() string
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) bool
+	// PublicKeys lists the keys downstream services can verify tokens with.
+	PublicKeys() []JWK
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// HMACSigner signs with HS256. The key is a shared secret, so no public key
+// is published and only services knowing the secret can verify the tokens.
+type HMACSigner struct {
+	secret []byte
+	keyID  string
+}
+
+func NewHMACSigner(secret []byte) (HMACSigner, error) {
+	if len(secret) < sha256.Size {
+		return HMACSigner{}, ErrInvalidKey
+	}
+
+	return HMACSigner{
+		secret: secret,
+		keyID:  keyID(secret),
+	}, nil
+}
+
+func (s HMACSigner) Algorithm() string {
+	return "HS256"
+}
+
+func (s HMACSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s HMACSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+func (s HMACSigner) Verify(data, signature []byte) bool {
+	expected, _ := s.Sign(data)
+
+	return hmac.Equal(expected, signature)
+}
+
+func (s HMACSigner) PublicKeys() []JWK {
+	return []JWK{}
+}
+
+// Ed25519Signer signs with EdDSA and publishes its public key.
+type Ed25519Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+func NewEd25519Signer(key ed25519.PrivateKey) (Ed25519Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return Ed25519Signer{}, ErrInvalidKey
+	}
+
+	return Ed25519Signer{
+		key:   key,
+		keyID: keyID(key.Public().(ed25519.PublicKey)),
+	}, nil
+}
+
+func (s Ed25519Signer) Algorithm() string {
+	return "EdDSA"
+}
+
+func (s Ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+func (s Ed25519Signer) Verify(data, signature []byte) bool {
+	return ed25519.Verify(s.key.Public().(ed25519.PublicKey), data, signature)
+}
+
+func (s Ed25519Signer) PublicKeys() []JWK {
+	return []JWK{
+		{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+			KeyID:     s.keyID,
+			Algorithm: s.Algorithm(),
+			Use:       "sig",
+		},
+	}
+}
+
+// keyID derives a stable identifier from the key so rotating the key
+// changes the kid header of new tokens.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
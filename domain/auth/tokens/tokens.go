@@ -0,0 +1,130 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpiredToken     = errors.New("token expired")
+)
+
+// Claims are the registered JWT claims the service uses, along with the
+// token type, the space separated scopes of access tokens and, for refresh
+// tokens, the family it belongs to.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	ID        string `json:"jti"`
+	Type      string `json:"typ"`
+	Family    string `json:"fam,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Encode signs the claims into a compact JWT.
+func Encode(signer Signer, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: signer.Algorithm(), Type: "JWT", KeyID: signer.KeyID()})
+	if err != nil {
+		return "", fmt.Errorf("%w failed to marshal header", err)
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("%w failed to marshal claims", err)
+	}
+
+	signingInput := encodeSegment(h) + "." + encodeSegment(c)
+
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("%w failed to sign token", err)
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Decode verifies the signature and expiry of a compact JWT and returns its
+// claims. The algorithm of the header must be the one of the signer.
+func Decode(signer Signer, token string, now time.Time) (Claims, error) {
+	var (
+		h      header
+		claims Claims
+	)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformedToken
+	}
+
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	if h.Algorithm != signer.Algorithm() || (h.KeyID != "" && h.KeyID != signer.KeyID()) {
+		return Claims{}, ErrInvalidSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	if !signer.Verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return Claims{}, ErrInvalidSignature
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// NewID returns a random identifier for tokens and token families.
+func NewID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("%w failed to generate id", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,119 @@
+//+build unit
+
+package tokens
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_EncodeDecode(t *testing.T) {
+
+	now := time.Date(2021, time.May, 1, 10, 0, 0, 0, time.UTC)
+
+	hmacSigner, _ := NewHMACSigner([]byte(strings.Repeat("s", 32)))
+	otherHMACSigner, _ := NewHMACSigner([]byte(strings.Repeat("o", 32)))
+	edSigner, _ := NewEd25519Signer(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+
+	claims := Claims{
+		Issuer:    "users",
+		Subject:   "1",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		ID:        "abc",
+		Type:      TypeAccess,
+	}
+
+	type testInput struct {
+		signer   Signer
+		verifier Signer
+		now      time.Time
+	}
+
+	testCases := []struct {
+		description string
+		input       testInput
+		expected    error
+	}{
+		{
+			description: "when verifying an HMAC token",
+			input:       testInput{signer: hmacSigner, verifier: hmacSigner, now: now},
+		},
+		{
+			description: "when verifying an Ed25519 token",
+			input:       testInput{signer: edSigner, verifier: edSigner, now: now},
+		},
+		{
+			description: "when the token was signed with another secret",
+			input:       testInput{signer: otherHMACSigner, verifier: hmacSigner, now: now},
+			expected:    ErrInvalidSignature,
+		},
+		{
+			description: "when the token was signed with another algorithm",
+			input:       testInput{signer: edSigner, verifier: hmacSigner, now: now},
+			expected:    ErrInvalidSignature,
+		},
+		{
+			description: "when the token expired",
+			input:       testInput{signer: hmacSigner, verifier: hmacSigner, now: now.Add(time.Minute)},
+			expected:    ErrExpiredToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			token, err := Encode(tc.input.signer, claims)
+			g.Expect(err).ToNot(HaveOccurred(), "should sign the token")
+
+			decoded, err := Decode(tc.input.verifier, token, tc.input.now)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should verify the token")
+				g.Expect(decoded).To(Equal(claims), "should return the claims")
+			}
+		})
+	}
+}
+
+func Test_Decode_Tampered(t *testing.T) {
+	g := NewWithT(t)
+
+	signer, _ := NewHMACSigner([]byte(strings.Repeat("s", 32)))
+	now := time.Now()
+
+	token, _ := Encode(signer, Claims{Subject: "1", ExpiresAt: now.Add(time.Minute).Unix()})
+	forged, _ := Encode(signer, Claims{Subject: "2", ExpiresAt: now.Add(time.Minute).Unix()})
+
+	parts := strings.Split(token, ".")
+	forgedParts := strings.Split(forged, ".")
+
+	_, err := Decode(signer, parts[0]+"."+forgedParts[1]+"."+parts[2], now)
+	g.Expect(err).To(Equal(ErrInvalidSignature), "should reject a changed payload")
+
+	_, err = Decode(signer, "not.a-token", now)
+	g.Expect(err).To(Equal(ErrMalformedToken), "should reject malformed tokens")
+}
+
+func Test_Signers(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewHMACSigner([]byte("short"))
+	g.Expect(err).To(Equal(ErrInvalidKey), "should reject short secrets")
+
+	hmacSigner, _ := NewHMACSigner([]byte(strings.Repeat("s", 32)))
+	g.Expect(hmacSigner.PublicKeys()).To(BeEmpty(), "should not publish the shared secret")
+
+	edSigner, _ := NewEd25519Signer(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	keys := edSigner.PublicKeys()
+	g.Expect(keys).To(HaveLen(1), "should publish the public key")
+	g.Expect(keys[0].KeyID).To(Equal(edSigner.KeyID()), "should publish the key id of the tokens")
+	g.Expect(keys[0].Algorithm).To(Equal("EdDSA"), "should publish the algorithm")
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "context"
+
+// ActorAnonymous is the actor of the changes made without credentials, like
+// signing up.
+const ActorAnonymous = "anonymous"
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// WithActor records who makes the changes, the stores keep it in the history
+// of the entities they change.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns who makes the changes, anonymous when nobody was recorded.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+
+	return ActorAnonymous
+}
+
+// WithRequestID records the request the changes are made for, so they can be
+// traced back to it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the id of the request, empty when there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
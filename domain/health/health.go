@@ -0,0 +1,163 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+var ErrTimeout = errors.New("check timed out")
+
+// Checker checks a dependency of the process, such as the database.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Config struct {
+	// Timeout bounds each check, a check taking longer is down.
+	Timeout time.Duration
+	// CacheTTL is how long the result of a check is reused, so frequent
+	// probes do not load the dependencies.
+	CacheTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:  2 * time.Second,
+		CacheTTL: 5 * time.Second,
+	}
+}
+
+// Result is the outcome of a check, Error being empty when it is up.
+type Result struct {
+	Name      string
+	Status    string
+	Latency   time.Duration
+	Error     string
+	CheckedAt time.Time
+}
+
+// Report gathers the results of every check, in the order they were
+// registered. It is up when all of them are.
+type Report struct {
+	Status string
+	Checks []Result
+}
+
+type check struct {
+	name    string
+	checker Checker
+
+	// mu is held while checking, so concurrent probes wait for the running
+	// check and share its result.
+	mu     sync.Mutex
+	result Result
+}
+
+// Registry runs the registered checks.
+type Registry struct {
+	config Config
+
+	mu     sync.RWMutex
+	checks []*check
+}
+
+func NewRegistry(config Config) *Registry {
+	return &Registry{
+		config: config,
+	}
+}
+
+func (r *Registry) Register(name string, checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, &check{name: name, checker: checker})
+}
+
+// Check runs the checks concurrently, reusing the results younger than the
+// cache TTL. As the results are shared, the checks do not depend on the
+// context of the caller, only on the timeout.
+func (r *Registry) Check() Report {
+	r.mu.RLock()
+	checks := append([]*check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	report := Report{
+		Status: StatusUp,
+		Checks: make([]Result, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = r.run(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func (r *Registry) run(c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < r.config.CacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	done := make(chan error, 1)
+
+	// the checker runs apart, so those not honouring the context, such as
+	// blocking client calls, are still bounded by the timeout
+	go func() {
+		done <- c.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	result := Result{
+		Name:      c.name,
+		Status:    StatusUp,
+		Latency:   time.Since(started),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	c.result = result
+
+	return result
+}
@@ -0,0 +1,138 @@
+//+build unit
+
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+var ERROR = errors.New("expected error")
+
+// counted counts the checks actually run, the cached ones not being.
+func counted(calls *int32, err error) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		atomic.AddInt32(calls, 1)
+
+		return err
+	})
+}
+
+func Test_Registry_Check(t *testing.T) {
+
+	type testExpectation struct {
+		status   string
+		statuses []string
+		errors   []string
+	}
+
+	testCases := []struct {
+		description string
+		checkers    map[string]Checker
+		expected    testExpectation
+	}{
+		{
+			description: "when there is no check",
+			checkers:    map[string]Checker{},
+			expected:    testExpectation{status: StatusUp, statuses: []string{}, errors: []string{}},
+		},
+		{
+			description: "when every check passes",
+			checkers: map[string]Checker{
+				"postgres": CheckerFunc(func(ctx context.Context) error { return nil }),
+			},
+			expected: testExpectation{status: StatusUp, statuses: []string{StatusUp}, errors: []string{""}},
+		},
+		{
+			description: "when a check fails",
+			checkers: map[string]Checker{
+				"postgres": CheckerFunc(func(ctx context.Context) error { return ERROR }),
+			},
+			expected: testExpectation{status: StatusDown, statuses: []string{StatusDown}, errors: []string{ERROR.Error()}},
+		},
+		{
+			description: "when a check times out",
+			checkers: map[string]Checker{
+				"kafka": CheckerFunc(func(ctx context.Context) error {
+					time.Sleep(time.Second)
+
+					return nil
+				}),
+			},
+			expected: testExpectation{status: StatusDown, statuses: []string{StatusDown}, errors: []string{ErrTimeout.Error()}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			registry := NewRegistry(Config{Timeout: 50 * time.Millisecond})
+			for name, checker := range tc.checkers {
+				registry.Register(name, checker)
+			}
+
+			started := time.Now()
+			report := registry.Check()
+
+			g.Expect(time.Since(started)).To(BeNumerically("<", time.Second), "should not wait past the timeout")
+			g.Expect(report.Status).To(Equal(tc.expected.status), "should be up only when every check is")
+
+			statuses, errs := []string{}, []string{}
+			for _, result := range report.Checks {
+				statuses = append(statuses, result.Status)
+				errs = append(errs, result.Error)
+			}
+
+			g.Expect(statuses).To(Equal(tc.expected.statuses), "should report the status of each check")
+			g.Expect(errs).To(Equal(tc.expected.errors), "should report why a check is down")
+		})
+	}
+}
+
+func Test_Registry_Check_Cache(t *testing.T) {
+	g := NewWithT(t)
+
+	var calls int32
+
+	registry := NewRegistry(Config{Timeout: time.Second, CacheTTL: time.Hour})
+	registry.Register("postgres", counted(&calls, ERROR))
+
+	first := registry.Check()
+	second := registry.Check()
+
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)), "should reuse the result within the cache TTL")
+	g.Expect(second).To(Equal(first), "should report the cached result")
+
+	registry = NewRegistry(Config{Timeout: time.Second})
+	registry.Register("postgres", counted(&calls, nil))
+
+	registry.Check()
+	registry.Check()
+
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(3)), "should check again once the result expired")
+}
+
+func Test_Registry_Check_Order(t *testing.T) {
+	g := NewWithT(t)
+
+	registry := NewRegistry(DefaultConfig())
+	registry.Register("postgres", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+
+		return nil
+	}))
+	registry.Register("kafka", CheckerFunc(func(ctx context.Context) error { return nil }))
+
+	report := registry.Check()
+
+	g.Expect(report.Checks).To(HaveLen(2))
+	g.Expect(report.Checks[0].Name).To(Equal("postgres"), "should keep the order of registration")
+	g.Expect(report.Checks[0].Latency).To(BeNumerically(">=", 10*time.Millisecond), "should measure the latency")
+	g.Expect(report.Checks[1].Name).To(Equal("kafka"), "should keep the order of registration")
+}
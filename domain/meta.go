@@ -2,7 +2,11 @@ package domain
 
 import "time"
 
-type Event interface{}
+// Event is a change recorded by an entity, kept until the entity is stored.
+type Event interface {
+	EventType() string
+	OccurredAt() time.Time
+}
 
 type Meta struct {
 	version   uint32
@@ -37,6 +41,12 @@ func (m *Meta) ClearChanges() {
 	m.changes = make([]Event, 0)
 }
 
+// Changes returns the events recorded since the entity was loaded, oldest
+// first.
+func (m Meta) Changes() []Event {
+	return append([]Event(nil), m.changes...)
+}
+
 func (m Meta) HasChanges() bool {
 	return len(m.changes) > 0
 }
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"database/sql"
+	"runtime"
+	"time"
+)
+
+// GaugeValue is a family of a single gauge value, for the collectors reading
+// their values when gathered.
+func GaugeValue(name, help string, value float64) Family {
+	return Family{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: value}}}
+}
+
+// CounterValue is a family of a single counter value, for the collectors
+// reading their values when gathered.
+func CounterValue(name, help string, value float64) Family {
+	return Family{Name: name, Help: help, Type: TypeCounter, Samples: []Sample{{Value: value}}}
+}
+
+// Pool gives the statistics of a database pool, as *sql.DB does.
+type Pool interface {
+	Stats() sql.DBStats
+}
+
+// NewPoolCollector exposes the statistics of the database pool, read when
+// gathered.
+func NewPoolCollector(pool Pool) Collector {
+	return CollectorFunc(func() []Family {
+		stats := pool.Stats()
+
+		return []Family{
+			GaugeValue("db_pool_max_open_connections", "Maximum number of open connections to the database.", float64(stats.MaxOpenConnections)),
+			GaugeValue("db_pool_open_connections", "Number of established connections, in use and idle.", float64(stats.OpenConnections)),
+			GaugeValue("db_pool_in_use_connections", "Number of connections in use.", float64(stats.InUse)),
+			GaugeValue("db_pool_idle_connections", "Number of idle connections.", float64(stats.Idle)),
+			CounterValue("db_pool_wait_count_total", "Total number of connections waited for.", float64(stats.WaitCount)),
+			CounterValue("db_pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", stats.WaitDuration.Seconds()),
+			CounterValue("db_pool_max_idle_closed_total", "Total number of connections closed due to the maximum of idle connections.", float64(stats.MaxIdleClosed)),
+			CounterValue("db_pool_max_lifetime_closed_total", "Total number of connections closed due to their maximum lifetime.", float64(stats.MaxLifetimeClosed)),
+		}
+	})
+}
+
+// NewRuntimeCollector exposes the goroutines, the memory and the garbage
+// collections of the Go runtime. Reading the memory statistics stops the
+// world briefly, which is fine at the pace of scrapes.
+func NewRuntimeCollector() Collector {
+	return CollectorFunc(func() []Family {
+		var memstats runtime.MemStats
+		runtime.ReadMemStats(&memstats)
+
+		lastGC := float64(0)
+		if memstats.LastGC > 0 {
+			lastGC = float64(memstats.LastGC) / float64(time.Second)
+		}
+
+		return []Family{
+			{
+				Name:    "go_info",
+				Help:    "Information about the Go environment.",
+				Type:    TypeGauge,
+				Samples: []Sample{{Labels: []Label{{Name: "version", Value: runtime.Version()}}, Value: 1}},
+			},
+			GaugeValue("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())),
+			GaugeValue("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(memstats.Alloc)),
+			CounterValue("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(memstats.TotalAlloc)),
+			GaugeValue("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(memstats.Sys)),
+			CounterValue("go_memstats_mallocs_total", "Total number of mallocs.", float64(memstats.Mallocs)),
+			CounterValue("go_memstats_frees_total", "Total number of frees.", float64(memstats.Frees)),
+			GaugeValue("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", float64(memstats.HeapAlloc)),
+			GaugeValue("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(memstats.HeapInuse)),
+			GaugeValue("go_memstats_heap_objects", "Number of allocated objects.", float64(memstats.HeapObjects)),
+			GaugeValue("go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", float64(memstats.NextGC)),
+			GaugeValue("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", lastGC),
+			CounterValue("go_gc_cycles_total", "Total number of completed garbage collection cycles.", float64(memstats.NumGC)),
+			CounterValue("go_gc_pause_seconds_total", "Total time the garbage collections stopped the world.", float64(memstats.PauseTotalNs)/float64(time.Second)),
+			GaugeValue("go_gc_cpu_fraction", "Fraction of the CPU time used by the garbage collector since the process started.", memstats.GCCPUFraction),
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the one of the Prometheus text format written by WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Label is a label of a sample, e.g. the route of a request.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of a metric. Suffix is appended to the name of the
+// family, as histograms do with `_bucket`, `_sum` and `_count`.
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with its samples, as exposed to Prometheus.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector gives the current families of the metrics it holds. The
+// counters, gauges and histograms are ones, the collectors of the database
+// pool, the runtime or the producer read their values when gathered.
+type Collector interface {
+	Collect() []Family
+}
+
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Registry holds the collectors exposed by the process. The metric names must
+// be unique across them.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := NewCounter(name, help, labels...)
+	r.Register(c)
+
+	return c
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := NewGauge(name, help, labels...)
+	r.Register(g)
+
+	return g
+}
+
+// Histogram registers a histogram with the given upper bounds and label
+// names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := NewHistogram(name, help, buckets, labels...)
+	r.Register(h)
+
+	return h
+}
+
+// Gather collects the families of every collector, sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	var families []Family
+	for _, collector := range collectors {
+		families = append(families, collector.Collect()...)
+	}
+
+	sort.SliceStable(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+
+	return families
+}
+
+// WriteText writes the gathered families in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	return WriteText(w, r.Gather())
+}
+
+func WriteText(w io.Writer, families []Family) error {
+	buf := bufio.NewWriter(w)
+
+	for _, family := range families {
+		if family.Help != "" {
+			buf.WriteString("# HELP " + family.Name + " " + escapeHelp(family.Help) + "\n")
+		}
+		buf.WriteString("# TYPE " + family.Name + " " + family.Type + "\n")
+
+		for _, sample := range family.Samples {
+			buf.WriteString(family.Name + sample.Suffix)
+
+			if len(sample.Labels) > 0 {
+				buf.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(label.Name + `="` + escapeLabel(label.Value) + `"`)
+				}
+				buf.WriteByte('}')
+			}
+
+			buf.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+
+	return buf.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
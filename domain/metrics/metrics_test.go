@@ -0,0 +1,160 @@
+//+build unit
+
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func text(g *WithT, r *Registry) string {
+	var out bytes.Buffer
+	g.Expect(r.WriteText(&out)).To(Succeed(), "should write the metrics")
+
+	return out.String()
+}
+
+func Test_Registry_WriteText(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		record      func(r *Registry)
+		expected    string
+	}{
+		{
+			description: "when a counter is incremented",
+			record: func(r *Registry) {
+				requests := r.Counter("http_requests_total", "Total number of requests.", "route", "code")
+				requests.Inc("/users/{id}", "200")
+				requests.Inc("/users", "201")
+				requests.Add(2, "/users/{id}", "200")
+				requests.Add(-1, "/users/{id}", "200")
+			},
+			expected: `# HELP http_requests_total Total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{route="/users",code="201"} 1
+http_requests_total{route="/users/{id}",code="200"} 3
+`,
+		},
+		{
+			description: "when a gauge is set",
+			record: func(r *Registry) {
+				pending := r.Gauge("pending", "")
+				pending.Set(4)
+				pending.Add(-1.5)
+			},
+			expected: `# TYPE pending gauge
+pending 2.5
+`,
+		},
+		{
+			description: "when a histogram observes values",
+			record: func(r *Registry) {
+				durations := r.Histogram("duration_seconds", "Duration.", []float64{1, 0.1}, "method")
+				durations.Observe(0.05, "Get")
+				durations.Observe(0.1, "Get")
+				durations.Observe(3, "Get")
+			},
+			expected: `# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{method="Get",le="0.1"} 2
+duration_seconds_bucket{method="Get",le="1"} 2
+duration_seconds_bucket{method="Get",le="+Inf"} 3
+duration_seconds_sum{method="Get"} 3.15
+duration_seconds_count{method="Get"} 3
+`,
+		},
+		{
+			description: "when the values need escaping",
+			record: func(r *Registry) {
+				r.Counter("errors_total", "Errors by \\ reason\nfor real.", "reason").Inc("a \"quoted\"\nreason\\")
+			},
+			expected: `# HELP errors_total Errors by \\ reason\nfor real.
+# TYPE errors_total counter
+errors_total{reason="a \"quoted\"\nreason\\"} 1
+`,
+		},
+		{
+			description: "when there are several metrics",
+			record: func(r *Registry) {
+				r.Gauge("b", "").Set(1)
+				r.Gauge("a", "").Set(2)
+			},
+			expected: `# TYPE a gauge
+a 2
+# TYPE b gauge
+b 1
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := NewRegistry()
+			tc.record(r)
+
+			g.Expect(text(g, r)).To(Equal(tc.expected), "should write the Prometheus text format")
+		})
+	}
+}
+
+func Test_Counter_Labels(t *testing.T) {
+	g := NewWithT(t)
+
+	requests := NewCounter("http_requests_total", "", "route", "code")
+
+	g.Expect(func() { requests.Inc("/users") }).To(Panic(), "should refuse a wrong number of label values")
+}
+
+type pool struct {
+	stats sql.DBStats
+}
+
+func (p pool) Stats() sql.DBStats {
+	return p.stats
+}
+
+func Test_NewPoolCollector(t *testing.T) {
+	g := NewWithT(t)
+
+	r := NewRegistry()
+	r.Register(NewPoolCollector(pool{stats: sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       1500 * time.Millisecond,
+	}}))
+
+	out := text(g, r)
+	g.Expect(out).To(ContainSubstring("\ndb_pool_open_connections 3\n"), "should expose the open connections")
+	g.Expect(out).To(ContainSubstring("\ndb_pool_in_use_connections 2\n"), "should expose the connections in use")
+	g.Expect(out).To(ContainSubstring("# TYPE db_pool_wait_count_total counter\ndb_pool_wait_count_total 5\n"), "should expose the waits as counters")
+	g.Expect(out).To(ContainSubstring("\ndb_pool_wait_duration_seconds_total 1.5\n"), "should expose the durations in seconds")
+}
+
+func Test_NewRuntimeCollector(t *testing.T) {
+	g := NewWithT(t)
+
+	r := NewRegistry()
+	r.Register(NewRuntimeCollector())
+
+	out := text(g, r)
+	for _, name := range []string{"go_goroutines", "go_memstats_alloc_bytes", "go_memstats_heap_objects", "go_gc_cycles_total", "go_gc_pause_seconds_total"} {
+		g.Expect(out).To(ContainSubstring("\n"+name+" "), "should expose %s", name)
+	}
+
+	names := []string{}
+	for _, family := range r.Gather() {
+		names = append(names, family.Name)
+	}
+	g.Expect(strings.Join(names, " ")).To(HavePrefix("go_gc_cpu_fraction go_gc_cycles_total"), "should sort the metrics by name")
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit latencies in seconds, from 5 milliseconds to 10
+// seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// vector keeps a value per combination of label values. Giving another number
+// of values than there are label names is a programming error, it panics.
+type vector struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	// value is the value of counters and gauges, the sum of histograms
+	value float64
+	// counts are the observations of each bucket of histograms, not
+	// cumulated, the last one being those above the upper bounds
+	counts []uint64
+	count  uint64
+}
+
+func newVector(name, help string, labels []string) vector {
+	return vector{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+// get returns the series of the label values, the lock being held.
+func (v *vector) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+// sorted returns the series ordered by their label values, the lock being
+// held, for the output to be stable.
+func (v *vector) sorted() []*series {
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		for k := range all[i].values {
+			if all[i].values[k] != all[j].values[k] {
+				return all[i].values[k] < all[j].values[k]
+			}
+		}
+
+		return false
+	})
+
+	return all
+}
+
+func (v *vector) labelsOf(s *series, extra ...Label) []Label {
+	labels := make([]Label, 0, len(v.labels)+len(extra))
+	for i, name := range v.labels {
+		labels = append(labels, Label{Name: name, Value: s.values[i]})
+	}
+
+	return append(labels, extra...)
+}
+
+func (v *vector) collect(kind string) []Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	family := Family{Name: v.name, Help: v.help, Type: kind}
+	for _, s := range v.sorted() {
+		family.Samples = append(family.Samples, Sample{Labels: v.labelsOf(s), Value: s.value})
+	}
+
+	return []Family{family}
+}
+
+// Counter is a value only going up, such as a number of requests.
+type Counter struct {
+	vector
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{vector: newVector(name, help, labels)}
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds the delta to the counter, ignoring the negative ones.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(values).value += delta
+}
+
+func (c *Counter) Collect() []Family {
+	return c.collect(TypeCounter)
+}
+
+// Gauge is a value going up and down, such as a number of connections.
+type Gauge struct {
+	vector
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{vector: newVector(name, help, labels)}
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(values).value = value
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(values).value += delta
+}
+
+func (g *Gauge) Collect() []Family {
+	return g.collect(TypeGauge)
+}
+
+// Histogram counts the observations, such as durations, in buckets of
+// increasing upper bounds.
+type Histogram struct {
+	vector
+	buckets []float64
+	// bounds are the buckets followed by +Inf, as exposed
+	bounds []float64
+}
+
+// NewHistogram sorts the upper bounds, the default ones being used when none
+// is given.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Histogram{
+		vector:  newVector(name, help, labels),
+		buckets: buckets,
+		bounds:  append(append([]float64(nil), buckets...), math.Inf(1)),
+	}
+}
+
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets)+1)
+	}
+
+	s.counts[sort.SearchFloat64s(h.buckets, value)]++
+	s.count++
+	s.value += value
+}
+
+// Collect gives the cumulative counts of the buckets, along with the sum and
+// the count of the observations.
+func (h *Histogram) Collect() []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	family := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += s.counts[i]
+			family.Samples = append(family.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: h.labelsOf(s, Label{Name: "le", Value: formatValue(bound)}),
+				Value:  float64(cumulative),
+			})
+		}
+
+		family.Samples = append(family.Samples,
+			Sample{Suffix: "_sum", Labels: h.labelsOf(s), Value: s.value},
+			Sample{Suffix: "_count", Labels: h.labelsOf(s), Value: float64(s.count)},
+		)
+	}
+
+	return []Family{family}
+}
@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+// Message is a row of the outbox, written in the same transaction as the
+// change it announces and published afterwards by the relay.
+type Message struct {
+	ID          int64
+	AggregateID int
+	Payload     []byte
+	CreatedAt   time.Time
+	Attempts    int
+	// SentAt is zero until the message is sent.
+	SentAt time.Time
+	// TraceParent is the span the change was made in, for the published
+	// events to continue its trace. It is empty when it was not traced.
+	TraceParent string
+}
+
+// payload is the state of the user after the change along with the events
+// recorded on it.
+type payload struct {
+	User   snapshot `json:"user"`
+	Events []event  `json:"events"`
+}
+
+type event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// snapshot is the state of the user at the time of the change, without the
+// password which is never published.
+type snapshot struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Nickname  string    `json:"nickname"`
+	Email     string    `json:"email"`
+	Country   string    `json:"country"`
+	Roles     []string  `json:"roles,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Disabled  bool      `json:"disabled"`
+	Version   uint32    `json:"version"`
+}
+
+// NewUserMessage announces the events recorded on the user, the user being
+// the one returned by the store so the id and version are known.
+func NewUserMessage(user models.User, events []domain.Event) (Message, error) {
+	p := payload{
+		User: snapshot{
+			ID:        user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Nickname:  user.Nickname,
+			Email:     user.Email,
+			Country:   user.Country,
+			Roles:     user.Roles,
+			CreatedAt: user.Meta.GetCreatedAt(),
+			UpdatedAt: user.Meta.GetUpdatedAt(),
+			Disabled:  user.Meta.GetDisabled(),
+			Version:   user.Meta.GetVersion(),
+		},
+		Events: make([]event, 0, len(events)),
+	}
+
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return Message{}, fmt.Errorf("%w failed to marshal %s event", err, e.EventType())
+		}
+
+		p.Events = append(p.Events, event{Type: e.EventType(), Data: data})
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w failed to marshal user", err)
+	}
+
+	return Message{
+		AggregateID: user.ID,
+		Payload:     b,
+	}, nil
+}
+
+// User rebuilds the user the message was written for.
+func (m Message) User() (models.User, error) {
+	var p payload
+
+	if err := json.Unmarshal(m.Payload, &p); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to unmarshal user", err)
+	}
+
+	s := p.User
+
+	user := models.NewUser(s.ID, s.FirstName, s.LastName, s.Nickname, "", s.Email, s.Country)
+	user.Roles = s.Roles
+	user.Meta.HydrateMeta(s.Version, s.CreatedAt, s.UpdatedAt, s.Disabled)
+
+	return user, nil
+}
+
+// Events rebuilds the events of the message, in the order they were recorded.
+func (m Message) Events() ([]domain.Event, error) {
+	var p payload
+
+	if err := json.Unmarshal(m.Payload, &p); err != nil {
+		return nil, fmt.Errorf("%w failed to unmarshal events", err)
+	}
+
+	var events []domain.Event = make([]domain.Event, 0, len(p.Events))
+
+	for _, e := range p.Events {
+		decoded, err := decodeEvent(e)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, decoded)
+	}
+
+	return events, nil
+}
+
+func decodeEvent(e event) (domain.Event, error) {
+	var (
+		decoded domain.Event
+		err     error
+	)
+
+	switch e.Type {
+	case models.EventUserCreated:
+		var v models.UserCreated
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventFirstNameChanged:
+		var v models.FirstNameChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventLastNameChanged:
+		var v models.LastNameChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventNicknameChanged:
+		var v models.NicknameChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventEmailChanged:
+		var v models.EmailChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventPasswordChanged:
+		var v models.PasswordChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventCountryChanged:
+		var v models.CountryChanged
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventRoleAssigned:
+		var v models.RoleAssigned
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventRoleRevoked:
+		var v models.RoleRevoked
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventUserDeactivated:
+		var v models.UserDeactivated
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventUserRestored:
+		var v models.UserRestored
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventUserErased:
+		var v models.UserErased
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	case models.EventUserSnapshot:
+		var v models.UserSnapshot
+		err = json.Unmarshal(e.Data, &v)
+		decoded = v
+	default:
+		return nil, fmt.Errorf("%w %s", ErrUnknownEvent, e.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to unmarshal %s event", err, e.Type)
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"context"
+	"fmt"
+)
+
+// FanOut publishes the events to every publisher. A failure of one of them
+// fails the message, which is then published again to all of them, so the
+// others may see the events more than once.
+type FanOut struct {
+	publishers []Publisher
+}
+
+func NewFanOut(publishers ...Publisher) FanOut {
+	return FanOut{
+		publishers: publishers,
+	}
+}
+
+func (f FanOut) PublishSync(ctx context.Context, user models.User, events []domain.Event) error {
+	var (
+		first  error
+		failed int
+	)
+
+	for _, p := range f.publishers {
+		if err := p.PublishSync(ctx, user, events); err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+
+	if first != nil {
+		return fmt.Errorf("%w failed to publish to %d of %d publishers", first, failed, len(f.publishers))
+	}
+
+	return nil
+}
+
+// Discard drops the events, for running without any message broker.
+type Discard struct{}
+
+func (Discard) PublishSync(ctx context.Context, user models.User, events []domain.Event) error {
+	return nil
+}
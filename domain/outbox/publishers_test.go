@@ -0,0 +1,63 @@
+//+build unit
+
+package outbox_test
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/users/models"
+	"context"
+	"errors"
+	"testing"
+
+	mock_outbox "code/tech-test/domain/outbox/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func Test_FanOut(t *testing.T) {
+	ERROR := errors.New("broker down")
+
+	testCases := []struct {
+		description string
+		results     []error
+		expected    error
+	}{
+		{
+			description: "when every publisher succeeds",
+			results:     []error{nil, nil},
+		},
+		{
+			description: "when a publisher fails",
+			results:     []error{ERROR, nil},
+			expected:    ERROR,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			user := models.NewUser(1, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+			events := []domain.Event{models.UserCreated{}}
+
+			var publishers []outbox.Publisher
+			for _, result := range tc.results {
+				publisher := mock_outbox.NewMockPublisher(mockCtrl)
+				publisher.EXPECT().PublishSync(ctx, user, events).Return(result)
+				publishers = append(publishers, publisher)
+			}
+
+			err := outbox.NewFanOut(publishers...).PublishSync(ctx, user, events)
+			if tc.expected != nil {
+				g.Expect(errors.Is(err, tc.expected)).To(BeTrue(), "should return the error of the failed publisher")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should publish to every publisher")
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package outbox
+
+//go:generate mockgen -source=relay.go -destination=mock/relay_mock.go
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/domain/users/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Store interface {
+	// Claim returns up to limit due messages, hiding them from other relays
+	// for the lease. A message is only returned once the previous messages of
+	// its aggregate were sent, so consumers see the changes in order.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Message, error)
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error
+	Stats(ctx context.Context) (Stats, error)
+	// Prune deletes the messages sent before the time and returns how many
+	// were deleted.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Publisher publishes the events of a change to the user, the user being
+// its state once they are applied. It returns once the events are delivered.
+type Publisher interface {
+	PublishSync(ctx context.Context, user models.User, events []domain.Event) error
+}
+
+// Stats describes the messages not sent yet.
+type Stats struct {
+	Pending      int
+	OldestUnsent time.Time
+}
+
+type RelayConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	// Lease hides the claimed messages from the other relays. The messages
+	// of a batch left when it runs out are not published, as another relay
+	// may have claimed them meanwhile, so it must exceed PublishTimeout.
+	Lease      time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PublishTimeout bounds the wait for the delivery of a message, it is
+	// then retried like a failed one.
+	PublishTimeout time.Duration
+	// Retention is how long the sent messages are kept, every PruneInterval
+	// the older ones are deleted. A zero Retention keeps them.
+	Retention     time.Duration
+	PruneInterval time.Duration
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		Interval:       time.Second,
+		BatchSize:      100,
+		Lease:          30 * time.Second,
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+		PublishTimeout: 10 * time.Second,
+		Retention:      7 * 24 * time.Hour,
+		PruneInterval:  time.Hour,
+	}
+}
+
+// Lag is what the relay reports about its progress.
+type Lag struct {
+	Pending   int
+	OldestAge time.Duration
+	Sent      uint64
+	Failed    uint64
+	LastError string
+}
+
+type Relay struct {
+	// messages sent and failed since the start, reported by Lag
+	sent   uint64
+	failed uint64
+
+	store     Store
+	publisher Publisher
+	config    RelayConfig
+
+	mu        sync.Mutex
+	lastError string
+}
+
+func NewRelay(store Store, publisher Publisher, config RelayConfig) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		config:    config,
+	}
+}
+
+// Run polls the outbox until the context is cancelled, pruning the sent
+// messages along the way.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		if r.config.Retention > 0 && time.Since(pruned) >= r.config.PruneInterval {
+			if _, err := r.Prune(ctx); err != nil && ctx.Err() == nil {
+				log.Println(err)
+			}
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes the due messages and returns how many were sent. Failed
+// messages are retried later with an exponential backoff. A message is only
+// published while its lease outlasts the publish timeout, the rest of the
+// batch being claimed again once the lease runs out.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	var sent int
+
+	for {
+		expires := time.Now().Add(r.config.Lease)
+
+		messages, err := r.store.Claim(ctx, r.config.BatchSize, r.config.Lease)
+		if err != nil {
+			return sent, fmt.Errorf("%w failed to claim messages", err)
+		}
+
+		for i, message := range messages {
+			if time.Until(expires) < r.config.PublishTimeout {
+				log.Printf("outbox lease ran out, %d messages left to be claimed again", len(messages)-i)
+				return sent, nil
+			}
+
+			if err := r.publish(ctx, message); err != nil {
+				r.fail(ctx, message, err)
+				continue
+			}
+
+			if err := r.store.MarkSent(ctx, message.ID); err != nil {
+				return sent, fmt.Errorf("%w failed to mark message %d sent", err, message.ID)
+			}
+
+			atomic.AddUint64(&r.sent, 1)
+			sent++
+		}
+
+		if len(messages) < r.config.BatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// Prune deletes the messages sent longer than the retention ago and returns
+// how many were deleted.
+func (r *Relay) Prune(ctx context.Context) (int, error) {
+	pruned, err := r.store.Prune(ctx, time.Now().Add(-r.config.Retention))
+	if err != nil {
+		return 0, fmt.Errorf("%w failed to prune messages", err)
+	}
+
+	return pruned, nil
+}
+
+func (r *Relay) publish(ctx context.Context, message Message) error {
+	user, err := message.User()
+	if err != nil {
+		return err
+	}
+
+	events, err := message.Events()
+	if err != nil {
+		return err
+	}
+
+	// the events continue the trace of the change they announce
+	if parent, err := tracing.ParseTraceParent(message.TraceParent); err == nil {
+		ctx = tracing.WithRemoteParent(ctx, parent)
+	}
+
+	ctx, span := tracing.Start(ctx, "Relay.publish", tracing.KindInternal, tracing.Int("outbox.aggregate_id", message.AggregateID))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.PublishTimeout)
+	defer cancel()
+
+	err = r.publisher.PublishSync(ctx, user, events)
+	span.RecordError(err)
+
+	return err
+}
+
+func (r *Relay) fail(ctx context.Context, message Message, err error) {
+	atomic.AddUint64(&r.failed, 1)
+
+	r.mu.Lock()
+	r.lastError = err.Error()
+	r.mu.Unlock()
+
+	retryAt := time.Now().Add(r.backoff(message.Attempts))
+	if err := r.store.MarkFailed(ctx, message.ID, retryAt, err.Error()); err != nil {
+		// the lease runs out and the message is claimed again
+		log.Println(err)
+	}
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.config.MinBackoff
+
+	for i := 0; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > r.config.MaxBackoff {
+		return r.config.MaxBackoff
+	}
+
+	return delay
+}
+
+func (r *Relay) Lag(ctx context.Context) (Lag, error) {
+	stats, err := r.store.Stats(ctx)
+	if err != nil {
+		return Lag{}, fmt.Errorf("%w failed to get outbox stats", err)
+	}
+
+	lag := Lag{
+		Pending: stats.Pending,
+		Sent:    atomic.LoadUint64(&r.sent),
+		Failed:  atomic.LoadUint64(&r.failed),
+	}
+
+	if !stats.OldestUnsent.IsZero() {
+		lag.OldestAge = time.Since(stats.OldestUnsent)
+	}
+
+	r.mu.Lock()
+	lag.LastError = r.lastError
+	r.mu.Unlock()
+
+	return lag, nil
+}
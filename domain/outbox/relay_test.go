@@ -0,0 +1,300 @@
+//+build unit
+
+package outbox_test
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/domain/users/models"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mock_outbox "code/tech-test/domain/outbox/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func testMessage(id int64, userID int, attempts int) outbox.Message {
+	user := models.NewUser(userID, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(1, time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), false)
+
+	message, err := outbox.NewUserMessage(user, []domain.Event{models.UserCreated{At: user.Meta.GetCreatedAt()}})
+	if err != nil {
+		panic(err)
+	}
+
+	message.ID = id
+	message.Attempts = attempts
+
+	return message
+}
+
+func Test_Relay_Flush(t *testing.T) {
+
+	config := outbox.RelayConfig{BatchSize: 10, Lease: time.Minute, MinBackoff: time.Second, MaxBackoff: 4 * time.Second, PublishTimeout: 10 * time.Millisecond}
+
+	type testExpectation struct {
+		sent   int
+		failed uint64
+	}
+
+	testCases := []struct {
+		description string
+		setup       func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher)
+		expected    testExpectation
+	}{
+		{
+			description: "when every message is published",
+			setup: func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher) {
+				store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{testMessage(1, 1, 0), testMessage(2, 2, 0)}, nil)
+				publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+				store.EXPECT().MarkSent(ctx, int64(1)).Return(nil)
+				store.EXPECT().MarkSent(ctx, int64(2)).Return(nil)
+			},
+			expected: testExpectation{sent: 2},
+		},
+		{
+			description: "when publishing fails",
+			setup: func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher) {
+				store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{testMessage(1, 1, 2)}, nil)
+				publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("broker down"))
+				store.EXPECT().MarkFailed(ctx, int64(1), gomock.Any(), "broker down").DoAndReturn(
+					func(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+						NewWithT(t).Expect(retryAt).To(BeTemporally("~", time.Now().Add(4*time.Second), time.Second), "should back off exponentially")
+						return nil
+					})
+			},
+			expected: testExpectation{failed: 1},
+		},
+		{
+			description: "when publishing keeps failing",
+			setup: func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher) {
+				store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{testMessage(1, 1, 10)}, nil)
+				publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("broker down"))
+				store.EXPECT().MarkFailed(ctx, int64(1), gomock.Any(), "broker down").DoAndReturn(
+					func(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+						NewWithT(t).Expect(retryAt).To(BeTemporally("~", time.Now().Add(4*time.Second), time.Second), "should not back off longer than the maximum")
+						return nil
+					})
+			},
+			expected: testExpectation{failed: 1},
+		},
+		{
+			description: "when the delivery is not confirmed in time",
+			setup: func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher) {
+				store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{testMessage(1, 1, 0)}, nil)
+				publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, user models.User, events []domain.Event) error {
+						<-ctx.Done()
+						return ctx.Err()
+					})
+				store.EXPECT().MarkFailed(ctx, int64(1), gomock.Any(), context.DeadlineExceeded.Error()).Return(nil)
+			},
+			expected: testExpectation{failed: 1},
+		},
+		{
+			description: "when the outbox is empty",
+			setup: func(ctx context.Context, store *mock_outbox.MockStore, publisher *mock_outbox.MockPublisher) {
+				store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{}, nil)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			store := mock_outbox.NewMockStore(mockCtrl)
+			publisher := mock_outbox.NewMockPublisher(mockCtrl)
+			relay := outbox.NewRelay(store, publisher, config)
+
+			tc.setup(ctx, store, publisher)
+
+			sent, err := relay.Flush(ctx)
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(sent).To(Equal(tc.expected.sent), "should return the number of sent messages")
+
+			store.EXPECT().Stats(ctx).Return(outbox.Stats{}, nil)
+			lag, err := relay.Lag(ctx)
+			g.Expect(err).ToNot(HaveOccurred(), "should report the lag")
+			g.Expect(lag.Sent).To(Equal(uint64(tc.expected.sent)), "should count the sent messages")
+			g.Expect(lag.Failed).To(Equal(tc.expected.failed), "should count the failures")
+		})
+	}
+}
+
+func Test_Relay_Flush_Lease(t *testing.T) {
+	g := NewWithT(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mock_outbox.NewMockStore(ctrl)
+	publisher := mock_outbox.NewMockPublisher(ctrl)
+
+	config := outbox.RelayConfig{BatchSize: 10, Lease: 50 * time.Millisecond, PublishTimeout: 20 * time.Millisecond}
+
+	ctx := context.Background()
+	store.EXPECT().Claim(ctx, 10, config.Lease).Return([]outbox.Message{testMessage(1, 1, 0), testMessage(2, 2, 0), testMessage(3, 3, 0)}, nil)
+	publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, user models.User, events []domain.Event) error {
+			time.Sleep(40 * time.Millisecond)
+			return nil
+		})
+	store.EXPECT().MarkSent(ctx, int64(1)).Return(nil)
+
+	relay := outbox.NewRelay(store, publisher, config)
+
+	sent, err := relay.Flush(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(sent).To(Equal(1), "should not publish the messages once the lease would run out")
+}
+
+func Test_Relay_Flush_Trace(t *testing.T) {
+	g := NewWithT(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mock_outbox.NewMockStore(ctrl)
+	publisher := mock_outbox.NewMockPublisher(ctrl)
+
+	message := testMessage(1, 1, 0)
+	message.TraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var published []string
+
+	ctx := context.Background()
+	store.EXPECT().Claim(ctx, 10, time.Minute).Return([]outbox.Message{message, testMessage(2, 2, 0)}, nil)
+	publisher.EXPECT().PublishSync(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(ctx context.Context, user models.User, events []domain.Event) error {
+			published = append(published, tracing.TraceParent(ctx))
+			return nil
+		})
+	store.EXPECT().MarkSent(ctx, gomock.Any()).Times(2).Return(nil)
+
+	relay := outbox.NewRelay(store, publisher, outbox.RelayConfig{BatchSize: 10, Lease: time.Minute, PublishTimeout: time.Second})
+
+	_, err := relay.Flush(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(published).To(Equal([]string{message.TraceParent, ""}), "should publish the events in the trace of their change")
+}
+
+func Test_Relay_Prune(t *testing.T) {
+	g := NewWithT(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mock_outbox.NewMockStore(ctrl)
+	publisher := mock_outbox.NewMockPublisher(ctrl)
+
+	ERROR := errors.New("connection refused")
+
+	ctx := context.Background()
+	config := outbox.RelayConfig{Retention: time.Hour}
+
+	store.EXPECT().Prune(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, before time.Time) (int, error) {
+		g.Expect(before).To(BeTemporally("~", time.Now().Add(-time.Hour), time.Second), "should prune the messages sent before the retention")
+		return 3, nil
+	})
+	store.EXPECT().Prune(ctx, gomock.Any()).Return(0, ERROR)
+
+	relay := outbox.NewRelay(store, publisher, config)
+
+	pruned, err := relay.Prune(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(Equal(3), "should return how many messages were pruned")
+
+	_, err = relay.Prune(ctx)
+	g.Expect(err).To(Equal(fmt.Errorf("%w failed to prune messages", ERROR)), "should return the error of the store")
+}
+
+func Test_Relay_Run_Prune(t *testing.T) {
+	g := NewWithT(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mock_outbox.NewMockStore(ctrl)
+	publisher := mock_outbox.NewMockPublisher(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := outbox.RelayConfig{Interval: time.Millisecond, BatchSize: 10, Retention: time.Hour, PruneInterval: time.Hour}
+
+	claims := 0
+	store.EXPECT().Claim(gomock.Any(), 10, gomock.Any()).AnyTimes().DoAndReturn(func(ctx context.Context, limit int, lease time.Duration) ([]outbox.Message, error) {
+		if claims++; claims == 3 {
+			cancel()
+		}
+		return nil, nil
+	})
+	store.EXPECT().Prune(gomock.Any(), gomock.Any()).Return(0, nil).Times(1)
+
+	done := make(chan struct{})
+	go func() {
+		outbox.NewRelay(store, publisher, config).Run(ctx)
+		close(done)
+	}()
+
+	g.Eventually(done).Should(BeClosed(), "should stop once the context is cancelled")
+	g.Expect(claims).To(BeNumerically(">=", 3), "should keep polling the outbox")
+}
+
+func Test_Message_User(t *testing.T) {
+	g := NewWithT(t)
+
+	user := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Roles = []string{"admin"}
+	user.Meta.HydrateMeta(3, time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.May, 2, 0, 0, 0, 0, time.UTC), true)
+
+	message, err := outbox.NewUserMessage(user, nil)
+	g.Expect(err).ToNot(HaveOccurred(), "should encode the user")
+	g.Expect(string(message.Payload)).ToNot(ContainSubstring("qwerty"), "should leave the password out")
+
+	decoded, err := message.User()
+	g.Expect(err).ToNot(HaveOccurred(), "should decode the user")
+
+	user.Password = ""
+	g.Expect(decoded).To(Equal(user), "should rebuild the user")
+}
+
+func Test_Message_Events(t *testing.T) {
+	g := NewWithT(t)
+
+	at := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	events := []domain.Event{
+		models.UserCreated{At: at},
+		models.FirstNameChanged{Old: "Test", New: "First", At: at},
+		models.LastNameChanged{Old: "Test", New: "Last", At: at},
+		models.NicknameChanged{Old: "testuser", New: "nick", At: at},
+		models.EmailChanged{Old: "example@example.qqq", New: "new@example.qqq", At: at},
+		models.PasswordChanged{At: at},
+		models.CountryChanged{Old: "uk", New: "pt", At: at},
+		models.RoleAssigned{Role: "admin", At: at},
+		models.RoleRevoked{Role: "admin", At: at},
+		models.UserDeactivated{At: at},
+		models.UserRestored{At: at},
+		models.UserErased{At: at},
+	}
+
+	message, err := outbox.NewUserMessage(user, events)
+	g.Expect(err).ToNot(HaveOccurred(), "should encode the events")
+
+	decoded, err := message.Events()
+	g.Expect(err).ToNot(HaveOccurred(), "should decode the events")
+	g.Expect(decoded).To(Equal(events), "should rebuild the events in order")
+
+	_, err = outbox.Message{Payload: []byte(`{"events":[{"type":"UserRenamed","data":{}}]}`)}.Events()
+	g.Expect(err).To(MatchError(outbox.ErrUnknownEvent), "should reject unknown events")
+}
@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HeaderTraceParent carries the span context between processes, as defined by
+// W3C Trace Context.
+const HeaderTraceParent = "traceparent"
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext identifies a span across processes. Only the sampled spans are
+// exported, their children being sampled too.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// TraceParent formats the span context as a traceparent header, e.g.
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent reads a traceparent header. The versions after 00 are read
+// the same way, as the specification asks, ignoring their extra fields.
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[0]) != 2 || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+
+	var sc SpanContext
+
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("%w trace id %q", ErrInvalidTraceParent, parts[1])
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("%w parent id %q", ErrInvalidTraceParent, parts[2])
+	}
+
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return SpanContext{}, fmt.Errorf("%w flags %q", ErrInvalidTraceParent, parts[3])
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w %q", ErrInvalidTraceParent, value)
+	}
+
+	return sc, nil
+}
+
+// decodeHex fills dst from the lowercase hex string, which must have the
+// exact length.
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return ErrInvalidTraceParent
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+
+	return err
+}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// WithTracer makes the spans started from the context recorded by the tracer.
+// Without one they are not recorded, which is what the tests and the commands
+// not tracing get.
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+func withSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// WithRemoteParent makes the span context, read from a request or a message,
+// the parent of the next span started from the context.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFrom returns the current span of the context, nil when there is none.
+func SpanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+
+	return span
+}
+
+// SpanContextFrom returns the context of the current span, or the remote
+// parent, to be propagated. It is not valid when there is none.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if span := SpanFrom(ctx); span != nil {
+		return span.SpanContext()
+	}
+
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+
+	return sc
+}
+
+// TraceParent returns the traceparent header of the current span, empty when
+// there is none.
+func TraceParent(ctx context.Context) string {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+
+	return sc.TraceParent()
+}
@@ -0,0 +1,306 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind tells the role of a span in the trace, numbered as in OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = iota + 1
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+// StatusCode is the outcome of a span, numbered as in OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// Attribute describes a span, its value being a string, an int or a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is an ended span, as exported.
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Exporter sends the ended spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []SpanData) error
+}
+
+type Config struct {
+	// Service names the process in the tracing backend.
+	Service string
+	// Interval is how often the ended spans are exported.
+	Interval time.Duration
+	// BatchSize bounds the spans exported at once.
+	BatchSize int
+	// QueueSize bounds the spans waiting for their export, the spans ended
+	// while it is full being dropped rather than slowing the requests down.
+	QueueSize int
+	// ExportTimeout bounds each export.
+	ExportTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Service:       "users",
+		Interval:      5 * time.Second,
+		BatchSize:     512,
+		QueueSize:     2048,
+		ExportTimeout: 10 * time.Second,
+	}
+}
+
+// Tracer records the spans and exports them in batches, in the background.
+type Tracer struct {
+	// spans dropped on a full queue, first in the struct as atomic operations
+	// need 64-bit words aligned, which 32-bit platforms only guarantee there
+	dropped uint64
+
+	exporter Exporter
+	config   Config
+
+	mu    sync.Mutex
+	queue []SpanData
+	full  chan struct{}
+}
+
+func NewTracer(exporter Exporter, config Config) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		config:   config,
+		full:     make(chan struct{}, 1),
+	}
+}
+
+// Start starts a span, child of the current span of the context, or of its
+// remote parent, and returns the context holding it. The spans are recorded
+// by the tracer of the context, see WithTracer, or by the one of their
+// parent.
+func Start(ctx context.Context, name string, kind Kind, attributes ...Attribute) (context.Context, *Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(*Tracer)
+
+	parent := SpanFrom(ctx)
+	if parent != nil && tracer == nil {
+		tracer = parent.tracer
+	}
+
+	if tracer == nil {
+		return ctx, &Span{}
+	}
+
+	return tracer.Start(ctx, name, kind, attributes...)
+}
+
+// Start starts a span recorded by the tracer, see the Start function.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attributes ...Attribute) (context.Context, *Span) {
+	parent := SpanContextFrom(ctx)
+
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		randomID(sc.TraceID[:])
+	}
+	randomID(sc.SpanID[:])
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			Start:       time.Now(),
+			Attributes:  attributes,
+		},
+	}
+
+	return withSpan(ctx, span), span
+}
+
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		log.Println(err)
+	}
+}
+
+func (t *Tracer) end(data SpanData) {
+	if !data.SpanContext.Sampled {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.queue) >= t.config.QueueSize {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+
+	t.queue = append(t.queue, data)
+
+	if len(t.queue) >= t.config.BatchSize {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run exports the ended spans every interval, or as soon as a batch is full,
+// until the context is cancelled.
+func (t *Tracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.full:
+		}
+
+		if err := t.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Flush exports the spans ended so far, the ones failing to be exported being
+// dropped. It is called on shutdown, for the last spans not to be lost.
+func (t *Tracer) Flush(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		batch := t.queue
+		if len(batch) > t.config.BatchSize {
+			batch = batch[:t.config.BatchSize]
+		}
+		t.queue = t.queue[len(batch):]
+		if len(t.queue) == 0 {
+			t.queue = nil
+		}
+		t.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := t.export(ctx, batch); err != nil {
+			atomic.AddUint64(&t.dropped, uint64(len(batch)))
+			return fmt.Errorf("%w failed to export %d spans", err, len(batch))
+		}
+	}
+}
+
+func (t *Tracer) export(ctx context.Context, batch []SpanData) error {
+	ctx, cancel := context.WithTimeout(ctx, t.config.ExportTimeout)
+	defer cancel()
+
+	return t.exporter.Export(ctx, t.config.Service, batch)
+}
+
+// Dropped counts the spans lost because the queue was full or their export
+// failed.
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Span is an operation of a trace. The spans started without a tracer are not
+// recorded, their methods doing nothing.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes = append(s.data.Attributes, attributes...)
+}
+
+// RecordError marks the span failed, with the error as message. It does
+// nothing when the error is nil.
+func (s *Span) RecordError(err error) {
+	if err == nil || s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// End ends the span and queues it for the export, the later calls doing
+// nothing.
+func (s *Span) End() {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.end(data)
+}
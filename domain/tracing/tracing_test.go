@@ -0,0 +1,179 @@
+//+build unit
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+var ERROR = errors.New("expected error")
+
+// recorder keeps the exported spans.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+	err   error
+}
+
+func (r *recorder) Export(ctx context.Context, service string, spans []SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.spans = append(r.spans, spans...)
+
+	return nil
+}
+
+func (r *recorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]SpanData(nil), r.spans...)
+}
+
+func Test_ParseTraceParent(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		value       string
+		valid       bool
+		sampled     bool
+	}{
+		{description: "when it is sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true, sampled: true},
+		{description: "when it is not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		{description: "when it is a later version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: true, sampled: true},
+		{description: "when it is empty", value: ""},
+		{description: "when the version is invalid", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{description: "when version 00 has extra fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{description: "when the trace id is zero", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{description: "when the span id is zero", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{description: "when the trace id is uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{description: "when the span id is short", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			sc, err := ParseTraceParent(tc.value)
+			if !tc.valid {
+				g.Expect(err).To(MatchError(ErrInvalidTraceParent), "should reject the header")
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred(), "should read the header")
+			g.Expect(sc.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"), "should read the trace id")
+			g.Expect(sc.SpanID.String()).To(Equal("00f067aa0ba902b7"), "should read the parent id")
+			g.Expect(sc.Sampled).To(Equal(tc.sampled), "should read the sampled flag")
+		})
+	}
+}
+
+func Test_SpanContext_TraceParent(t *testing.T) {
+	g := NewWithT(t)
+
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceParent(value)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(sc.TraceParent()).To(Equal(value), "should format the header back")
+}
+
+func Test_Start(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := &recorder{}
+	tracer := NewTracer(exporter, DefaultConfig())
+
+	ctx, root := tracer.Start(context.Background(), "GET /users/{id}", KindServer)
+	ctx, child := Start(ctx, "UserService.GetUser", KindInternal, String("user.id", "1"))
+	child.RecordError(ERROR)
+	child.End()
+	child.End()
+	root.End()
+
+	g.Expect(tracer.Flush(context.Background())).To(Succeed(), "should export the spans")
+
+	spans := exporter.Spans()
+	g.Expect(spans).To(HaveLen(2), "should export each span once")
+	g.Expect(spans[0].Name).To(Equal("UserService.GetUser"))
+	g.Expect(spans[0].SpanContext.TraceID).To(Equal(root.SpanContext().TraceID), "should keep the trace of the parent")
+	g.Expect(spans[0].Parent).To(Equal(root.SpanContext().SpanID), "should be a child of the span of the context")
+	g.Expect(spans[0].Attributes).To(Equal([]Attribute{String("user.id", "1")}), "should keep the attributes")
+	g.Expect(spans[0].Status).To(Equal(StatusError), "should record the error")
+	g.Expect(spans[0].StatusMessage).To(Equal(ERROR.Error()))
+	g.Expect(spans[1].Parent.IsValid()).To(BeFalse(), "should start a trace without a parent")
+	g.Expect(spans[1].End).ToNot(BeTemporally("<", spans[1].Start), "should record the end")
+
+	g.Expect(TraceParent(ctx)).To(Equal(child.SpanContext().TraceParent()), "should propagate the current span")
+}
+
+func Test_Start_RemoteParent(t *testing.T) {
+	g := NewWithT(t)
+
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	exporter := &recorder{}
+	tracer := NewTracer(exporter, DefaultConfig())
+
+	ctx := WithRemoteParent(context.Background(), parent)
+
+	_, span := Start(ctx, "untraced", KindInternal)
+	g.Expect(span.SpanContext().IsValid()).To(BeFalse(), "should not record spans without a tracer")
+	g.Expect(TraceParent(ctx)).To(Equal(parent.TraceParent()), "should still propagate the remote parent")
+
+	_, span = Start(WithTracer(ctx, tracer), "GET /users", KindServer)
+	span.End()
+
+	g.Expect(span.SpanContext().TraceID).To(Equal(parent.TraceID), "should continue the remote trace")
+	g.Expect(span.SpanContext().Sampled).To(BeFalse(), "should follow the sampling of the remote parent")
+
+	g.Expect(tracer.Flush(context.Background())).To(Succeed())
+	g.Expect(exporter.Spans()).To(BeEmpty(), "should not export the spans not sampled")
+}
+
+func Test_Tracer_Run(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := &recorder{}
+	tracer := NewTracer(exporter, Config{Interval: time.Hour, BatchSize: 2, QueueSize: 3, ExportTimeout: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go tracer.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		_, span := tracer.Start(context.Background(), "span", KindInternal)
+		span.End()
+	}
+
+	g.Eventually(exporter.Spans).Should(HaveLen(2), "should export as soon as a batch is full")
+}
+
+func Test_Tracer_Flush(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := &recorder{err: ERROR}
+	tracer := NewTracer(exporter, Config{Interval: time.Hour, BatchSize: 2, QueueSize: 3, ExportTimeout: time.Second})
+
+	for i := 0; i < 4; i++ {
+		_, span := tracer.Start(context.Background(), "span", KindInternal)
+		span.End()
+	}
+
+	g.Expect(tracer.Dropped()).To(Equal(uint64(1)), "should drop the spans past the queue size")
+	g.Expect(tracer.Flush(context.Background())).To(MatchError(ERROR), "should return the export error")
+	g.Expect(tracer.Dropped()).To(Equal(uint64(3)), "should drop the spans failing to be exported")
+}
@@ -0,0 +1,198 @@
+package commands
+
+//go:generate mockgen -source=commands.go -destination=mock/commands_mock.go
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// The commands an upstream system sends to change the users.
+const (
+	TypeUpsert = "upsert"
+	TypeDelete = "delete"
+)
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+type UserService interface {
+	CreateUser(ctx context.Context, params services.CreateUserParams) (models.User, error)
+	UpdateUser(ctx context.Context, params services.UpdateUserParams) (models.User, error)
+	DeleteUser(ctx context.Context, params services.DeleteUserParams) (models.User, error)
+	ListUsers(ctx context.Context, q query.Query) (query.Page, error)
+}
+
+// Command is the JSON message of a change. The version follows the store: an
+// upsert with version 0 creates the user, under its id when set, any other
+// version must be the current version of the user.
+type Command struct {
+	Type      string `json:"type"`
+	ID        int    `json:"id"`
+	Version   uint32 `json:"version"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Nickname  string `json:"nickname"`
+	Password  string `json:"password"`
+	Email     string `json:"email"`
+	Country   string `json:"country"`
+}
+
+func Decode(value []byte) (Command, error) {
+	var command Command
+
+	if err := json.Unmarshal(value, &command); err != nil {
+		return Command{}, fmt.Errorf("%w: %s", ErrInvalidCommand, err)
+	}
+
+	return command, nil
+}
+
+// Handler applies the commands through the user service, so they are
+// validated and announced like the changes made through the API.
+type Handler struct {
+	service UserService
+}
+
+func NewHandler(service UserService) Handler {
+	return Handler{
+		service: service,
+	}
+}
+
+// Handle decodes and applies the command held by the value.
+func (h Handler) Handle(ctx context.Context, value []byte) error {
+	command, err := Decode(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.Apply(ctx, command)
+
+	return err
+}
+
+func (h Handler) Apply(ctx context.Context, command Command) (models.User, error) {
+	switch command.Type {
+	case TypeUpsert:
+		if command.Version == 0 {
+			return h.create(ctx, command)
+		}
+
+		return h.update(ctx, command)
+	case TypeDelete:
+		return h.delete(ctx, command)
+	}
+
+	return models.User{}, fmt.Errorf("%w: unknown type %q", ErrInvalidCommand, command.Type)
+}
+
+// create adds a new user, under the id of the upstream system when given or
+// one assigned by the store otherwise. A user already created under the
+// given id, or erased since, is a command delivered again and is skipped.
+func (h Handler) create(ctx context.Context, command Command) (models.User, error) {
+	user, err := h.service.CreateUser(ctx, services.CreateUserParams{
+		ID:        command.ID,
+		FirstName: command.FirstName,
+		LastName:  command.LastName,
+		Nickname:  command.Nickname,
+		Password:  command.Password,
+		Email:     command.Email,
+		Country:   command.Country,
+	})
+	if command.ID != 0 && (errors.Is(err, services.ErrUserExists) || errors.Is(err, services.ErrUserErased)) {
+		return models.User{}, nil
+	}
+
+	return user, err
+}
+
+// update changes the fields which are set, like a PUT to the API.
+func (h Handler) update(ctx context.Context, command Command) (models.User, error) {
+	if command.ID == 0 {
+		return models.User{}, fmt.Errorf("%w: missing id", ErrInvalidCommand)
+	}
+
+	user, err := h.service.UpdateUser(ctx, services.UpdateUserParams{
+		ID:        command.ID,
+		FirstName: command.FirstName,
+		LastName:  command.LastName,
+		Nickname:  command.Nickname,
+		Password:  command.Password,
+		Email:     command.Email,
+		Country:   command.Country,
+		Version:   command.Version,
+	})
+	if errors.Is(err, services.ErrWrongVersion) || errors.Is(err, services.ErrUserNotFound) {
+		return h.redelivered(ctx, command, err)
+	}
+
+	return user, err
+}
+
+// delete deactivates the user. The version is checked by the store, in the
+// transaction of the deletion. Without a version the user is deleted
+// whatever its current version.
+func (h Handler) delete(ctx context.Context, command Command) (models.User, error) {
+	if command.ID == 0 {
+		return models.User{}, fmt.Errorf("%w: missing id", ErrInvalidCommand)
+	}
+
+	user, err := h.service.DeleteUser(ctx, services.DeleteUserParams{ID: command.ID, Version: command.Version})
+	if errors.Is(err, services.ErrWrongVersion) || errors.Is(err, services.ErrUserNotFound) {
+		return h.redelivered(ctx, command, err)
+	}
+
+	return user, err
+}
+
+// redelivered tells a command delivered again once applied, which is skipped,
+// from one which failed with err: the user is past the version of the
+// command, or already deleted for a deletion. Deleted users being hidden from
+// the other reads, the user is listed along with them.
+func (h Handler) redelivered(ctx context.Context, command Command, err error) (models.User, error) {
+	page, listErr := h.service.ListUsers(ctx, query.Query{
+		Filter:          query.Equal("id", strconv.Itoa(command.ID)),
+		Sort:            query.Sort{Field: "id"},
+		Limit:           1,
+		IncludeDisabled: true,
+	})
+	if listErr != nil {
+		return models.User{}, fmt.Errorf("%w failed to get user", listErr)
+	}
+
+	if len(page.Users) == 0 {
+		return models.User{}, err
+	}
+
+	user := page.Users[0]
+	if command.Version != 0 && user.Meta.GetVersion() > command.Version {
+		return models.User{}, nil
+	}
+	if command.Type == TypeDelete && user.Meta.GetDisabled() {
+		return models.User{}, nil
+	}
+
+	return models.User{}, err
+}
+
+// IsPermanent tells whether applying the command again would fail the same
+// way, in which case it is dead-lettered instead of retried.
+func IsPermanent(err error) bool {
+	switch {
+	case errors.Is(err, ErrInvalidCommand),
+		errors.Is(err, services.ErrWrongVersion),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, postgresql.ErrUserNotFound),
+		errors.Is(err, postgresql.ErrUniqueViolation):
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,227 @@
+//+build unit
+
+package commands_test
+
+import (
+	"code/tech-test/domain/users/commands"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mock_commands "code/tech-test/domain/users/commands/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func Test_Handler_Handle(t *testing.T) {
+
+	at := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(3, at, at, false)
+
+	deleted := models.NewUser(7, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+	deleted.Meta.HydrateMeta(3, at, at, true)
+
+	transient := errors.New("connection refused")
+
+	lookup := query.Query{
+		Filter:          query.Equal("id", "7"),
+		Sort:            query.Sort{Field: "id"},
+		Limit:           1,
+		IncludeDisabled: true,
+	}
+
+	testCases := []struct {
+		description string
+		value       string
+		setup       func(ctx context.Context, service *mock_commands.MockUserService)
+		expectedErr error
+	}{
+		{
+			description: "when an upsert has no version",
+			value:       `{"type":"upsert","first_name":"Test","last_name":"Test","nickname":"testuser","password":"qwerty","email":"example@example.qqq","country":"uk"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().CreateUser(ctx, services.CreateUserParams{
+					FirstName: "Test",
+					LastName:  "Test",
+					Nickname:  "testuser",
+					Password:  "qwerty",
+					Email:     "example@example.qqq",
+					Country:   "uk",
+				}).Return(user, nil)
+			},
+		},
+		{
+			description: "when an upsert has a version",
+			value:       `{"type":"upsert","id":7,"version":3,"email":"other@example.qqq"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().UpdateUser(ctx, services.UpdateUserParams{
+					ID:      7,
+					Email:   "other@example.qqq",
+					Version: 3,
+				}).Return(user, nil)
+			},
+		},
+		{
+			description: "when a new user has an id",
+			value:       `{"type":"upsert","id":7,"nickname":"testuser"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().CreateUser(ctx, services.CreateUserParams{ID: 7, Nickname: "testuser"}).Return(user, nil)
+			},
+		},
+		{
+			description: "when a new user with an id was already created",
+			value:       `{"type":"upsert","id":7,"nickname":"testuser"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().CreateUser(ctx, services.CreateUserParams{ID: 7, Nickname: "testuser"}).Return(models.User{}, services.ErrUserExists)
+			},
+		},
+		{
+			description: "when a new user with an id was already created and erased",
+			value:       `{"type":"upsert","id":7,"nickname":"testuser"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().CreateUser(ctx, services.CreateUserParams{ID: 7, Nickname: "testuser"}).Return(models.User{}, services.ErrUserErased)
+			},
+		},
+		{
+			description: "when an update has no id",
+			value:       `{"type":"upsert","version":3,"nickname":"testuser"}`,
+			setup:       func(ctx context.Context, service *mock_commands.MockUserService) {},
+			expectedErr: commands.ErrInvalidCommand,
+		},
+		{
+			description: "when a delete has no version",
+			value:       `{"type":"delete","id":7}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7}).Return(user, nil)
+			},
+		},
+		{
+			description: "when a delete has the current version",
+			value:       `{"type":"delete","id":7,"version":3}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7, Version: 3}).Return(user, nil)
+			},
+		},
+		{
+			description: "when a delete has a version the user is not at yet",
+			value:       `{"type":"delete","id":7,"version":4}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7, Version: 4}).Return(models.User{}, services.ErrWrongVersion)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{user}}, nil)
+			},
+			expectedErr: services.ErrWrongVersion,
+		},
+		{
+			description: "when a delete has a version the user is past",
+			value:       `{"type":"delete","id":7,"version":2}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7, Version: 2}).Return(models.User{}, services.ErrWrongVersion)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{user}}, nil)
+			},
+		},
+		{
+			description: "when a delete is delivered again",
+			value:       `{"type":"delete","id":7}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7}).Return(models.User{}, services.ErrUserNotFound)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{deleted}}, nil)
+			},
+		},
+		{
+			description: "when a delete targets an unknown user",
+			value:       `{"type":"delete","id":7}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7}).Return(models.User{}, services.ErrUserNotFound)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{}}, nil)
+			},
+			expectedErr: services.ErrUserNotFound,
+		},
+		{
+			description: "when an update is delivered again",
+			value:       `{"type":"upsert","id":7,"version":2,"email":"other@example.qqq"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().UpdateUser(ctx, services.UpdateUserParams{
+					ID:      7,
+					Email:   "other@example.qqq",
+					Version: 2,
+				}).Return(models.User{}, services.ErrWrongVersion)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{user}}, nil)
+			},
+		},
+		{
+			description: "when an update targets a user deleted at its version",
+			value:       `{"type":"upsert","id":7,"version":3,"email":"other@example.qqq"}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().UpdateUser(ctx, services.UpdateUserParams{
+					ID:      7,
+					Email:   "other@example.qqq",
+					Version: 3,
+				}).Return(models.User{}, services.ErrUserNotFound)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{Users: []models.User{deleted}}, nil)
+			},
+			expectedErr: services.ErrUserNotFound,
+		},
+		{
+			description: "when the user of a failed command cannot be read",
+			value:       `{"type":"delete","id":7}`,
+			setup: func(ctx context.Context, service *mock_commands.MockUserService) {
+				service.EXPECT().DeleteUser(ctx, services.DeleteUserParams{ID: 7}).Return(models.User{}, services.ErrUserNotFound)
+				service.EXPECT().ListUsers(ctx, lookup).Return(query.Page{}, transient)
+			},
+			expectedErr: transient,
+		},
+		{
+			description: "when the type is unknown",
+			value:       `{"type":"merge","id":7}`,
+			setup:       func(ctx context.Context, service *mock_commands.MockUserService) {},
+			expectedErr: commands.ErrInvalidCommand,
+		},
+		{
+			description: "when the value is not json",
+			value:       `upsert`,
+			setup:       func(ctx context.Context, service *mock_commands.MockUserService) {},
+			expectedErr: commands.ErrInvalidCommand,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			service := mock_commands.NewMockUserService(mockCtrl)
+			tc.setup(ctx, service)
+
+			err := commands.NewHandler(service).Handle(ctx, []byte(tc.value))
+
+			if tc.expectedErr != nil {
+				g.Expect(errors.Is(err, tc.expectedErr)).To(BeTrue(), fmt.Sprintf("should fail with %v, got %v", tc.expectedErr, err))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should apply the command")
+			}
+		})
+	}
+}
+
+func Test_IsPermanent(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(commands.IsPermanent(fmt.Errorf("%w: unknown type", commands.ErrInvalidCommand))).To(BeTrue(), "should not retry invalid commands")
+	g.Expect(commands.IsPermanent(services.ErrWrongVersion)).To(BeTrue(), "should not retry a wrong version")
+	g.Expect(commands.IsPermanent(services.ErrUserNotFound)).To(BeTrue(), "should not retry a missing user")
+	g.Expect(commands.IsPermanent(fmt.Errorf("%w failed to delete user", postgresql.ErrUserNotFound))).To(BeTrue(), "should not retry a missing user")
+	g.Expect(commands.IsPermanent(fmt.Errorf("%w failed to store user", postgresql.ErrUniqueViolation))).To(BeTrue(), "should not retry a duplicate user")
+	g.Expect(commands.IsPermanent(fmt.Errorf("%w failed to store user", errors.New("connection refused")))).To(BeFalse(), "should retry other failures")
+}
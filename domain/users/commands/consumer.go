@@ -0,0 +1,186 @@
+package commands
+
+//go:generate mockgen -source=consumer.go -destination=mock/consumer_mock.go
+
+import (
+	"code/tech-test/domain"
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a command read from the source, with where it was read from.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+}
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+func (m Message) String() string {
+	return fmt.Sprintf("%s[%d]@%d", m.Topic, m.Partition, m.Offset)
+}
+
+type Source interface {
+	// Next blocks until a message is read or the context is done.
+	Next(ctx context.Context) (Message, error)
+	// Commit marks the message and the ones before it as consumed.
+	Commit(ctx context.Context, message Message) error
+	// Rewind makes Next return the message again.
+	Rewind(message Message) error
+}
+
+// DeadLetters keeps the messages which cannot be applied, along with the
+// reason, for someone to look into them.
+type DeadLetters interface {
+	Send(ctx context.Context, message Message, reason error) error
+}
+
+type CommandHandler interface {
+	Handle(ctx context.Context, value []byte) error
+}
+
+type ConsumerConfig struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		MinBackoff: time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// ConsumerStats counts the messages processed since the consumer started.
+type ConsumerStats struct {
+	Applied      uint64
+	DeadLettered uint64
+	Retried      uint64
+}
+
+type Consumer struct {
+	// outcomes of the processed messages, read by Stats while Run goes on
+	applied      uint64
+	deadLettered uint64
+	retried      uint64
+
+	source      Source
+	handler     CommandHandler
+	deadLetters DeadLetters
+	config      ConsumerConfig
+}
+
+func NewConsumer(source Source, handler CommandHandler, deadLetters DeadLetters, config ConsumerConfig) *Consumer {
+	return &Consumer{
+		source:      source,
+		handler:     handler,
+		deadLetters: deadLetters,
+		config:      config,
+	}
+}
+
+// Run applies the commands until the context is cancelled or the source
+// fails. A message failing for a transient reason, such as the database being
+// down, is read again after a backoff, which holds back the following ones.
+func (c *Consumer) Run(ctx context.Context) error {
+	failures := 0
+
+	for {
+		message, err := c.source.Next(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w failed to read command", err)
+		}
+
+		if err := c.Process(ctx, message); err != nil {
+			log.Printf("failed to process %s: %s", message, err)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(c.backoff(failures)):
+			}
+
+			failures++
+			continue
+		}
+
+		failures = 0
+	}
+}
+
+// Process applies the message and commits its offset. A message which cannot
+// be applied is sent to the dead letters before being committed, one failing
+// for a transient reason is rewound without committing.
+func (c *Consumer) Process(ctx context.Context, message Message) error {
+	// the changes are recorded as made by the consumer, for the message
+	changes := domain.WithRequestID(domain.WithActor(ctx, "consumer:"+message.Topic), message.String())
+
+	err := c.handler.Handle(changes, message.Value)
+	switch {
+	case err == nil:
+		atomic.AddUint64(&c.applied, 1)
+	case IsPermanent(err):
+		if err := c.deadLetters.Send(ctx, message, err); err != nil {
+			return c.retry(message, fmt.Errorf("%w failed to dead-letter %s", err, message))
+		}
+
+		log.Printf("dead-lettered %s: %s", message, err)
+		atomic.AddUint64(&c.deadLettered, 1)
+	default:
+		return c.retry(message, err)
+	}
+
+	if err := c.source.Commit(ctx, message); err != nil {
+		// the commit of a later message covers this one, unless the consumer
+		// stops before and the message is applied again on the next start
+		return fmt.Errorf("%w failed to commit %s", err, message)
+	}
+
+	return nil
+}
+
+func (c *Consumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Applied:      atomic.LoadUint64(&c.applied),
+		DeadLettered: atomic.LoadUint64(&c.deadLettered),
+		Retried:      atomic.LoadUint64(&c.retried),
+	}
+}
+
+func (c *Consumer) retry(message Message, err error) error {
+	atomic.AddUint64(&c.retried, 1)
+
+	if rewindErr := c.source.Rewind(message); rewindErr != nil {
+		return fmt.Errorf("%w failed to rewind %s after: %s", rewindErr, message, err)
+	}
+
+	return err
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff.
+func (c *Consumer) backoff(failures int) time.Duration {
+	delay := c.config.MinBackoff
+
+	for i := 0; i < failures && delay < c.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > c.config.MaxBackoff {
+		return c.config.MaxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,178 @@
+//+build unit
+
+package commands_test
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/commands"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/services"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mock_commands "code/tech-test/domain/users/commands/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func Test_Consumer_Process(t *testing.T) {
+
+	message := commands.Message{Topic: "users-commands", Partition: 1, Offset: 42, Key: []byte("7"), Value: []byte(`{"type":"delete","id":7}`)}
+	transient := errors.New("connection refused")
+
+	testCases := []struct {
+		description string
+		setup       func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters)
+		expectedErr bool
+		expected    commands.ConsumerStats
+	}{
+		{
+			description: "when the command is applied",
+			setup: func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters) {
+				handler.EXPECT().Handle(gomock.Any(), message.Value).DoAndReturn(func(ctx context.Context, value []byte) error {
+					NewWithT(t).Expect(domain.ActorFrom(ctx)).To(Equal("consumer:users-commands"), "should record the consumer as actor")
+					NewWithT(t).Expect(domain.RequestIDFrom(ctx)).To(Equal("users-commands[1]@42"), "should record the message as request")
+					return nil
+				})
+				source.EXPECT().Commit(ctx, message).Return(nil)
+			},
+			expected: commands.ConsumerStats{Applied: 1},
+		},
+		{
+			description: "when the command cannot be applied",
+			setup: func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters) {
+				reason := fmt.Errorf("%w: missing id", commands.ErrInvalidCommand)
+				handler.EXPECT().Handle(gomock.Any(), message.Value).Return(reason)
+				deadLetters.EXPECT().Send(ctx, message, reason).Return(nil)
+				source.EXPECT().Commit(ctx, message).Return(nil)
+			},
+			expected: commands.ConsumerStats{DeadLettered: 1},
+		},
+		{
+			description: "when the command fails for a transient reason",
+			setup: func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters) {
+				handler.EXPECT().Handle(gomock.Any(), message.Value).Return(transient)
+				source.EXPECT().Rewind(message).Return(nil)
+			},
+			expectedErr: true,
+			expected:    commands.ConsumerStats{Retried: 1},
+		},
+		{
+			description: "when the dead letter cannot be sent",
+			setup: func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters) {
+				handler.EXPECT().Handle(gomock.Any(), message.Value).Return(commands.ErrInvalidCommand)
+				deadLetters.EXPECT().Send(ctx, message, commands.ErrInvalidCommand).Return(transient)
+				source.EXPECT().Rewind(message).Return(nil)
+			},
+			expectedErr: true,
+			expected:    commands.ConsumerStats{Retried: 1},
+		},
+		{
+			description: "when the offset cannot be committed",
+			setup: func(ctx context.Context, source *mock_commands.MockSource, handler *mock_commands.MockCommandHandler, deadLetters *mock_commands.MockDeadLetters) {
+				handler.EXPECT().Handle(gomock.Any(), message.Value).Return(nil)
+				source.EXPECT().Commit(ctx, message).Return(transient)
+			},
+			expectedErr: true,
+			expected:    commands.ConsumerStats{Applied: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			source := mock_commands.NewMockSource(mockCtrl)
+			handler := mock_commands.NewMockCommandHandler(mockCtrl)
+			deadLetters := mock_commands.NewMockDeadLetters(mockCtrl)
+			tc.setup(ctx, source, handler, deadLetters)
+
+			consumer := commands.NewConsumer(source, handler, deadLetters, commands.DefaultConsumerConfig())
+
+			err := consumer.Process(ctx, message)
+
+			if tc.expectedErr {
+				g.Expect(err).To(HaveOccurred(), "should fail")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should process the message")
+			}
+			g.Expect(consumer.Stats()).To(Equal(tc.expected), "should count the message")
+		})
+	}
+}
+
+func Test_Consumer_Process_Redelivered(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	source := mock_commands.NewMockSource(mockCtrl)
+	service := mock_commands.NewMockUserService(mockCtrl)
+	deadLetters := mock_commands.NewMockDeadLetters(mockCtrl)
+
+	at := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+	deleted := models.NewUser(7, "Test", "Test", "testuser", "hash", "example@example.qqq", "uk")
+	deleted.Meta.HydrateMeta(4, at, at, true)
+
+	update := commands.Message{Topic: "users-commands", Offset: 1, Value: []byte(`{"type":"upsert","id":7,"version":2,"email":"other@example.qqq"}`)}
+	remove := commands.Message{Topic: "users-commands", Offset: 2, Value: []byte(`{"type":"delete","id":7,"version":3}`)}
+
+	// both commands were applied before the consumer stopped without
+	// committing them, so the user is already deleted past their versions
+	service.EXPECT().UpdateUser(gomock.Any(), services.UpdateUserParams{ID: 7, Email: "other@example.qqq", Version: 2}).Return(models.User{}, services.ErrWrongVersion)
+	service.EXPECT().DeleteUser(gomock.Any(), services.DeleteUserParams{ID: 7, Version: 3}).Return(models.User{}, services.ErrUserNotFound)
+	service.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(query.Page{Users: []models.User{deleted}}, nil).Times(2)
+	source.EXPECT().Commit(ctx, update).Return(nil)
+	source.EXPECT().Commit(ctx, remove).Return(nil)
+
+	consumer := commands.NewConsumer(source, commands.NewHandler(service), deadLetters, commands.DefaultConsumerConfig())
+
+	g.Expect(consumer.Process(ctx, update)).To(Succeed(), "should skip the update delivered again")
+	g.Expect(consumer.Process(ctx, remove)).To(Succeed(), "should skip the delete delivered again")
+	g.Expect(consumer.Stats()).To(Equal(commands.ConsumerStats{Applied: 2}), "should not dead-letter the commands delivered again")
+}
+
+func Test_Consumer_Run(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	source := mock_commands.NewMockSource(mockCtrl)
+	handler := mock_commands.NewMockCommandHandler(mockCtrl)
+	deadLetters := mock_commands.NewMockDeadLetters(mockCtrl)
+
+	message := commands.Message{Topic: "users-commands", Offset: 1, Value: []byte(`{"type":"delete","id":7}`)}
+
+	gomock.InOrder(
+		source.EXPECT().Next(gomock.Any()).Return(message, nil),
+		handler.EXPECT().Handle(gomock.Any(), message.Value).Return(errors.New("connection refused")),
+		source.EXPECT().Rewind(message).Return(nil),
+		source.EXPECT().Next(gomock.Any()).Return(message, nil),
+		handler.EXPECT().Handle(gomock.Any(), message.Value).Return(nil),
+		source.EXPECT().Commit(gomock.Any(), message).Return(nil),
+		source.EXPECT().Next(gomock.Any()).DoAndReturn(func(ctx context.Context) (commands.Message, error) {
+			cancel()
+			return commands.Message{}, ctx.Err()
+		}),
+	)
+
+	consumer := commands.NewConsumer(source, handler, deadLetters, commands.ConsumerConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	g.Expect(consumer.Run(ctx)).To(Succeed(), "should stop when the context is cancelled")
+	g.Expect(consumer.Stats()).To(Equal(commands.ConsumerStats{Applied: 1, Retried: 1}), "should apply the message once retried")
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Erasure is the proof that the data of a user was erased on request. It
+// holds none of that data, only which fields were erased, how many history
+// entries were anonymized, and who asked for it.
+type Erasure struct {
+	UserID         int
+	Version        uint32
+	Fields         []string
+	HistoryEntries int
+	Actor          string
+	RequestID      string
+	At             time.Time
+}
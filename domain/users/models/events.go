@@ -0,0 +1,137 @@
+package models
+
+import "time"
+
+const (
+	EventUserCreated      = "UserCreated"
+	EventFirstNameChanged = "FirstNameChanged"
+	EventLastNameChanged  = "LastNameChanged"
+	EventNicknameChanged  = "NicknameChanged"
+	EventEmailChanged     = "EmailChanged"
+	EventPasswordChanged  = "PasswordChanged"
+	EventCountryChanged   = "CountryChanged"
+	EventRoleAssigned     = "RoleAssigned"
+	EventRoleRevoked      = "RoleRevoked"
+	EventUserDeactivated  = "UserDeactivated"
+	EventUserRestored     = "UserRestored"
+	EventUserSnapshot     = "UserSnapshot"
+	EventUserErased       = "UserErased"
+)
+
+// The events are recorded on the user by its setters and written to the
+// outbox when the user is stored, they carry the values before and after the
+// change. The user id is the one of the stored user, as a new user has none
+// until then.
+
+type UserCreated struct {
+	At time.Time
+}
+
+func (e UserCreated) EventType() string     { return EventUserCreated }
+func (e UserCreated) OccurredAt() time.Time { return e.At }
+
+type FirstNameChanged struct {
+	Old string
+	New string
+	At  time.Time
+}
+
+func (e FirstNameChanged) EventType() string     { return EventFirstNameChanged }
+func (e FirstNameChanged) OccurredAt() time.Time { return e.At }
+
+type LastNameChanged struct {
+	Old string
+	New string
+	At  time.Time
+}
+
+func (e LastNameChanged) EventType() string     { return EventLastNameChanged }
+func (e LastNameChanged) OccurredAt() time.Time { return e.At }
+
+type NicknameChanged struct {
+	Old string
+	New string
+	At  time.Time
+}
+
+func (e NicknameChanged) EventType() string     { return EventNicknameChanged }
+func (e NicknameChanged) OccurredAt() time.Time { return e.At }
+
+type EmailChanged struct {
+	Old string
+	New string
+	At  time.Time
+}
+
+func (e EmailChanged) EventType() string     { return EventEmailChanged }
+func (e EmailChanged) OccurredAt() time.Time { return e.At }
+
+// PasswordChanged carries no values, hashes never leave the service.
+type PasswordChanged struct {
+	At time.Time
+}
+
+func (e PasswordChanged) EventType() string     { return EventPasswordChanged }
+func (e PasswordChanged) OccurredAt() time.Time { return e.At }
+
+type CountryChanged struct {
+	Old string
+	New string
+	At  time.Time
+}
+
+func (e CountryChanged) EventType() string     { return EventCountryChanged }
+func (e CountryChanged) OccurredAt() time.Time { return e.At }
+
+type RoleAssigned struct {
+	Role string
+	At   time.Time
+}
+
+func (e RoleAssigned) EventType() string     { return EventRoleAssigned }
+func (e RoleAssigned) OccurredAt() time.Time { return e.At }
+
+type RoleRevoked struct {
+	Role string
+	At   time.Time
+}
+
+func (e RoleRevoked) EventType() string     { return EventRoleRevoked }
+func (e RoleRevoked) OccurredAt() time.Time { return e.At }
+
+type UserDeactivated struct {
+	At time.Time
+}
+
+func (e UserDeactivated) EventType() string     { return EventUserDeactivated }
+func (e UserDeactivated) OccurredAt() time.Time { return e.At }
+
+// UserRestored is recorded when a deleted user is brought back.
+type UserRestored struct {
+	At time.Time
+}
+
+func (e UserRestored) EventType() string     { return EventUserRestored }
+func (e UserRestored) OccurredAt() time.Time { return e.At }
+
+// UserErased is recorded when the data of the user is removed for good,
+// unlike UserDeactivated which only hides the user.
+type UserErased struct {
+	At time.Time
+}
+
+func (e UserErased) EventType() string     { return EventUserErased }
+func (e UserErased) OccurredAt() time.Time { return e.At }
+
+// UserSnapshot is not a change but the state of the user, republished for
+// the consumers which missed the events that led to it.
+type UserSnapshot struct {
+	At time.Time
+}
+
+func (e UserSnapshot) EventType() string     { return EventUserSnapshot }
+func (e UserSnapshot) OccurredAt() time.Time { return e.At }
+
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"code/tech-test/domain"
+	"time"
+)
+
+// The fields named in the history, as in the API.
+const (
+	FieldFirstName = "first_name"
+	FieldLastName  = "last_name"
+	FieldNickname  = "nickname"
+	FieldPassword  = "password"
+	FieldEmail     = "email"
+	FieldCountry   = "country"
+	FieldRoles     = "roles"
+	FieldActive    = "active"
+)
+
+// HistoryEntry is a version of a user, with what changed from the previous
+// one, who changed it and for which request. The entries are written along
+// with the changes and never updated.
+type HistoryEntry struct {
+	// User is the user as of the version, without the password.
+	User      User
+	Changes   []string
+	Actor     string
+	RequestID string
+	At        time.Time
+}
+
+func NewHistoryEntry(user User, events []domain.Event, actor, requestID string) HistoryEntry {
+	snapshot := NewUser(user.ID, user.FirstName, user.LastName, user.Nickname, "", user.Email, user.Country)
+	snapshot.Roles = append([]string(nil), user.Roles...)
+	snapshot.Meta.HydrateMeta(user.Meta.GetVersion(), user.Meta.GetCreatedAt(), user.Meta.GetUpdatedAt(), user.Meta.GetDisabled())
+
+	return HistoryEntry{
+		User:      snapshot,
+		Changes:   ChangedFields(events),
+		Actor:     actor,
+		RequestID: requestID,
+		At:        user.Meta.GetUpdatedAt(),
+	}
+}
+
+func (e HistoryEntry) Version() uint32 {
+	return e.User.Meta.GetVersion()
+}
+
+// ChangedFields names the fields changed by the events, once each and in the
+// order they changed. Creating a user sets every field and erasing it
+// clears them.
+func ChangedFields(events []domain.Event) []string {
+	var (
+		fields = make([]string, 0, len(events))
+		seen   = make(map[string]bool)
+	)
+
+	add := func(names ...string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+
+	for _, event := range events {
+		switch event.(type) {
+		case UserCreated:
+			add(FieldFirstName, FieldLastName, FieldNickname, FieldPassword, FieldEmail, FieldCountry)
+		case FirstNameChanged:
+			add(FieldFirstName)
+		case LastNameChanged:
+			add(FieldLastName)
+		case NicknameChanged:
+			add(FieldNickname)
+		case PasswordChanged:
+			add(FieldPassword)
+		case EmailChanged:
+			add(FieldEmail)
+		case CountryChanged:
+			add(FieldCountry)
+		case RoleAssigned, RoleRevoked:
+			add(FieldRoles)
+		case UserDeactivated, UserRestored:
+			add(FieldActive)
+		case UserErased:
+			add(FieldFirstName, FieldLastName, FieldNickname, FieldPassword, FieldEmail, FieldCountry, FieldRoles, FieldActive)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"code/tech-test/domain"
+	"errors"
+	"regexp"
+	"sort"
+)
+
+// PermissionAdmin grants every permission.
+const PermissionAdmin = "admin"
+
+var ErrInvalidRole = errors.New("invalid role")
+
+var (
+	roleName   = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	permission = regexp.MustCompile(`^[a-z][a-z0-9_-]*(:[a-z][a-z0-9_-]*)*$`)
+)
+
+// Role is a named set of permissions assigned to users. Permissions are
+// granted to the tokens of the users as scopes, e.g. `users:read`.
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+	Meta        domain.Meta
+}
+
+func NewRole(name, description string, permissions []string) Role {
+	return Role{
+		Name:        name,
+		Description: description,
+		Permissions: normalize(permissions),
+		Meta:        domain.NewMeta(),
+	}
+}
+
+func (r *Role) SetDescription(description string) {
+	r.Description = description
+}
+
+func (r *Role) SetPermissions(permissions []string) {
+	r.Permissions = normalize(permissions)
+}
+
+func (r Role) HasPermission(p string) bool {
+	for _, granted := range r.Permissions {
+		if granted == p || granted == PermissionAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Role) Validate() error {
+	if !roleName.MatchString(r.Name) {
+		return ErrInvalidRole
+	}
+
+	for _, p := range r.Permissions {
+		if !permission.MatchString(p) {
+			return ErrInvalidRole
+		}
+	}
+
+	return nil
+}
+
+// normalize sorts the names and drops duplicates so sets compare equal.
+func normalize(names []string) []string {
+	var result []string = make([]string, 0, len(names))
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	for i, name := range sorted {
+		if i > 0 && sorted[i-1] == name {
+			continue
+		}
+		result = append(result, name)
+	}
+
+	return result
+}
@@ -10,6 +10,7 @@ type User struct {
 	Password  string
 	Email     string
 	Country   string
+	Roles     []string
 	Meta      domain.Meta
 }
 
@@ -26,40 +27,123 @@ func NewUser(id int, fn, ln, nickname, pw, email, country string) User {
 	}
 }
 
+// CreateUser builds a new user, recording its creation.
+func CreateUser(fn, ln, nickname, pw, email, country string) User {
+	user := NewUser(0, fn, ln, nickname, pw, email, country)
+
+	user.Meta.RegisterChanges(UserCreated{At: now()})
+
+	return user
+}
+
+// The setters only record a change when the value differs.
+
 func (u *User) SetFirstName(fn string) {
-	u.FirstName = fn
+	if u.FirstName == fn {
+		return
+	}
+
+	u.Meta.RegisterChanges(FirstNameChanged{Old: u.FirstName, New: fn, At: now()})
 
-	u.Meta.RegisterChanges(struct{}{})
+	u.FirstName = fn
 }
 
 func (u *User) SetLastName(ln string) {
-	u.LastName = ln
+	if u.LastName == ln {
+		return
+	}
+
+	u.Meta.RegisterChanges(LastNameChanged{Old: u.LastName, New: ln, At: now()})
 
-	u.Meta.RegisterChanges(struct{}{})
+	u.LastName = ln
 }
 
 func (u *User) SetNickname(nickname string) {
-	u.Nickname = nickname
+	if u.Nickname == nickname {
+		return
+	}
 
-	u.Meta.RegisterChanges(struct{}{})
+	u.Meta.RegisterChanges(NicknameChanged{Old: u.Nickname, New: nickname, At: now()})
+
+	u.Nickname = nickname
 }
 
 func (u *User) SetPassword(pw string) {
+	if u.Password == pw {
+		return
+	}
+
+	u.Meta.RegisterChanges(PasswordChanged{At: now()})
+
 	u.Password = pw
+}
 
-	u.Meta.RegisterChanges(struct{}{})
+// RehashPassword replaces the hash of the same password, which is not a
+// change anyone downstream cares about.
+func (u *User) RehashPassword(pw string) {
+	u.Password = pw
 }
 
 func (u *User) SetEmail(email string) {
-	u.Email = email
+	if u.Email == email {
+		return
+	}
 
-	u.Meta.RegisterChanges(struct{}{})
+	u.Meta.RegisterChanges(EmailChanged{Old: u.Email, New: email, At: now()})
+
+	u.Email = email
 }
 
 func (u *User) SetCountry(country string) {
+	if u.Country == country {
+		return
+	}
+
+	u.Meta.RegisterChanges(CountryChanged{Old: u.Country, New: country, At: now()})
+
 	u.Country = country
+}
+
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssignRole adds the role, reporting false when it was already assigned.
+func (u *User) AssignRole(role string) bool {
+	if u.HasRole(role) {
+		return false
+	}
 
-	u.Meta.RegisterChanges(struct{}{})
+	u.Roles = normalize(append(u.Roles, role))
+
+	u.Meta.RegisterChanges(RoleAssigned{Role: role, At: now()})
+
+	return true
+}
+
+// RevokeRole removes the role, reporting false when it was not assigned.
+func (u *User) RevokeRole(role string) bool {
+	if !u.HasRole(role) {
+		return false
+	}
+
+	var roles []string = make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	u.Roles = roles
+
+	u.Meta.RegisterChanges(RoleRevoked{Role: role, At: now()})
+
+	return true
 }
 
 func (u User) IsZero() bool {
@@ -71,3 +155,12 @@ func (u User) IsZero() bool {
 		u.Country == "" &&
 		u.ID == 0
 }
+
+// Erased keeps only what identifies the user, for the records left once its
+// data is removed for good.
+func (u User) Erased() User {
+	erased := User{ID: u.ID}
+	erased.Meta.HydrateMeta(u.Meta.GetVersion(), u.Meta.GetCreatedAt(), u.Meta.GetUpdatedAt(), true)
+
+	return erased
+}
@@ -0,0 +1,220 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hashing algorithm")
+	ErrInvalidConfig    = errors.New("invalid password hashing configuration")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// Config selects the algorithm new hashes are created with, along with its
+// parameters. Hashes made with another algorithm or other parameters are
+// still verified but reported as needing a rehash.
+type Config struct {
+	Algorithm Algorithm
+
+	BcryptCost int
+
+	Argon2Time       uint32
+	Argon2Memory     uint32
+	Argon2Threads    uint8
+	Argon2KeyLength  uint32
+	Argon2SaltLength uint32
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:        Argon2id,
+		BcryptCost:       bcrypt.DefaultCost,
+		Argon2Time:       3,
+		Argon2Memory:     64 * 1024,
+		Argon2Threads:    2,
+		Argon2KeyLength:  32,
+		Argon2SaltLength: 16,
+	}
+}
+
+type Hasher struct {
+	config Config
+}
+
+func NewHasher(config Config) (Hasher, error) {
+	switch config.Algorithm {
+	case Bcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return Hasher{}, fmt.Errorf("%w bcrypt cost %d", ErrInvalidConfig, config.BcryptCost)
+		}
+	case Argon2id:
+		if config.Argon2Time == 0 || config.Argon2Memory == 0 || config.Argon2Threads == 0 ||
+			config.Argon2KeyLength == 0 || config.Argon2SaltLength == 0 {
+			return Hasher{}, fmt.Errorf("%w argon2id parameters", ErrInvalidConfig)
+		}
+	default:
+		return Hasher{}, fmt.Errorf("%w %q", ErrUnknownAlgorithm, config.Algorithm)
+	}
+
+	return Hasher{config: config}, nil
+}
+
+// Hash encodes the password with the configured algorithm. The result holds
+// the algorithm and its parameters so it can be verified on its own.
+func (h Hasher) Hash(password string) (string, error) {
+	switch h.config.Algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("%w failed to hash password", err)
+		}
+
+		return string(hash), nil
+	case Argon2id:
+		salt := make([]byte, h.config.Argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("%w failed to generate salt", err)
+		}
+
+		params := argon2Params{
+			time:    h.config.Argon2Time,
+			memory:  h.config.Argon2Memory,
+			threads: h.config.Argon2Threads,
+		}
+		key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, h.config.Argon2KeyLength)
+
+		return params.encode(salt, key), nil
+	}
+
+	return "", fmt.Errorf("%w %q", ErrUnknownAlgorithm, h.config.Algorithm)
+}
+
+// Verify reports whether the password matches the hash. Hashes not starting
+// with `$` are plain text passwords stored before passwords were hashed.
+func (h Hasher) Verify(hash, password string) (bool, error) {
+	switch algorithmOf(hash) {
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w failed to verify password", err)
+		}
+
+		return true, nil
+	case Argon2id:
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case "":
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1, nil
+	}
+
+	return false, ErrMalformedHash
+}
+
+// NeedsRehash reports whether the hash was not made with the configured
+// algorithm and parameters.
+func (h Hasher) NeedsRehash(hash string) bool {
+	if algorithmOf(hash) != h.config.Algorithm {
+		return true
+	}
+
+	switch h.config.Algorithm {
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.config.BcryptCost
+	case Argon2id:
+		params, salt, key, err := decodeArgon2(hash)
+		return err != nil ||
+			params.time != h.config.Argon2Time ||
+			params.memory != h.config.Argon2Memory ||
+			params.threads != h.config.Argon2Threads ||
+			uint32(len(salt)) != h.config.Argon2SaltLength ||
+			uint32(len(key)) != h.config.Argon2KeyLength
+	}
+
+	return true
+}
+
+func algorithmOf(hash string) Algorithm {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	case strings.HasPrefix(hash, "$"):
+		return "unknown"
+	}
+
+	return ""
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// encode follows the PHC string format used by the reference implementation:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var (
+		params  argon2Params
+		version int
+	)
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,109 @@
+//+build unit
+
+package passwords
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func testConfig(algorithm Algorithm) Config {
+	config := DefaultConfig()
+	config.Algorithm = algorithm
+	config.BcryptCost = 4
+	config.Argon2Memory = 1024
+	config.Argon2Time = 1
+
+	return config
+}
+
+func Test_Hasher(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		input       Algorithm
+		prefix      string
+	}{
+		{
+			description: "when hashing with bcrypt",
+			input:       Bcrypt,
+			prefix:      "$2a$04$",
+		},
+		{
+			description: "when hashing with argon2id",
+			input:       Argon2id,
+			prefix:      "$argon2id$v=19$m=1024,t=1,p=2$",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			hasher, err := NewHasher(testConfig(tc.input))
+			g.Expect(err).ToNot(HaveOccurred(), "should accept the configuration")
+
+			hash, err := hasher.Hash("qwerty")
+			g.Expect(err).ToNot(HaveOccurred(), "should hash the password")
+			g.Expect(hash).To(HavePrefix(tc.prefix), "should encode the algorithm and parameters")
+
+			other, err := hasher.Hash("qwerty")
+			g.Expect(err).ToNot(HaveOccurred(), "should hash the password")
+			g.Expect(other).ToNot(Equal(hash), "should salt every hash")
+
+			ok, err := hasher.Verify(hash, "qwerty")
+			g.Expect(err).ToNot(HaveOccurred(), "should verify the password")
+			g.Expect(ok).To(BeTrue(), "should accept the right password")
+
+			ok, err = hasher.Verify(hash, "qwertz")
+			g.Expect(err).ToNot(HaveOccurred(), "should verify the password")
+			g.Expect(ok).To(BeFalse(), "should reject a wrong password")
+
+			g.Expect(hasher.NeedsRehash(hash)).To(BeFalse(), "should not need a rehash")
+		})
+	}
+}
+
+func Test_Hasher_NeedsRehash(t *testing.T) {
+	g := NewWithT(t)
+
+	bcryptHasher, _ := NewHasher(testConfig(Bcrypt))
+	argon2Hasher, _ := NewHasher(testConfig(Argon2id))
+
+	stronger := testConfig(Argon2id)
+	stronger.Argon2Time = 2
+	strongerHasher, _ := NewHasher(stronger)
+
+	bcryptHash, _ := bcryptHasher.Hash("qwerty")
+	argon2Hash, _ := argon2Hasher.Hash("qwerty")
+
+	g.Expect(argon2Hasher.NeedsRehash(bcryptHash)).To(BeTrue(), "should rehash other algorithms")
+	g.Expect(strongerHasher.NeedsRehash(argon2Hash)).To(BeTrue(), "should rehash outdated parameters")
+	g.Expect(argon2Hasher.NeedsRehash("qwerty")).To(BeTrue(), "should rehash plain text passwords")
+
+	ok, err := strongerHasher.Verify(argon2Hash, "qwerty")
+	g.Expect(err).ToNot(HaveOccurred(), "should verify outdated hashes")
+	g.Expect(ok).To(BeTrue(), "should accept the right password with outdated parameters")
+
+	ok, err = argon2Hasher.Verify(bcryptHash, "qwerty")
+	g.Expect(err).ToNot(HaveOccurred(), "should verify other algorithms")
+	g.Expect(ok).To(BeTrue(), "should accept the right password with another algorithm")
+
+	ok, err = argon2Hasher.Verify("qwerty", "qwerty")
+	g.Expect(err).ToNot(HaveOccurred(), "should verify plain text passwords")
+	g.Expect(ok).To(BeTrue(), "should accept a plain text password")
+
+	_, err = argon2Hasher.Verify("$argon2id$v=19$broken", "qwerty")
+	g.Expect(err).To(Equal(ErrMalformedHash), "should reject malformed hashes")
+}
+
+func Test_NewHasher(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewHasher(Config{Algorithm: "md5"})
+	g.Expect(err).To(MatchError(ErrUnknownAlgorithm), "should reject unknown algorithms")
+
+	_, err = NewHasher(Config{Algorithm: Bcrypt, BcryptCost: 1})
+	g.Expect(err).To(MatchError(ErrInvalidConfig), "should reject invalid parameters")
+}
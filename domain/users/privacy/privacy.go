@@ -0,0 +1,192 @@
+package privacy
+
+//go:generate mockgen -source=privacy.go -destination=mock/privacy_mock.go
+
+import (
+	authModels "code/tech-test/domain/auth/models"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// historyPage is the number of history entries read at once for an export.
+const historyPage = 100
+
+type UserStore interface {
+	List(ctx context.Context, q query.Query) ([]models.User, error)
+	History(ctx context.Context, id int, after uint32, limit int) ([]models.HistoryEntry, error)
+	Erase(ctx context.Context, id int, version uint32) (models.Erasure, error)
+	Erasures(ctx context.Context, id int) ([]models.Erasure, error)
+}
+
+type TokenStore interface {
+	ListByUser(ctx context.Context, userID int) ([]authModels.RefreshToken, error)
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+type MessageStore interface {
+	Messages(ctx context.Context, aggregateID int) ([]outbox.Message, error)
+}
+
+// Event describes an event of the user written to the outbox, without its
+// data.
+type Event struct {
+	MessageID  int64
+	Type       string
+	OccurredAt time.Time
+	QueuedAt   time.Time
+	// SentAt is zero while the event is not published.
+	SentAt time.Time
+}
+
+// Export is all the data held about a user. The password hash is left out,
+// it is of no use to the user.
+type Export struct {
+	ExportedAt time.Time
+	User       models.User
+	History    []models.HistoryEntry
+	Tokens     []authModels.RefreshToken
+	Events     []Event
+	Erasures   []models.Erasure
+}
+
+// Service answers the subject access and erasure requests of the users.
+type Service struct {
+	users    UserStore
+	tokens   TokenStore
+	messages MessageStore
+}
+
+func NewService(users UserStore, tokens TokenStore, messages MessageStore) Service {
+	return Service{
+		users:    users,
+		tokens:   tokens,
+		messages: messages,
+	}
+}
+
+// Export gathers the data held about the user, deleted or not.
+func (s Service) Export(ctx context.Context, id int) (Export, error) {
+	users, err := s.users.List(ctx, query.Query{
+		Filter:          query.Equal("id", strconv.Itoa(id)),
+		Sort:            query.Sort{Field: "id"},
+		Limit:           1,
+		IncludeDisabled: true,
+	})
+	if err != nil {
+		return Export{}, fmt.Errorf("%w failed to get user", err)
+	}
+
+	if len(users) == 0 {
+		return Export{}, services.ErrUserNotFound
+	}
+
+	export := Export{
+		ExportedAt: time.Now().UTC(),
+		User:       users[0],
+	}
+	export.User.Password = ""
+
+	if export.History, err = s.history(ctx, id); err != nil {
+		return Export{}, err
+	}
+
+	if export.Tokens, err = s.tokens.ListByUser(ctx, id); err != nil {
+		return Export{}, fmt.Errorf("%w failed to list refresh tokens", err)
+	}
+
+	if export.Events, err = s.events(ctx, id); err != nil {
+		return Export{}, err
+	}
+
+	if export.Erasures, err = s.users.Erasures(ctx, id); err != nil {
+		return Export{}, fmt.Errorf("%w failed to list erasures", err)
+	}
+
+	return export, nil
+}
+
+func (s Service) history(ctx context.Context, id int) ([]models.HistoryEntry, error) {
+	var (
+		history = make([]models.HistoryEntry, 0)
+		after   uint32
+	)
+
+	for {
+		entries, err := s.users.History(ctx, id, after, historyPage)
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to list history", err)
+		}
+
+		history = append(history, entries...)
+		if len(entries) < historyPage {
+			return history, nil
+		}
+
+		after = entries[len(entries)-1].Version()
+	}
+}
+
+func (s Service) events(ctx context.Context, id int) ([]Event, error) {
+	messages, err := s.messages.Messages(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list messages", err)
+	}
+
+	var events = make([]Event, 0, len(messages))
+
+	for _, message := range messages {
+		decoded, err := message.Events()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range decoded {
+			events = append(events, Event{
+				MessageID:  message.ID,
+				Type:       event.EventType(),
+				OccurredAt: event.OccurredAt(),
+				QueuedAt:   message.CreatedAt,
+				SentAt:     message.SentAt,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// Erase anonymizes the user and its history, deleted or not, and returns the
+// proof of it. The refresh tokens of the user are deleted once it is erased,
+// so a failed erasure logs no one out, and again when it was already erased
+// so an erasure failing on them can be retried.
+func (s Service) Erase(ctx context.Context, id int, version uint32) (models.Erasure, error) {
+	erasure, err := s.users.Erase(ctx, id, version)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUserNotFound:
+			return models.Erasure{}, services.ErrUserNotFound
+		case postgresql.ErrWrongVersion:
+			return models.Erasure{}, services.ErrWrongVersion
+		case postgresql.ErrUserErased:
+			if err := s.tokens.DeleteByUser(ctx, id); err != nil {
+				return models.Erasure{}, fmt.Errorf("%w failed to delete refresh tokens", err)
+			}
+
+			return models.Erasure{}, services.ErrUserErased
+		default:
+			return models.Erasure{}, fmt.Errorf("%w failed to erase user", err)
+		}
+	}
+
+	if err := s.tokens.DeleteByUser(ctx, id); err != nil {
+		return models.Erasure{}, fmt.Errorf("%w failed to delete refresh tokens", err)
+	}
+
+	return erasure, nil
+}
@@ -0,0 +1,186 @@
+//+build unit
+
+package privacy
+
+import (
+	"code/tech-test/domain"
+	authModels "code/tech-test/domain/auth/models"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/services"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mock_privacy "code/tech-test/domain/users/privacy/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+var ERROR = fmt.Errorf("expected error")
+
+type mocks struct {
+	users    *mock_privacy.MockUserStore
+	tokens   *mock_privacy.MockTokenStore
+	messages *mock_privacy.MockMessageStore
+}
+
+func newMocks(mockCtrl *gomock.Controller) mocks {
+	return mocks{
+		users:    mock_privacy.NewMockUserStore(mockCtrl),
+		tokens:   mock_privacy.NewMockTokenStore(mockCtrl),
+		messages: mock_privacy.NewMockMessageStore(mockCtrl),
+	}
+}
+
+func testUser() models.User {
+	user := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(1, time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), false)
+
+	return user
+}
+
+func userQuery() query.Query {
+	return query.Query{
+		Filter:          query.Equal("id", "1"),
+		Sort:            query.Sort{Field: "id"},
+		Limit:           1,
+		IncludeDisabled: true,
+	}
+}
+
+func Test_Export(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	m := newMocks(mockCtrl)
+	service := NewService(m.users, m.tokens, m.messages)
+
+	user := testUser()
+	message, err := outbox.NewUserMessage(user, []domain.Event{models.UserCreated{At: user.Meta.GetCreatedAt()}})
+	g.Expect(err).ToNot(HaveOccurred())
+	message.ID = 7
+	message.CreatedAt = user.Meta.GetCreatedAt()
+
+	full := make([]models.HistoryEntry, historyPage)
+	for i := range full {
+		full[i] = models.NewHistoryEntry(user, nil, "user:1", "")
+		full[i].User.Meta.SetVersion(uint32(i + 1))
+	}
+
+	tokens := []authModels.RefreshToken{authModels.NewRefreshToken("token", "family", 1, time.Now().Add(time.Hour))}
+
+	m.users.EXPECT().List(ctx, userQuery()).Return([]models.User{user}, nil)
+	m.users.EXPECT().History(ctx, 1, uint32(0), historyPage).Return(full, nil)
+	m.users.EXPECT().History(ctx, 1, uint32(historyPage), historyPage).Return(full[:1], nil)
+	m.tokens.EXPECT().ListByUser(ctx, 1).Return(tokens, nil)
+	m.messages.EXPECT().Messages(ctx, 1).Return([]outbox.Message{message}, nil)
+	m.users.EXPECT().Erasures(ctx, 1).Return([]models.Erasure{}, nil)
+
+	export, err := service.Export(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should export the user")
+	g.Expect(export.User.Nickname).To(Equal("testuser"), "should export the user")
+	g.Expect(export.User.Password).To(BeEmpty(), "should not export the password")
+	g.Expect(export.History).To(HaveLen(historyPage+1), "should export every page of the history")
+	g.Expect(export.Tokens).To(Equal(tokens), "should export the refresh tokens")
+	g.Expect(export.Events).To(Equal([]Event{{
+		MessageID:  7,
+		Type:       models.EventUserCreated,
+		OccurredAt: user.Meta.GetCreatedAt(),
+		QueuedAt:   user.Meta.GetCreatedAt(),
+	}}), "should export the events without their data")
+	g.Expect(export.ExportedAt).ToNot(BeZero(), "should date the export")
+
+	m.users.EXPECT().List(ctx, userQuery()).Return([]models.User{}, nil)
+	_, err = service.Export(ctx, 1)
+	g.Expect(err).To(Equal(services.ErrUserNotFound), "should not export unknown users")
+
+	m.users.EXPECT().List(ctx, userQuery()).Return([]models.User{user}, nil)
+	m.users.EXPECT().History(ctx, 1, uint32(0), historyPage).Return(nil, ERROR)
+	_, err = service.Export(ctx, 1)
+	g.Expect(err).To(Equal(fmt.Errorf("%w failed to list history", ERROR)), "should fail when the history fails to be listed")
+}
+
+func Test_Erase(t *testing.T) {
+
+	type testExpectation struct {
+		err error
+	}
+
+	testCases := []struct {
+		description string
+		setup       func(ctx context.Context, m mocks)
+		expected    testExpectation
+	}{
+		{
+			description: "when the user is erased",
+			setup: func(ctx context.Context, m mocks) {
+				gomock.InOrder(
+					m.users.EXPECT().Erase(ctx, 1, uint32(2)).Return(models.Erasure{UserID: 1, Version: 3}, nil),
+					m.tokens.EXPECT().DeleteByUser(ctx, 1).Return(nil),
+				)
+			},
+		},
+		{
+			description: "when the tokens fail to be deleted",
+			setup: func(ctx context.Context, m mocks) {
+				m.users.EXPECT().Erase(ctx, 1, uint32(2)).Return(models.Erasure{UserID: 1, Version: 3}, nil)
+				m.tokens.EXPECT().DeleteByUser(ctx, 1).Return(ERROR)
+			},
+			expected: testExpectation{err: fmt.Errorf("%w failed to delete refresh tokens", ERROR)},
+		},
+		{
+			description: "when the user does not exist",
+			setup: func(ctx context.Context, m mocks) {
+				m.users.EXPECT().Erase(ctx, 1, uint32(2)).Return(models.Erasure{}, postgresql.ErrUserNotFound)
+			},
+			expected: testExpectation{err: services.ErrUserNotFound},
+		},
+		{
+			description: "when the version is wrong",
+			setup: func(ctx context.Context, m mocks) {
+				// no DeleteByUser expected: the user stays logged in
+				m.users.EXPECT().Erase(ctx, 1, uint32(2)).Return(models.Erasure{}, postgresql.ErrWrongVersion)
+			},
+			expected: testExpectation{err: services.ErrWrongVersion},
+		},
+		{
+			description: "when the user is already erased",
+			setup: func(ctx context.Context, m mocks) {
+				m.users.EXPECT().Erase(ctx, 1, uint32(2)).Return(models.Erasure{}, postgresql.ErrUserErased)
+				m.tokens.EXPECT().DeleteByUser(ctx, 1).Return(nil)
+			},
+			expected: testExpectation{err: services.ErrUserErased},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			m := newMocks(mockCtrl)
+			tc.setup(ctx, m)
+
+			erasure, err := NewService(m.users, m.tokens, m.messages).Erase(ctx, 1, 2)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(erasure.Version).To(Equal(uint32(3)), "should return the proof of the erasure")
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"code/tech-test/domain/users/models"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Cursor points at the last user of a page, it holds the value of the sort
+// field and the id of that user so the next page can be fetched by keyset.
+type Cursor struct {
+	Sort  Sort
+	Value interface{}
+	ID    int
+}
+
+type cursorPayload struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func CursorFor(user models.User, sort Sort) Cursor {
+	return Cursor{
+		Sort:  sort,
+		Value: Value(user, sort.Field),
+		ID:    user.ID,
+	}
+}
+
+// After reports whether the user comes after the cursor in the cursor order.
+func (c Cursor) After(user models.User) bool {
+	cmp := compare(Value(user, c.Sort.Field), c.Value)
+	if cmp == 0 {
+		cmp = compare(user.ID, c.ID)
+	}
+
+	if c.Sort.Descending {
+		return cmp < 0
+	}
+
+	return cmp > 0
+}
+
+// Encode returns the opaque representation of the cursor given to clients.
+func (c Cursor) Encode() string {
+	payload := cursorPayload{
+		Sort: c.Sort.String(),
+		ID:   c.ID,
+	}
+
+	switch v := c.Value.(type) {
+	case int:
+		payload.Value = strconv.Itoa(v)
+	case string:
+		payload.Value = v
+	case time.Time:
+		payload.Value = v.Format(time.RFC3339Nano)
+	}
+
+	encoded, _ := json.Marshal(payload)
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var payload cursorPayload
+
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	sort, err := ParseSort(payload.Sort)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	cursor := Cursor{Sort: sort, ID: payload.ID}
+
+	switch sort.Field {
+	case "id":
+		cursor.Value, err = strconv.Atoi(payload.Value)
+	case "created_at", "updated_at":
+		cursor.Value, err = time.Parse(time.RFC3339Nano, payload.Value)
+	default:
+		cursor.Value = payload.Value
+	}
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
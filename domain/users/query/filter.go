@@ -0,0 +1,251 @@
+package query
+
+import (
+	"code/tech-test/domain/users/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+type Operator string
+
+const (
+	OpEqual        Operator = "="
+	OpNotEqual     Operator = "!="
+	OpPrefix       Operator = "^="
+	OpLike         Operator = "~"
+	OpIn           Operator = "in"
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+)
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	numberField
+	timeField
+)
+
+// filterFields whitelists the columns users can be filtered by, like
+// sortFields their names are safe to use in SQL statements.
+var filterFields = map[string]fieldKind{
+	"id":         numberField,
+	"first_name": textField,
+	"last_name":  textField,
+	"nickname":   textField,
+	"email":      textField,
+	"country":    textField,
+	"created_at": timeField,
+	"updated_at": timeField,
+}
+
+var fieldOperators = map[fieldKind][]Operator{
+	textField:   {OpEqual, OpNotEqual, OpPrefix, OpLike, OpIn},
+	numberField: {OpEqual, OpNotEqual, OpIn},
+	timeField:   {OpLess, OpLessEqual, OpGreater, OpGreaterEqual},
+}
+
+// Filter is a node of the filter tree: a Condition or a combination of them.
+type Filter interface {
+	Match(user models.User) bool
+}
+
+// Condition compares a field to its values. Every operator takes a single
+// value but OpIn. OpLike values use `*` as a case insensitive wildcard.
+type Condition struct {
+	Field    string
+	Operator Operator
+	Values   []string
+}
+
+type And []Filter
+
+type Or []Filter
+
+type Not struct {
+	Filter Filter
+}
+
+// Equal builds the condition used by the plain `field=value` parameters.
+func Equal(field, value string) Condition {
+	return Condition{Field: field, Operator: OpEqual, Values: []string{value}}
+}
+
+func (c Condition) Match(user models.User) bool {
+	switch filterFields[c.Field] {
+	case timeField:
+		value := Value(user, c.Field).(time.Time)
+		bound, _ := c.Time()
+
+		switch c.Operator {
+		case OpLess:
+			return value.Before(bound)
+		case OpLessEqual:
+			return !value.After(bound)
+		case OpGreater:
+			return value.After(bound)
+		case OpGreaterEqual:
+			return !value.Before(bound)
+		}
+
+		return false
+	case numberField:
+		return c.matchText(strconv.Itoa(user.ID))
+	default:
+		return c.matchText(Value(user, c.Field).(string))
+	}
+}
+
+func (c Condition) matchText(value string) bool {
+	switch c.Operator {
+	case OpEqual:
+		return value == c.Values[0]
+	case OpNotEqual:
+		return value != c.Values[0]
+	case OpPrefix:
+		return strings.HasPrefix(value, c.Values[0])
+	case OpLike:
+		return likePattern(c.Values[0]).MatchString(value)
+	case OpIn:
+		for _, v := range c.Values {
+			if value == v {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Time returns the value of a condition on a timestamp field.
+func (c Condition) Time() (time.Time, error) {
+	return parseTime(c.Values[0])
+}
+
+// Numbers returns the values of a condition on the id field.
+func (c Condition) Numbers() ([]int, error) {
+	numbers := make([]int, 0, len(c.Values))
+
+	for _, v := range c.Values {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, n)
+	}
+
+	return numbers, nil
+}
+
+func (a And) Match(user models.User) bool {
+	for _, f := range a {
+		if !f.Match(user) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (o Or) Match(user models.User) bool {
+	for _, f := range o {
+		if f.Match(user) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n Not) Match(user models.User) bool {
+	return !n.Filter.Match(user)
+}
+
+// ValidateFilter checks the fields, operators and values of every condition.
+func ValidateFilter(f Filter) error {
+	switch f := f.(type) {
+	case nil:
+		return nil
+	case Condition:
+		return f.validate()
+	case And:
+		for _, child := range f {
+			if err := ValidateFilter(child); err != nil {
+				return err
+			}
+		}
+	case Or:
+		for _, child := range f {
+			if err := ValidateFilter(child); err != nil {
+				return err
+			}
+		}
+	case Not:
+		if f.Filter == nil {
+			return fmt.Errorf("%w: empty negation", ErrInvalidFilter)
+		}
+		return ValidateFilter(f.Filter)
+	default:
+		return fmt.Errorf("%w: unknown node %T", ErrInvalidFilter, f)
+	}
+
+	return nil
+}
+
+func (c Condition) validate() error {
+	kind, ok := filterFields[c.Field]
+	if !ok {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, c.Field)
+	}
+
+	allowed := false
+	for _, op := range fieldOperators[kind] {
+		allowed = allowed || op == c.Operator
+	}
+	if !allowed {
+		return fmt.Errorf("%w: operator %q not supported on %q", ErrInvalidFilter, c.Operator, c.Field)
+	}
+
+	if len(c.Values) == 0 || (c.Operator != OpIn && len(c.Values) != 1) {
+		return fmt.Errorf("%w: wrong number of values for %q", ErrInvalidFilter, c.Field)
+	}
+
+	switch kind {
+	case timeField:
+		if _, err := c.Time(); err != nil {
+			return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidFilter, c.Values[0])
+		}
+	case numberField:
+		if _, err := c.Numbers(); err != nil {
+			return fmt.Errorf("%w: invalid number for %q", ErrInvalidFilter, c.Field)
+		}
+	}
+
+	return nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+func likePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	return regexp.MustCompile("(?is)^" + strings.Join(parts, ".*") + "$")
+}
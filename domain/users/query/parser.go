@@ -0,0 +1,341 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseFilter parses the filter language of the users listing:
+//
+//	filter    = or
+//	or        = and { "or" and }
+//	and       = unary { "and" unary }
+//	unary     = "not" unary | "(" filter ")" | condition
+//	condition = field operator value | field [ "not" ] "in" "(" value { "," value } ")"
+//	operator  = "=" | "!=" | "^=" | "~" | "<" | "<=" | ">" | ">="
+//
+// Values are bare words or double quoted strings, keywords are case
+// insensitive. For example:
+//
+//	country in (uk, pt) and (nickname ^= jo or email ~ "*@example.com") and created_at >= 2021-01-01
+//
+// An empty string parses to a nil filter.
+func ParseFilter(s string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &parser{tokens: tokens}
+
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, p.unexpected()
+	}
+
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, value: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case r == '"':
+			var value strings.Builder
+
+			start := i
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidFilter, start)
+			}
+			i++
+
+			tokens = append(tokens, token{kind: tokenString, value: value.String(), pos: start})
+		case strings.ContainsRune("=!^~<>", r):
+			start := i
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' && r != '~' {
+				op += "="
+			}
+			i += len(op)
+
+			if op == "!" || op == "^" {
+				return nil, fmt.Errorf("%w: unknown operator %q at %d", ErrInvalidFilter, op, start)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, value: op, pos: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`(),"=!^~<>`, runes[i]) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[start:i]), pos: start})
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) keyword(word string) bool {
+	if p.done() {
+		return false
+	}
+
+	t := p.peek()
+
+	return t.kind == tokenWord && strings.EqualFold(t.value, word)
+}
+
+func (p *parser) unexpected() error {
+	if p.done() {
+		return fmt.Errorf("%w: unexpected end of filter", ErrInvalidFilter)
+	}
+
+	t := p.peek()
+
+	return fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFilter, t.value, t.pos)
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	if p.done() || p.peek().kind != kind {
+		return token{}, p.unexpected()
+	}
+
+	t := p.peek()
+	p.pos++
+
+	return t, nil
+}
+
+func (p *parser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := Or{left}
+	for p.keyword("or") {
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, right)
+	}
+
+	if len(filters) == 1 {
+		return left, nil
+	}
+
+	return filters, nil
+}
+
+func (p *parser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := And{left}
+	for p.keyword("and") {
+		p.pos++
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, right)
+	}
+
+	if len(filters) == 1 {
+		return left, nil
+	}
+
+	return filters, nil
+}
+
+func (p *parser) parseUnary() (Filter, error) {
+	if p.done() {
+		return nil, p.unexpected()
+	}
+
+	if p.keyword("not") {
+		p.pos++
+
+		filter, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return Not{Filter: filter}, nil
+	}
+
+	if p.peek().kind == tokenOpen {
+		p.pos++
+
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokenClose); err != nil {
+			return nil, err
+		}
+
+		return filter, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (Filter, error) {
+	field, err := p.expect(tokenWord)
+	if err != nil {
+		return nil, err
+	}
+
+	negated := false
+	if p.keyword("not") {
+		negated = true
+		p.pos++
+	}
+
+	if p.keyword("in") {
+		p.pos++
+
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+
+		var filter Filter = Condition{Field: field.value, Operator: OpIn, Values: values}
+		if negated {
+			filter = Not{Filter: filter}
+		}
+
+		return filter, nil
+	}
+
+	if negated {
+		return nil, p.unexpected()
+	}
+
+	op, err := p.expect(tokenOperator)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return Condition{Field: field.value, Operator: Operator(op.value), Values: []string{value}}, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if _, err := p.expect(tokenOpen); err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.done() || p.peek().kind != tokenComma {
+			break
+		}
+		p.pos++
+	}
+
+	if _, err := p.expect(tokenClose); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	if p.done() {
+		return "", p.unexpected()
+	}
+
+	t := p.peek()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return "", p.unexpected()
+	}
+	p.pos++
+
+	return t.value, nil
+}
@@ -0,0 +1,156 @@
+//+build unit
+
+package query_test
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_ParseFilter(t *testing.T) {
+
+	type testExpectation struct {
+		err    error
+		filter query.Filter
+	}
+
+	testCases := []struct {
+		description string
+		input       string
+		expected    testExpectation
+	}{
+		{
+			description: "when the filter is empty",
+			input:       "  ",
+			expected: testExpectation{
+				filter: nil,
+			},
+		},
+		{
+			description: "when the filter is a single condition",
+			input:       `country = uk`,
+			expected: testExpectation{
+				filter: query.Equal("country", "uk"),
+			},
+		},
+		{
+			description: "when the filter combines conditions",
+			input:       `country in (uk, "p t") AND (nickname ^= jo or email ~ "*@example.com") and not first_name != John`,
+			expected: testExpectation{
+				filter: query.And{
+					query.Condition{Field: "country", Operator: query.OpIn, Values: []string{"uk", "p t"}},
+					query.Or{
+						query.Condition{Field: "nickname", Operator: query.OpPrefix, Values: []string{"jo"}},
+						query.Condition{Field: "email", Operator: query.OpLike, Values: []string{"*@example.com"}},
+					},
+					query.Not{Filter: query.Condition{Field: "first_name", Operator: query.OpNotEqual, Values: []string{"John"}}},
+				},
+			},
+		},
+		{
+			description: "when the filter has a time range",
+			input:       `created_at >= 2021-01-01 and created_at < 2021-02-01T00:00:00Z`,
+			expected: testExpectation{
+				filter: query.And{
+					query.Condition{Field: "created_at", Operator: query.OpGreaterEqual, Values: []string{"2021-01-01"}},
+					query.Condition{Field: "created_at", Operator: query.OpLess, Values: []string{"2021-02-01T00:00:00Z"}},
+				},
+			},
+		},
+		{
+			description: "when the filter negates a list",
+			input:       `id not in (1, 2)`,
+			expected: testExpectation{
+				filter: query.Not{Filter: query.Condition{Field: "id", Operator: query.OpIn, Values: []string{"1", "2"}}},
+			},
+		},
+		{
+			description: "when the field is unknown",
+			input:       `password = qwerty`,
+			expected: testExpectation{
+				err: query.ErrInvalidFilter,
+			},
+		},
+		{
+			description: "when the operator is not supported by the field",
+			input:       `created_at ^= 2021`,
+			expected: testExpectation{
+				err: query.ErrInvalidFilter,
+			},
+		},
+		{
+			description: "when the timestamp is invalid",
+			input:       `updated_at > yesterday`,
+			expected: testExpectation{
+				err: query.ErrInvalidFilter,
+			},
+		},
+		{
+			description: "when a parenthesis is not closed",
+			input:       `(country = uk or country = pt`,
+			expected: testExpectation{
+				err: query.ErrInvalidFilter,
+			},
+		},
+		{
+			description: "when a string is not terminated",
+			input:       `country = "uk`,
+			expected: testExpectation{
+				err: query.ErrInvalidFilter,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			filter, err := query.ParseFilter(tc.input)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(MatchError(tc.expected.err), "should return the expected error")
+			} else if tc.expected.filter == nil {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(filter).To(BeNil(), "should not return a filter")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(filter).To(Equal(tc.expected.filter), "should return the expected filter")
+			}
+		})
+	}
+}
+
+func Test_Filter_Match(t *testing.T) {
+
+	user := models.NewUser(1, "John", "Doe", "johndoe", "qwerty", "john@Example.com", "uk")
+	user.Meta.HydrateMeta(1, time.Date(2021, time.January, 15, 0, 0, 0, 0, time.UTC), time.Now(), false)
+
+	testCases := []struct {
+		description string
+		input       string
+		expected    bool
+	}{
+		{description: "when the prefix matches", input: `nickname ^= john`, expected: true},
+		{description: "when the prefix differs in case", input: `nickname ^= John`, expected: false},
+		{description: "when the pattern matches ignoring case", input: `email ~ "*@example.COM"`, expected: true},
+		{description: "when the value is in the list", input: `country in (pt, uk)`, expected: true},
+		{description: "when the value is not in the list", input: `country not in (pt, uk)`, expected: false},
+		{description: "when the timestamp is in the range", input: `created_at >= 2021-01-01 and created_at < 2021-02-01`, expected: true},
+		{description: "when one of the alternatives matches", input: `id = 2 or last_name = Doe`, expected: true},
+		{description: "when none of the alternatives matches", input: `id = 2 or not last_name = Doe`, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			filter, err := query.ParseFilter(tc.input)
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(filter.Match(user)).To(Equal(tc.expected), "should match the expected users")
+		})
+	}
+}
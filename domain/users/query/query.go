@@ -0,0 +1,168 @@
+package query
+
+import (
+	"code/tech-test/domain/users/models"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+var (
+	ErrInvalidLimit     = errors.New("invalid limit")
+	ErrInvalidOffset    = errors.New("invalid offset")
+	ErrInvalidSort      = errors.New("invalid sort")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrCursorWithOffset = errors.New("cursor and offset are mutually exclusive")
+)
+
+// sortFields whitelists the columns users can be sorted by. Being a
+// whitelist, the names can safely be used to build SQL statements.
+var sortFields = map[string]bool{
+	"id":         true,
+	"first_name": true,
+	"last_name":  true,
+	"nickname":   true,
+	"email":      true,
+	"country":    true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// Query describes which users to list and which page of them to return.
+// A zero Limit returns every matching user. Deleted users are left out unless
+// IncludeDisabled is set.
+type Query struct {
+	Filter          Filter
+	Sort            Sort
+	Limit           int
+	Offset          int
+	After           *Cursor
+	WithTotal       bool
+	IncludeDisabled bool
+}
+
+// Page is a single page of a listing. NextCursor is empty on the last page.
+type Page struct {
+	Users      []models.User
+	NextCursor string
+	Limit      int
+	Total      *int
+}
+
+// ParseSort parses a field name optionally prefixed by `-` for a descending
+// order. An empty string sorts by id.
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return Sort{Field: "id"}, nil
+	}
+
+	sort := Sort{Field: s}
+	if strings.HasPrefix(s, "-") {
+		sort = Sort{Field: s[1:], Descending: true}
+	}
+
+	if !sortFields[sort.Field] {
+		return Sort{}, ErrInvalidSort
+	}
+
+	return sort, nil
+}
+
+func (s Sort) String() string {
+	if s.Descending {
+		return "-" + s.Field
+	}
+
+	return s.Field
+}
+
+func (q Query) Validate() error {
+	if q.Limit < 0 || q.Limit > MaxLimit {
+		return ErrInvalidLimit
+	}
+	if q.Offset < 0 {
+		return ErrInvalidOffset
+	}
+	if !sortFields[q.Sort.Field] {
+		return ErrInvalidSort
+	}
+	if q.After != nil && q.Offset > 0 {
+		return ErrCursorWithOffset
+	}
+	if q.After != nil && q.After.Sort != q.Sort {
+		return ErrInvalidCursor
+	}
+
+	return ValidateFilter(q.Filter)
+}
+
+// Less reports whether a sorts before b, ties being broken by id.
+func (s Sort) Less(a, b models.User) bool {
+	cmp := compare(Value(a, s.Field), Value(b, s.Field))
+	if cmp == 0 {
+		cmp = compare(a.ID, b.ID)
+	}
+
+	if s.Descending {
+		return cmp > 0
+	}
+
+	return cmp < 0
+}
+
+// Value returns the value of a sortable field of the user.
+func Value(user models.User, field string) interface{} {
+	switch field {
+	case "first_name":
+		return user.FirstName
+	case "last_name":
+		return user.LastName
+	case "nickname":
+		return user.Nickname
+	case "email":
+		return user.Email
+	case "country":
+		return user.Country
+	case "created_at":
+		return user.Meta.GetCreatedAt()
+	case "updated_at":
+		return user.Meta.GetUpdatedAt()
+	default:
+		return user.ID
+	}
+}
+
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,110 @@
+//+build unit
+
+package query_test
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_ParseSort(t *testing.T) {
+
+	type testExpectation struct {
+		err  error
+		sort query.Sort
+	}
+
+	testCases := []struct {
+		description string
+		input       string
+		expected    testExpectation
+	}{
+		{
+			description: "when no sort is given",
+			input:       "",
+			expected: testExpectation{
+				sort: query.Sort{Field: "id"},
+			},
+		},
+		{
+			description: "when sorting in ascending order",
+			input:       "nickname",
+			expected: testExpectation{
+				sort: query.Sort{Field: "nickname"},
+			},
+		},
+		{
+			description: "when sorting in descending order",
+			input:       "-created_at",
+			expected: testExpectation{
+				sort: query.Sort{Field: "created_at", Descending: true},
+			},
+		},
+		{
+			description: "when sorting by a field that is not allowed",
+			input:       "password",
+			expected: testExpectation{
+				err: query.ErrInvalidSort,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			sort, err := query.ParseSort(tc.input)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(sort).To(Equal(tc.expected.sort), "should return the expected sort")
+			}
+		})
+	}
+}
+
+func Test_Cursor(t *testing.T) {
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(1, time.Date(2021, time.May, 1, 10, 0, 0, 123000, time.UTC), time.Now(), false)
+
+	testCases := []struct {
+		description string
+		input       query.Sort
+	}{
+		{
+			description: "when the cursor is on the id",
+			input:       query.Sort{Field: "id"},
+		},
+		{
+			description: "when the cursor is on a text field",
+			input:       query.Sort{Field: "nickname", Descending: true},
+		},
+		{
+			description: "when the cursor is on a timestamp",
+			input:       query.Sort{Field: "created_at"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cursor := query.CursorFor(user, tc.input)
+
+			decoded, err := query.DecodeCursor(cursor.Encode())
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(decoded).To(Equal(cursor), "should decode to the same cursor")
+			g.Expect(decoded.After(user)).To(BeFalse(), "should not include the user it points at")
+		})
+	}
+
+	_, err := query.DecodeCursor("not a cursor")
+	NewWithT(t).Expect(err).To(Equal(query.ErrInvalidCursor), "should reject malformed cursors")
+}
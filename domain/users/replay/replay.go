@@ -0,0 +1,205 @@
+package replay
+
+//go:generate mockgen -source=replay.go -destination=mock/replay_mock.go
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"fmt"
+	"time"
+)
+
+// UserStore writes the snapshots to the outbox, under the lock of the user,
+// so they are published after the changes already written and before the
+// following ones, by the relay like any change.
+type UserStore interface {
+	List(ctx context.Context, q query.Query) ([]models.User, error)
+	Snapshot(ctx context.Context, id int, snapshot models.UserSnapshot) (models.User, error)
+}
+
+// Checkpoints keep the progress of a replay, so an interrupted one resumes
+// where it stopped.
+type Checkpoints interface {
+	Load() (Checkpoint, error)
+	Save(checkpoint Checkpoint) error
+	Clear() error
+}
+
+// Checkpoint is the last user replayed, the users being replayed by id.
+type Checkpoint struct {
+	LastID    int       `json:"last_id"`
+	Published int       `json:"published"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type Config struct {
+	BatchSize       int
+	IncludeDisabled bool
+	// Rate is the most users snapshotted per second, 0 for no limit.
+	Rate float64
+	// DryRun counts the users without snapshotting nor checkpointing.
+	DryRun bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize: 100,
+		Rate:      100,
+	}
+}
+
+// Report counts the users of the run, Resumed being the id the run resumed
+// after. Published counts the snapshots written to the outbox, including the
+// ones of the interrupted runs.
+type Report struct {
+	Users     int
+	Disabled  int
+	Published int
+	Resumed   int
+}
+
+// Replayer republishes the current state of every user as a UserSnapshot
+// event, for the consumers which started after the users were created.
+type Replayer struct {
+	store       UserStore
+	checkpoints Checkpoints
+	config      Config
+}
+
+func NewReplayer(store UserStore, checkpoints Checkpoints, config Config) Replayer {
+	return Replayer{
+		store:       store,
+		checkpoints: checkpoints,
+		config:      config,
+	}
+}
+
+// Run pages through the users from the checkpoint, saving it after every page
+// and when the run is interrupted. The checkpoint is cleared once every user
+// is replayed, so the next run starts over.
+func (r Replayer) Run(ctx context.Context) (Report, error) {
+	var report Report
+
+	checkpoint, err := r.checkpoints.Load()
+	if err != nil {
+		return report, fmt.Errorf("%w failed to load checkpoint", err)
+	}
+
+	if checkpoint.StartedAt.IsZero() {
+		checkpoint.StartedAt = time.Now().UTC()
+	}
+
+	report.Resumed = checkpoint.LastID
+	report.Published = checkpoint.Published
+
+	limiter := newLimiter(r.config.Rate)
+	defer limiter.stop()
+
+	sort := query.Sort{Field: "id"}
+
+	for {
+		q := query.Query{
+			Sort:            sort,
+			Limit:           r.config.BatchSize,
+			IncludeDisabled: r.config.IncludeDisabled,
+		}
+		if checkpoint.LastID > 0 {
+			q.After = &query.Cursor{Sort: sort, Value: checkpoint.LastID, ID: checkpoint.LastID}
+		}
+
+		users, err := r.store.List(ctx, q)
+		if err != nil {
+			return report, fmt.Errorf("%w failed to list users", err)
+		}
+
+		for _, user := range users {
+			report.Users++
+			if user.Meta.GetDisabled() {
+				report.Disabled++
+			}
+
+			if !r.config.DryRun {
+				if err := limiter.wait(ctx); err != nil {
+					return report, r.interrupt(checkpoint, err)
+				}
+
+				_, err := r.store.Snapshot(ctx, user.ID, models.UserSnapshot{At: time.Now().UTC()})
+				switch err {
+				case nil:
+					report.Published++
+					checkpoint.Published++
+				case postgresql.ErrUserNotFound:
+					// purged since the page was listed
+				default:
+					return report, r.interrupt(checkpoint, fmt.Errorf("%w failed to snapshot user %d", err, user.ID))
+				}
+			}
+
+			checkpoint.LastID = user.ID
+		}
+
+		if len(users) < r.config.BatchSize {
+			break
+		}
+
+		if !r.config.DryRun {
+			if err := r.checkpoints.Save(checkpoint); err != nil {
+				return report, fmt.Errorf("%w failed to save checkpoint", err)
+			}
+		}
+	}
+
+	if r.config.DryRun {
+		return report, nil
+	}
+
+	if err := r.checkpoints.Clear(); err != nil {
+		return report, fmt.Errorf("%w failed to clear checkpoint", err)
+	}
+
+	return report, nil
+}
+
+// interrupt saves the progress of the page before returning the error.
+func (r Replayer) interrupt(checkpoint Checkpoint, err error) error {
+	if saveErr := r.checkpoints.Save(checkpoint); saveErr != nil {
+		return fmt.Errorf("%w failed to save checkpoint after: %s", saveErr, err)
+	}
+
+	return err
+}
+
+// limiter spaces the snapshots evenly to stay under the rate.
+type limiter struct {
+	ticker *time.Ticker
+}
+
+func newLimiter(rate float64) limiter {
+	interval := time.Duration(float64(time.Second) / rate)
+	if rate <= 0 || interval <= 0 {
+		return limiter{}
+	}
+
+	return limiter{ticker: time.NewTicker(interval)}
+}
+
+func (l limiter) wait(ctx context.Context) error {
+	if l.ticker == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ticker.C:
+		return nil
+	}
+}
+
+func (l limiter) stop() {
+	if l.ticker != nil {
+		l.ticker.Stop()
+	}
+}
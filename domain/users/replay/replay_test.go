@@ -0,0 +1,166 @@
+//+build unit
+
+package replay_test
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/replay"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mock_replay "code/tech-test/domain/users/replay/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func testUsers(ids ...int) []models.User {
+	var users []models.User = make([]models.User, 0)
+
+	for _, id := range ids {
+		user := models.NewUser(id, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+		user.Meta.HydrateMeta(1, time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), id%2 == 0)
+		users = append(users, user)
+	}
+
+	return users
+}
+
+func page(after, limit int) query.Query {
+	sort := query.Sort{Field: "id"}
+
+	q := query.Query{Sort: sort, Limit: limit, IncludeDisabled: true}
+	if after > 0 {
+		q.After = &query.Cursor{Sort: sort, Value: after, ID: after}
+	}
+
+	return q
+}
+
+func Test_Replayer_Run(t *testing.T) {
+
+	config := replay.Config{BatchSize: 2, IncludeDisabled: true}
+	unavailable := errors.New("database unavailable")
+
+	type testExpectation struct {
+		report replay.Report
+		err    error
+	}
+
+	testCases := []struct {
+		description string
+		config      func(config replay.Config) replay.Config
+		setup       func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints)
+		expected    testExpectation
+	}{
+		{
+			description: "when every user is replayed",
+			setup: func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints) {
+				checkpoints.EXPECT().Load().Return(replay.Checkpoint{}, nil)
+				store.EXPECT().List(gomock.Any(), page(0, 2)).Return(testUsers(1, 2), nil)
+				checkpoints.EXPECT().Save(gomock.Any()).DoAndReturn(func(checkpoint replay.Checkpoint) error {
+					if checkpoint.LastID != 2 || checkpoint.Published != 2 {
+						return errors.New("unexpected checkpoint")
+					}
+					return nil
+				})
+				store.EXPECT().List(gomock.Any(), page(2, 2)).Return(testUsers(3), nil)
+				store.EXPECT().Snapshot(gomock.Any(), gomock.Any(), gomock.AssignableToTypeOf(models.UserSnapshot{})).Return(models.User{}, nil).Times(3)
+				checkpoints.EXPECT().Clear().Return(nil)
+			},
+			expected: testExpectation{
+				report: replay.Report{Users: 3, Disabled: 1, Published: 3},
+			},
+		},
+		{
+			description: "when resuming from a checkpoint",
+			setup: func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints) {
+				checkpoints.EXPECT().Load().Return(replay.Checkpoint{LastID: 2, Published: 2, StartedAt: time.Now()}, nil)
+				store.EXPECT().List(gomock.Any(), page(2, 2)).Return(testUsers(3), nil)
+				store.EXPECT().Snapshot(gomock.Any(), 3, gomock.Any()).Return(testUsers(3)[0], nil)
+				checkpoints.EXPECT().Clear().Return(nil)
+			},
+			expected: testExpectation{
+				report: replay.Report{Users: 1, Published: 3, Resumed: 2},
+			},
+		},
+		{
+			description: "when a user was purged since it was listed",
+			setup: func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints) {
+				checkpoints.EXPECT().Load().Return(replay.Checkpoint{}, nil)
+				store.EXPECT().List(gomock.Any(), page(0, 2)).Return(testUsers(1), nil)
+				store.EXPECT().Snapshot(gomock.Any(), 1, gomock.Any()).Return(models.User{}, postgresql.ErrUserNotFound)
+				checkpoints.EXPECT().Clear().Return(nil)
+			},
+			expected: testExpectation{
+				report: replay.Report{Users: 1},
+			},
+		},
+		{
+			description: "when the snapshot fails",
+			setup: func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints) {
+				checkpoints.EXPECT().Load().Return(replay.Checkpoint{}, nil)
+				store.EXPECT().List(gomock.Any(), page(0, 2)).Return(testUsers(1, 2), nil)
+				store.EXPECT().Snapshot(gomock.Any(), 1, gomock.Any()).Return(testUsers(1)[0], nil)
+				store.EXPECT().Snapshot(gomock.Any(), 2, gomock.Any()).Return(models.User{}, unavailable)
+				checkpoints.EXPECT().Save(gomock.Any()).DoAndReturn(func(checkpoint replay.Checkpoint) error {
+					if checkpoint.LastID != 1 {
+						return errors.New("unexpected checkpoint")
+					}
+					return nil
+				})
+			},
+			expected: testExpectation{
+				report: replay.Report{Users: 2, Disabled: 1, Published: 1},
+				err:    unavailable,
+			},
+		},
+		{
+			description: "when running dry",
+			config: func(config replay.Config) replay.Config {
+				config.DryRun = true
+				return config
+			},
+			setup: func(store *mock_replay.MockUserStore, checkpoints *mock_replay.MockCheckpoints) {
+				checkpoints.EXPECT().Load().Return(replay.Checkpoint{}, nil)
+				store.EXPECT().List(gomock.Any(), page(0, 2)).Return(testUsers(1, 2), nil)
+				store.EXPECT().List(gomock.Any(), page(2, 2)).Return(testUsers(3, 4), nil)
+				store.EXPECT().List(gomock.Any(), page(4, 2)).Return(testUsers(), nil)
+			},
+			expected: testExpectation{
+				report: replay.Report{Users: 4, Disabled: 2},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			store := mock_replay.NewMockUserStore(mockCtrl)
+			checkpoints := mock_replay.NewMockCheckpoints(mockCtrl)
+			tc.setup(store, checkpoints)
+
+			c := config
+			if tc.config != nil {
+				c = tc.config(c)
+			}
+
+			report, err := replay.NewReplayer(store, checkpoints, c).Run(context.TODO())
+
+			if tc.expected.err != nil {
+				g.Expect(errors.Is(err, tc.expected.err)).To(BeTrue(), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			}
+			g.Expect(report).To(Equal(tc.expected.report), "should report the users")
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+//go:generate mockgen -source=history.go -destination=mock/history_mock.go
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultHistoryLimit = 20
+	MaxHistoryLimit     = 100
+)
+
+var ErrVersionNotFound = errors.New("version not found")
+
+type HistoryStore interface {
+	History(ctx context.Context, id int, after uint32, limit int) ([]models.HistoryEntry, error)
+	GetVersion(ctx context.Context, id int, version uint32) (models.HistoryEntry, error)
+}
+
+type HistoryQuery struct {
+	ID int
+	// After is the last version of the previous page, 0 for the first page.
+	After uint32
+	Limit int
+}
+
+// HistoryPage holds the versions of a user, oldest first. Next is the After
+// of the next page, 0 on the last one.
+type HistoryPage struct {
+	Entries []models.HistoryEntry
+	Next    uint32
+	Limit   int
+}
+
+type HistoryService struct {
+	store HistoryStore
+}
+
+func NewHistoryService(store HistoryStore) HistoryService {
+	return HistoryService{
+		store: store,
+	}
+}
+
+// History returns a single page of the versions of the user. One more entry
+// than the limit is fetched to know whether there is a next page.
+func (s HistoryService) History(ctx context.Context, q HistoryQuery) (HistoryPage, error) {
+	if q.Limit <= 0 || q.Limit > MaxHistoryLimit {
+		return HistoryPage{}, ErrInvalidQuery
+	}
+
+	entries, err := s.store.History(ctx, q.ID, q.After, q.Limit+1)
+	if err != nil {
+		return HistoryPage{}, fmt.Errorf("%w failed to list history", err)
+	}
+
+	// every stored user has a version, so an empty first page means no user
+	if len(entries) == 0 && q.After == 0 {
+		return HistoryPage{}, ErrUserNotFound
+	}
+
+	page := HistoryPage{
+		Entries: entries,
+		Limit:   q.Limit,
+	}
+
+	if len(entries) > q.Limit {
+		page.Entries = entries[:q.Limit]
+		page.Next = page.Entries[q.Limit-1].Version()
+	}
+
+	return page, nil
+}
+
+// UserAt returns the user as of the version.
+func (s HistoryService) UserAt(ctx context.Context, id int, version uint32) (models.HistoryEntry, error) {
+	entry, err := s.store.GetVersion(ctx, id, version)
+	if err != nil {
+		switch err {
+		case postgresql.ErrVersionNotFound:
+			return models.HistoryEntry{}, ErrVersionNotFound
+		default:
+			return models.HistoryEntry{}, fmt.Errorf("%w failed to get version", err)
+		}
+	}
+
+	return entry, nil
+}
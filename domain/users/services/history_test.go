@@ -0,0 +1,148 @@
+//+build unit
+
+package services
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"fmt"
+	"testing"
+
+	mock_services "code/tech-test/domain/users/services/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func historyEntries(versions ...uint32) []models.HistoryEntry {
+	var entries []models.HistoryEntry
+
+	for _, version := range versions {
+		user := models.NewUser(1, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+		user.Meta.SetVersion(version)
+
+		entries = append(entries, models.HistoryEntry{User: user, Changes: []string{}})
+	}
+
+	return entries
+}
+
+func Test_History(t *testing.T) {
+
+	type testExpectation struct {
+		err      error
+		versions []uint32
+		next     uint32
+	}
+
+	testCases := []struct {
+		description string
+		input       HistoryQuery
+		setup       func(ctx context.Context, store *mock_services.MockHistoryStore)
+		expected    testExpectation
+	}{
+		{
+			description: "when the history fits in a page",
+			input:       HistoryQuery{ID: 1, Limit: 3},
+			setup: func(ctx context.Context, store *mock_services.MockHistoryStore) {
+				store.EXPECT().History(ctx, 1, uint32(0), 4).Return(historyEntries(1, 2, 3), nil)
+			},
+			expected: testExpectation{versions: []uint32{1, 2, 3}},
+		},
+		{
+			description: "when there is a next page",
+			input:       HistoryQuery{ID: 1, Limit: 2},
+			setup: func(ctx context.Context, store *mock_services.MockHistoryStore) {
+				store.EXPECT().History(ctx, 1, uint32(0), 3).Return(historyEntries(1, 2, 3), nil)
+			},
+			expected: testExpectation{versions: []uint32{1, 2}, next: 2},
+		},
+		{
+			description: "when reading the next page",
+			input:       HistoryQuery{ID: 1, After: 2, Limit: 2},
+			setup: func(ctx context.Context, store *mock_services.MockHistoryStore) {
+				store.EXPECT().History(ctx, 1, uint32(2), 3).Return(historyEntries(3), nil)
+			},
+			expected: testExpectation{versions: []uint32{3}},
+		},
+		{
+			description: "when the user has no history",
+			input:       HistoryQuery{ID: 1, Limit: 2},
+			setup: func(ctx context.Context, store *mock_services.MockHistoryStore) {
+				store.EXPECT().History(ctx, 1, uint32(0), 3).Return(historyEntries(), nil)
+			},
+			expected: testExpectation{err: ErrUserNotFound},
+		},
+		{
+			description: "when the limit is invalid",
+			input:       HistoryQuery{ID: 1},
+			setup:       func(ctx context.Context, store *mock_services.MockHistoryStore) {},
+			expected:    testExpectation{err: ErrInvalidQuery},
+		},
+		{
+			description: "when the limit is above the maximum",
+			input:       HistoryQuery{ID: 1, Limit: MaxHistoryLimit + 1},
+			setup:       func(ctx context.Context, store *mock_services.MockHistoryStore) {},
+			expected:    testExpectation{err: ErrInvalidQuery},
+		},
+		{
+			description: "when the history fails to be listed",
+			input:       HistoryQuery{ID: 1, Limit: 2},
+			setup: func(ctx context.Context, store *mock_services.MockHistoryStore) {
+				store.EXPECT().History(ctx, 1, uint32(0), 3).Return(nil, ERROR)
+			},
+			expected: testExpectation{err: fmt.Errorf("%w failed to list history", ERROR)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx := context.TODO()
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			store := mock_services.NewMockHistoryStore(mockCtrl)
+			tc.setup(ctx, store)
+
+			page, err := NewHistoryService(store).History(ctx, tc.input)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+
+			var versions []uint32
+			for _, entry := range page.Entries {
+				versions = append(versions, entry.Version())
+			}
+
+			g.Expect(versions).To(Equal(tc.expected.versions), "should return the versions of the page")
+			g.Expect(page.Next).To(Equal(tc.expected.next), "should point to the next page")
+		})
+	}
+}
+
+func Test_UserAt(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	store := mock_services.NewMockHistoryStore(mockCtrl)
+	service := NewHistoryService(store)
+
+	store.EXPECT().GetVersion(ctx, 1, uint32(2)).Return(historyEntries(2)[0], nil)
+	entry, err := service.UserAt(ctx, 1, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "should return the version")
+	g.Expect(entry.Version()).To(Equal(uint32(2)), "should return the requested version")
+
+	store.EXPECT().GetVersion(ctx, 1, uint32(9)).Return(models.HistoryEntry{}, postgresql.ErrVersionNotFound)
+	_, err = service.UserAt(ctx, 1, 9)
+	g.Expect(err).To(Equal(ErrVersionNotFound), "should not find unknown versions")
+}
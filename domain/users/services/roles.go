@@ -0,0 +1,139 @@
+package services
+
+//go:generate mockgen -source=roles.go -destination=mock/roles_mock.go
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleInUse    = errors.New("role is assigned to users")
+	ErrInvalidRole  = models.ErrInvalidRole
+	ErrForbidden    = errors.New("permission denied")
+)
+
+type RoleStore interface {
+	Get(ctx context.Context, name string) (models.Role, error)
+	List(ctx context.Context) ([]models.Role, error)
+	Store(ctx context.Context, role models.Role, version uint32) (models.Role, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type CreateRoleParams struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// UpdateRoleParams replaces the permissions when they are not nil, an empty
+// list removes every permission.
+type UpdateRoleParams struct {
+	Name        string
+	Description string
+	Permissions []string
+	Version     uint32
+}
+
+type RoleService struct {
+	store RoleStore
+}
+
+func NewRoleService(store RoleStore) RoleService {
+	return RoleService{
+		store: store,
+	}
+}
+
+func (s RoleService) GetRole(ctx context.Context, name string) (models.Role, error) {
+	role, err := s.store.Get(ctx, name)
+	if err != nil {
+		switch err {
+		case postgresql.ErrRoleNotFound:
+			return models.Role{}, ErrRoleNotFound
+		default:
+			return models.Role{}, fmt.Errorf("%w failed to get role", err)
+		}
+	}
+
+	return role, nil
+}
+
+func (s RoleService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	roles, err := s.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list roles", err)
+	}
+
+	return roles, nil
+}
+
+func (s RoleService) CreateRole(ctx context.Context, params CreateRoleParams) (models.Role, error) {
+	role := models.NewRole(params.Name, params.Description, params.Permissions)
+	if err := role.Validate(); err != nil {
+		return models.Role{}, err
+	}
+
+	role, err := s.store.Store(ctx, role, 0)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUniqueViolation, postgresql.ErrWrongVersion:
+			return models.Role{}, ErrRoleExists
+		default:
+			return models.Role{}, fmt.Errorf("%w failed to store role", err)
+		}
+	}
+
+	return role, nil
+}
+
+func (s RoleService) UpdateRole(ctx context.Context, params UpdateRoleParams) (models.Role, error) {
+	role, err := s.GetRole(ctx, params.Name)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	if params.Description != "" {
+		role.SetDescription(params.Description)
+	}
+	if params.Permissions != nil {
+		role.SetPermissions(params.Permissions)
+	}
+
+	if err := role.Validate(); err != nil {
+		return models.Role{}, err
+	}
+
+	role, err = s.store.Store(ctx, role, params.Version)
+	if err != nil {
+		switch err {
+		case postgresql.ErrWrongVersion:
+			return models.Role{}, ErrWrongVersion
+		default:
+			return models.Role{}, fmt.Errorf("%w failed to store role", err)
+		}
+	}
+
+	return role, nil
+}
+
+func (s RoleService) DeleteRole(ctx context.Context, name string) error {
+	err := s.store.Delete(ctx, name)
+	if err != nil {
+		switch err {
+		case postgresql.ErrRoleNotFound:
+			return ErrRoleNotFound
+		case postgresql.ErrRoleInUse:
+			return ErrRoleInUse
+		default:
+			return fmt.Errorf("%w failed to delete role", err)
+		}
+	}
+
+	return nil
+}
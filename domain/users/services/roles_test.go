@@ -0,0 +1,223 @@
+//+build unit
+
+package services
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"testing"
+
+	mock_services "code/tech-test/domain/users/services/mock"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+)
+
+func setupRoleTest(t *testing.T) (context.Context, *mock_services.MockUserStore, *mock_services.MockRoleStore, UserService, RoleService) {
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	users := mock_services.NewMockUserStore(mockCtrl)
+	roles := mock_services.NewMockRoleStore(mockCtrl)
+
+	return ctx, users, roles, NewUserService(users, roles, fakeHasher{}), NewRoleService(roles)
+}
+
+func Test_CreateRole(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		input       CreateRoleParams
+		setup       func(ctx context.Context, roles *mock_services.MockRoleStore)
+		expected    error
+	}{
+		{
+			description: "when the role is created",
+			input:       CreateRoleParams{Name: "support", Permissions: []string{"users:read", "users:read", "roles:manage"}},
+			setup: func(ctx context.Context, roles *mock_services.MockRoleStore) {
+				roles.EXPECT().Store(ctx, gomock.Any(), uint32(0)).DoAndReturn(
+					func(ctx context.Context, role models.Role, version uint32) (models.Role, error) {
+						NewWithT(t).Expect(role.Permissions).To(Equal([]string{"roles:manage", "users:read"}), "should store each permission once")
+						return role, nil
+					})
+			},
+		},
+		{
+			description: "when the role already exists",
+			input:       CreateRoleParams{Name: "admin"},
+			setup: func(ctx context.Context, roles *mock_services.MockRoleStore) {
+				roles.EXPECT().Store(ctx, gomock.Any(), uint32(0)).Return(models.Role{}, postgresql.ErrWrongVersion)
+			},
+			expected: ErrRoleExists,
+		},
+		{
+			description: "when the role name is invalid",
+			input:       CreateRoleParams{Name: "Support Team"},
+			setup:       func(ctx context.Context, roles *mock_services.MockRoleStore) {},
+			expected:    ErrInvalidRole,
+		},
+		{
+			description: "when a permission is invalid",
+			input:       CreateRoleParams{Name: "support", Permissions: []string{"users read"}},
+			setup:       func(ctx context.Context, roles *mock_services.MockRoleStore) {},
+			expected:    ErrInvalidRole,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, _, roles, _, service := setupRoleTest(t)
+
+			tc.setup(ctx, roles)
+
+			_, err := service.CreateRole(ctx, tc.input)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			}
+		})
+	}
+}
+
+func Test_DeleteRole(t *testing.T) {
+	g := NewWithT(t)
+	ctx, _, roles, _, service := setupRoleTest(t)
+
+	roles.EXPECT().Delete(ctx, "admin").Return(postgresql.ErrRoleInUse)
+	roles.EXPECT().Delete(ctx, "unknown").Return(postgresql.ErrRoleNotFound)
+
+	g.Expect(service.DeleteRole(ctx, "admin")).To(Equal(ErrRoleInUse), "should not delete assigned roles")
+	g.Expect(service.DeleteRole(ctx, "unknown")).To(Equal(ErrRoleNotFound), "should report unknown roles")
+}
+
+func Test_AssignRole(t *testing.T) {
+
+	user := models.NewUser(1, "Test", "Test", "testuser", "hash:qwerty", "example@example.qqq", "uk")
+	user.Meta.SetVersion(1)
+
+	withRole := models.NewUser(1, "Test", "Test", "testuser", "hash:qwerty", "example@example.qqq", "uk")
+	withRole.Roles = []string{"admin"}
+	withRole.Meta.SetVersion(1)
+
+	testCases := []struct {
+		description string
+		input       RoleAssignmentParams
+		setup       func(ctx context.Context, users *mock_services.MockUserStore, roles *mock_services.MockRoleStore)
+		expected    error
+	}{
+		{
+			description: "when the role is assigned",
+			input:       RoleAssignmentParams{ID: 1, Role: "admin"},
+			setup: func(ctx context.Context, users *mock_services.MockUserStore, roles *mock_services.MockRoleStore) {
+				users.EXPECT().Get(ctx, 1).Return(user, nil)
+				roles.EXPECT().Get(ctx, "admin").Return(models.NewRole("admin", "", []string{"admin"}), nil)
+				users.EXPECT().Store(ctx, gomock.Any(), uint32(1)).DoAndReturn(
+					func(ctx context.Context, stored models.User, version uint32) (models.User, error) {
+						NewWithT(t).Expect(stored.Roles).To(Equal([]string{"admin"}), "should store the role")
+						return stored, nil
+					})
+			},
+		},
+		{
+			description: "when the role is already assigned",
+			input:       RoleAssignmentParams{ID: 1, Role: "admin"},
+			setup: func(ctx context.Context, users *mock_services.MockUserStore, roles *mock_services.MockRoleStore) {
+				users.EXPECT().Get(ctx, 1).Return(withRole, nil)
+				roles.EXPECT().Get(ctx, "admin").Return(models.NewRole("admin", "", []string{"admin"}), nil)
+			},
+		},
+		{
+			description: "when the role does not exist",
+			input:       RoleAssignmentParams{ID: 1, Role: "unknown"},
+			setup: func(ctx context.Context, users *mock_services.MockUserStore, roles *mock_services.MockRoleStore) {
+				users.EXPECT().Get(ctx, 1).Return(user, nil)
+				roles.EXPECT().Get(ctx, "unknown").Return(models.Role{}, postgresql.ErrRoleNotFound)
+			},
+			expected: ErrRoleNotFound,
+		},
+		{
+			description: "when the user changed meanwhile",
+			input:       RoleAssignmentParams{ID: 1, Role: "admin"},
+			setup: func(ctx context.Context, users *mock_services.MockUserStore, roles *mock_services.MockRoleStore) {
+				users.EXPECT().Get(ctx, 1).Return(user, nil)
+				roles.EXPECT().Get(ctx, "admin").Return(models.NewRole("admin", "", []string{"admin"}), nil)
+				users.EXPECT().Store(ctx, gomock.Any(), uint32(1)).Return(models.User{}, postgresql.ErrWrongVersion)
+			},
+			expected: ErrWrongVersion,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, users, roles, service, _ := setupRoleTest(t)
+
+			tc.setup(ctx, users, roles)
+
+			result, err := service.AssignRole(ctx, tc.input)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(result.Roles).To(Equal([]string{"admin"}), "should return the user with the role")
+			}
+		})
+	}
+}
+
+func Test_Authorize(t *testing.T) {
+
+	support := models.NewUser(1, "Test", "Test", "testuser", "hash:qwerty", "example@example.qqq", "uk")
+	support.Roles = []string{"removed", "support"}
+
+	admin := models.NewUser(2, "Test", "Test", "testuser-2", "hash:qwerty", "example-2@example.qqq", "uk")
+	admin.Roles = []string{"admin"}
+
+	testCases := []struct {
+		description string
+		input       models.User
+		permission  string
+		expected    error
+	}{
+		{
+			description: "when a role grants the permission",
+			input:       support,
+			permission:  "users:read",
+		},
+		{
+			description: "when no role grants the permission",
+			input:       support,
+			permission:  "roles:manage",
+			expected:    ErrForbidden,
+		},
+		{
+			description: "when the user is an admin",
+			input:       admin,
+			permission:  "roles:manage",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, users, roles, service, _ := setupRoleTest(t)
+
+			users.EXPECT().Get(ctx, tc.input.ID).Return(tc.input, nil)
+			roles.EXPECT().Get(ctx, "removed").Return(models.Role{}, postgresql.ErrRoleNotFound).AnyTimes()
+			roles.EXPECT().Get(ctx, "support").Return(models.NewRole("support", "", []string{"users:read"}), nil).AnyTimes()
+			roles.EXPECT().Get(ctx, "admin").Return(models.NewRole("admin", "", []string{"admin"}), nil).AnyTimes()
+
+			err := service.Authorize(ctx, tc.input.ID, tc.permission)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should grant the permission")
+			}
+		})
+	}
+}
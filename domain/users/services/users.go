@@ -3,26 +3,50 @@ package services
 //go:generate mockgen -source=users.go -destination=mock/users_mock.go
 
 import (
+	"code/tech-test/domain/tracing"
 	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
 	"code/tech-test/repositories/postgresql"
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"sync"
 )
 
 var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrWrongVersion = errors.New("wrong version provided")
+	ErrInvalidQuery = errors.New("invalid query")
+	ErrUserActive   = errors.New("user is not deleted")
+	ErrUserTaken    = errors.New("nickname or email taken by another user")
+	ErrUserErased   = errors.New("user erased")
+	ErrUserExists   = errors.New("user already exists")
+
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
 type UserStore interface {
 	Get(ctx context.Context, id int) (models.User, error)
-	List(ctx context.Context, queryTerms map[string]string) ([]models.User, error)
+	GetByLogin(ctx context.Context, login string) (models.User, error)
+	List(ctx context.Context, q query.Query) ([]models.User, error)
+	Count(ctx context.Context, q query.Query) (int, error)
 	Store(ctx context.Context, user models.User, version uint32) (models.User, error)
-	Delete(ctx context.Context, id int) (models.User, error)
+	Delete(ctx context.Context, id int, version uint32) (models.User, error)
+	Restore(ctx context.Context, id int, version uint32) (models.User, error)
+	Purge(ctx context.Context, id int, version uint32) (models.User, error)
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
 }
 
+// CreateUserParams take the id of the user when the system creating it owns
+// the ids, 0 for one assigned by the store.
 type CreateUserParams struct {
+	ID        int
 	FirstName string
 	LastName  string
 	Nickname  string
@@ -42,21 +66,68 @@ type UpdateUserParams struct {
 	Version   uint32
 }
 
+// DeleteUserParams, RestoreUserParams and PurgeUserParams take the version
+// the change is made against, 0 for the current one.
 type DeleteUserParams struct {
-	ID int
+	ID      int
+	Version uint32
+}
+
+type RestoreUserParams struct {
+	ID      int
+	Version uint32
+}
+
+type PurgeUserParams struct {
+	ID      int
+	Version uint32
+}
+
+type RoleAssignmentParams struct {
+	ID   int
+	Role string
 }
 
 type UserService struct {
-	store UserStore
+	store  UserStore
+	roles  RoleStore
+	hasher PasswordHasher
+	dummy  *dummyHash
 }
 
-func NewUserService(store UserStore) UserService {
+func NewUserService(store UserStore, roles RoleStore, hasher PasswordHasher) UserService {
 	return UserService{
-		store: store,
+		store:  store,
+		roles:  roles,
+		hasher: hasher,
+		dummy:  &dummyHash{},
 	}
 }
 
+// dummyHash is the hash unknown logins are verified against, so they take as
+// long as wrong passwords and cannot be told apart. It is made once, with the
+// algorithm and parameters of the hasher.
+type dummyHash struct {
+	once sync.Once
+	hash string
+}
+
+func (d *dummyHash) get(hasher PasswordHasher) string {
+	d.once.Do(func() {
+		hash, err := hasher.Hash("dummy password")
+		if err != nil {
+			log.Println(fmt.Errorf("%w failed to hash dummy password", err))
+		}
+		d.hash = hash
+	})
+
+	return d.hash
+}
+
 func (s UserService) GetUser(ctx context.Context, id int) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUser", tracing.KindInternal)
+	defer span.End()
+
 	user, err := s.store.Get(ctx, id)
 	if err != nil {
 		switch err {
@@ -74,20 +145,57 @@ func (s UserService) GetUser(ctx context.Context, id int) (models.User, error) {
 	return user, nil
 }
 
-func (s UserService) ListUsers(ctx context.Context, queryTerms map[string]string) ([]models.User, error) {
-	users, err := s.store.List(ctx, queryTerms)
+// ListUsers returns a single page of the users matching the query. One more
+// user than the limit is fetched to know whether there is a next page.
+func (s UserService) ListUsers(ctx context.Context, q query.Query) (query.Page, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers", tracing.KindInternal)
+	defer span.End()
+
+	if err := q.Validate(); err != nil || q.Limit == 0 {
+		return query.Page{}, ErrInvalidQuery
+	}
+
+	fetch := q
+	fetch.Limit = q.Limit + 1
+
+	users, err := s.store.List(ctx, fetch)
 	if err != nil {
-		return nil, fmt.Errorf("%w failed to list users", err)
+		return query.Page{}, fmt.Errorf("%w failed to list users", err)
+	}
+
+	page := query.Page{
+		Users: users,
+		Limit: q.Limit,
+	}
+
+	if len(users) > q.Limit {
+		page.Users = users[:q.Limit]
+		page.NextCursor = query.CursorFor(page.Users[q.Limit-1], q.Sort).Encode()
 	}
 
-	return users, nil
+	if q.WithTotal {
+		total, err := s.store.Count(ctx, q)
+		if err != nil {
+			return query.Page{}, fmt.Errorf("%w failed to count users", err)
+		}
+
+		page.Total = &total
+	}
+
+	return page, nil
 }
 
 func (s UserService) CreateUser(ctx context.Context, params CreateUserParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser", tracing.KindInternal)
+	defer span.End()
+
 	return s.createUser(ctx, params)
 }
 
 func (s UserService) UpdateUser(ctx context.Context, params UpdateUserParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser", tracing.KindInternal)
+	defer span.End()
+
 	user, err := s.GetUser(ctx, params.ID)
 	if err != nil {
 		return models.User{}, err
@@ -113,7 +221,12 @@ func (s UserService) UpdateUser(ctx context.Context, params UpdateUserParams) (m
 		user.SetNickname(params.Nickname)
 	}
 	if params.Password != "" {
-		user.SetPassword(params.Password)
+		hash, err := s.hasher.Hash(params.Password)
+		if err != nil {
+			return models.User{}, fmt.Errorf("%w failed to hash password", err)
+		}
+
+		user.SetPassword(hash)
 	}
 
 	user, err = s.store.Store(ctx, user, params.Version)
@@ -129,21 +242,261 @@ func (s UserService) UpdateUser(ctx context.Context, params UpdateUserParams) (m
 }
 
 func (s UserService) DeleteUser(ctx context.Context, params DeleteUserParams) (models.User, error) {
-	user, err := s.store.Delete(ctx, params.ID)
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.store.Delete(ctx, params.ID, params.Version)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUserNotFound:
+			return models.User{}, ErrUserNotFound
+		case postgresql.ErrWrongVersion:
+			return models.User{}, ErrWrongVersion
+		default:
+			return models.User{}, fmt.Errorf("%w failed to delete user", err)
+		}
+	}
+
+	return user, nil
+}
+
+// RestoreUser brings back a deleted user, failing when another user took its
+// nickname or email since or when it was erased.
+func (s UserService) RestoreUser(ctx context.Context, params RestoreUserParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.store.Restore(ctx, params.ID, params.Version)
 	if err != nil {
-		return models.User{}, fmt.Errorf("%w failed to delete user", err)
+		switch err {
+		case postgresql.ErrUserNotFound:
+			return models.User{}, ErrUserNotFound
+		case postgresql.ErrWrongVersion:
+			return models.User{}, ErrWrongVersion
+		case postgresql.ErrUserActive:
+			return models.User{}, ErrUserActive
+		case postgresql.ErrUserErased:
+			return models.User{}, ErrUserErased
+		case postgresql.ErrUniqueViolation:
+			return models.User{}, ErrUserTaken
+		default:
+			return models.User{}, fmt.Errorf("%w failed to restore user", err)
+		}
 	}
 
 	return user, nil
 }
 
-func (s UserService) createUser(ctx context.Context, params CreateUserParams) (models.User, error) {
-	user := models.NewUser(0, params.FirstName, params.LastName, params.Nickname, params.Password, params.Email, params.Country)
+// PurgeUser erases a user, deleted or not, for good. The returned user only
+// holds its id and the version of the erasure.
+func (s UserService) PurgeUser(ctx context.Context, params PurgeUserParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PurgeUser", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.store.Purge(ctx, params.ID, params.Version)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUserNotFound:
+			return models.User{}, ErrUserNotFound
+		case postgresql.ErrWrongVersion:
+			return models.User{}, ErrWrongVersion
+		default:
+			return models.User{}, fmt.Errorf("%w failed to purge user", err)
+		}
+	}
+
+	return user, nil
+}
+
+// AssignRole gives the role to the user. Assigning a role the user already
+// has leaves the user untouched.
+func (s UserService) AssignRole(ctx context.Context, params RoleAssignmentParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.AssignRole", tracing.KindInternal)
+	defer span.End()
 
-	user, err := s.store.Store(ctx, user, 0)
+	user, err := s.GetUser(ctx, params.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = s.roles.Get(ctx, params.Role)
 	if err != nil {
+		switch err {
+		case postgresql.ErrRoleNotFound:
+			return models.User{}, ErrRoleNotFound
+		default:
+			return models.User{}, fmt.Errorf("%w failed to get role", err)
+		}
+	}
+
+	if !user.AssignRole(params.Role) {
+		return user, nil
+	}
+
+	return s.storeRoles(ctx, user)
+}
+
+// RevokeRole takes the role away from the user. Revoking a role the user
+// does not have leaves the user untouched.
+func (s UserService) RevokeRole(ctx context.Context, params RoleAssignmentParams) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RevokeRole", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.GetUser(ctx, params.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if !user.RevokeRole(params.Role) {
+		return user, nil
+	}
+
+	return s.storeRoles(ctx, user)
+}
+
+func (s UserService) storeRoles(ctx context.Context, user models.User) (models.User, error) {
+	user, err := s.store.Store(ctx, user, user.Meta.GetVersion())
+	if err != nil {
+		switch err {
+		case postgresql.ErrWrongVersion:
+			return models.User{}, ErrWrongVersion
+		case postgresql.ErrRoleNotFound:
+			return models.User{}, ErrRoleNotFound
+		}
 		return models.User{}, fmt.Errorf("%w failed to store user", err)
 	}
 
 	return user, nil
 }
+
+// Permissions returns the union of the permissions of the roles of the user.
+func (s UserService) Permissions(ctx context.Context, user models.User) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Permissions", tracing.KindInternal)
+	defer span.End()
+
+	var (
+		permissions []string = make([]string, 0)
+		seen                 = make(map[string]bool)
+	)
+
+	for _, name := range user.Roles {
+		role, err := s.roles.Get(ctx, name)
+		if err == postgresql.ErrRoleNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to get role", err)
+		}
+
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+// Authorize returns ErrForbidden unless one of the roles of the user grants
+// the permission. Unlike the scopes of a token it reflects the current roles.
+func (s UserService) Authorize(ctx context.Context, id int, permission string) error {
+	ctx, span := tracing.Start(ctx, "UserService.Authorize", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := s.Permissions(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range permissions {
+		if p == permission || p == models.PermissionAdmin {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// VerifyCredentials returns the active user whose nickname or email is the
+// login when the password matches. Unknown logins are verified against a
+// dummy hash so they take as long as wrong passwords. Hashes made with an
+// outdated algorithm or parameters are replaced on the way, without a new
+// version of the user.
+func (s UserService) VerifyCredentials(ctx context.Context, login, password string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.VerifyCredentials", tracing.KindInternal)
+	defer span.End()
+
+	user, err := s.store.GetByLogin(ctx, login)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUserNotFound:
+			s.hasher.Verify(s.dummy.get(s.hasher), password)
+			return models.User{}, ErrInvalidCredentials
+		default:
+			return models.User{}, fmt.Errorf("%w failed to get user", err)
+		}
+	}
+
+	ok, err := s.hasher.Verify(user.Password, password)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to verify password", err)
+	}
+	if !ok {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if !s.hasher.NeedsRehash(user.Password) {
+		return user, nil
+	}
+
+	// a failed rehash, like a concurrent update, must not fail the login,
+	// the hash is upgraded on the next one instead
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Println(fmt.Errorf("%w failed to rehash password of user %d", err, user.ID))
+		return user, nil
+	}
+
+	user.RehashPassword(hash)
+
+	// the rehash registers no event, so the store keeps the version and the
+	// next update of the clients holding it still succeeds
+	rehashed, err := s.store.Store(ctx, user, user.Meta.GetVersion())
+	if err != nil {
+		log.Println(fmt.Errorf("%w failed to store rehashed password of user %d", err, user.ID))
+		return user, nil
+	}
+
+	return rehashed, nil
+}
+
+func (s UserService) createUser(ctx context.Context, params CreateUserParams) (models.User, error) {
+	hash, err := s.hasher.Hash(params.Password)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to hash password", err)
+	}
+
+	user := models.CreateUser(params.FirstName, params.LastName, params.Nickname, hash, params.Email, params.Country)
+	user.ID = params.ID
+
+	user, err = s.store.Store(ctx, user, 0)
+	if err != nil {
+		switch err {
+		case postgresql.ErrUserExists:
+			return models.User{}, ErrUserExists
+		case postgresql.ErrUserErased:
+			return models.User{}, ErrUserErased
+		default:
+			return models.User{}, fmt.Errorf("%w failed to store user", err)
+		}
+	}
+
+	return user, nil
+}
@@ -5,9 +5,11 @@ package services
 import (
 	"code/tech-test/domain"
 	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
 	"code/tech-test/repositories/postgresql"
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,11 +22,39 @@ import (
 
 var ERROR = fmt.Errorf("error")
 
+// fakeHasher prefixes passwords instead of hashing them so the expected
+// users can be written down. Passwords without the prefix are outdated.
+type fakeHasher struct{}
+
+func (h fakeHasher) Hash(password string) (string, error) {
+	return "hash:" + password, nil
+}
+
+func (h fakeHasher) Verify(hash, password string) (bool, error) {
+	return hash == "hash:"+password || hash == password, nil
+}
+
+func (h fakeHasher) NeedsRehash(hash string) bool {
+	return !strings.HasPrefix(hash, "hash:")
+}
+
+// recordingHasher records the hashes it verifies.
+type recordingHasher struct {
+	fakeHasher
+	verified []string
+}
+
+func (h *recordingHasher) Verify(hash, password string) (bool, error) {
+	h.verified = append(h.verified, hash)
+
+	return h.fakeHasher.Verify(hash, password)
+}
+
 func setupUserTest(t *testing.T) (context.Context, *gomock.Controller, *mock_services.MockUserStore, UserService) {
 	ctx := context.TODO()
 	mockCtrl := gomock.NewController(t)
 	repo := mock_services.NewMockUserStore(mockCtrl)
-	service := NewUserService(repo)
+	service := NewUserService(repo, mock_services.NewMockRoleStore(mockCtrl), fakeHasher{})
 
 	return ctx, mockCtrl, repo, service
 }
@@ -121,62 +151,80 @@ func Test_ListUsers(t *testing.T) {
 
 	type testExpectation struct {
 		err  error
-		user []models.User
+		page query.Page
 	}
 
+	user := func(id int) models.User {
+		return models.User{
+			Country:   "uk",
+			Email:     "example@example.com",
+			FirstName: "test",
+			LastName:  "test",
+			Nickname:  "test",
+			Password:  "test",
+			ID:        id,
+		}
+	}
+
+	total := 3
+
 	testCases := []struct {
 		description string
 		setup       func(ctx context.Context, repo *mock_services.MockUserStore)
-		input       map[string]string
+		input       query.Query
 		expected    testExpectation
 	}{
 		{
 			description: "when the users are listed",
 			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
-				repo.EXPECT().List(ctx, nil).Return([]models.User{
-					{
-						Country:   "uk",
-						Email:     "example@example.com",
-						FirstName: "test",
-						LastName:  "test",
-						Nickname:  "test",
-						Password:  "test",
-					},
+				repo.EXPECT().List(ctx, query.Query{Sort: query.Sort{Field: "id"}, Limit: 3}).Return([]models.User{
+					user(1),
 				}, nil)
 			},
-			input: nil,
+			input: query.Query{Sort: query.Sort{Field: "id"}, Limit: 2},
 			expected: testExpectation{
 				err: nil,
-				user: []models.User{
-					{
-						Country:   "uk",
-						Email:     "example@example.com",
-						FirstName: "test",
-						LastName:  "test",
-						Nickname:  "test",
-						Password:  "test",
-					},
+				page: query.Page{
+					Users: []models.User{user(1)},
+					Limit: 2,
 				},
 			},
 		},
+		{
+			description: "when there are more users than the limit",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().List(ctx, query.Query{Sort: query.Sort{Field: "id"}, Limit: 3, WithTotal: true}).Return([]models.User{
+					user(1), user(2), user(3),
+				}, nil)
+				repo.EXPECT().Count(ctx, query.Query{Sort: query.Sort{Field: "id"}, Limit: 2, WithTotal: true}).Return(3, nil)
+			},
+			input: query.Query{Sort: query.Sort{Field: "id"}, Limit: 2, WithTotal: true},
+			expected: testExpectation{
+				err: nil,
+				page: query.Page{
+					Users:      []models.User{user(1), user(2)},
+					Limit:      2,
+					NextCursor: query.CursorFor(user(2), query.Sort{Field: "id"}).Encode(),
+					Total:      &total,
+				},
+			},
+		},
+		{
+			description: "when the query is invalid",
+			setup:       func(ctx context.Context, repo *mock_services.MockUserStore) {},
+			input:       query.Query{Sort: query.Sort{Field: "password"}, Limit: 2},
+			expected: testExpectation{
+				err: ErrInvalidQuery,
+			},
+		},
 		{
 			description: "when the request to list users fails",
 			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
-				repo.EXPECT().List(ctx, nil).Return(nil, ERROR)
+				repo.EXPECT().List(ctx, query.Query{Sort: query.Sort{Field: "id"}, Limit: 3}).Return(nil, ERROR)
 			},
-			input: nil,
+			input: query.Query{Sort: query.Sort{Field: "id"}, Limit: 2},
 			expected: testExpectation{
 				err: fmt.Errorf("%w failed to list users", ERROR),
-				user: []models.User{
-					{
-						Country:   "uk",
-						Email:     "example@example.com",
-						FirstName: "test",
-						LastName:  "test",
-						Nickname:  "test",
-						Password:  "test",
-					},
-				},
 			},
 		},
 	}
@@ -191,12 +239,12 @@ func Test_ListUsers(t *testing.T) {
 
 			testCase.setup(ctx, repo)
 
-			users, err := service.ListUsers(ctx, testCase.input)
+			page, err := service.ListUsers(ctx, testCase.input)
 
 			if testCase.expected.err != nil {
 				g.Expect(testCase.expected.err).To(Equal(err), "error when fetching user")
 			} else {
-				g.Expect(users).To(Equal(testCase.expected.user), "should return the expected user")
+				g.Expect(page).To(Equal(testCase.expected.page), "should return the expected page")
 			}
 
 		})
@@ -215,6 +263,9 @@ func Test_CreateUser(t *testing.T) {
 	defer f.Undo()
 	f.Do()
 
+	created := domain.NewMeta()
+	created.RegisterChanges(models.UserCreated{At: time.Now().UTC()})
+
 	testCases := []struct {
 		description string
 		setup       func(ctx context.Context, repo *mock_services.MockUserStore)
@@ -230,9 +281,9 @@ func Test_CreateUser(t *testing.T) {
 					FirstName: "test",
 					LastName:  "test",
 					Nickname:  "test",
-					Password:  "test",
+					Password:  "hash:test",
 					ID:        0,
-					Meta:      domain.NewMeta(),
+					Meta:      created,
 				}, uint32(0)).Return(models.User{
 					Country:   "uk",
 					Email:     "example@example.com",
@@ -266,6 +317,33 @@ func Test_CreateUser(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "when a user already has the given id",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Store(ctx, models.User{
+					Country:   "uk",
+					Email:     "example@example.com",
+					FirstName: "test",
+					LastName:  "test",
+					Nickname:  "test",
+					Password:  "hash:test",
+					ID:        7,
+					Meta:      created,
+				}, uint32(0)).Return(models.User{}, postgresql.ErrUserExists)
+			},
+			input: CreateUserParams{
+				ID:        7,
+				Country:   "uk",
+				Email:     "example@example.com",
+				FirstName: "test",
+				LastName:  "test",
+				Nickname:  "test",
+				Password:  "test",
+			},
+			expected: testExpectation{
+				err: ErrUserExists,
+			},
+		},
 		{
 			description: "when the user fails to be created",
 			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
@@ -275,9 +353,9 @@ func Test_CreateUser(t *testing.T) {
 					FirstName: "test",
 					LastName:  "test",
 					Nickname:  "test",
-					Password:  "test",
+					Password:  "hash:test",
 					ID:        0,
-					Meta:      domain.NewMeta(),
+					Meta:      created,
 				}, uint32(0)).Return(models.User{}, ERROR)
 			},
 			input: CreateUserParams{
@@ -351,12 +429,13 @@ func Test_UpdateUser(t *testing.T) {
 
 				meta := domain.NewMeta()
 
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
+				meta.RegisterChanges(
+					models.CountryChanged{Old: "uk", New: "ab", At: time.Now().UTC()},
+					models.EmailChanged{Old: "example@example.com", New: "example-updated@example.com", At: time.Now().UTC()},
+					models.FirstNameChanged{Old: "test", New: "test-updated", At: time.Now().UTC()},
+					models.LastNameChanged{Old: "test", New: "test-updated", At: time.Now().UTC()},
+					models.PasswordChanged{At: time.Now().UTC()},
+				)
 
 				repo.EXPECT().Store(ctx, models.User{
 					Country:   "ab",
@@ -364,7 +443,7 @@ func Test_UpdateUser(t *testing.T) {
 					FirstName: "test-updated",
 					LastName:  "test-updated",
 					Nickname:  "testuser",
-					Password:  "test-updated",
+					Password:  "hash:test-updated",
 					ID:        1,
 					Meta:      meta,
 				}, uint32(0)).Return(models.User{
@@ -439,12 +518,13 @@ func Test_UpdateUser(t *testing.T) {
 
 				meta := domain.NewMeta()
 
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
-				meta.RegisterChanges(struct{}{})
+				meta.RegisterChanges(
+					models.CountryChanged{Old: "uk", New: "ab", At: time.Now().UTC()},
+					models.EmailChanged{Old: "example@example.com", New: "example-updated@example.com", At: time.Now().UTC()},
+					models.FirstNameChanged{Old: "test", New: "test-updated", At: time.Now().UTC()},
+					models.LastNameChanged{Old: "test", New: "test-updated", At: time.Now().UTC()},
+					models.PasswordChanged{At: time.Now().UTC()},
+				)
 
 				repo.EXPECT().Store(ctx, models.User{
 					Country:   "ab",
@@ -452,7 +532,7 @@ func Test_UpdateUser(t *testing.T) {
 					FirstName: "test-updated",
 					LastName:  "test-updated",
 					Nickname:  "testuser",
-					Password:  "test-updated",
+					Password:  "hash:test-updated",
 					ID:        1,
 					Meta:      meta,
 				}, uint32(1)).Return(models.User{}, ERROR)
@@ -516,7 +596,7 @@ func Test_DeleteUser(t *testing.T) {
 		{
 			description: "when the user is deleted",
 			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
-				repo.EXPECT().Delete(ctx, 1).Return(models.User{
+				repo.EXPECT().Delete(ctx, 1, uint32(0)).Return(models.User{
 					Meta: expectedMeta,
 				}, nil)
 			},
@@ -530,10 +610,35 @@ func Test_DeleteUser(t *testing.T) {
 				err: nil,
 			},
 		},
+		{
+			description: "when the user is already deleted",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Delete(ctx, 1, uint32(0)).Return(models.User{}, postgresql.ErrUserNotFound)
+			},
+			input: DeleteUserParams{
+				ID: 1,
+			},
+			expected: testExpectation{
+				err: ErrUserNotFound,
+			},
+		},
+		{
+			description: "when the version is outdated",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Delete(ctx, 1, uint32(2)).Return(models.User{}, postgresql.ErrWrongVersion)
+			},
+			input: DeleteUserParams{
+				ID:      1,
+				Version: 2,
+			},
+			expected: testExpectation{
+				err: ErrWrongVersion,
+			},
+		},
 		{
 			description: "when the user fails to be deleted",
 			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
-				repo.EXPECT().Delete(ctx, 1).Return(models.User{}, ERROR)
+				repo.EXPECT().Delete(ctx, 1, uint32(0)).Return(models.User{}, ERROR)
 			},
 			input: DeleteUserParams{
 				ID: 1,
@@ -566,3 +671,297 @@ func Test_DeleteUser(t *testing.T) {
 		})
 	}
 }
+
+func Test_RestoreUser(t *testing.T) {
+
+	restored := models.NewUser(1, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+	restored.Meta.HydrateMeta(3, time.Time{}, time.Time{}, false)
+
+	testCases := []struct {
+		description string
+		input       RestoreUserParams
+		setup       func(ctx context.Context, repo *mock_services.MockUserStore)
+		expected    error
+	}{
+		{
+			description: "when the user is restored",
+			input:       RestoreUserParams{ID: 1, Version: 2},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(2)).Return(restored, nil)
+			},
+		},
+		{
+			description: "when the user does not exist",
+			input:       RestoreUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(0)).Return(models.User{}, postgresql.ErrUserNotFound)
+			},
+			expected: ErrUserNotFound,
+		},
+		{
+			description: "when the user is not deleted",
+			input:       RestoreUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(0)).Return(models.User{}, postgresql.ErrUserActive)
+			},
+			expected: ErrUserActive,
+		},
+		{
+			description: "when the nickname or email was taken",
+			input:       RestoreUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(0)).Return(models.User{}, postgresql.ErrUniqueViolation)
+			},
+			expected: ErrUserTaken,
+		},
+		{
+			description: "when the version is outdated",
+			input:       RestoreUserParams{ID: 1, Version: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(1)).Return(models.User{}, postgresql.ErrWrongVersion)
+			},
+			expected: ErrWrongVersion,
+		},
+		{
+			description: "when the user fails to be restored",
+			input:       RestoreUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Restore(ctx, 1, uint32(0)).Return(models.User{}, ERROR)
+			},
+			expected: fmt.Errorf("%w failed to restore user", ERROR),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx, mockCtrl, repo, service := setupUserTest(t)
+			defer mockCtrl.Finish()
+
+			tc.setup(ctx, repo)
+
+			user, err := service.RestoreUser(ctx, tc.input)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(user).To(Equal(restored), "should return the restored user")
+		})
+	}
+}
+
+func Test_PurgeUser(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		input       PurgeUserParams
+		setup       func(ctx context.Context, repo *mock_services.MockUserStore)
+		expected    error
+	}{
+		{
+			description: "when the user is purged",
+			input:       PurgeUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Purge(ctx, 1, uint32(0)).Return(models.User{ID: 1}, nil)
+			},
+		},
+		{
+			description: "when the user does not exist",
+			input:       PurgeUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Purge(ctx, 1, uint32(0)).Return(models.User{}, postgresql.ErrUserNotFound)
+			},
+			expected: ErrUserNotFound,
+		},
+		{
+			description: "when the version is outdated",
+			input:       PurgeUserParams{ID: 1, Version: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Purge(ctx, 1, uint32(1)).Return(models.User{}, postgresql.ErrWrongVersion)
+			},
+			expected: ErrWrongVersion,
+		},
+		{
+			description: "when the user fails to be purged",
+			input:       PurgeUserParams{ID: 1},
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().Purge(ctx, 1, uint32(0)).Return(models.User{}, ERROR)
+			},
+			expected: fmt.Errorf("%w failed to purge user", ERROR),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ctx, mockCtrl, repo, service := setupUserTest(t)
+			defer mockCtrl.Finish()
+
+			tc.setup(ctx, repo)
+
+			_, err := service.PurgeUser(ctx, tc.input)
+
+			if tc.expected != nil {
+				g.Expect(err).To(Equal(tc.expected), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			}
+		})
+	}
+}
+
+func Test_VerifyCredentials(t *testing.T) {
+	RegisterTestingT(t)
+
+	type testInput struct {
+		login    string
+		password string
+	}
+
+	type testExpectation struct {
+		err  error
+		user models.User
+	}
+
+	f := faketime.NewFaketime(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+	defer f.Undo()
+	f.Do()
+
+	user := func(password string, version uint32) models.User {
+		meta := domain.NewMeta()
+		meta.SetVersion(version)
+
+		return models.User{
+			Country:   "uk",
+			Email:     "example@example.com",
+			FirstName: "test",
+			LastName:  "test",
+			Nickname:  "testuser",
+			Password:  password,
+			ID:        1,
+			Meta:      meta,
+		}
+	}
+
+	rehashed := user("hash:qwerty", 1)
+
+	testCases := []struct {
+		description string
+		setup       func(ctx context.Context, repo *mock_services.MockUserStore)
+		input       testInput
+		expected    testExpectation
+	}{
+		{
+			description: "when the credentials are valid",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "testuser").Return(user("hash:qwerty", 1), nil)
+			},
+			input: testInput{login: "testuser", password: "qwerty"},
+			expected: testExpectation{
+				user: user("hash:qwerty", 1),
+			},
+		},
+		{
+			description: "when the password is wrong",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "example@example.com").Return(user("hash:qwerty", 1), nil)
+			},
+			input: testInput{login: "example@example.com", password: "qwertz"},
+			expected: testExpectation{
+				err: ErrInvalidCredentials,
+			},
+		},
+		{
+			description: "when the user does not exist",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "nobody").Return(models.User{}, postgresql.ErrUserNotFound)
+			},
+			input: testInput{login: "nobody", password: "qwerty"},
+			expected: testExpectation{
+				err: ErrInvalidCredentials,
+			},
+		},
+		{
+			description: "when the hash is outdated",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "testuser").Return(user("qwerty", 1), nil)
+				repo.EXPECT().Store(ctx, rehashed, uint32(1)).Return(user("hash:qwerty", 1), nil)
+			},
+			input: testInput{login: "testuser", password: "qwerty"},
+			expected: testExpectation{
+				user: user("hash:qwerty", 1),
+			},
+		},
+		{
+			description: "when the outdated hash fails to be replaced",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "testuser").Return(user("qwerty", 1), nil)
+				repo.EXPECT().Store(ctx, rehashed, uint32(1)).Return(models.User{}, postgresql.ErrWrongVersion)
+			},
+			input: testInput{login: "testuser", password: "qwerty"},
+			expected: testExpectation{
+				user: rehashed,
+			},
+		},
+		{
+			description: "when the user fails to be fetched",
+			setup: func(ctx context.Context, repo *mock_services.MockUserStore) {
+				repo.EXPECT().GetByLogin(ctx, "testuser").Return(models.User{}, ERROR)
+			},
+			input: testInput{login: "testuser", password: "qwerty"},
+			expected: testExpectation{
+				err: fmt.Errorf("%w failed to get user", ERROR),
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			ctx, mockCtrl, repo, service := setupUserTest(t)
+			defer ctx.Done()
+			defer mockCtrl.Finish()
+
+			testCase.setup(ctx, repo)
+
+			user, err := service.VerifyCredentials(ctx, testCase.input.login, testCase.input.password)
+
+			if testCase.expected.err != nil {
+				g.Expect(testCase.expected.err).To(Equal(err), "error when verifying credentials")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(user).To(Equal(testCase.expected.user), "should return the expected user")
+			}
+
+		})
+	}
+}
+
+func Test_VerifyCredentials_UnknownLogin(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ctx := context.TODO()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	repo := mock_services.NewMockUserStore(mockCtrl)
+	hasher := &recordingHasher{}
+	service := NewUserService(repo, mock_services.NewMockRoleStore(mockCtrl), hasher)
+
+	repo.EXPECT().GetByLogin(ctx, "nobody").Return(models.User{}, postgresql.ErrUserNotFound).Times(2)
+
+	for i := 0; i < 2; i++ {
+		_, err := service.VerifyCredentials(ctx, "nobody", "qwerty")
+		g.Expect(err).To(Equal(ErrInvalidCredentials), "should reject the unknown login")
+	}
+
+	g.Expect(hasher.verified).To(HaveLen(2), "should verify the password of unknown logins too")
+	g.Expect(hasher.verified[0]).To(Equal("hash:dummy password"), "should verify against a hash made by the hasher")
+	g.Expect(hasher.verified[1]).To(Equal(hasher.verified[0]), "should always verify against the same hash")
+}
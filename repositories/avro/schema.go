@@ -0,0 +1,341 @@
+package avro
+
+import (
+	"code/tech-test/repositories/schemas"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema is the schema of the user events. The encoder writes the fields in
+// this order, so both change together. Old, new and role are set for the
+// changes to a field and to the roles, user for a created user.
+const Schema = `{
+  "type": "record",
+  "name": "UserEvent",
+  "namespace": "users",
+  "fields": [
+    {"name": "type", "type": "string"},
+    {"name": "user_id", "type": "long"},
+    {"name": "version", "type": "long"},
+    {"name": "occurred_at", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "old", "type": ["null", "string"], "default": null},
+    {"name": "new", "type": ["null", "string"], "default": null},
+    {"name": "role", "type": ["null", "string"], "default": null},
+    {"name": "user", "type": ["null", {
+      "type": "record",
+      "name": "User",
+      "fields": [
+        {"name": "id", "type": "long"},
+        {"name": "first_name", "type": "string"},
+        {"name": "last_name", "type": "string"},
+        {"name": "nickname", "type": "string"},
+        {"name": "email", "type": "string"},
+        {"name": "country", "type": "string"},
+        {"name": "roles", "type": {"type": "array", "items": "string"}},
+        {"name": "created_at", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+        {"name": "updated_at", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+        {"name": "active", "type": "boolean"},
+        {"name": "version", "type": "long"}
+      ]
+    }], "default": null}
+  ]
+}`
+
+// Definition is an Avro schema for the registry.
+type Definition struct {
+	schema string
+}
+
+func NewDefinition(schema string) Definition {
+	return Definition{
+		schema: schema,
+	}
+}
+
+func (d Definition) SchemaType() string {
+	return "AVRO"
+}
+
+func (d Definition) Schema() string {
+	return d.schema
+}
+
+// CheckBackward follows the schema resolution rules of the Avro
+// specification, the new schema being the reader of the data written with the
+// previous one.
+func (d Definition) CheckBackward(previous string) error {
+	reader, err := parse(d.schema)
+	if err != nil {
+		return err
+	}
+
+	writer, err := parse(previous)
+	if err != nil {
+		return err
+	}
+
+	return canRead(reader, writer, "", make(map[[2]*node]bool))
+}
+
+type node struct {
+	kind     string
+	name     string
+	fields   []field
+	items    *node
+	values   *node
+	symbols  []string
+	size     int
+	branches []*node
+}
+
+type field struct {
+	name       string
+	kind       *node
+	hasDefault bool
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// promotions lists the writer types a reader type accepts besides its own.
+var promotions = map[string][]string{
+	"long":   {"int"},
+	"float":  {"int", "long"},
+	"double": {"int", "long", "float"},
+	"string": {"bytes"},
+	"bytes":  {"string"},
+}
+
+func parse(schema string) (*node, error) {
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(schema), &v); err != nil {
+		return nil, fmt.Errorf("%w failed to parse avro schema", err)
+	}
+
+	return build(v, make(map[string]*node))
+}
+
+func build(v interface{}, names map[string]*node) (*node, error) {
+	switch t := v.(type) {
+	case string:
+		if primitives[t] {
+			return &node{kind: t}, nil
+		}
+
+		if n, ok := names[shortName(t)]; ok {
+			return n, nil
+		}
+
+		return nil, fmt.Errorf("unknown avro type %q", t)
+	case []interface{}:
+		n := &node{kind: "union"}
+
+		for _, branch := range t {
+			b, err := build(branch, names)
+			if err != nil {
+				return nil, err
+			}
+			n.branches = append(n.branches, b)
+		}
+
+		return n, nil
+	case map[string]interface{}:
+		kind, _ := t["type"].(string)
+		name, _ := t["name"].(string)
+
+		switch kind {
+		case "record", "error":
+			n := &node{kind: "record", name: shortName(name)}
+			// registered before the fields, which may refer to the record
+			names[n.name] = n
+
+			fields, _ := t["fields"].([]interface{})
+			for _, f := range fields {
+				m, ok := f.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("invalid field in avro record %s", name)
+				}
+
+				fieldName, _ := m["name"].(string)
+				fieldType, err := build(m["type"], names)
+				if err != nil {
+					return nil, err
+				}
+
+				_, hasDefault := m["default"]
+				n.fields = append(n.fields, field{name: fieldName, kind: fieldType, hasDefault: hasDefault})
+			}
+
+			return n, nil
+		case "enum":
+			n := &node{kind: "enum", name: shortName(name)}
+			names[n.name] = n
+
+			symbols, _ := t["symbols"].([]interface{})
+			for _, s := range symbols {
+				symbol, _ := s.(string)
+				n.symbols = append(n.symbols, symbol)
+			}
+
+			return n, nil
+		case "fixed":
+			n := &node{kind: "fixed", name: shortName(name)}
+			names[n.name] = n
+
+			size, _ := t["size"].(float64)
+			n.size = int(size)
+
+			return n, nil
+		case "array":
+			items, err := build(t["items"], names)
+			if err != nil {
+				return nil, err
+			}
+
+			return &node{kind: "array", items: items}, nil
+		case "map":
+			values, err := build(t["values"], names)
+			if err != nil {
+				return nil, err
+			}
+
+			return &node{kind: "map", values: values}, nil
+		}
+
+		// a primitive with attributes, such as a logical type
+		return build(t["type"], names)
+	}
+
+	return nil, fmt.Errorf("invalid avro schema %v", v)
+}
+
+func canRead(reader, writer *node, path string, seen map[[2]*node]bool) error {
+	if seen[[2]*node{reader, writer}] {
+		return nil
+	}
+	seen[[2]*node{reader, writer}] = true
+
+	if writer.kind == "union" {
+		for _, branch := range writer.branches {
+			if err := canRead(reader, branch, path, seen); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if reader.kind == "union" {
+		for _, branch := range reader.branches {
+			if canRead(branch, writer, path, copySeen(seen)) == nil {
+				return nil
+			}
+		}
+
+		return incompatible(path, "no branch of the union reads %s", writer.kind)
+	}
+
+	if reader.kind != writer.kind {
+		for _, promoted := range promotions[reader.kind] {
+			if promoted == writer.kind {
+				return nil
+			}
+		}
+
+		return incompatible(path, "%s cannot read %s", reader.kind, writer.kind)
+	}
+
+	switch reader.kind {
+	case "record":
+		if reader.name != writer.name {
+			return incompatible(path, "record %s cannot read record %s", reader.name, writer.name)
+		}
+
+		for _, f := range reader.fields {
+			w, ok := writer.field(f.name)
+			if !ok {
+				if !f.hasDefault {
+					return incompatible(join(path, f.name), "added without a default")
+				}
+				continue
+			}
+
+			if err := canRead(f.kind, w.kind, join(path, f.name), seen); err != nil {
+				return err
+			}
+		}
+	case "enum":
+		if reader.name != writer.name {
+			return incompatible(path, "enum %s cannot read enum %s", reader.name, writer.name)
+		}
+
+		for _, symbol := range writer.symbols {
+			if !contains(reader.symbols, symbol) {
+				return incompatible(path, "symbol %s removed", symbol)
+			}
+		}
+	case "fixed":
+		if reader.name != writer.name || reader.size != writer.size {
+			return incompatible(path, "fixed %s cannot read fixed %s", reader.name, writer.name)
+		}
+	case "array":
+		return canRead(reader.items, writer.items, path+"[]", seen)
+	case "map":
+		return canRead(reader.values, writer.values, path+"{}", seen)
+	}
+
+	return nil
+}
+
+func (n *node) field(name string) (field, bool) {
+	for _, f := range n.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+func incompatible(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "schema"
+	}
+
+	return fmt.Errorf("%w %s: %s", schemas.ErrIncompatibleSchema, path, fmt.Sprintf(format, args...))
+}
+
+func shortName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copySeen(seen map[[2]*node]bool) map[[2]*node]bool {
+	result := make(map[[2]*node]bool, len(seen))
+	for k, v := range seen {
+		result[k] = v
+	}
+
+	return result
+}
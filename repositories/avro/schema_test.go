@@ -0,0 +1,95 @@
+//+build unit
+
+package avro
+
+import (
+	"code/tech-test/repositories/schemas"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Definition_CheckBackward(t *testing.T) {
+	record := func(fields string) string {
+		return `{"type": "record", "name": "UserEvent", "namespace": "users", "fields": [` + fields + `]}`
+	}
+
+	testCases := []struct {
+		description string
+		previous    string
+		current     string
+		compatible  bool
+	}{
+		{
+			description: "when the schema is unchanged",
+			previous:    Schema,
+			current:     Schema,
+			compatible:  true,
+		},
+		{
+			description: "when a field is added with a default",
+			previous:    Schema,
+			current:     strings.Replace(Schema, `{"name": "type", "type": "string"},`, `{"name": "type", "type": "string"}, {"name": "actor", "type": ["null", "string"], "default": null},`, 1),
+			compatible:  true,
+		},
+		{
+			description: "when a field is added without a default",
+			previous:    Schema,
+			current:     strings.Replace(Schema, `{"name": "type", "type": "string"},`, `{"name": "type", "type": "string"}, {"name": "actor", "type": "string"},`, 1),
+		},
+		{
+			description: "when a field is removed",
+			previous:    record(`{"name": "type", "type": "string"}, {"name": "user_id", "type": "long"}`),
+			current:     record(`{"name": "type", "type": "string"}`),
+			compatible:  true,
+		},
+		{
+			description: "when a type is promoted",
+			previous:    record(`{"name": "user_id", "type": "int"}`),
+			current:     record(`{"name": "user_id", "type": "long"}`),
+			compatible:  true,
+		},
+		{
+			description: "when a type is narrowed",
+			previous:    record(`{"name": "user_id", "type": "long"}`),
+			current:     record(`{"name": "user_id", "type": "int"}`),
+		},
+		{
+			description: "when a nested field changes type",
+			previous:    Schema,
+			current:     strings.Replace(Schema, `{"name": "active", "type": "boolean"}`, `{"name": "active", "type": "string"}`, 1),
+		},
+		{
+			description: "when a field becomes optional",
+			previous:    record(`{"name": "role", "type": "string"}`),
+			current:     record(`{"name": "role", "type": ["null", "string"]}`),
+			compatible:  true,
+		},
+		{
+			description: "when an optional field becomes required",
+			previous:    record(`{"name": "role", "type": ["null", "string"]}`),
+			current:     record(`{"name": "role", "type": "string"}`),
+		},
+		{
+			description: "when the record is renamed",
+			previous:    record(`{"name": "type", "type": "string"}`),
+			current:     `{"type": "record", "name": "UserChange", "fields": [{"name": "type", "type": "string"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := NewDefinition(tc.current).CheckBackward(tc.previous)
+
+			if tc.compatible {
+				g.Expect(err).ToNot(HaveOccurred(), "should read the data of the previous schema")
+			} else {
+				g.Expect(errors.Is(err, schemas.ErrIncompatibleSchema)).To(BeTrue(), "should reject the schema")
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package avro
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	jsonSerializer "code/tech-test/repositories/json"
+	"code/tech-test/repositories/schemas"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const ContentType = "application/avro"
+
+var ErrInvalidData = errors.New("invalid avro data")
+
+type Registry interface {
+	Register(subject string, definition schemas.Definition) (schemas.Schema, error)
+}
+
+// Serializer writes the user events in the Avro binary encoding, framed in
+// the Confluent wire format with the id of the schema.
+type Serializer struct {
+	schemaID int
+}
+
+// NewSerializer registers the schema for the subject, failing when it breaks
+// the backward compatibility with the registered one.
+func NewSerializer(registry Registry, subject string) (Serializer, error) {
+	schema, err := registry.Register(subject, NewDefinition(Schema))
+	if err != nil {
+		return Serializer{}, err
+	}
+
+	return Serializer{
+		schemaID: schema.ID,
+	}, nil
+}
+
+func (s Serializer) ContentType() string {
+	return ContentType
+}
+
+func (s Serializer) Serialize(user models.User, event domain.Event) ([]byte, error) {
+	message := jsonSerializer.UserSerializer{}.SerializeEvent(user, event)
+
+	return schemas.Frame(s.schemaID, Encode(message)), nil
+}
+
+// Encode writes the message with the schema.
+func Encode(message jsonSerializer.EventMessage) []byte {
+	var e encoder
+
+	e.string(message.Type)
+	e.long(int64(message.UserID))
+	e.long(int64(message.Version))
+	e.timestamp(message.OccurredAt)
+
+	change, isChange := message.Data.(jsonSerializer.ChangeMessage)
+	e.optionalString(change.Old, isChange)
+	e.optionalString(change.New, isChange)
+
+	role, isRole := message.Data.(jsonSerializer.RoleMessage)
+	e.optionalString(role.Role, isRole)
+
+	user, isUser := message.Data.(jsonSerializer.UserMessage)
+	if !isUser {
+		e.long(0)
+		return e.buf
+	}
+
+	e.long(1)
+	e.long(int64(user.ID))
+	e.string(user.FirstName)
+	e.string(user.LastName)
+	e.string(user.Nickname)
+	e.string(user.Email)
+	e.string(user.Country)
+	if len(user.Roles) > 0 {
+		e.long(int64(len(user.Roles)))
+		for _, r := range user.Roles {
+			e.string(r)
+		}
+	}
+	e.long(0)
+	e.timestamp(user.CreatedAt)
+	e.timestamp(user.UpdatedAt)
+	e.boolean(user.Active)
+	e.long(int64(user.Version))
+
+	return e.buf
+}
+
+// Decode reads a message written with the schema.
+func Decode(payload []byte) (jsonSerializer.EventMessage, error) {
+	var message jsonSerializer.EventMessage
+
+	d := decoder{buf: payload}
+
+	message.Type = d.string()
+	message.UserID = int(d.long())
+	message.Version = uint32(d.long())
+	message.OccurredAt = d.timestamp()
+
+	before, hasOld := d.optionalString()
+	after, hasNew := d.optionalString()
+	if hasOld || hasNew {
+		message.Data = jsonSerializer.ChangeMessage{Old: before, New: after}
+	}
+
+	if role, ok := d.optionalString(); ok {
+		message.Data = jsonSerializer.RoleMessage{Role: role}
+	}
+
+	if d.long() == 1 {
+		var user jsonSerializer.UserMessage
+
+		user.ID = int(d.long())
+		user.FirstName = d.string()
+		user.LastName = d.string()
+		user.Nickname = d.string()
+		user.Email = d.string()
+		user.Country = d.string()
+		user.Roles = make([]string, 0)
+		for count := d.long(); count != 0 && d.err == nil; count = d.long() {
+			if count < 0 {
+				// a negative count is followed by the size of the block
+				count = -count
+				d.long()
+			}
+			for i := int64(0); i < count; i++ {
+				user.Roles = append(user.Roles, d.string())
+			}
+		}
+		user.CreatedAt = d.timestamp()
+		user.UpdatedAt = d.timestamp()
+		user.Active = d.boolean()
+		user.Version = uint32(d.long())
+
+		message.Data = user
+	}
+
+	if d.err != nil {
+		return jsonSerializer.EventMessage{}, d.err
+	}
+
+	return message, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+// long writes the zig-zag varint Avro uses for int and long.
+func (e *encoder) long(v int64) {
+	var b [binary.MaxVarintLen64]byte
+
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) string(s string) {
+	e.long(int64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) boolean(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) timestamp(t time.Time) {
+	e.long(t.UnixNano() / int64(time.Microsecond))
+}
+
+// optionalString writes the ["null", "string"] union.
+func (e *encoder) optionalString(s string, ok bool) {
+	if !ok {
+		e.long(0)
+		return
+	}
+
+	e.long(1)
+	e.string(s)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) long() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidData
+		return 0
+	}
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.long()
+	if d.err != nil {
+		return ""
+	}
+
+	if n < 0 || int64(len(d.buf)) < n {
+		d.err = ErrInvalidData
+		return ""
+	}
+
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+
+	return s
+}
+
+func (d *decoder) boolean() bool {
+	if d.err != nil {
+		return false
+	}
+
+	if len(d.buf) < 1 {
+		d.err = ErrInvalidData
+		return false
+	}
+
+	b := d.buf[0] == 1
+	d.buf = d.buf[1:]
+
+	return b
+}
+
+func (d *decoder) timestamp() time.Time {
+	return time.Unix(0, d.long()*int64(time.Microsecond)).UTC()
+}
+
+func (d *decoder) optionalString() (string, bool) {
+	switch d.long() {
+	case 0:
+		return "", false
+	case 1:
+		return d.string(), true
+	}
+
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: unknown union branch", ErrInvalidData)
+	}
+
+	return "", false
+}
@@ -0,0 +1,67 @@
+package checkpoints
+
+import (
+	"code/tech-test/domain/users/replay"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// FileStore keeps the replay checkpoint in a JSON file, a missing file being
+// a replay which has not started.
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) FileStore {
+	return FileStore{
+		path: path,
+	}
+}
+
+func (s FileStore) Load() (replay.Checkpoint, error) {
+	var checkpoint replay.Checkpoint
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("%w failed to read checkpoint", err)
+	}
+
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("%w failed to parse checkpoint", err)
+	}
+
+	return checkpoint, nil
+}
+
+// Save replaces the file through a rename so a crash cannot leave it half
+// written.
+func (s FileStore) Save(checkpoint replay.Checkpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("%w failed to marshal checkpoint", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("%w failed to write checkpoint", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("%w failed to write checkpoint", err)
+	}
+
+	return nil
+}
+
+func (s FileStore) Clear() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w failed to remove checkpoint", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+//+build unit
+
+package checkpoints
+
+import (
+	"code/tech-test/domain/users/replay"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_FileStore(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "checkpoints")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(filepath.Join(dir, "replay.json"))
+
+	checkpoint, err := store.Load()
+	g.Expect(err).ToNot(HaveOccurred(), "should not fail without a file")
+	g.Expect(checkpoint).To(Equal(replay.Checkpoint{}), "should start from the beginning")
+
+	saved := replay.Checkpoint{LastID: 42, Published: 40, StartedAt: time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)}
+	g.Expect(store.Save(saved)).To(Succeed(), "should save the checkpoint")
+
+	checkpoint, err = store.Load()
+	g.Expect(err).ToNot(HaveOccurred(), "should load the checkpoint")
+	g.Expect(checkpoint).To(Equal(saved), "should resume from the saved checkpoint")
+
+	g.Expect(store.Clear()).To(Succeed(), "should clear the checkpoint")
+	g.Expect(store.Clear()).To(Succeed(), "should clear a missing checkpoint")
+
+	checkpoint, err = store.Load()
+	g.Expect(err).ToNot(HaveOccurred(), "should not fail once cleared")
+	g.Expect(checkpoint).To(Equal(replay.Checkpoint{}), "should start over once cleared")
+}
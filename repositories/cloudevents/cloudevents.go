@@ -0,0 +1,211 @@
+package cloudevents
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The user events are published as CloudEvents 1.0, whatever the backend.
+const (
+	SpecVersion = "1.0"
+
+	TypeUserCreated  = "user.created"
+	TypeUserUpdated  = "user.updated"
+	TypeUserDeleted  = "user.deleted"
+	TypeUserRestored = "user.restored"
+	TypeUserSnapshot = "user.snapshot"
+
+	ContentTypeJSON       = "application/json"
+	ContentTypeCloudEvent = "application/cloudevents+json"
+)
+
+// The topic is keyed by the user id so it can be compacted, a tombstone
+// removing the earlier records of a user. Erased users always leave a
+// tombstone, with TombstoneOnDelete the deleted users do too, after their
+// user.deleted event.
+const (
+	TombstoneOnErasure = "erasure"
+	TombstoneOnDelete  = "delete"
+)
+
+// Event is the structured mode envelope of a user event. Data holds JSON
+// data while binary data, such as Avro, is held base64 encoded in DataBase64.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// Payload returns the data as sent in the binary mode.
+func (e Event) Payload() []byte {
+	if e.DataBase64 != nil {
+		return e.DataBase64
+	}
+
+	return e.Data
+}
+
+// Record is a message of the topic, keyed by the user id. A tombstone has no
+// event.
+type Record struct {
+	Key   string
+	Event *Event
+}
+
+func (r Record) Tombstone() bool {
+	return r.Event == nil
+}
+
+type Serializer interface {
+	ContentType() string
+	Serialize(user models.User, event domain.Event) ([]byte, error)
+}
+
+// Encoder wraps the serialized user events in CloudEvents, every publisher
+// sharing one so the backends publish the same events.
+type Encoder struct {
+	serializer Serializer
+	source     string
+	tombstones string
+}
+
+// NewEncoder builds an encoder for the source, which is the same for every
+// instance of the service. Only erased users leave a tombstone.
+func NewEncoder(serializer Serializer, source string) Encoder {
+	return Encoder{
+		serializer: serializer,
+		source:     source,
+		tombstones: TombstoneOnErasure,
+	}
+}
+
+// WithTombstones returns the encoder with another tombstone mode.
+func (e Encoder) WithTombstones(mode string) (Encoder, error) {
+	switch mode {
+	case TombstoneOnErasure, TombstoneOnDelete:
+		e.tombstones = mode
+		return e, nil
+	}
+
+	return Encoder{}, fmt.Errorf("unknown tombstone mode %q", mode)
+}
+
+// Records returns the records a publisher writes for the event, in order.
+// The erasure of a user is only a tombstone unless the deletions are
+// followed by one, its user.deleted event carrying no data. The deletions
+// being followed by one, so are the snapshots of the deleted users.
+func (e Encoder) Records(user models.User, event domain.Event) ([]Record, error) {
+	key := strconv.Itoa(user.ID)
+	tombstone := Record{Key: key}
+
+	_, erased := event.(models.UserErased)
+	if erased && e.tombstones == TombstoneOnErasure {
+		return []Record{tombstone}, nil
+	}
+
+	ce, err := e.Encode(user, event)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{{Key: key, Event: &ce}}
+
+	// a snapshot of a deleted user is tombstoned again, so replaying the
+	// deleted users does not bring their data back to the compacted topic
+	_, deleted := event.(models.UserDeactivated)
+	_, snapshot := event.(models.UserSnapshot)
+	deleted = deleted || (snapshot && user.Meta.GetDisabled())
+
+	if erased || (deleted && e.tombstones == TombstoneOnDelete) {
+		records = append(records, tombstone)
+	}
+
+	return records, nil
+}
+
+// Encode describes the event, the user being its state once the events of
+// the change are applied. The subject is the user id. Encoding the same event
+// of the same version of the user gives the same id, so the consumers can
+// drop the events published again by a retry.
+func (e Encoder) Encode(user models.User, event domain.Event) (Event, error) {
+	data, err := e.serializer.Serialize(user, event)
+	if err != nil {
+		return Event{}, err
+	}
+
+	id, err := e.newID(user, event)
+	if err != nil {
+		return Event{}, err
+	}
+
+	ce := Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          e.source,
+		Type:            eventType(event),
+		Subject:         strconv.Itoa(user.ID),
+		Time:            event.OccurredAt().UTC(),
+		DataContentType: e.serializer.ContentType(),
+	}
+
+	if ce.DataContentType == ContentTypeJSON {
+		ce.Data = data
+	} else {
+		ce.DataBase64 = data
+	}
+
+	return ce, nil
+}
+
+// eventType maps the domain events to the CloudEvents types, the changes to
+// single fields and roles being updates of the user.
+func eventType(event domain.Event) string {
+	switch event.(type) {
+	case models.UserCreated:
+		return TypeUserCreated
+	case models.UserDeactivated, models.UserErased:
+		return TypeUserDeleted
+	case models.UserRestored:
+		return TypeUserRestored
+	case models.UserSnapshot:
+		return TypeUserSnapshot
+	}
+
+	return TypeUserUpdated
+}
+
+// namespace is the RFC 4122 URL namespace the ids are derived in.
+var namespace = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// newID returns the name-based UUID, version 5, of the event of the version
+// of the user. The event is part of the name, as a change records several
+// events, which differ by their type or their data.
+func (e Encoder) newID(user models.User, event domain.Event) (string, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("%w failed to generate event id", err)
+	}
+
+	h := sha1.New()
+	h.Write(namespace)
+	fmt.Fprintf(h, "%s/%d/%d/%s/", e.source, user.ID, user.Meta.GetVersion(), event.EventType())
+	h.Write(data)
+
+	b := h.Sum(nil)[:16]
+
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
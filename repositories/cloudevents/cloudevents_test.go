@@ -0,0 +1,112 @@
+//+build unit
+
+package cloudevents
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	jsonSerializer "code/tech-test/repositories/json"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Encoder_Encode(t *testing.T) {
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(2, at, at, false)
+
+	encoder := NewEncoder(jsonSerializer.UserSerializer{}, "/users")
+
+	testCases := []struct {
+		description string
+		event       domain.Event
+		eventType   string
+	}{
+		{description: "when the user is created", event: models.UserCreated{At: at}, eventType: TypeUserCreated},
+		{description: "when the email changes", event: models.EmailChanged{Old: "a@example.qqq", New: "example@example.qqq", At: at}, eventType: TypeUserUpdated},
+		{description: "when a role is assigned", event: models.RoleAssigned{Role: "admin", At: at}, eventType: TypeUserUpdated},
+		{description: "when the user is deactivated", event: models.UserDeactivated{At: at}, eventType: TypeUserDeleted},
+		{description: "when the user is restored", event: models.UserRestored{At: at}, eventType: TypeUserRestored},
+		{description: "when the user is replayed", event: models.UserSnapshot{At: at}, eventType: TypeUserSnapshot},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ce, err := encoder.Encode(user, tc.event)
+			g.Expect(err).ToNot(HaveOccurred(), "should encode the event")
+			g.Expect(ce.SpecVersion).To(Equal("1.0"), "should follow CloudEvents 1.0")
+			g.Expect(ce.Type).To(Equal(tc.eventType), "should map the event type")
+			g.Expect(ce.Source).To(Equal("/users"), "should set the source")
+			g.Expect(ce.Subject).To(Equal("7"), "should set the user as the subject")
+			g.Expect(ce.Time).To(Equal(at), "should set the time of the event")
+			g.Expect(ce.DataContentType).To(Equal(ContentTypeJSON), "should set the content type of the data")
+			g.Expect(ce.ID).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), "should set a name-based id")
+
+			var data jsonSerializer.EventMessage
+			g.Expect(json.Unmarshal(ce.Data, &data)).To(Succeed(), "should hold the event as data")
+			g.Expect(data.Type).To(Equal(tc.event.EventType()), "should describe the change")
+			g.Expect(data.Version).To(Equal(uint32(2)), "should hold the version of the user")
+		})
+	}
+}
+
+func Test_Encoder_Encode_ID(t *testing.T) {
+	g := NewWithT(t)
+
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(2, at, at, false)
+
+	encoder := NewEncoder(jsonSerializer.UserSerializer{}, "/users")
+
+	id := func(user models.User, event domain.Event) string {
+		ce, err := encoder.Encode(user, event)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		return ce.ID
+	}
+
+	admin := models.RoleAssigned{Role: "admin", At: at}
+
+	g.Expect(id(user, admin)).To(Equal(id(user, admin)), "should give the same id to the same event")
+	g.Expect(id(user, admin)).ToNot(Equal(id(user, models.RoleAssigned{Role: "editor", At: at})), "should tell apart the events of a change")
+	g.Expect(id(user, admin)).ToNot(Equal(id(user, models.UserRestored{At: at})), "should tell apart the types of events")
+
+	next := user
+	next.Meta.HydrateMeta(3, at, at, false)
+	g.Expect(id(user, admin)).ToNot(Equal(id(next, admin)), "should tell apart the versions of the user")
+
+	other := models.NewUser(8, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	other.Meta.HydrateMeta(2, at, at, false)
+	g.Expect(id(user, admin)).ToNot(Equal(id(other, admin)), "should tell apart the users")
+}
+
+type binarySerializer struct{}
+
+func (binarySerializer) ContentType() string { return "application/avro" }
+func (binarySerializer) Serialize(user models.User, event domain.Event) ([]byte, error) {
+	return []byte{0, 0, 0, 0, 1, 2}, nil
+}
+
+func Test_Encoder_Binary(t *testing.T) {
+	g := NewWithT(t)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+
+	ce, err := NewEncoder(binarySerializer{}, "/users").Encode(user, models.UserCreated{})
+	g.Expect(err).ToNot(HaveOccurred(), "should encode the event")
+	g.Expect(ce.DataContentType).To(Equal("application/avro"), "should set the content type of the serializer")
+	g.Expect(ce.Data).To(BeNil(), "should not hold binary data as json")
+	g.Expect(ce.Payload()).To(Equal([]byte{0, 0, 0, 0, 1, 2}), "should hold the binary data")
+
+	b, err := json.Marshal(ce)
+	g.Expect(err).ToNot(HaveOccurred(), "should marshal the event")
+	g.Expect(string(b)).To(ContainSubstring(`"data_base64":"AAAAAAEC"`), "should encode binary data in base64")
+}
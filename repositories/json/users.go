@@ -1,10 +1,15 @@
 package json
 
 import (
+	"code/tech-test/domain"
 	"code/tech-test/domain/users/models"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
+const ContentType = "application/json"
+
 type UserMessage struct {
 	ID        int       `json:"id"`
 	FirstName string    `json:"first_name"`
@@ -12,6 +17,7 @@ type UserMessage struct {
 	Nickname  string    `json:"nickname"`
 	Email     string    `json:"email"`
 	Country   string    `json:"country"`
+	Roles     []string  `json:"roles"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Active    bool      `json:"active"`
@@ -21,6 +27,9 @@ type UserMessage struct {
 type UserSerializer struct{}
 
 func (s UserSerializer) SerializeUser(user models.User) UserMessage {
+	var roles []string = make([]string, 0, len(user.Roles))
+	roles = append(roles, user.Roles...)
+
 	return UserMessage{
 		ID:        user.ID,
 		Active:    !user.Meta.GetDisabled(),
@@ -30,7 +39,72 @@ func (s UserSerializer) SerializeUser(user models.User) UserMessage {
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
 		Nickname:  user.Nickname,
+		Roles:     roles,
 		UpdatedAt: user.Meta.GetUpdatedAt(),
 		Version:   user.Meta.GetVersion(),
 	}
 }
+
+// EventMessage describes a single change to a user. Data holds the created
+// user, the old and new values of a field or the role assigned or revoked.
+type EventMessage struct {
+	Type       string      `json:"type"`
+	UserID     int         `json:"user_id"`
+	Version    uint32      `json:"version"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+type ChangeMessage struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type RoleMessage struct {
+	Role string `json:"role"`
+}
+
+// SerializeEvent describes the event, the user being its state once the
+// events of the change are applied.
+func (s UserSerializer) SerializeEvent(user models.User, event domain.Event) EventMessage {
+	message := EventMessage{
+		Type:       event.EventType(),
+		UserID:     user.ID,
+		Version:    user.Meta.GetVersion(),
+		OccurredAt: event.OccurredAt(),
+	}
+
+	switch e := event.(type) {
+	case models.UserCreated, models.UserRestored, models.UserSnapshot:
+		message.Data = s.SerializeUser(user)
+	case models.FirstNameChanged:
+		message.Data = ChangeMessage{Old: e.Old, New: e.New}
+	case models.LastNameChanged:
+		message.Data = ChangeMessage{Old: e.Old, New: e.New}
+	case models.NicknameChanged:
+		message.Data = ChangeMessage{Old: e.Old, New: e.New}
+	case models.EmailChanged:
+		message.Data = ChangeMessage{Old: e.Old, New: e.New}
+	case models.CountryChanged:
+		message.Data = ChangeMessage{Old: e.Old, New: e.New}
+	case models.RoleAssigned:
+		message.Data = RoleMessage{Role: e.Role}
+	case models.RoleRevoked:
+		message.Data = RoleMessage{Role: e.Role}
+	}
+
+	return message
+}
+
+func (s UserSerializer) ContentType() string {
+	return ContentType
+}
+
+func (s UserSerializer) Serialize(user models.User, event domain.Event) ([]byte, error) {
+	message, err := json.Marshal(s.SerializeEvent(user, event))
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to marshal message", err)
+	}
+
+	return message, nil
+}
@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"code/tech-test/domain/users/commands"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// The headers added to the dead letters, the original headers being kept.
+const (
+	HeaderError     = "dlq_error"
+	HeaderTopic     = "dlq_topic"
+	HeaderPartition = "dlq_partition"
+	HeaderOffset    = "dlq_offset"
+	HeaderFailedAt  = "dlq_failed_at"
+)
+
+type ConsumerConfig struct {
+	Topic           string
+	DeadLetterTopic string
+	Group           string
+	// PollTimeout bounds the wait for a message, after which the context is
+	// checked again.
+	PollTimeout time.Duration
+}
+
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		Topic:           "users-commands",
+		DeadLetterTopic: "users-commands-dlq",
+		Group:           "users",
+		PollTimeout:     100 * time.Millisecond,
+	}
+}
+
+// ConsumerConfigMap disables the automatic commits, the offsets are
+// committed once the commands are applied.
+func ConsumerConfigMap(servers string, config ConsumerConfig) *kafka.ConfigMap {
+	return &kafka.ConfigMap{
+		"bootstrap.servers":  servers,
+		"group.id":           config.Group,
+		"enable.auto.commit": false,
+		"auto.offset.reset":  "earliest",
+	}
+}
+
+// CommandSource reads the user commands from the topic and sends the ones
+// which cannot be applied to the dead-letter topic.
+type CommandSource struct {
+	consumer *kafka.Consumer
+	producer *kafka.Producer
+	config   ConsumerConfig
+}
+
+func NewCommandSource(consumer *kafka.Consumer, producer *kafka.Producer, config ConsumerConfig) (*CommandSource, error) {
+	if err := consumer.Subscribe(config.Topic, nil); err != nil {
+		return nil, fmt.Errorf("%w failed to subscribe to %s", err, config.Topic)
+	}
+
+	return &CommandSource{
+		consumer: consumer,
+		producer: producer,
+		config:   config,
+	}, nil
+}
+
+func (s *CommandSource) Next(ctx context.Context) (commands.Message, error) {
+	for ctx.Err() == nil {
+		switch e := s.consumer.Poll(int(s.config.PollTimeout / time.Millisecond)).(type) {
+		case *kafka.Message:
+			if e.TopicPartition.Error != nil {
+				return commands.Message{}, e.TopicPartition.Error
+			}
+
+			return fromKafka(e), nil
+		case kafka.Error:
+			if e.IsFatal() {
+				return commands.Message{}, e
+			}
+			log.Println(e)
+		}
+	}
+
+	return commands.Message{}, ctx.Err()
+}
+
+// Commit commits the offset after the message, the next one to read.
+func (s *CommandSource) Commit(ctx context.Context, message commands.Message) error {
+	_, err := s.consumer.CommitOffsets([]kafka.TopicPartition{{
+		Topic:     &message.Topic,
+		Partition: message.Partition,
+		Offset:    kafka.Offset(message.Offset + 1),
+	}})
+	if err != nil {
+		return fmt.Errorf("%w failed to commit offset", err)
+	}
+
+	return nil
+}
+
+// Rewind seeks the partition back to the message, dropping the messages
+// fetched after it.
+func (s *CommandSource) Rewind(message commands.Message) error {
+	err := s.consumer.Seek(kafka.TopicPartition{
+		Topic:     &message.Topic,
+		Partition: message.Partition,
+		Offset:    kafka.Offset(message.Offset),
+	}, 0)
+	if err != nil {
+		return fmt.Errorf("%w failed to seek", err)
+	}
+
+	return nil
+}
+
+// Send produces the message to the dead-letter topic, with the same key and
+// value, and waits for its delivery.
+func (s *CommandSource) Send(ctx context.Context, message commands.Message, reason error) error {
+	deliveries := make(chan kafka.Event, 1)
+
+	err := s.producer.Produce(s.deadLetter(message, reason, time.Now()), deliveries)
+	if err != nil {
+		return fmt.Errorf("%w failed to publish dead letter", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w failed to confirm delivery", ctx.Err())
+	case e := <-deliveries:
+		if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			return fmt.Errorf("%w failed to deliver dead letter", m.TopicPartition.Error)
+		}
+	}
+
+	return nil
+}
+
+// Close leaves the consumer group, so the partitions are reassigned, and
+// closes the dead-letter producer.
+func (s *CommandSource) Close() {
+	if err := s.consumer.Close(); err != nil {
+		log.Println(err)
+	}
+
+	s.producer.Close()
+}
+
+func (s *CommandSource) deadLetter(message commands.Message, reason error, at time.Time) *kafka.Message {
+	dead := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &s.config.DeadLetterTopic, Partition: kafka.PartitionAny},
+		Key:            message.Key,
+		Value:          message.Value,
+	}
+
+	for _, h := range message.Headers {
+		dead.Headers = append(dead.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+
+	dead.Headers = append(dead.Headers,
+		kafka.Header{Key: HeaderError, Value: []byte(reason.Error())},
+		kafka.Header{Key: HeaderTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderPartition, Value: []byte(strconv.Itoa(int(message.Partition)))},
+		kafka.Header{Key: HeaderOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(at.UTC().Format(time.RFC3339Nano))},
+	)
+
+	return dead
+}
+
+func fromKafka(m *kafka.Message) commands.Message {
+	message := commands.Message{
+		Partition: m.TopicPartition.Partition,
+		Offset:    int64(m.TopicPartition.Offset),
+		Key:       m.Key,
+		Value:     m.Value,
+	}
+
+	if m.TopicPartition.Topic != nil {
+		message.Topic = *m.TopicPartition.Topic
+	}
+
+	for _, h := range m.Headers {
+		message.Headers = append(message.Headers, commands.Header{Key: h.Key, Value: h.Value})
+	}
+
+	return message
+}
@@ -0,0 +1,66 @@
+//+build unit
+
+package kafka
+
+import (
+	"code/tech-test/domain/users/commands"
+	"errors"
+	"testing"
+	"time"
+
+	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/gomega"
+)
+
+func Test_CommandSource_DeadLetter(t *testing.T) {
+	g := NewWithT(t)
+
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	s := CommandSource{config: DefaultConsumerConfig()}
+
+	message := commands.Message{
+		Topic:     "users-commands",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("7"),
+		Value:     []byte(`{"type":"delete"}`),
+		Headers:   []commands.Header{{Key: "trace", Value: []byte("abc")}},
+	}
+
+	dead := s.deadLetter(message, errors.New("invalid command: missing id"), at)
+
+	g.Expect(*dead.TopicPartition.Topic).To(Equal("users-commands-dlq"), "should produce to the dead-letter topic")
+	g.Expect(dead.Key).To(Equal(message.Key), "should keep the key")
+	g.Expect(dead.Value).To(Equal(message.Value), "should keep the value")
+	g.Expect(headers(dead)).To(Equal(map[string]string{
+		"trace":         "abc",
+		"dlq_error":     "invalid command: missing id",
+		"dlq_topic":     "users-commands",
+		"dlq_partition": "2",
+		"dlq_offset":    "42",
+		"dlq_failed_at": "2021-05-01T01:00:00Z",
+	}), "should describe the failure in the headers")
+}
+
+func Test_FromKafka(t *testing.T) {
+	g := NewWithT(t)
+
+	topic := "users-commands"
+
+	message := fromKafka(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 5},
+		Key:            []byte("7"),
+		Value:          []byte(`{}`),
+		Headers:        []kafka.Header{{Key: "trace", Value: []byte("abc")}},
+	})
+
+	g.Expect(message).To(Equal(commands.Message{
+		Topic:     "users-commands",
+		Partition: 1,
+		Offset:    5,
+		Key:       []byte("7"),
+		Value:     []byte(`{}`),
+		Headers:   []commands.Header{{Key: "trace", Value: []byte("abc")}},
+	}), "should read where the message comes from")
+}
@@ -1,46 +1,323 @@
 package kafka
 
 import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/metrics"
+	"code/tech-test/domain/tracing"
 	"code/tech-test/domain/users/models"
-	jsonSerializer "code/tech-test/repositories/json"
+	"code/tech-test/repositories/cloudevents"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
 
 	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-type UserSerializer interface {
-	SerializeUser(user models.User) jsonSerializer.UserMessage
+// The messages follow the Kafka protocol binding of CloudEvents 1.0. In the
+// structured mode the value is the whole event, in the binary mode it is only
+// the data and the attributes are `ce_` headers.
+const (
+	ModeStructured = "structured"
+	ModeBinary     = "binary"
+)
+
+type EventEncoder interface {
+	Records(user models.User, event domain.Event) ([]cloudevents.Record, error)
 }
 
-type UserProducer struct {
-	serializer UserSerializer
-	producer   *kafka.Producer
-	topic      string
+type ProducerConfig struct {
+	Topic string
+	Mode  string
+	// FlushTimeout bounds the wait for the pending messages on Close.
+	FlushTimeout time.Duration
 }
 
-func NewUserProducer(producer *kafka.Producer, topic string, userSerializer UserSerializer) UserProducer {
-	return UserProducer{
-		producer:   producer,
-		topic:      topic,
-		serializer: userSerializer,
+func DefaultProducerConfig() ProducerConfig {
+	return ProducerConfig{
+		Topic:        "users",
+		Mode:         ModeStructured,
+		FlushTimeout: 10 * time.Second,
 	}
 }
 
-func (p UserProducer) Publish(user models.User) error {
+// DeliveryStats counts the messages published and the delivery reports
+// received since the producer started, Pending being the messages still
+// waiting for one.
+type DeliveryStats struct {
+	Published uint64
+	Delivered uint64
+	Failed    uint64
+	Pending   int
+}
+
+type UserProducer struct {
+	// counts of the messages for Stats, updated by the delivery reports
+	published uint64
+	delivered uint64
+	failed    uint64
+
+	encoder  EventEncoder
+	producer *kafka.Producer
+	config   ProducerConfig
+	done     chan struct{}
+}
+
+// NewUserProducer starts reading the delivery reports of the producer, which
+// must be drained for the producer not to block once its buffer is full.
+func NewUserProducer(producer *kafka.Producer, encoder EventEncoder, config ProducerConfig) *UserProducer {
+	p := &UserProducer{
+		producer: producer,
+		encoder:  encoder,
+		config:   config,
+		done:     make(chan struct{}),
+	}
+
+	go p.reports()
 
-	message, err := json.Marshal(p.serializer.SerializeUser(user))
+	return p
+}
+
+// PublishSync produces the messages of every event, in the order they were
+// recorded, then waits for the delivery of all of them, until the context is
+// done. The messages are keyed by the user id so the events of a user land on
+// the same partition, the idempotent producer keeping their order.
+func (p *UserProducer) PublishSync(ctx context.Context, user models.User, events []domain.Event) (err error) {
+	messages, err := p.messages(user, events)
 	if err != nil {
-		return fmt.Errorf("%w failed to marshal message", err)
+		return err
+	}
+
+	var spans []*tracing.Span
+
+	// the spans not ended by their delivery report end with the error
+	defer func() {
+		for _, span := range spans {
+			span.RecordError(err)
+			span.End()
+		}
+	}()
+
+	deliveries := make(chan kafka.Event, len(messages))
+
+	for _, message := range messages {
+		span := p.produce(ctx, message)
+		spans = append(spans, span)
+
+		if err := p.producer.Produce(message, deliveries); err != nil {
+			return fmt.Errorf("%w failed to publish message", err)
+		}
+		atomic.AddUint64(&p.published, 1)
+	}
+
+	for range messages {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w failed to confirm delivery", ctx.Err())
+		case e := <-deliveries:
+			if err := p.confirm(e); err != nil {
+				return err
+			}
+		}
 	}
 
-	err = p.producer.Produce(&kafka.Message{
-		TopicPartition: kafka.TopicPartition{Topic: &p.topic, Partition: kafka.PartitionAny},
-		Value:          []byte(message),
-	}, nil)
+	return nil
+}
+
+// produce starts the producer span of the message, whose context is passed on
+// in the traceparent header but for tombstones, which keep no headers. The
+// span rides along the message to be ended by its delivery report.
+func (p *UserProducer) produce(ctx context.Context, message *kafka.Message) *tracing.Span {
+	ctx, span := tracing.Start(ctx, p.config.Topic+" publish", tracing.KindProducer,
+		tracing.String("messaging.system", "kafka"),
+		tracing.String("messaging.destination.name", p.config.Topic),
+	)
+
+	if message.Value != nil {
+		inject(ctx, message)
+	}
+	message.Opaque = span
+
+	return span
+}
+
+// confirm reads the delivery report of a message of PublishSync and ends
+// its span.
+func (p *UserProducer) confirm(e kafka.Event) error {
+	err := p.report(e)
+
+	if m, ok := e.(*kafka.Message); ok {
+		if span, ok := m.Opaque.(*tracing.Span); ok {
+			span.RecordError(err)
+			span.End()
+		}
+	}
+
+	return err
+}
+
+// inject adds the traceparent header of the current span to the message,
+// when there is one, for the consumers to continue the trace.
+func inject(ctx context.Context, message *kafka.Message) {
+	if traceParent := tracing.TraceParent(ctx); traceParent != "" {
+		message.Headers = append(message.Headers, kafka.Header{Key: tracing.HeaderTraceParent, Value: []byte(traceParent)})
+	}
+}
+
+// metadataTimeout bounds the metadata request of Check when its context has
+// no deadline.
+const metadataTimeout = 5 * time.Second
+
+// Check asks the brokers for the metadata of the topic, failing when none
+// answers in time or the topic is unknown to them.
+func (p *UserProducer) Check(ctx context.Context) error {
+	timeout := metadataTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	metadata, err := p.producer.GetMetadata(&p.config.Topic, false, int(timeout/time.Millisecond))
 	if err != nil {
-		return fmt.Errorf("%w failed to publish message", err)
+		return fmt.Errorf("%w failed to get metadata", err)
+	}
+
+	topic, ok := metadata.Topics[p.config.Topic]
+	if !ok {
+		return fmt.Errorf("unknown topic %s", p.config.Topic)
+	}
+	if topic.Error.Code() != kafka.ErrNoError {
+		return fmt.Errorf("%w for topic %s", topic.Error, p.config.Topic)
 	}
 
 	return nil
 }
+
+func (p *UserProducer) Stats() DeliveryStats {
+	return DeliveryStats{
+		Published: atomic.LoadUint64(&p.published),
+		Delivered: atomic.LoadUint64(&p.delivered),
+		Failed:    atomic.LoadUint64(&p.failed),
+		Pending:   p.producer.Len(),
+	}
+}
+
+// Collect exposes the delivery statistics as metrics.
+func (p *UserProducer) Collect() []metrics.Family {
+	stats := p.Stats()
+
+	return []metrics.Family{
+		metrics.CounterValue("kafka_producer_published_total", "Total number of messages handed to the producer.", float64(stats.Published)),
+		metrics.CounterValue("kafka_producer_delivered_total", "Total number of messages delivered to the brokers.", float64(stats.Delivered)),
+		metrics.CounterValue("kafka_producer_failed_total", "Total number of messages the brokers failed to take.", float64(stats.Failed)),
+		metrics.GaugeValue("kafka_producer_pending", "Number of messages waiting for their delivery report.", float64(stats.Pending)),
+	}
+}
+
+// Close waits up to the flush timeout for the pending messages to be
+// delivered and closes the producer. It returns how many were left behind.
+func (p *UserProducer) Close() int {
+	remaining := p.producer.Flush(int(p.config.FlushTimeout / time.Millisecond))
+
+	p.producer.Close()
+	<-p.done
+
+	return remaining
+}
+
+// reports counts the delivery reports of the messages produced without a
+// delivery channel, until the producer is closed.
+func (p *UserProducer) reports() {
+	defer close(p.done)
+
+	for e := range p.producer.Events() {
+		switch e.(type) {
+		case *kafka.Message:
+			if err := p.report(e); err != nil {
+				log.Println(err)
+			}
+		case kafka.Error:
+			log.Println(e)
+		}
+	}
+}
+
+func (p *UserProducer) report(e kafka.Event) error {
+	m, ok := e.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery report %v", e)
+	}
+
+	if m.TopicPartition.Error != nil {
+		atomic.AddUint64(&p.failed, 1)
+		return fmt.Errorf("%w failed to deliver message", m.TopicPartition.Error)
+	}
+
+	atomic.AddUint64(&p.delivered, 1)
+
+	return nil
+}
+
+func (p *UserProducer) messages(user models.User, events []domain.Event) ([]*kafka.Message, error) {
+	var messages []*kafka.Message
+
+	for _, event := range events {
+		records, err := p.encoder.Records(user, event)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			message, err := p.message(record)
+			if err != nil {
+				return nil, err
+			}
+
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// message builds the message of the record, a tombstone having a null value
+// and no headers.
+func (p *UserProducer) message(record cloudevents.Record) (*kafka.Message, error) {
+	message := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &p.config.Topic, Partition: kafka.PartitionAny},
+		Key:            []byte(record.Key),
+	}
+
+	if record.Tombstone() {
+		return message, nil
+	}
+
+	ce := *record.Event
+
+	switch p.config.Mode {
+	case ModeBinary:
+		message.Value = ce.Payload()
+		message.Headers = []kafka.Header{
+			{Key: "content-type", Value: []byte(ce.DataContentType)},
+			{Key: "ce_specversion", Value: []byte(ce.SpecVersion)},
+			{Key: "ce_id", Value: []byte(ce.ID)},
+			{Key: "ce_source", Value: []byte(ce.Source)},
+			{Key: "ce_type", Value: []byte(ce.Type)},
+			{Key: "ce_subject", Value: []byte(ce.Subject)},
+			{Key: "ce_time", Value: []byte(ce.Time.Format(time.RFC3339Nano))},
+		}
+	default:
+		value, err := json.Marshal(ce)
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to marshal cloud event", err)
+		}
+
+		message.Value = value
+		message.Headers = []kafka.Header{
+			{Key: "content-type", Value: []byte(cloudevents.ContentTypeCloudEvent)},
+		}
+	}
+
+	return message, nil
+}
@@ -0,0 +1,215 @@
+//+build unit
+
+package kafka
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/cloudevents"
+	jsonSerializer "code/tech-test/repositories/json"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	kafka "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/gomega"
+)
+
+func headers(message *kafka.Message) map[string]string {
+	var result = make(map[string]string)
+
+	for _, h := range message.Headers {
+		result[h.Key] = string(h.Value)
+	}
+
+	return result
+}
+
+func Test_UserProducer_Message(t *testing.T) {
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(2, at, at, false)
+
+	event := models.EmailChanged{Old: "a@example.qqq", New: "example@example.qqq", At: at}
+	encoder := cloudevents.NewEncoder(jsonSerializer.UserSerializer{}, "/users")
+
+	t.Run("when the mode is structured", func(t *testing.T) {
+		g := NewWithT(t)
+
+		p := UserProducer{encoder: encoder, config: DefaultProducerConfig()}
+
+		messages, err := p.messages(user, []domain.Event{event})
+		g.Expect(err).ToNot(HaveOccurred(), "should build the message")
+		g.Expect(messages).To(HaveLen(1), "should build a message for the event")
+
+		message := messages[0]
+		g.Expect(string(message.Key)).To(Equal("7"), "should key the message by the user id")
+		g.Expect(headers(message)).To(HaveKeyWithValue("content-type", "application/cloudevents+json"), "should flag the structured mode")
+
+		var ce cloudevents.Event
+		g.Expect(json.Unmarshal(message.Value, &ce)).To(Succeed(), "should hold a cloud event")
+		g.Expect(ce.Type).To(Equal(cloudevents.TypeUserUpdated), "should hold the attributes")
+
+		var data jsonSerializer.EventMessage
+		g.Expect(json.Unmarshal(ce.Data, &data)).To(Succeed(), "should hold the event as data")
+		g.Expect(data.Type).To(Equal(models.EventEmailChanged), "should describe the change")
+	})
+
+	t.Run("when the mode is binary", func(t *testing.T) {
+		g := NewWithT(t)
+
+		config := DefaultProducerConfig()
+		config.Mode = ModeBinary
+		p := UserProducer{encoder: encoder, config: config}
+
+		messages, err := p.messages(user, []domain.Event{event})
+		g.Expect(err).ToNot(HaveOccurred(), "should build the message")
+		g.Expect(messages).To(HaveLen(1), "should build a message for the event")
+
+		message := messages[0]
+		g.Expect(string(message.Key)).To(Equal("7"), "should key the message by the user id")
+		g.Expect(headers(message)).To(HaveKeyWithValue("ce_type", cloudevents.TypeUserUpdated), "should set the attributes as headers")
+		g.Expect(headers(message)).To(HaveKeyWithValue("ce_specversion", "1.0"), "should set the attributes as headers")
+		g.Expect(headers(message)).To(HaveKeyWithValue("ce_subject", "7"), "should set the attributes as headers")
+		g.Expect(headers(message)).To(HaveKeyWithValue("ce_time", "2021-05-01T01:00:00Z"), "should set the attributes as headers")
+		g.Expect(headers(message)).To(HaveKeyWithValue("content-type", "application/json"), "should set the content type of the data")
+		g.Expect(headers(message)).To(HaveKey("ce_id"), "should set the attributes as headers")
+
+		var data jsonSerializer.EventMessage
+		g.Expect(json.Unmarshal(message.Value, &data)).To(Succeed(), "should only hold the data")
+		g.Expect(data.UserID).To(Equal(7), "should hold the event as value")
+	})
+}
+
+func Test_UserProducer_Tombstones(t *testing.T) {
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(2, at, at, true)
+
+	encoder, err := cloudevents.NewEncoder(jsonSerializer.UserSerializer{}, "/users").WithTombstones(cloudevents.TombstoneOnDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{ModeStructured, ModeBinary} {
+		t.Run("when the mode is "+mode, func(t *testing.T) {
+			g := NewWithT(t)
+
+			config := DefaultProducerConfig()
+			config.Mode = mode
+			p := UserProducer{encoder: encoder, config: config}
+
+			messages, err := p.messages(user, []domain.Event{models.UserDeactivated{At: at}})
+			g.Expect(err).ToNot(HaveOccurred(), "should build the messages")
+			g.Expect(messages).To(HaveLen(2), "should follow the event with a tombstone")
+
+			tombstone := messages[1]
+			g.Expect(string(tombstone.Key)).To(Equal("7"), "should key the tombstone by the user id")
+			g.Expect(tombstone.Value).To(BeNil(), "should have a null value")
+			g.Expect(tombstone.Headers).To(BeEmpty(), "should have no headers")
+		})
+	}
+}
+
+func Test_UserProducer_Report(t *testing.T) {
+	g := NewWithT(t)
+
+	topic := "users"
+	p := UserProducer{}
+
+	g.Expect(p.report(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}})).To(Succeed(), "should accept a delivered message")
+	g.Expect(p.report(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Error: kafka.NewError(kafka.ErrMsgTimedOut, "timed out", false)}})).ToNot(Succeed(), "should return the delivery error")
+	g.Expect(p.report(kafka.NewError(kafka.ErrAllBrokersDown, "down", false))).ToNot(Succeed(), "should reject other events")
+
+	g.Expect(p.delivered).To(Equal(uint64(1)), "should count the delivered messages")
+	g.Expect(p.failed).To(Equal(uint64(1)), "should count the failed messages")
+}
+
+func Test_Inject(t *testing.T) {
+	g := NewWithT(t)
+
+	message := &kafka.Message{}
+	inject(context.Background(), message)
+	g.Expect(message.Headers).To(BeEmpty(), "should not add a header outside of a trace")
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := tracing.ParseTraceParent(parent)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	inject(tracing.WithRemoteParent(context.Background(), sc), message)
+	g.Expect(headers(message)).To(HaveKeyWithValue(tracing.HeaderTraceParent, parent), "should pass the trace on")
+}
+
+func Test_UserProducer_Produce(t *testing.T) {
+	g := NewWithT(t)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := tracing.ParseTraceParent(parent)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx := tracing.WithRemoteParent(context.Background(), sc)
+	p := UserProducer{config: DefaultProducerConfig()}
+
+	message := &kafka.Message{Key: []byte("7"), Value: []byte("{}")}
+	p.produce(ctx, message)
+	g.Expect(headers(message)).To(HaveKey(tracing.HeaderTraceParent), "should pass the trace on")
+
+	tombstone := &kafka.Message{Key: []byte("7")}
+	p.produce(ctx, tombstone)
+	g.Expect(tombstone.Headers).To(BeEmpty(), "should keep the tombstone without headers")
+}
+
+func Test_UserProducer_PublishSync(t *testing.T) {
+	g := NewWithT(t)
+
+	// the producer talks to a mock cluster of librdkafka
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"test.mock.num.brokers": 1, "enable.idempotence": true})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	p := NewUserProducer(producer, cloudevents.NewEncoder(jsonSerializer.UserSerializer{}, "/users"), DefaultProducerConfig())
+	defer p.Close()
+
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Meta.HydrateMeta(2, at, at, false)
+
+	exporter := &recorder{}
+	tracer := tracing.NewTracer(exporter, tracing.DefaultConfig())
+
+	ctx, cancel := context.WithTimeout(tracing.WithTracer(context.Background(), tracer), 10*time.Second)
+	defer cancel()
+
+	err = p.PublishSync(ctx, user, []domain.Event{
+		models.EmailChanged{Old: "a@example.qqq", New: "example@example.qqq", At: at},
+		models.CountryChanged{Old: "pt", New: "uk", At: at},
+	})
+	g.Expect(err).ToNot(HaveOccurred(), "should publish the events")
+
+	stats := p.Stats()
+	g.Expect(stats.Published).To(Equal(uint64(2)), "should produce a message per event")
+	g.Expect(stats.Delivered).To(Equal(uint64(2)), "should wait for the delivery of every message")
+	g.Expect(stats.Pending).To(BeZero())
+
+	g.Expect(tracer.Flush(context.Background())).To(Succeed())
+	g.Expect(exporter.spans).To(HaveLen(2), "should end the span of every message on its delivery")
+	for _, span := range exporter.spans {
+		g.Expect(span.Kind).To(Equal(tracing.KindProducer))
+		g.Expect(span.Status).To(Equal(tracing.StatusUnset), "should not mark the delivered messages failed")
+	}
+}
+
+// recorder keeps the exported spans.
+type recorder struct {
+	spans []tracing.SpanData
+}
+
+func (r *recorder) Export(ctx context.Context, service string, spans []tracing.SpanData) error {
+	r.spans = append(r.spans, spans...)
+
+	return nil
+}
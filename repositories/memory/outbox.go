@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"code/tech-test/domain/outbox"
+	"context"
+	"sync"
+	"time"
+)
+
+type outboxEntry struct {
+	message       outbox.Message
+	nextAttemptAt time.Time
+	sent          bool
+}
+
+// Outbox keeps the messages written by the UserStore along with its changes.
+type Outbox struct {
+	mu      sync.Mutex
+	entries []outboxEntry
+	lastID  int64
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) add(message outbox.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.lastID++
+	message.ID = o.lastID
+	message.CreatedAt = now()
+
+	o.entries = append(o.entries, outboxEntry{message: message, nextAttemptAt: message.CreatedAt})
+}
+
+func (o *Outbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]outbox.Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var (
+		messages []outbox.Message = make([]outbox.Message, 0)
+		blocked                   = make(map[int]bool)
+		current                   = now()
+	)
+
+	for i, entry := range o.entries {
+		if len(messages) == limit {
+			break
+		}
+
+		if entry.sent {
+			continue
+		}
+
+		// an unsent message holds back the later ones of its aggregate
+		if blocked[entry.message.AggregateID] || entry.nextAttemptAt.After(current) {
+			blocked[entry.message.AggregateID] = true
+			continue
+		}
+		blocked[entry.message.AggregateID] = true
+
+		o.entries[i].nextAttemptAt = current.Add(lease)
+		messages = append(messages, entry.message)
+	}
+
+	return messages, nil
+}
+
+func (o *Outbox) MarkSent(ctx context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.entries {
+		if o.entries[i].message.ID == id {
+			o.entries[i].sent = true
+			o.entries[i].message.SentAt = now()
+			o.entries[i].message.Attempts++
+		}
+	}
+
+	o.compact()
+
+	return nil
+}
+
+func (o *Outbox) MarkFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.entries {
+		if o.entries[i].message.ID == id {
+			o.entries[i].nextAttemptAt = retryAt
+			o.entries[i].message.Attempts++
+		}
+	}
+
+	return nil
+}
+
+// Messages returns the messages of the aggregate, oldest first. The sent
+// messages are dropped once no earlier one is pending, so they may be missing.
+func (o *Outbox) Messages(ctx context.Context, aggregateID int) ([]outbox.Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var messages []outbox.Message = make([]outbox.Message, 0)
+
+	for _, entry := range o.entries {
+		if entry.message.AggregateID == aggregateID {
+			messages = append(messages, entry.message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (o *Outbox) Stats(ctx context.Context) (outbox.Stats, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var stats outbox.Stats
+
+	for _, entry := range o.entries {
+		if entry.sent {
+			continue
+		}
+
+		if stats.Pending == 0 {
+			stats.OldestUnsent = entry.message.CreatedAt
+		}
+		stats.Pending++
+	}
+
+	return stats, nil
+}
+
+// Prune drops the messages sent before the time, including the ones left
+// behind an unsent message of another aggregate.
+func (o *Outbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := o.entries[:0]
+	for _, entry := range o.entries {
+		if !entry.sent || !entry.message.SentAt.Before(before) {
+			entries = append(entries, entry)
+		}
+	}
+
+	pruned := len(o.entries) - len(entries)
+	o.entries = entries
+
+	return pruned, nil
+}
+
+// drop removes the messages of the aggregate, sent or not, so the data they
+// hold is neither kept nor published. A message being published meanwhile is
+// still marked as sent without error.
+func (o *Outbox) drop(aggregateID int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := o.entries[:0]
+	for _, entry := range o.entries {
+		if entry.message.AggregateID != aggregateID {
+			entries = append(entries, entry)
+		}
+	}
+
+	o.entries = entries
+}
+
+// compact drops the sent messages at the head so the outbox does not grow
+// forever.
+func (o *Outbox) compact() {
+	i := 0
+	for i < len(o.entries) && o.entries[i].sent {
+		i++
+	}
+
+	o.entries = o.entries[i:]
+}
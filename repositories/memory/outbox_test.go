@@ -0,0 +1,87 @@
+//+build unit
+
+package memory
+
+import (
+	"code/tech-test/domain/users/models"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Outbox(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	store := initUserStore()
+	outbox := store.Outbox()
+
+	user, _ := store.Get(ctx, 1)
+	user.SetCountry("pt")
+	_, err := store.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should update the user")
+
+	stats, _ := outbox.Stats(ctx)
+	g.Expect(stats.Pending).To(Equal(3), "should write a message for every change")
+
+	messages, _ := outbox.Claim(ctx, 10, time.Minute)
+	g.Expect(messages).To(HaveLen(2), "should hold back the later changes of a user")
+	g.Expect(messages[0].AggregateID).To(Equal(1), "should claim the first change of the first user")
+	g.Expect(messages[1].AggregateID).To(Equal(2), "should claim the first change of the second user")
+
+	again, _ := outbox.Claim(ctx, 10, time.Minute)
+	g.Expect(again).To(BeEmpty(), "should not hand out claimed messages")
+
+	g.Expect(outbox.MarkSent(ctx, messages[0].ID)).To(Succeed())
+	g.Expect(outbox.MarkFailed(ctx, messages[1].ID, time.Now().Add(time.Hour), "broker down")).To(Succeed())
+
+	next, _ := outbox.Claim(ctx, 10, time.Minute)
+	g.Expect(next).To(HaveLen(1), "should release the next change once the previous one is sent")
+
+	updated, err := next[0].User()
+	g.Expect(err).ToNot(HaveOccurred(), "should decode the user")
+	g.Expect(updated.Country).To(Equal("pt"), "should hold the updated user")
+
+	events, err := next[0].Events()
+	g.Expect(err).ToNot(HaveOccurred(), "should decode the events")
+	g.Expect(events).To(HaveLen(1), "should hold the events of the change")
+	g.Expect(events[0]).To(BeAssignableToTypeOf(models.CountryChanged{}), "should describe the change")
+	g.Expect(events[0].(models.CountryChanged).Old).To(Equal("uk"), "should hold the previous value")
+
+	unchanged, _ := store.Get(ctx, 2)
+	_, err = store.Store(ctx, unchanged, unchanged.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should store the user")
+
+	stats, _ = outbox.Stats(ctx)
+	g.Expect(stats.Pending).To(Equal(2), "should not count sent messages nor announce changes without events")
+}
+
+func Test_Outbox_Prune(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	store := initUserStore()
+	outbox := store.Outbox()
+
+	messages, _ := outbox.Claim(ctx, 10, time.Minute)
+	g.Expect(messages).To(HaveLen(2))
+
+	// the message of the second user is sent while the first is still pending
+	g.Expect(outbox.MarkSent(ctx, messages[1].ID)).To(Succeed())
+
+	pruned, err := outbox.Prune(ctx, time.Now().Add(-time.Hour))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(BeZero(), "should keep the messages sent within the retention")
+
+	pruned, err = outbox.Prune(ctx, time.Now().Add(time.Hour))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(Equal(1), "should drop the sent messages behind a pending one")
+
+	sent, _ := outbox.Messages(ctx, messages[1].AggregateID)
+	g.Expect(sent).To(BeEmpty(), "should not list the pruned messages")
+
+	stats, _ := outbox.Stats(ctx)
+	g.Expect(stats.Pending).To(Equal(1), "should keep the unsent messages")
+}
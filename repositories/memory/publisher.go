@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/cloudevents"
+	"context"
+	"fmt"
+)
+
+type EventEncoder interface {
+	Records(user models.User, event domain.Event) ([]cloudevents.Record, error)
+}
+
+// Publisher hands the records to a buffered channel, for tests to read what
+// would have been sent to Kafka. Publishing waits for room in the buffer.
+type Publisher struct {
+	encoder EventEncoder
+	records chan cloudevents.Record
+}
+
+func NewPublisher(encoder EventEncoder, buffer int) *Publisher {
+	return &Publisher{
+		encoder: encoder,
+		records: make(chan cloudevents.Record, buffer),
+	}
+}
+
+func (p *Publisher) PublishSync(ctx context.Context, user models.User, events []domain.Event) error {
+	for _, event := range events {
+		records, err := p.encoder.Records(user, event)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w failed to publish event", ctx.Err())
+			case p.records <- record:
+			}
+		}
+	}
+
+	return nil
+}
+
+// Records returns the channel the published records are sent to, the events
+// and the tombstones.
+func (p *Publisher) Records() <-chan cloudevents.Record {
+	return p.records
+}
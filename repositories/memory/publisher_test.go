@@ -0,0 +1,210 @@
+//+build unit
+
+package memory
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/cloudevents"
+	"code/tech-test/repositories/json"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Publisher(t *testing.T) {
+	g := NewWithT(t)
+
+	publisher := NewPublisher(cloudevents.NewEncoder(json.UserSerializer{}, "/users"), 1)
+	user := models.NewUser(1, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+
+	err := publisher.PublishSync(context.TODO(), user, []domain.Event{models.UserCreated{}})
+	g.Expect(err).ToNot(HaveOccurred(), "should publish the event")
+
+	record := <-publisher.Records()
+	g.Expect(record.Event.Type).To(Equal(cloudevents.TypeUserCreated), "should hand out the encoded event")
+	g.Expect(record.Event.Subject).To(Equal("1"), "should hand out the encoded event")
+
+	g.Expect(publisher.PublishSync(context.TODO(), user, []domain.Event{models.UserCreated{}})).To(Succeed(), "should fill the buffer")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	err = publisher.PublishSync(ctx, user, []domain.Event{models.UserCreated{}})
+	g.Expect(err).To(HaveOccurred(), "should give up once the context is done when the buffer is full")
+}
+
+// compact keeps the last record of every key, dropping the keys whose last
+// record is a tombstone, like the log compaction of Kafka eventually does.
+func compact(records []cloudevents.Record) map[string]cloudevents.Record {
+	var compacted = make(map[string]cloudevents.Record)
+
+	for _, record := range records {
+		if record.Tombstone() {
+			delete(compacted, record.Key)
+			continue
+		}
+
+		compacted[record.Key] = record
+	}
+
+	return compacted
+}
+
+// Test_Publisher_Tombstones describes what the consumers of a compacted topic
+// can rely on.
+func Test_Publisher_Tombstones(t *testing.T) {
+
+	at := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	user := func(id int, deleted bool) models.User {
+		u := models.NewUser(id, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+		u.Meta.HydrateMeta(2, at, at, deleted)
+		return u
+	}
+
+	type testExpectation struct {
+		types     []string
+		compacted []string
+	}
+
+	testCases := []struct {
+		description string
+		mode        string
+		deleted     bool
+		events      []domain.Event
+		expected    testExpectation
+	}{
+		{
+			description: "when a user is deleted",
+			mode:        cloudevents.TombstoneOnErasure,
+			events:      []domain.Event{models.UserCreated{At: at}, models.UserDeactivated{At: at}},
+			expected: testExpectation{
+				types:     []string{cloudevents.TypeUserCreated, cloudevents.TypeUserDeleted},
+				compacted: []string{cloudevents.TypeUserDeleted},
+			},
+		},
+		{
+			description: "when a user is erased",
+			mode:        cloudevents.TombstoneOnErasure,
+			events:      []domain.Event{models.UserCreated{At: at}, models.UserErased{At: at}},
+			expected: testExpectation{
+				types: []string{cloudevents.TypeUserCreated, "tombstone"},
+			},
+		},
+		{
+			description: "when a user is deleted and deletions leave tombstones",
+			mode:        cloudevents.TombstoneOnDelete,
+			events:      []domain.Event{models.UserCreated{At: at}, models.UserDeactivated{At: at}},
+			expected: testExpectation{
+				types: []string{cloudevents.TypeUserCreated, cloudevents.TypeUserDeleted, "tombstone"},
+			},
+		},
+		{
+			description: "when a user is erased and deletions leave tombstones",
+			mode:        cloudevents.TombstoneOnDelete,
+			events:      []domain.Event{models.UserCreated{At: at}, models.UserErased{At: at}},
+			expected: testExpectation{
+				types: []string{cloudevents.TypeUserCreated, cloudevents.TypeUserDeleted, "tombstone"},
+			},
+		},
+		{
+			description: "when a deleted user is replayed",
+			mode:        cloudevents.TombstoneOnErasure,
+			deleted:     true,
+			events:      []domain.Event{models.UserDeactivated{At: at}, models.UserSnapshot{At: at}},
+			expected: testExpectation{
+				types:     []string{cloudevents.TypeUserDeleted, cloudevents.TypeUserSnapshot},
+				compacted: []string{cloudevents.TypeUserSnapshot},
+			},
+		},
+		{
+			description: "when a deleted user is replayed and deletions leave tombstones",
+			mode:        cloudevents.TombstoneOnDelete,
+			deleted:     true,
+			events:      []domain.Event{models.UserDeactivated{At: at}, models.UserSnapshot{At: at}},
+			expected: testExpectation{
+				types: []string{cloudevents.TypeUserDeleted, "tombstone", cloudevents.TypeUserSnapshot, "tombstone"},
+			},
+		},
+		{
+			description: "when an active user is replayed and deletions leave tombstones",
+			mode:        cloudevents.TombstoneOnDelete,
+			events:      []domain.Event{models.UserCreated{At: at}, models.UserSnapshot{At: at}},
+			expected: testExpectation{
+				types:     []string{cloudevents.TypeUserCreated, cloudevents.TypeUserSnapshot},
+				compacted: []string{cloudevents.TypeUserSnapshot},
+			},
+		},
+		{
+			description: "when a user is updated and deletions leave tombstones",
+			mode:        cloudevents.TombstoneOnDelete,
+			events:      []domain.Event{models.UserCreated{At: at}, models.EmailChanged{Old: "a@example.qqq", New: "example@example.qqq", At: at}},
+			expected: testExpectation{
+				types:     []string{cloudevents.TypeUserCreated, cloudevents.TypeUserUpdated},
+				compacted: []string{cloudevents.TypeUserUpdated},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			encoder, err := cloudevents.NewEncoder(json.UserSerializer{}, "/users").WithTombstones(tc.mode)
+			g.Expect(err).ToNot(HaveOccurred(), "should accept the mode")
+
+			publisher := NewPublisher(encoder, 10)
+
+			// another user, whose records compaction must keep
+			g.Expect(publisher.PublishSync(context.TODO(), user(2, false), []domain.Event{models.UserCreated{At: at}})).To(Succeed())
+			for _, event := range tc.events {
+				g.Expect(publisher.PublishSync(context.TODO(), user(1, tc.deleted), []domain.Event{event})).To(Succeed(), "should publish the event")
+			}
+
+			var (
+				records []cloudevents.Record
+				types   []string
+			)
+
+			for len(publisher.Records()) > 0 {
+				record := <-publisher.Records()
+				records = append(records, record)
+
+				if record.Key == "2" {
+					continue
+				}
+
+				g.Expect(record.Key).To(Equal("1"), "should key every record by the user id")
+				if record.Tombstone() {
+					types = append(types, "tombstone")
+					continue
+				}
+
+				g.Expect(record.Event.Subject).To(Equal(record.Key), "should use the key as subject")
+				types = append(types, record.Event.Type)
+
+				if record.Event.Type == cloudevents.TypeUserDeleted {
+					g.Expect(string(record.Event.Data)).ToNot(ContainSubstring("example@example.qqq"), "should not carry the data of a deleted user")
+				}
+			}
+
+			g.Expect(types).To(Equal(tc.expected.types), "should publish the records in order")
+
+			compacted := compact(records)
+			g.Expect(compacted).To(HaveKey("2"), "should keep the other users")
+
+			if tc.expected.compacted == nil {
+				g.Expect(compacted).ToNot(HaveKey("1"), "should leave nothing of the user once compacted")
+			} else {
+				g.Expect(compacted).To(HaveKey("1"), "should keep the user once compacted")
+				g.Expect(compacted["1"].Event.Type).To(Equal(tc.expected.compacted[0]), "should keep the last event of the user")
+			}
+		})
+	}
+
+	_, err := cloudevents.NewEncoder(json.UserSerializer{}, "/users").WithTombstones("never")
+	NewWithT(t).Expect(err).To(HaveOccurred(), "should reject unknown modes")
+}
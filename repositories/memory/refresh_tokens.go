@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"code/tech-test/domain/auth/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrTokenNotFound = postgresql.ErrTokenNotFound
+	ErrTokenRotated  = postgresql.ErrTokenRotated
+)
+
+type RefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]models.RefreshToken
+}
+
+func NewRefreshTokenStore() *RefreshTokenStore {
+	return &RefreshTokenStore{
+		tokens: make(map[string]models.RefreshToken),
+	}
+}
+
+func (s *RefreshTokenStore) Get(ctx context.Context, id string) (models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return models.RefreshToken{}, ErrTokenNotFound
+	}
+
+	return token, nil
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token.CreatedAt = now()
+	s.tokens[token.ID] = token
+
+	return nil
+}
+
+func (s *RefreshTokenStore) Rotate(ctx context.Context, id string, next models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || token.IsRotated() || token.IsRevoked() {
+		return ErrTokenRotated
+	}
+
+	token.RotatedAt = now()
+	s.tokens[id] = token
+
+	next.CreatedAt = now()
+	s.tokens[next.ID] = next
+
+	return nil
+}
+
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.FamilyID == familyID && !token.IsRevoked() {
+			token.RevokedAt = now()
+			s.tokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+// ListByUser returns the refresh tokens of the user, oldest first.
+func (s *RefreshTokenStore) ListByUser(ctx context.Context, userID int) ([]models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tokens []models.RefreshToken = make([]models.RefreshToken, 0)
+
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].ID < tokens[j].ID
+		}
+
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// DeleteByUser removes the refresh tokens of the user, which can no longer
+// refresh its access tokens.
+func (s *RefreshTokenStore) DeleteByUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, id)
+		}
+	}
+
+	return nil
+}
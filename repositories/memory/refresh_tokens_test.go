@@ -0,0 +1,64 @@
+//+build unit
+
+package memory
+
+import (
+	"code/tech-test/domain/auth/models"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_RefreshTokenStore(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+	store := NewRefreshTokenStore()
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	g.Expect(store.Create(ctx, models.NewRefreshToken("first", "family", 1, expiresAt))).To(Succeed(), "should create the token")
+
+	g.Expect(store.Rotate(ctx, "first", models.NewRefreshToken("second", "family", 1, expiresAt))).To(Succeed(), "should rotate the token")
+	g.Expect(store.Rotate(ctx, "first", models.NewRefreshToken("third", "family", 1, expiresAt))).To(Equal(ErrTokenRotated), "should rotate a token only once")
+
+	first, err := store.Get(ctx, "first")
+	g.Expect(err).ToNot(HaveOccurred(), "should get the token")
+	g.Expect(first.IsRotated()).To(BeTrue(), "should mark the token as rotated")
+
+	g.Expect(store.RevokeFamily(ctx, "family")).To(Succeed(), "should revoke the family")
+
+	second, err := store.Get(ctx, "second")
+	g.Expect(err).ToNot(HaveOccurred(), "should get the token")
+	g.Expect(second.IsRevoked()).To(BeTrue(), "should revoke every token of the family")
+
+	_, err = store.Get(ctx, "third")
+	g.Expect(err).To(Equal(ErrTokenNotFound), "should not store the token of a failed rotation")
+}
+
+func Test_RefreshTokenStore_ByUser(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+	store := NewRefreshTokenStore()
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	g.Expect(store.Create(ctx, models.NewRefreshToken("first", "family", 1, expiresAt))).To(Succeed())
+	g.Expect(store.Create(ctx, models.NewRefreshToken("second", "family", 1, expiresAt))).To(Succeed())
+	g.Expect(store.Create(ctx, models.NewRefreshToken("other", "other", 2, expiresAt))).To(Succeed())
+
+	tokens, err := store.ListByUser(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should list the tokens")
+	g.Expect(tokens).To(HaveLen(2), "should only list the tokens of the user")
+	g.Expect(tokens[0].ID).To(Equal("first"), "should list the oldest token first")
+
+	g.Expect(store.DeleteByUser(ctx, 1)).To(Succeed(), "should delete the tokens")
+
+	tokens, err = store.ListByUser(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tokens).To(BeEmpty(), "should delete every token of the user")
+
+	_, err = store.Get(ctx, "other")
+	g.Expect(err).ToNot(HaveOccurred(), "should keep the tokens of the other users")
+}
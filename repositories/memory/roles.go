@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrRoleNotFound = postgresql.ErrRoleNotFound
+	ErrRoleInUse    = postgresql.ErrRoleInUse
+)
+
+type RoleStore struct {
+	mu    sync.RWMutex
+	roles map[string]models.Role
+	users *UserStore
+}
+
+// NewRoleStore holds the admin role from the start, like the migration
+// creating the roles table. The user store is checked for assignments
+// before deleting a role.
+func NewRoleStore(users *UserStore) *RoleStore {
+	admin := models.NewRole("admin", "Full access to every resource", []string{models.PermissionAdmin})
+	admin.Meta.HydrateMeta(1, now(), now(), false)
+
+	return &RoleStore{
+		roles: map[string]models.Role{admin.Name: admin},
+		users: users,
+	}
+}
+
+func (s *RoleStore) Get(ctx context.Context, name string) (models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	role, ok := s.roles[name]
+	if !ok {
+		return models.Role{}, ErrRoleNotFound
+	}
+
+	return s.copy(role), nil
+}
+
+func (s *RoleStore) List(ctx context.Context) ([]models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var roles []models.Role = make([]models.Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, s.copy(role))
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+func (s *RoleStore) Store(ctx context.Context, role models.Role, version uint32) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current uint32
+
+	stored, ok := s.roles[role.Name]
+	if ok {
+		current = stored.Meta.GetVersion()
+	}
+
+	if current != version {
+		return models.Role{}, ErrWrongVersion
+	}
+
+	result := models.NewRole(role.Name, role.Description, role.Permissions)
+	if current == 0 {
+		result.Meta.HydrateMeta(1, now(), now(), false)
+	} else {
+		result.Meta.HydrateMeta(current+1, stored.Meta.GetCreatedAt(), now(), false)
+	}
+
+	s.roles[result.Name] = result
+
+	return s.copy(result), nil
+}
+
+func (s *RoleStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[name]; !ok {
+		return ErrRoleNotFound
+	}
+
+	if s.users.assigned(name) {
+		return ErrRoleInUse
+	}
+
+	delete(s.roles, name)
+
+	return nil
+}
+
+func (s *RoleStore) copy(role models.Role) models.Role {
+	result := models.NewRole(role.Name, role.Description, role.Permissions)
+
+	result.Meta.HydrateMeta(role.Meta.GetVersion(), role.Meta.GetCreatedAt(), role.Meta.GetUpdatedAt(), false)
+
+	return result
+}
@@ -0,0 +1,41 @@
+//+build unit
+
+package memory
+
+import (
+	"code/tech-test/domain/users/models"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_RoleStore(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+	users := initUserStore()
+	store := NewRoleStore(users)
+
+	_, err := store.Get(ctx, "admin")
+	g.Expect(err).ToNot(HaveOccurred(), "should hold the admin role from the start")
+
+	support, err := store.Store(ctx, models.NewRole("support", "", []string{"users:read"}), 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should create the role")
+	g.Expect(support.Meta.GetVersion()).To(Equal(uint32(1)), "should start at the first version")
+
+	_, err = store.Store(ctx, models.NewRole("support", "", nil), 0)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should not create a role twice")
+
+	user, _ := users.Get(ctx, 1)
+	user.AssignRole("support")
+	_, err = users.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should assign the role")
+
+	g.Expect(store.Delete(ctx, "support")).To(Equal(ErrRoleInUse), "should not delete an assigned role")
+	g.Expect(store.Delete(ctx, "unknown")).To(Equal(ErrRoleNotFound), "should report unknown roles")
+
+	roles, err := store.List(ctx)
+	g.Expect(err).ToNot(HaveOccurred(), "should list the roles")
+	g.Expect(roles).To(HaveLen(2), "should list every role")
+	g.Expect(roles[0].Name).To(Equal("admin"), "should sort the roles by name")
+}
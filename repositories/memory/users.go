@@ -0,0 +1,551 @@
+package memory
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/tracing"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/repositories/postgresql"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The memory store shares the sentinel errors of the postgresql store so the
+// services map both implementations in the same way.
+var (
+	ErrWrongVersion    = postgresql.ErrWrongVersion
+	ErrUniqueViolation = postgresql.ErrUniqueViolation
+	ErrUserNotFound    = postgresql.ErrUserNotFound
+	ErrVersionNotFound = postgresql.ErrVersionNotFound
+	ErrUserActive      = postgresql.ErrUserActive
+	ErrUserErased      = postgresql.ErrUserErased
+	ErrUserExists      = postgresql.ErrUserExists
+)
+
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[int]models.User
+	lastID   int
+	outbox   *Outbox
+	history  map[int][]models.HistoryEntry
+	erasures map[int][]models.Erasure
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:    make(map[int]models.User),
+		outbox:   NewOutbox(),
+		history:  make(map[int][]models.HistoryEntry),
+		erasures: make(map[int][]models.Erasure),
+	}
+}
+
+// Outbox returns the outbox the changes of the store are written to.
+func (s *UserStore) Outbox() *Outbox {
+	return s.outbox
+}
+
+func (s *UserStore) Get(ctx context.Context, id int) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok || user.Meta.GetDisabled() {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return s.copy(user), nil
+}
+
+// GetByLogin finds the active user whose nickname or email is the login,
+// preferring a nickname match.
+func (s *UserStore) GetByLogin(ctx context.Context, login string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		found models.User
+		ok    bool
+	)
+
+	for _, user := range s.users {
+		if user.Meta.GetDisabled() {
+			continue
+		}
+
+		if user.Nickname == login {
+			return s.copy(user), nil
+		}
+
+		if user.Email == login {
+			found, ok = user, true
+		}
+	}
+
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+
+	return s.copy(found), nil
+}
+
+func (s *UserStore) List(ctx context.Context, q query.Query) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := s.filter(q)
+
+	sort.Slice(users, func(i, j int) bool {
+		return q.Sort.Less(users[i], users[j])
+	})
+
+	if q.After != nil {
+		after := make([]models.User, 0, len(users))
+		for _, user := range users {
+			if q.After.After(user) {
+				after = append(after, user)
+			}
+		}
+		users = after
+	}
+
+	if q.Offset >= len(users) {
+		return make([]models.User, 0), nil
+	}
+	users = users[q.Offset:]
+
+	if q.Limit > 0 && q.Limit < len(users) {
+		users = users[:q.Limit]
+	}
+
+	return users, nil
+}
+
+func (s *UserStore) Count(ctx context.Context, q query.Query) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.filter(q)), nil
+}
+
+func (s *UserStore) filter(q query.Query) []models.User {
+	var users []models.User = make([]models.User, 0)
+
+	for _, user := range s.users {
+		if (user.Meta.GetDisabled() && !q.IncludeDisabled) || (q.Filter != nil && !q.Filter.Match(user)) {
+			continue
+		}
+
+		users = append(users, s.copy(user))
+	}
+
+	return users
+}
+
+func (s *UserStore) Store(ctx context.Context, user models.User, version uint32) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current uint32
+
+	stored, ok := s.users[user.ID]
+	if ok {
+		current = stored.Meta.GetVersion()
+	}
+
+	switch {
+	case current != version && version == 0:
+		return models.User{}, ErrUserExists
+	case current != version:
+		return models.User{}, ErrWrongVersion
+	}
+
+	if current == 0 {
+		return s.create(ctx, user)
+	}
+
+	return s.update(ctx, stored, user)
+}
+
+// Delete hides the user. It is a change like any other, so it makes a new
+// version of the user. A user already deleted, or erased, is not found, so
+// deleting it again publishes nothing. A version of 0 deletes whatever the
+// current version.
+func (s *UserStore) Delete(ctx context.Context, id int, version uint32) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	switch {
+	case !ok || user.Meta.GetDisabled():
+		return models.User{}, ErrUserNotFound
+	case version != 0 && user.Meta.GetVersion() != version:
+		return models.User{}, ErrWrongVersion
+	}
+
+	user.Meta.HydrateMeta(user.Meta.GetVersion()+1, user.Meta.GetCreatedAt(), now(), true)
+
+	deactivated := models.UserDeactivated{At: user.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, user, []domain.Event{deactivated}); err != nil {
+		return models.User{}, err
+	}
+	s.users[id] = user
+	s.record(ctx, user, []domain.Event{deactivated})
+
+	return s.copy(user), nil
+}
+
+// Restore follows the contract of the postgresql UserStore.Restore.
+func (s *UserStore) Restore(ctx context.Context, id int, version uint32) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	switch {
+	case !ok:
+		return models.User{}, ErrUserNotFound
+	case version != 0 && user.Meta.GetVersion() != version:
+		return models.User{}, ErrWrongVersion
+	case !user.Meta.GetDisabled():
+		return models.User{}, ErrUserActive
+	case len(s.erasures[id]) > 0:
+		return models.User{}, ErrUserErased
+	case s.conflicts(id, user):
+		return models.User{}, ErrUniqueViolation
+	}
+
+	user.Meta.HydrateMeta(user.Meta.GetVersion()+1, user.Meta.GetCreatedAt(), now(), false)
+
+	restored := models.UserRestored{At: user.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, user, []domain.Event{restored}); err != nil {
+		return models.User{}, err
+	}
+	s.users[id] = user
+	s.record(ctx, user, []domain.Event{restored})
+
+	return s.copy(user), nil
+}
+
+// Purge erases the user for good, along with its roles, history and outbox
+// messages, sent or not. The erasure is the last version of the user, it is
+// published and kept in the history without the data of the user, and its
+// proof is recorded like for Erase. A version of 0 purges whatever the current
+// version.
+func (s *UserStore) Purge(ctx context.Context, id int, version uint32) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	switch {
+	case !ok:
+		return models.User{}, ErrUserNotFound
+	case version != 0 && user.Meta.GetVersion() != version:
+		return models.User{}, ErrWrongVersion
+	}
+
+	erased := user.Erased()
+	erased.Meta.HydrateMeta(user.Meta.GetVersion()+1, user.Meta.GetCreatedAt(), now(), true)
+
+	event := models.UserErased{At: erased.Meta.GetUpdatedAt()}
+
+	s.outbox.drop(id)
+	if err := s.announce(ctx, erased, []domain.Event{event}); err != nil {
+		return models.User{}, err
+	}
+	entries := len(s.history[id])
+	delete(s.users, id)
+	delete(s.history, id)
+	s.record(ctx, erased, []domain.Event{event})
+
+	s.erasures[id] = append(s.erasures[id], models.Erasure{
+		UserID:         id,
+		Version:        erased.Meta.GetVersion(),
+		Fields:         models.ChangedFields([]domain.Event{event}),
+		HistoryEntries: entries,
+		Actor:          domain.ActorFrom(ctx),
+		RequestID:      domain.RequestIDFrom(ctx),
+		At:             event.At,
+	})
+
+	return erased, nil
+}
+
+// Erase anonymizes the user and its history for good, on request of the user.
+// Its roles go along with its outbox messages, sent or not, which still hold
+// its data, while the user and history keep the versions, actors and timestamps. The
+// erasure is a new version of the user, published without any data, and the
+// proof of it is recorded. A version of 0 erases whatever the current version.
+func (s *UserStore) Erase(ctx context.Context, id int, version uint32) (models.Erasure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	switch {
+	case !ok:
+		return models.Erasure{}, ErrUserNotFound
+	case version != 0 && user.Meta.GetVersion() != version:
+		return models.Erasure{}, ErrWrongVersion
+	case len(s.erasures[id]) > 0:
+		return models.Erasure{}, ErrUserErased
+	}
+
+	erased := models.NewUser(id, "", "", "", "", "", "")
+	erased.Meta.HydrateMeta(user.Meta.GetVersion()+1, user.Meta.GetCreatedAt(), now(), true)
+
+	event := models.UserErased{At: erased.Meta.GetUpdatedAt()}
+
+	s.outbox.drop(id)
+	if err := s.announce(ctx, erased, []domain.Event{event}); err != nil {
+		return models.Erasure{}, err
+	}
+
+	history := s.history[id]
+	for i := range history {
+		snapshot := history[i].User
+		anonymized := models.NewUser(id, "", "", "", "", "", "")
+		anonymized.Roles = snapshot.Roles
+		anonymized.Meta.HydrateMeta(snapshot.Meta.GetVersion(), snapshot.Meta.GetCreatedAt(), snapshot.Meta.GetUpdatedAt(), snapshot.Meta.GetDisabled())
+
+		history[i].User = anonymized
+	}
+
+	s.users[id] = erased
+	s.record(ctx, erased, []domain.Event{event})
+
+	erasure := models.Erasure{
+		UserID:         id,
+		Version:        erased.Meta.GetVersion(),
+		Fields:         models.ChangedFields([]domain.Event{event}),
+		HistoryEntries: len(history),
+		Actor:          domain.ActorFrom(ctx),
+		RequestID:      domain.RequestIDFrom(ctx),
+		At:             event.At,
+	}
+	s.erasures[id] = append(s.erasures[id], erasure)
+
+	return erasure, nil
+}
+
+// Erasures returns the proofs of erasure of the user, oldest first. They are
+// kept when the user is purged.
+func (s *UserStore) Erasures(ctx context.Context, id int) ([]models.Erasure, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var erasures []models.Erasure = make([]models.Erasure, 0)
+
+	for _, erasure := range s.erasures[id] {
+		erasure.Fields = append([]string(nil), erasure.Fields...)
+		erasures = append(erasures, erasure)
+	}
+
+	return erasures, nil
+}
+
+// Snapshot writes the snapshot of the user to the outbox, under the lock of
+// the changes. It is not a change, the version is kept.
+func (s *UserStore) Snapshot(ctx context.Context, id int, snapshot models.UserSnapshot) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+
+	if err := s.announce(ctx, user, []domain.Event{snapshot}); err != nil {
+		return models.User{}, err
+	}
+
+	return s.copy(user), nil
+}
+
+// announce writes the outbox message of the change before it is applied,
+// both happen under the lock of the store. Changes without events are not
+// announced.
+func (s *UserStore) announce(ctx context.Context, user models.User, events []domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	message, err := outbox.NewUserMessage(user, events)
+	if err != nil {
+		return err
+	}
+	message.TraceParent = tracing.TraceParent(ctx)
+
+	s.outbox.add(message)
+
+	return nil
+}
+
+// create adds the user under the next id, or the one it is given, which the
+// next ids then follow. A given id is refused once erased so a create
+// delivered again does not bring a purged user back.
+func (s *UserStore) create(ctx context.Context, user models.User) (models.User, error) {
+	if s.conflicts(0, user) {
+		return models.User{}, ErrUniqueViolation
+	}
+
+	if len(s.erasures[user.ID]) > 0 {
+		return models.User{}, ErrUserErased
+	}
+
+	id := user.ID
+	if id == 0 {
+		id = s.lastID + 1
+	}
+
+	created := models.NewUser(id, user.FirstName, user.LastName, user.Nickname, user.Password, user.Email, user.Country)
+	created.Roles = copyRoles(user.Roles)
+	created.Meta.HydrateMeta(1, now(), now(), false)
+
+	if err := s.announce(ctx, created, user.Meta.Changes()); err != nil {
+		return models.User{}, err
+	}
+	if id > s.lastID {
+		s.lastID = id
+	}
+	s.users[created.ID] = created
+	s.record(ctx, created, user.Meta.Changes())
+
+	return s.copy(created), nil
+}
+
+func (s *UserStore) update(ctx context.Context, stored, user models.User) (models.User, error) {
+	if !stored.Meta.GetDisabled() && s.conflicts(stored.ID, user) {
+		return models.User{}, ErrUniqueViolation
+	}
+
+	updated := models.NewUser(stored.ID, user.FirstName, user.LastName, user.Nickname, user.Password, user.Email, user.Country)
+	updated.Roles = copyRoles(user.Roles)
+
+	// an update without events, like a rehashed password, keeps the version
+	// so it is neither a new version of the history nor a conflict for
+	// the clients holding the current one
+	if len(user.Meta.Changes()) == 0 {
+		updated.Meta.HydrateMeta(stored.Meta.GetVersion(), stored.Meta.GetCreatedAt(), stored.Meta.GetUpdatedAt(), stored.Meta.GetDisabled())
+		s.users[updated.ID] = updated
+
+		return s.copy(updated), nil
+	}
+
+	updated.Meta.HydrateMeta(user.Meta.GetVersion()+1, stored.Meta.GetCreatedAt(), now(), stored.Meta.GetDisabled())
+
+	if err := s.announce(ctx, updated, user.Meta.Changes()); err != nil {
+		return models.User{}, err
+	}
+	s.users[updated.ID] = updated
+	s.record(ctx, updated, user.Meta.Changes())
+
+	return s.copy(updated), nil
+}
+
+// record appends the version of the user to its history, under the lock of
+// the change.
+func (s *UserStore) record(ctx context.Context, user models.User, events []domain.Event) {
+	entry := models.NewHistoryEntry(user, events, domain.ActorFrom(ctx), domain.RequestIDFrom(ctx))
+
+	s.history[user.ID] = append(s.history[user.ID], entry)
+}
+
+// History returns the versions of the user after the given one, oldest
+// first. Deleted users keep their history.
+func (s *UserStore) History(ctx context.Context, id int, after uint32, limit int) ([]models.HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.HistoryEntry = make([]models.HistoryEntry, 0)
+
+	for _, entry := range s.history[id] {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+
+		if entry.Version() > after {
+			entries = append(entries, copyEntry(entry))
+		}
+	}
+
+	return entries, nil
+}
+
+// GetVersion returns the user as of the version.
+func (s *UserStore) GetVersion(ctx context.Context, id int, version uint32) (models.HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.history[id] {
+		if entry.Version() == version {
+			return copyEntry(entry), nil
+		}
+	}
+
+	return models.HistoryEntry{}, ErrVersionNotFound
+}
+
+// conflicts mirrors the unique_active_nickname and unique_active_email indexes.
+func (s *UserStore) conflicts(id int, user models.User) bool {
+	for _, other := range s.users {
+		if other.ID == id || other.Meta.GetDisabled() {
+			continue
+		}
+
+		if other.Nickname == user.Nickname || other.Email == user.Email {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *UserStore) copy(user models.User) models.User {
+	result := models.NewUser(user.ID, user.FirstName, user.LastName, user.Nickname, user.Password, user.Email, user.Country)
+	result.Roles = copyRoles(user.Roles)
+
+	result.Meta.HydrateMeta(user.Meta.GetVersion(), user.Meta.GetCreatedAt(), user.Meta.GetUpdatedAt(), user.Meta.GetDisabled())
+
+	return result
+}
+
+// assigned reports whether any user, including deleted ones, has the role,
+// like the foreign key of the user_roles table.
+func (s *UserStore) assigned(role string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyEntry(entry models.HistoryEntry) models.HistoryEntry {
+	result := entry
+	result.User.Roles = copyRoles(entry.User.Roles)
+	result.Changes = append(make([]string, 0, len(entry.Changes)), entry.Changes...)
+
+	return result
+}
+
+// copyRoles keeps nil roles nil, like a user built without any.
+func copyRoles(roles []string) []string {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return append([]string(nil), roles...)
+}
+
+// now matches the precision of the PostgreSQL TIMESTAMP columns.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,698 @@
+//+build unit
+
+package memory
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func initUserStore() *UserStore {
+	store := NewUserStore()
+
+	for _, user := range []models.User{
+		models.CreateUser("Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk"),
+		models.CreateUser("Test", "Test", "testuser-2", "qwerty", "example-db@example.qqq", "ab"),
+	} {
+		if _, err := store.Store(context.TODO(), user, 0); err != nil {
+			panic(err)
+		}
+	}
+
+	return store
+}
+
+func Test_UserStore_Store(t *testing.T) {
+
+	sampleMeta := domain.NewMeta()
+	sampleMeta.SetVersion(1)
+
+	updated := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	updated.Meta.SetVersion(1)
+	updated.SetCountry("uk-Updated")
+	updated.SetEmail("example@example.qqq-Updated")
+	updated.SetFirstName("Test-Updated")
+	updated.SetLastName("Test-Updated")
+	updated.SetPassword("qwerty-Updated")
+
+	rehashed := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	rehashed.Meta.SetVersion(1)
+	rehashed.RehashPassword("qwerty-Rehashed")
+
+	type testInput struct {
+		user    models.User
+		version uint32
+	}
+
+	type testExpectation struct {
+		err     error
+		result  models.User
+		version uint32
+	}
+
+	testCases := []struct {
+		description string
+		input       testInput
+		expected    testExpectation
+	}{
+		{
+			description: "when creating a user",
+			input: testInput{
+				user:    models.CreateUser("test", "test", "testUser1", "aue8r9gau98e", "user1@qweqwe.com", "uk"),
+				version: 0,
+			},
+			expected: testExpectation{
+				result: models.User{
+					Country:   "uk",
+					Email:     "user1@qweqwe.com",
+					FirstName: "test",
+					LastName:  "test",
+					Nickname:  "testUser1",
+					Password:  "aue8r9gau98e",
+					ID:        3,
+				},
+				version: 1,
+			},
+		},
+		{
+			description: "when updating a user",
+			input: testInput{
+				user:    updated,
+				version: 1,
+			},
+			expected: testExpectation{
+				result: models.User{
+					Nickname:  "testuser",
+					Country:   "uk-Updated",
+					Email:     "example@example.qqq-Updated",
+					FirstName: "Test-Updated",
+					LastName:  "Test-Updated",
+					Password:  "qwerty-Updated",
+					ID:        1,
+				},
+				version: 2,
+			},
+		},
+		{
+			description: "when storing a user without changes",
+			input: testInput{
+				user:    rehashed,
+				version: 1,
+			},
+			expected: testExpectation{
+				result: models.User{
+					Nickname:  "testuser",
+					Country:   "uk",
+					Email:     "example@example.qqq",
+					FirstName: "Test",
+					LastName:  "Test",
+					Password:  "qwerty-Rehashed",
+					ID:        1,
+				},
+				version: 1,
+			},
+		},
+		{
+			description: "when updating a user but version is incorrect",
+			input: testInput{
+				user: models.User{
+					Nickname: "testuser",
+					Meta:     domain.NewMeta(),
+					ID:       1,
+				},
+				version: 2,
+			},
+			expected: testExpectation{
+				err: ErrWrongVersion,
+			},
+		},
+		{
+			description: "when updating a user but user does not exist",
+			input: testInput{
+				user: models.User{
+					Nickname: "notanuser",
+					Meta:     sampleMeta,
+					ID:       100,
+				},
+				version: 1,
+			},
+			expected: testExpectation{
+				err: ErrWrongVersion,
+			},
+		},
+		{
+			description: "when creating a user with a nickname already in use",
+			input: testInput{
+				user:    models.CreateUser("test", "test", "testuser", "qwerty", "other@example.qqq", "uk"),
+				version: 0,
+			},
+			expected: testExpectation{
+				err: ErrUniqueViolation,
+			},
+		},
+		{
+			description: "when updating a user to an email already in use",
+			input: testInput{
+				user: models.User{
+					Nickname: "testuser",
+					Email:    "example-db@example.qqq",
+					Meta:     sampleMeta,
+					ID:       1,
+				},
+				version: 1,
+			},
+			expected: testExpectation{
+				err: ErrUniqueViolation,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var ctx = context.TODO()
+			defer ctx.Done()
+
+			repo := initUserStore()
+
+			result, err := repo.Store(ctx, tc.input.user, tc.input.version)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(result.Country).To(Equal(tc.expected.result.Country), "should be the same country")
+				g.Expect(result.Nickname).To(Equal(tc.expected.result.Nickname), "should be the same nickname")
+				g.Expect(result.FirstName).To(Equal(tc.expected.result.FirstName), "should be the same first name")
+				g.Expect(result.LastName).To(Equal(tc.expected.result.LastName), "should be the same last name")
+				g.Expect(result.Email).To(Equal(tc.expected.result.Email), "should be the same email")
+				g.Expect(result.Password).To(Equal(tc.expected.result.Password), "should be the same password")
+				g.Expect(result.ID).To(Equal(tc.expected.result.ID), "should be the same id")
+				g.Expect(result.Meta.GetVersion()).To(Equal(tc.expected.version), "should bump the version of the changes only")
+			}
+		})
+	}
+}
+
+func Test_UserStore_Store_Unchanged(t *testing.T) {
+	g := NewWithT(t)
+
+	var ctx = context.TODO()
+	defer ctx.Done()
+
+	repo := initUserStore()
+
+	stored, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user := stored
+	user.RehashPassword("qwerty-Rehashed")
+
+	result, err := repo.Store(ctx, user, stored.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should store the user")
+	g.Expect(result.Password).To(Equal("qwerty-Rehashed"), "should store the new hash")
+	g.Expect(result.Meta.GetVersion()).To(Equal(stored.Meta.GetVersion()), "should keep the version")
+	g.Expect(result.Meta.GetUpdatedAt()).To(Equal(stored.Meta.GetUpdatedAt()), "should keep the time of the last change")
+
+	history, err := repo.History(ctx, 1, 0, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(HaveLen(1), "should record no version")
+	g.Expect(repo.Outbox().entries).To(HaveLen(2), "should publish nothing")
+
+	_, err = repo.Store(ctx, stored, stored.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should still accept the version the clients hold")
+}
+
+func Test_UserStore_Delete(t *testing.T) {
+	g := NewWithT(t)
+
+	var ctx = context.TODO()
+	defer ctx.Done()
+
+	repo := initUserStore()
+
+	_, err := repo.Delete(ctx, 1, 2)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should check the version")
+
+	user, err := repo.Delete(ctx, 1, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+	g.Expect(user.Meta.GetDisabled()).To(BeTrue(), "should be disabled")
+	g.Expect(user.Meta.GetVersion()).To(Equal(uint32(2)), "should make a new version")
+
+	_, err = repo.Get(ctx, 1)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should hide the deleted user")
+
+	users, err := repo.List(ctx, query.Query{})
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+	g.Expect(users).To(HaveLen(1), "should not list the deleted user")
+
+	users, err = repo.List(ctx, query.Query{IncludeDisabled: true})
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+	g.Expect(users).To(HaveLen(2), "should list the deleted user when asked to")
+
+	created, err := repo.Store(ctx, models.CreateUser("Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk"), 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should allow reusing the nickname and email of a deleted user")
+	g.Expect(created.ID).To(Equal(3), "should be a new user")
+
+	_, err = repo.Delete(ctx, 100, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should fail for unknown users")
+
+	queued := len(repo.Outbox().entries)
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should fail for deleted users")
+	g.Expect(repo.Outbox().entries).To(HaveLen(queued), "should not publish the deletion again")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(2), "should not make a new version")
+}
+
+func Test_UserStore_Store_ID(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	repo := initUserStore()
+
+	user := models.CreateUser("Test", "Test", "upstream", "qwerty", "upstream@example.qqq", "uk")
+	user.ID = 10
+
+	created, err := repo.Store(ctx, user, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should create the user")
+	g.Expect(created.ID).To(Equal(10), "should keep the given id")
+
+	_, err = repo.Store(ctx, user, 0)
+	g.Expect(err).To(Equal(ErrUserExists), "should not create the user twice")
+
+	next, err := repo.Store(ctx, models.CreateUser("Test", "Test", "next", "qwerty", "next@example.qqq", "uk"), 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(next.ID).To(Equal(11), "should assign the ids after the given one")
+
+	_, err = repo.Purge(ctx, 10, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Store(ctx, user, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not bring a purged user back")
+}
+
+func Test_UserStore_List(t *testing.T) {
+
+	afterFirst := query.CursorFor(models.User{ID: 1}, query.Sort{Field: "id"})
+	afterLastDesc, _ := query.DecodeCursor(query.Cursor{Sort: query.Sort{Field: "nickname", Descending: true}, Value: "testuser-2", ID: 2}.Encode())
+
+	type testInput struct {
+		query query.Query
+	}
+
+	type testExpectation struct {
+		ids   []int
+		total int
+	}
+
+	testCases := []struct {
+		description string
+		input       testInput
+		expected    testExpectation
+	}{
+		{
+			description: "when searching for users with country uk",
+			input: testInput{
+				query: query.Query{Filter: query.Equal("country", "uk")},
+			},
+			expected: testExpectation{
+				ids:   []int{1},
+				total: 1,
+			},
+		},
+		{
+			description: "when searching with terms that do not match",
+			input: testInput{
+				query: query.Query{Filter: query.And{query.Equal("country", "uk"), query.Equal("nickname", "testuser-2")}},
+			},
+			expected: testExpectation{
+				ids:   []int{},
+				total: 0,
+			},
+		},
+		{
+			description: "when listing users",
+			input: testInput{
+				query: query.Query{Sort: query.Sort{Field: "id"}},
+			},
+			expected: testExpectation{
+				ids:   []int{1, 2},
+				total: 2,
+			},
+		},
+		{
+			description: "when searching with a filter",
+			input: testInput{
+				query: query.Query{Filter: query.Or{
+					query.Condition{Field: "nickname", Operator: query.OpPrefix, Values: []string{"testuser-"}},
+					query.Not{Filter: query.Condition{Field: "email", Operator: query.OpLike, Values: []string{"*EXAMPLE-DB*"}}},
+				}},
+			},
+			expected: testExpectation{
+				ids:   []int{1, 2},
+				total: 2,
+			},
+		},
+		{
+			description: "when listing users in descending order",
+			input: testInput{
+				query: query.Query{Sort: query.Sort{Field: "id", Descending: true}},
+			},
+			expected: testExpectation{
+				ids:   []int{2, 1},
+				total: 2,
+			},
+		},
+		{
+			description: "when listing users with a limit and an offset",
+			input: testInput{
+				query: query.Query{Sort: query.Sort{Field: "id"}, Limit: 1, Offset: 1},
+			},
+			expected: testExpectation{
+				ids:   []int{2},
+				total: 2,
+			},
+		},
+		{
+			description: "when listing users after a cursor",
+			input: testInput{
+				query: query.Query{Sort: query.Sort{Field: "id"}, After: &afterFirst},
+			},
+			expected: testExpectation{
+				ids:   []int{2},
+				total: 2,
+			},
+		},
+		{
+			description: "when listing users after a descending cursor",
+			input: testInput{
+				query: query.Query{Sort: query.Sort{Field: "nickname", Descending: true}, After: &afterLastDesc},
+			},
+			expected: testExpectation{
+				ids:   []int{1},
+				total: 2,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var ctx = context.TODO()
+			defer ctx.Done()
+
+			repo := initUserStore()
+
+			result, err := repo.List(ctx, tc.input.query)
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+
+			ids := make([]int, 0)
+			for _, user := range result {
+				ids = append(ids, user.ID)
+			}
+			g.Expect(ids).To(Equal(tc.expected.ids), "should return the expected users")
+
+			total, err := repo.Count(ctx, tc.input.query)
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(total).To(Equal(tc.expected.total), "should count every matching user")
+		})
+	}
+}
+
+func Test_UserStore_History(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := domain.WithRequestID(domain.WithActor(context.TODO(), "user:1"), "request-1")
+
+	repo := initUserStore()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	user.SetCountry("pt")
+	_, err = repo.Store(ctx, user, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should store the change")
+
+	_, err = repo.Store(ctx, user, 1)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should not record rejected changes")
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should delete the user")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred(), "should list the history")
+	g.Expect(entries).To(HaveLen(3), "should record every version")
+
+	g.Expect(entries[0].Version()).To(Equal(uint32(1)), "should start with the creation")
+	g.Expect(entries[0].Changes).To(ContainElements("nickname", "email"), "should record every field as set on creation")
+	g.Expect(entries[0].Actor).To(Equal(domain.ActorAnonymous), "should record changes without actor as anonymous")
+
+	g.Expect(entries[1].Changes).To(Equal([]string{"email", "country"}), "should record the changed fields")
+	g.Expect(entries[1].Actor).To(Equal("user:1"), "should record the actor")
+	g.Expect(entries[1].RequestID).To(Equal("request-1"), "should record the request")
+	g.Expect(entries[1].User.Password).To(BeEmpty(), "should not keep the password")
+
+	g.Expect(entries[2].Version()).To(Equal(uint32(3)), "should make the deletion a new version")
+	g.Expect(entries[2].Changes).To(Equal([]string{"active"}), "should record the deletion")
+	g.Expect(entries[2].User.Meta.GetDisabled()).To(BeTrue(), "should keep the user deleted")
+
+	entries, err = repo.History(ctx, 1, 1, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should list the history")
+	g.Expect(entries).To(HaveLen(1), "should respect the limit")
+	g.Expect(entries[0].Version()).To(Equal(uint32(2)), "should start after the given version")
+
+	entry, err := repo.GetVersion(ctx, 1, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should get the version")
+	g.Expect(entry.User.Email).To(Equal("example@example.qqq"), "should return the user as of the version")
+
+	_, err = repo.GetVersion(ctx, 1, 4)
+	g.Expect(err).To(Equal(ErrVersionNotFound), "should not find unknown versions")
+}
+
+func Test_UserStore_Restore(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	repo := initUserStore()
+
+	_, err := repo.Restore(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserActive), "should not restore an active user")
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Restore(ctx, 1, 1)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should check the version when given")
+
+	user, err := repo.Restore(ctx, 1, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "should restore the deleted user")
+	g.Expect(user.Meta.GetDisabled()).To(BeFalse(), "should be active again")
+	g.Expect(user.Meta.GetVersion()).To(Equal(uint32(3)), "should make a new version")
+	g.Expect(user.Password).To(Equal("qwerty"), "should keep the data of the user")
+
+	_, err = repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should get the restored user")
+
+	entries, err := repo.History(ctx, 1, 2, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1), "should record the restoration")
+	g.Expect(entries[0].Changes).To(Equal([]string{"active"}), "should record the restoration")
+
+	outboxEntries := repo.Outbox().entries
+	last, err := outboxEntries[len(outboxEntries)-1].message.Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(last).To(ConsistOf(models.UserRestored{At: user.Meta.GetUpdatedAt()}), "should publish the restoration")
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Store(ctx, models.CreateUser("Test", "Test", "testuser", "qwerty", "other@example.qqq", "uk"), 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should reuse the nickname of the deleted user")
+
+	_, err = repo.Restore(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUniqueViolation), "should not restore a user whose nickname was taken")
+
+	_, err = repo.Restore(ctx, 100, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should fail for unknown users")
+}
+
+func Test_UserStore_Purge(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := domain.WithActor(context.TODO(), "user:2")
+	repo := initUserStore()
+
+	_, err := repo.Purge(ctx, 1, 5)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should check the version when given")
+
+	user, err := repo.Purge(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should purge the user")
+	g.Expect(user.ID).To(Equal(1), "should return the id of the user")
+	g.Expect(user.Nickname).To(BeEmpty(), "should not return the data of the user")
+	g.Expect(user.Meta.GetVersion()).To(Equal(uint32(2)), "should make a new version")
+
+	users, err := repo.List(ctx, query.Query{IncludeDisabled: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(users).To(HaveLen(1), "should remove the user, even from the deleted ones")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1), "should only keep the erasure in the history")
+	g.Expect(entries[0].Version()).To(Equal(uint32(2)), "should record the erasure")
+	g.Expect(entries[0].Actor).To(Equal("user:2"), "should record who erased the user")
+	g.Expect(entries[0].User.Email).To(BeEmpty(), "should not keep the data of the user")
+
+	last := repo.Outbox().entries[len(repo.Outbox().entries)-1].message
+	purged, err := last.User()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(purged.Email).To(BeEmpty(), "should not publish the data of the user")
+
+	events, err := last.Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(ConsistOf(models.UserErased{At: user.Meta.GetUpdatedAt()}), "should publish the erasure")
+
+	messages, err := repo.Outbox().Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(1), "should drop the earlier messages of the user")
+
+	erasures, err := repo.Erasures(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(erasures).To(HaveLen(1), "should prove the purge")
+	g.Expect(erasures[0].Version).To(Equal(uint32(2)))
+	g.Expect(erasures[0].HistoryEntries).To(Equal(1), "should count the deleted history entries")
+	g.Expect(erasures[0].Actor).To(Equal("user:2"))
+
+	_, err = repo.Purge(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should not purge a user twice")
+}
+
+func Test_UserStore_Erase(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := domain.WithRequestID(domain.WithActor(context.TODO(), "user:1"), "request")
+	repo := initUserStore()
+
+	_, err := repo.Erase(ctx, 1, 5)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should check the version when given")
+
+	_, err = repo.Erase(ctx, 9, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should not erase unknown users")
+
+	erasure, err := repo.Erase(ctx, 1, 1)
+	g.Expect(err).ToNot(HaveOccurred(), "should erase the user")
+	g.Expect(erasure.UserID).To(Equal(1), "should prove the erasure of the user")
+	g.Expect(erasure.Version).To(Equal(uint32(2)), "should make a new version")
+	g.Expect(erasure.HistoryEntries).To(Equal(1), "should count the anonymized history entries")
+	g.Expect(erasure.Actor).To(Equal("user:1"), "should record who erased the user")
+	g.Expect(erasure.RequestID).To(Equal("request"), "should record the request of the erasure")
+
+	users, err := repo.List(ctx, query.Query{Filter: query.Equal("id", "1"), IncludeDisabled: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(users).To(HaveLen(1), "should keep the row of the user")
+	g.Expect(users[0].Email).To(BeEmpty(), "should blank the data of the user")
+	g.Expect(users[0].Password).To(BeEmpty(), "should blank the password of the user")
+	g.Expect(users[0].Meta.GetDisabled()).To(BeTrue(), "should disable the user")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(2), "should keep the versions of the user")
+	for _, entry := range entries {
+		g.Expect(entry.User.Nickname).To(BeEmpty(), "should anonymize the history")
+	}
+
+	last := repo.Outbox().entries[len(repo.Outbox().entries)-1].message
+	events, err := last.Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(ConsistOf(models.UserErased{At: erasure.At}), "should publish the erasure")
+
+	_, err = repo.Erase(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not erase a user twice")
+
+	_, err = repo.Restore(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not restore an erased user")
+
+	_, err = repo.Purge(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should purge an erased user")
+
+	erasures, err := repo.Erasures(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(erasures).To(HaveLen(2), "should prove the erasure and the purge")
+	g.Expect(erasures[0]).To(Equal(erasure), "should keep the proof of the erasure")
+}
+
+func Test_UserStore_Erase_Outbox(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	repo := initUserStore()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	_, err = repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Erase(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	messages, err := repo.Outbox().Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(1), "should drop the unsent changes of the user")
+
+	for _, message := range messages {
+		g.Expect(string(message.Payload)).ToNot(ContainSubstring("example.qqq"), "should leave no email in the outbox")
+		g.Expect(string(message.Payload)).ToNot(ContainSubstring("testuser"), "should leave no nickname in the outbox")
+	}
+
+	events, err := messages[0].Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(HaveLen(1))
+	g.Expect(events[0]).To(BeAssignableToTypeOf(models.UserErased{}), "should only publish the erasure")
+
+	others, err := repo.Outbox().Messages(ctx, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(others).To(HaveLen(1), "should keep the messages of the other users")
+}
+
+func Test_UserStore_Snapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+	repo := initUserStore()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	changed, err := repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	snapshotted, err := repo.Snapshot(ctx, 1, models.UserSnapshot{})
+	g.Expect(err).ToNot(HaveOccurred(), "should snapshot the user")
+	g.Expect(snapshotted.Meta.GetVersion()).To(Equal(changed.Meta.GetVersion()), "should keep the version")
+
+	messages, err := repo.Outbox().Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(3), "should write the snapshot to the outbox")
+
+	events, err := messages[2].Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(Equal([]domain.Event{models.UserSnapshot{}}), "should write the snapshot after the changes")
+	g.Expect(string(messages[2].Payload)).To(ContainSubstring("changed@example.qqq"), "should hold the current state")
+
+	_, err = repo.Snapshot(ctx, 100, models.UserSnapshot{})
+	g.Expect(err).To(Equal(ErrUserNotFound), "should not find unknown users")
+}
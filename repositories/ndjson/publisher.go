@@ -0,0 +1,95 @@
+package ndjson
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/cloudevents"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type EventEncoder interface {
+	Records(user models.User, event domain.Event) ([]cloudevents.Record, error)
+}
+
+// Publisher appends the events to a file, one structured CloudEvent per line,
+// for local development without Kafka. The file can be followed with
+// `tail -f`. A tombstone is written as its key with no event.
+type Publisher struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder EventEncoder
+}
+
+func NewPublisher(path string, encoder EventEncoder) (*Publisher, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to open %s", err, path)
+	}
+
+	return &Publisher{
+		file:    file,
+		encoder: encoder,
+	}, nil
+}
+
+// PublishSync writes the events of the change in a single write and syncs the
+// file, so they are on disk once it returns.
+func (p *Publisher) PublishSync(ctx context.Context, user models.User, events []domain.Event) error {
+	var lines []byte
+
+	for _, event := range events {
+		records, err := p.encoder.Records(user, event)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			line, err := marshal(record)
+			if err != nil {
+				return err
+			}
+
+			lines = append(append(lines, line...), '\n')
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.file.Write(lines); err != nil {
+		return fmt.Errorf("%w failed to write events", err)
+	}
+
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("%w failed to sync events", err)
+	}
+
+	return nil
+}
+
+type tombstone struct {
+	Key       string `json:"key"`
+	Tombstone bool   `json:"tombstone"`
+}
+
+func marshal(record cloudevents.Record) ([]byte, error) {
+	var v interface{} = record.Event
+	if record.Tombstone() {
+		v = tombstone{Key: record.Key, Tombstone: true}
+	}
+
+	line, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to marshal cloud event", err)
+	}
+
+	return line, nil
+}
+
+func (p *Publisher) Close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,72 @@
+//+build unit
+
+package ndjson
+
+import (
+	"bufio"
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"code/tech-test/repositories/cloudevents"
+	jsonSerializer "code/tech-test/repositories/json"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Publisher(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "ndjson")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users.ndjson")
+	encoder := cloudevents.NewEncoder(jsonSerializer.UserSerializer{}, "/users")
+	user := models.NewUser(1, "Test", "Test", "testuser", "", "example@example.qqq", "uk")
+
+	for i := 0; i < 2; i++ {
+		publisher, err := NewPublisher(path, encoder)
+		g.Expect(err).ToNot(HaveOccurred(), "should open the file")
+
+		err = publisher.PublishSync(context.TODO(), user, []domain.Event{
+			models.UserCreated{},
+			models.RoleAssigned{Role: "admin"},
+			models.UserErased{},
+		})
+		g.Expect(err).ToNot(HaveOccurred(), "should write the events")
+		g.Expect(publisher.Close()).To(Succeed(), "should close the file")
+	}
+
+	file, err := os.Open(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer file.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line struct {
+			cloudevents.Event
+			Key       string `json:"key"`
+			Tombstone bool   `json:"tombstone"`
+		}
+		g.Expect(json.Unmarshal(scanner.Bytes(), &line)).To(Succeed(), "should write a cloud event per line")
+
+		if line.Tombstone {
+			g.Expect(line.Key).To(Equal("1"), "should write the key of the tombstone")
+			types = append(types, "tombstone")
+			continue
+		}
+
+		types = append(types, line.Type)
+	}
+
+	g.Expect(types).To(Equal([]string{
+		cloudevents.TypeUserCreated, cloudevents.TypeUserUpdated, "tombstone",
+		cloudevents.TypeUserCreated, cloudevents.TypeUserUpdated, "tombstone",
+	}), "should append the events in order")
+}
@@ -0,0 +1,232 @@
+package otlp
+
+import (
+	"bytes"
+	"code/tech-test/domain/tracing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// scope names the instrumentation the spans come from.
+const scope = "code/tech-test"
+
+// The spans are encoded as the JSON of an OTLP ExportTraceServiceRequest,
+// which the OpenTelemetry collector takes over HTTP and reads from files.
+type request struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope instrumentationScope `json:"scope"`
+	Spans []span               `json:"spans"`
+}
+
+type instrumentationScope struct {
+	Name string `json:"name"`
+}
+
+// span follows the JSON mapping of OTLP, the ids being hex and the 64-bit
+// integers strings.
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func value(v interface{}) anyValue {
+	switch v := v.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case int:
+		i := strconv.Itoa(v)
+		return anyValue{IntValue: &i}
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &i}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	}
+
+	s := fmt.Sprint(v)
+
+	return anyValue{StringValue: &s}
+}
+
+func attributes(attrs []tracing.Attribute) []keyValue {
+	var kvs []keyValue
+
+	for _, attr := range attrs {
+		kvs = append(kvs, keyValue{Key: attr.Key, Value: value(attr.Value)})
+	}
+
+	return kvs
+}
+
+// Marshal encodes the spans of the service as an OTLP request.
+func Marshal(service string, spans []tracing.SpanData) ([]byte, error) {
+	encoded := make([]span, 0, len(spans))
+
+	for _, s := range spans {
+		e := span{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+			Status:            status{Code: int(s.Status), Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			e.ParentSpanID = s.Parent.String()
+		}
+
+		encoded = append(encoded, e)
+	}
+
+	return json.Marshal(request{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: attributes([]tracing.Attribute{tracing.String("service.name", service)}),
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: instrumentationScope{Name: scope},
+				Spans: encoded,
+			}},
+		}},
+	})
+}
+
+// HTTPExporter posts the spans to an OTLP/HTTP endpoint, such as the
+// OpenTelemetry collector, in the JSON encoding.
+type HTTPExporter struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPExporter exports to the endpoint, e.g. `http://localhost:4318`, the
+// spans being posted to its `/v1/traces` path.
+func NewHTTPExporter(endpoint string, client *http.Client) *HTTPExporter {
+	return &HTTPExporter{
+		client: client,
+		url:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+	}
+}
+
+func (e *HTTPExporter) Export(ctx context.Context, service string, spans []tracing.SpanData) error {
+	body, err := Marshal(service, spans)
+	if err != nil {
+		return fmt.Errorf("%w failed to marshal spans", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%w failed to post spans", err)
+	}
+	defer res.Body.Close()
+
+	// the body is read for the connection to be reused
+	message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("failed to post spans, %s: %s", res.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// FileExporter writes the spans as OTLP JSON, one request per line, for local
+// development without a collector. The collector can read the file back.
+type FileExporter struct {
+	mu     sync.Mutex
+	writer io.Writer
+	file   *os.File
+}
+
+// NewFileExporter appends to the file, or writes to the standard output when
+// the path is `-`.
+func NewFileExporter(path string) (*FileExporter, error) {
+	if path == "-" {
+		return &FileExporter{writer: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to open %s", err, path)
+	}
+
+	return &FileExporter{writer: file, file: file}, nil
+}
+
+func (e *FileExporter) Export(ctx context.Context, service string, spans []tracing.SpanData) error {
+	line, err := Marshal(service, spans)
+	if err != nil {
+		return fmt.Errorf("%w failed to marshal spans", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%w failed to write spans", err)
+	}
+
+	return nil
+}
+
+// Close closes the file, the standard output being left open.
+func (e *FileExporter) Close() error {
+	if e.file == nil {
+		return nil
+	}
+
+	return e.file.Close()
+}
@@ -0,0 +1,154 @@
+//+build unit
+
+package otlp
+
+import (
+	"bufio"
+	"code/tech-test/domain/tracing"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func spans(g *WithT) []tracing.SpanData {
+	parent, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	start := time.Unix(1600000000, 0)
+
+	return []tracing.SpanData{{
+		Name:        "GET /users/{id}",
+		Kind:        tracing.KindServer,
+		SpanContext: tracing.SpanContext{TraceID: parent.TraceID, SpanID: tracing.SpanID{1}, Sampled: true},
+		Parent:      parent.SpanID,
+		Start:       start,
+		End:         start.Add(time.Millisecond),
+		Attributes: []tracing.Attribute{
+			tracing.String("http.route", "/users/{id}"),
+			tracing.Int("http.response.status_code", 500),
+			tracing.Bool("retried", false),
+		},
+		Status:        tracing.StatusError,
+		StatusMessage: "Internal Server Error",
+	}}
+}
+
+func Test_Marshal(t *testing.T) {
+	g := NewWithT(t)
+
+	body, err := Marshal("users", spans(g))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(body).To(MatchJSON(`{
+		"resourceSpans": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "users"}}]},
+			"scopeSpans": [{
+				"scope": {"name": "code/tech-test"},
+				"spans": [{
+					"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+					"spanId": "0100000000000000",
+					"parentSpanId": "00f067aa0ba902b7",
+					"name": "GET /users/{id}",
+					"kind": 2,
+					"startTimeUnixNano": "1600000000000000000",
+					"endTimeUnixNano": "1600000000001000000",
+					"attributes": [
+						{"key": "http.route", "value": {"stringValue": "/users/{id}"}},
+						{"key": "http.response.status_code", "value": {"intValue": "500"}},
+						{"key": "retried", "value": {"boolValue": false}}
+					],
+					"status": {"code": 2, "message": "Internal Server Error"}
+				}]
+			}]
+		}]
+	}`), "should encode the spans as an OTLP request")
+}
+
+func Test_HTTPExporter(t *testing.T) {
+
+	testCases := []struct {
+		description string
+		status      int
+		fails       bool
+	}{
+		{description: "when the collector accepts the spans", status: http.StatusOK},
+		{description: "when the collector rejects the spans", status: http.StatusBadRequest, fails: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var received *http.Request
+			var body []byte
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = ioutil.ReadAll(r.Body)
+
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			exporter := NewHTTPExporter(server.URL+"/", server.Client())
+
+			err := exporter.Export(context.TODO(), "users", spans(g))
+			if tc.fails {
+				g.Expect(err).To(HaveOccurred(), "should fail on the status of the collector")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should post the spans")
+			}
+
+			g.Expect(received.Method).To(Equal(http.MethodPost))
+			g.Expect(received.URL.Path).To(Equal("/v1/traces"), "should post to the traces path of the endpoint")
+			g.Expect(received.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			expected, err := Marshal("users", spans(g))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(body).To(MatchJSON(expected), "should post the OTLP request")
+		})
+	}
+}
+
+func Test_FileExporter(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "otlp")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traces.ndjson")
+
+	for i := 0; i < 2; i++ {
+		exporter, err := NewFileExporter(path)
+		g.Expect(err).ToNot(HaveOccurred(), "should open the file")
+
+		g.Expect(exporter.Export(context.TODO(), "users", spans(g))).To(Succeed(), "should write the spans")
+		g.Expect(exporter.Close()).To(Succeed())
+	}
+
+	file, err := os.Open(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer file.Close()
+
+	var lines int
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var req request
+		g.Expect(json.Unmarshal(scanner.Bytes(), &req)).To(Succeed(), "should write a request per line")
+		g.Expect(req.ResourceSpans[0].ScopeSpans[0].Spans).To(HaveLen(1))
+
+		lines++
+	}
+
+	g.Expect(lines).To(Equal(2), "should append to the file")
+}
@@ -0,0 +1,195 @@
+package postgresql
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+var ErrUserErased = errors.New("user erased")
+
+// Erase anonymizes the user and its history for good, on request of the user.
+// Its roles go along with its outbox messages, sent or not, which still hold
+// its data, while the row and history keep the versions, actors and timestamps. The
+// erasure is a new version of the user, published without any data, and the
+// proof of it is recorded. A version of 0 erases whatever the current version.
+func (s UserStore) Erase(ctx context.Context, id int, version uint32) (_ models.Erasure, err error) {
+	ctx, end := s.instrument(ctx, "Erase", "erase_user")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return models.Erasure{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	erasure, err := s.erase(ctx, tx, id, version)
+	if err != nil {
+		tx.Rollback()
+		return models.Erasure{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Erasure{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return erasure, nil
+}
+
+func (s UserStore) erase(ctx context.Context, tx *sql.Tx, id int, version uint32) (models.Erasure, error) {
+	current, _, err := s.lockUser(ctx, tx, id)
+	if err != nil {
+		return models.Erasure{}, err
+	}
+
+	if version != 0 && current != version {
+		return models.Erasure{}, ErrWrongVersion
+	}
+
+	erased, err := s.erased(ctx, tx, id)
+	if err != nil {
+		return models.Erasure{}, err
+	}
+	if erased {
+		return models.Erasure{}, ErrUserErased
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, id); err != nil {
+		return models.Erasure{}, fmt.Errorf("%w failed to delete roles", err)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET first_name = '', last_name = '', nickname = '', password = '', email = '', country = '',
+		disabled = 't', version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
+	`, id)
+
+	result, err := s.scan(row)
+	if err != nil {
+		return models.Erasure{}, err
+	}
+
+	anonymized, err := tx.ExecContext(ctx, `
+		UPDATE user_history
+		SET first_name = '', last_name = '', nickname = '', email = '', country = ''
+		WHERE user_id = $1
+	`, id)
+	if err != nil {
+		return models.Erasure{}, fmt.Errorf("%w failed to anonymize history", err)
+	}
+
+	entries, err := anonymized.RowsAffected()
+	if err != nil {
+		return models.Erasure{}, err
+	}
+
+	if err := deleteOutbox(ctx, tx, id); err != nil {
+		return models.Erasure{}, err
+	}
+
+	event := models.UserErased{At: result.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, tx, result.Erased(), []domain.Event{event}); err != nil {
+		return models.Erasure{}, err
+	}
+
+	if err := s.record(ctx, tx, result, []domain.Event{event}); err != nil {
+		return models.Erasure{}, err
+	}
+
+	erasure := models.Erasure{
+		UserID:         id,
+		Version:        result.Meta.GetVersion(),
+		Fields:         models.ChangedFields([]domain.Event{event}),
+		HistoryEntries: int(entries),
+		Actor:          domain.ActorFrom(ctx),
+		RequestID:      domain.RequestIDFrom(ctx),
+		At:             event.At,
+	}
+
+	if err := insertErasure(ctx, tx, erasure); err != nil {
+		return models.Erasure{}, err
+	}
+
+	return erasure, nil
+}
+
+// insertErasure records the proof of the erasure within its transaction.
+func insertErasure(ctx context.Context, tx *sql.Tx, erasure models.Erasure) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO erasures(user_id, version, fields, history_entries, actor, request_id, erased_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`,
+		erasure.UserID,
+		erasure.Version,
+		textArray(erasure.Fields),
+		erasure.HistoryEntries,
+		erasure.Actor,
+		erasure.RequestID,
+		erasure.At,
+	)
+	if err != nil {
+		return fmt.Errorf("%w failed to record erasure", err)
+	}
+
+	return nil
+}
+
+// erased reports whether the user was erased, its anonymized row being kept.
+func (s UserStore) erased(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	var erased bool
+
+	row := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM erasures WHERE user_id = $1)`, id)
+	if err := row.Scan(&erased); err != nil {
+		return false, fmt.Errorf("%w failed to check erasures", err)
+	}
+
+	return erased, nil
+}
+
+// Erasures returns the proofs of erasure of the user, oldest first. They are
+// kept when the user is purged.
+func (s UserStore) Erasures(ctx context.Context, id int) (_ []models.Erasure, err error) {
+	ctx, end := s.instrument(ctx, "Erasures", "select_erasures")
+	defer func() { end(err) }()
+
+	var erasures []models.Erasure = make([]models.Erasure, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		SELECT user_id, version, fields, history_entries, actor, request_id, erased_at
+		FROM erasures
+		WHERE user_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list erasures", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			erasure models.Erasure
+			fields  pgtype.TextArray
+		)
+
+		if err := rows.Scan(&erasure.UserID, &erasure.Version, &fields, &erasure.HistoryEntries, &erasure.Actor, &erasure.RequestID, &erasure.At); err != nil {
+			return nil, fmt.Errorf("%w failed to scan erasure", err)
+		}
+		erasure.Fields = fromTextArray(fields)
+
+		erasures = append(erasures, erasure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w failed to list erasures", err)
+	}
+
+	return erasures, nil
+}
@@ -0,0 +1,98 @@
+// +build integrationdb
+
+package postgresql
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/query"
+	"code/tech-test/domain/users/models"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_UserStore_Erase(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := domain.WithRequestID(domain.WithActor(context.TODO(), "user:1"), "request-1")
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	_, err = repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Erase(ctx, 1, 1)
+	g.Expect(err).To(Equal(ErrWrongVersion), "should check the version when given")
+
+	erasure, err := repo.Erase(ctx, 1, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "should erase the user")
+	g.Expect(erasure.Version).To(Equal(uint32(3)), "should make a new version")
+	g.Expect(erasure.HistoryEntries).To(Equal(1), "should count the anonymized history entries")
+	g.Expect(erasure.Actor).To(Equal("user:1"), "should record who erased the user")
+	g.Expect(erasure.RequestID).To(Equal("request-1"), "should record the request of the erasure")
+
+	users, err := repo.List(ctx, query.Query{Filter: query.Equal("id", "1"), IncludeDisabled: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(users).To(HaveLen(1), "should keep the row of the user")
+	g.Expect(users[0].Email).To(BeEmpty(), "should blank the data of the user")
+	g.Expect(users[0].Meta.GetDisabled()).To(BeTrue(), "should disable the user")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(2), "should keep the versions of the user")
+	for _, entry := range entries {
+		g.Expect(entry.User.Email).To(BeEmpty(), "should anonymize the history")
+	}
+
+	_, err = repo.Erase(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not erase a user twice")
+
+	_, err = repo.Restore(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not restore an erased user")
+
+	erasures, err := repo.Erasures(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(erasures).To(HaveLen(1), "should keep the proof of the erasure")
+	g.Expect(erasures[0].Fields).To(Equal(erasure.Fields), "should prove which fields were erased")
+}
+
+func Test_UserStore_Erase_Outbox(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	_, err = repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Erase(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	messages, err := NewOutboxStore(repo.pool).Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(1), "should delete the unsent changes of the user")
+
+	for _, message := range messages {
+		g.Expect(string(message.Payload)).ToNot(ContainSubstring("example.qqq"), "should leave no email in the outbox")
+		g.Expect(string(message.Payload)).ToNot(ContainSubstring("testuser"), "should leave no nickname in the outbox")
+	}
+
+	events, err := messages[0].Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(HaveLen(1))
+	g.Expect(events[0]).To(BeAssignableToTypeOf(models.UserErased{}), "should only publish the erasure")
+}
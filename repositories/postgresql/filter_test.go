@@ -0,0 +1,67 @@
+//+build unit
+
+package postgresql
+
+import (
+	"code/tech-test/domain/users/query"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_queryComposer(t *testing.T) {
+
+	type testExpectation struct {
+		expression string
+		params     []interface{}
+	}
+
+	testCases := []struct {
+		description string
+		input       string
+		expected    testExpectation
+	}{
+		{
+			description: "when there is no filter",
+			input:       "",
+			expected: testExpectation{
+				expression: "",
+				params:     nil,
+			},
+		},
+		{
+			description: "when the filter is a single condition",
+			input:       `country = uk`,
+			expected: testExpectation{
+				expression: "(country = $1) AND",
+				params:     []interface{}{"uk"},
+			},
+		},
+		{
+			description: "when the filter combines conditions",
+			input:       `id not in (1, 2) and (nickname ^= "jo_" or email ~ "*@example.com") and created_at >= 2021-01-01`,
+			expected: testExpectation{
+				expression: "(NOT (id IN ($1, $2)) AND ((nickname LIKE $3) OR (email ILIKE $4)) AND (created_at >= $5)) AND",
+				params: []interface{}{
+					1, 2, `jo\_%`, "%@example.com", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			filter, err := query.ParseFilter(tc.input)
+			g.Expect(err).ToNot(HaveOccurred(), "should parse the filter")
+
+			expression, params, err := queryComposer(filter, nil)
+
+			g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+			g.Expect(expression).To(Equal(tc.expected.expression), "should compile the expected expression")
+			g.Expect(params).To(Equal(tc.expected.params), "should compile the expected parameters")
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package postgresql
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// record appends the version of the user to its history, in the transaction
+// of the change so the history holds every version that was committed.
+func (s UserStore) record(ctx context.Context, tx *sql.Tx, user models.User, events []domain.Event) error {
+	entry := models.NewHistoryEntry(user, events, domain.ActorFrom(ctx), domain.RequestIDFrom(ctx))
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO user_history(user_id, version, first_name, last_name, nickname, email, country, roles, disabled, created_at,
+		changes, actor, request_id, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`,
+		entry.User.ID,
+		entry.Version(),
+		entry.User.FirstName,
+		entry.User.LastName,
+		entry.User.Nickname,
+		entry.User.Email,
+		entry.User.Country,
+		textArray(entry.User.Roles),
+		entry.User.Meta.GetDisabled(),
+		entry.User.Meta.GetCreatedAt(),
+		textArray(entry.Changes),
+		entry.Actor,
+		entry.RequestID,
+		entry.At,
+	)
+	if err != nil {
+		return fmt.Errorf("%w failed to record history", err)
+	}
+
+	return nil
+}
+
+// History returns the versions of the user after the given one, oldest
+// first. Deleted users keep their history.
+func (s UserStore) History(ctx context.Context, id int, after uint32, limit int) (_ []models.HistoryEntry, err error) {
+	ctx, end := s.instrument(ctx, "History", "select_history")
+	defer func() { end(err) }()
+
+	var entries []models.HistoryEntry = make([]models.HistoryEntry, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		SELECT user_id, version, first_name, last_name, nickname, email, country, roles, disabled, created_at,
+		changes, actor, request_id, changed_at
+		FROM user_history
+		WHERE user_id = $1 AND version > $2
+		ORDER BY version
+		LIMIT $3
+	`, id, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list history", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w failed to list history", err)
+	}
+
+	return entries, nil
+}
+
+// GetVersion returns the user as of the version.
+func (s UserStore) GetVersion(ctx context.Context, id int, version uint32) (_ models.HistoryEntry, err error) {
+	ctx, end := s.instrument(ctx, "GetVersion", "select_history_version")
+	defer func() { end(err) }()
+
+	row := s.pool.QueryRowContext(ctx, `
+		SELECT user_id, version, first_name, last_name, nickname, email, country, roles, disabled, created_at,
+		changes, actor, request_id, changed_at
+		FROM user_history
+		WHERE user_id = $1 AND version = $2
+	`, id, version)
+
+	entry, err := scanHistory(row)
+	if err == sql.ErrNoRows {
+		return models.HistoryEntry{}, ErrVersionNotFound
+	}
+
+	return entry, err
+}
+
+func scanHistory(row scanner) (models.HistoryEntry, error) {
+	var (
+		entry     models.HistoryEntry
+		user      models.User
+		version   uint32
+		roles     pgtype.TextArray
+		disabled  bool
+		createdAt time.Time
+		changes   pgtype.TextArray
+	)
+
+	if err := row.Scan(
+		&user.ID,
+		&version,
+		&user.FirstName,
+		&user.LastName,
+		&user.Nickname,
+		&user.Email,
+		&user.Country,
+		&roles,
+		&disabled,
+		&createdAt,
+		&changes,
+		&entry.Actor,
+		&entry.RequestID,
+		&entry.At,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return models.HistoryEntry{}, err
+		}
+
+		return models.HistoryEntry{}, fmt.Errorf("%w failed to scan history", err)
+	}
+
+	user.Roles = fromTextArray(roles)
+	user.Meta.HydrateMeta(version, createdAt, entry.At, disabled)
+
+	entry.User = user
+	entry.Changes = fromTextArray(changes)
+	if entry.Changes == nil {
+		entry.Changes = make([]string, 0)
+	}
+
+	return entry, nil
+}
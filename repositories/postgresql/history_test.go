@@ -0,0 +1,93 @@
+// +build integrationdb
+
+package postgresql
+
+import (
+	"code/tech-test/domain"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_UserStore_History(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := domain.WithRequestID(domain.WithActor(context.TODO(), "user:1"), "request-1")
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	_, err = repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should store the change")
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should delete the user")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred(), "should list the history")
+	g.Expect(entries).To(HaveLen(2), "should record the change and the deletion")
+
+	g.Expect(entries[0].Version()).To(Equal(uint32(2)), "should record the new version")
+	g.Expect(entries[0].Changes).To(Equal([]string{"email"}), "should record the changed fields")
+	g.Expect(entries[0].Actor).To(Equal("user:1"), "should record the actor")
+	g.Expect(entries[0].RequestID).To(Equal("request-1"), "should record the request")
+	g.Expect(entries[1].Version()).To(Equal(uint32(3)), "should make the deletion a new version")
+	g.Expect(entries[1].Changes).To(Equal([]string{"active"}), "should record the deletion")
+
+	entry, err := repo.GetVersion(ctx, 1, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "should get the version")
+	g.Expect(entry.User.Email).To(Equal("changed@example.qqq"), "should return the user as of the version")
+	g.Expect(entry.User.Password).To(BeEmpty(), "should not keep the password")
+
+	_, err = repo.GetVersion(ctx, 1, 1)
+	g.Expect(err).To(Equal(ErrVersionNotFound), "should not know the versions before the history")
+}
+
+func Test_UserStore_RestoreAndPurge(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	_, err = repo.Restore(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserActive), "should not restore an active user")
+
+	_, err = repo.Delete(ctx, 1, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user, err := repo.Restore(ctx, 1, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "should restore the deleted user")
+	g.Expect(user.Meta.GetDisabled()).To(BeFalse(), "should be active again")
+	g.Expect(user.Meta.GetVersion()).To(Equal(uint32(3)), "should make a new version")
+
+	user, err = repo.Purge(ctx, 1, 3)
+	g.Expect(err).ToNot(HaveOccurred(), "should purge the user")
+	g.Expect(user.Email).To(BeEmpty(), "should not return the data of the user")
+
+	entries, err := repo.History(ctx, 1, 0, 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1), "should only keep the erasure in the history")
+	g.Expect(entries[0].Version()).To(Equal(uint32(4)), "should record the erasure")
+
+	messages, err := NewOutboxStore(repo.pool).Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(1), "should delete the earlier messages of the user")
+
+	erasures, err := repo.Erasures(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(erasures).To(HaveLen(1), "should prove the purge")
+	g.Expect(erasures[0].Version).To(Equal(uint32(4)))
+	g.Expect(erasures[0].HistoryEntries).To(Equal(2), "should count the deleted history entries")
+
+	_, err = repo.Purge(ctx, 1, 0)
+	g.Expect(err).To(Equal(ErrUserNotFound), "should not purge a user twice")
+}
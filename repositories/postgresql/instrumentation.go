@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"code/tech-test/domain/tracing"
+	"context"
+	"time"
+)
+
+// Durations records how long the methods of the stores take, in seconds, by
+// store and method, as the histograms of the metrics do.
+type Durations interface {
+	Observe(seconds float64, labels ...string)
+}
+
+// instrument starts the span of a method of a store, named after the store
+// type and the method and telling the statement it runs, and returns the
+// function ending it with the error of the method, if any, which also records
+// the duration of the method.
+func instrument(ctx context.Context, durations Durations, store, kind, method, statement string) (context.Context, func(error)) {
+	started := time.Now()
+
+	ctx, span := tracing.Start(ctx, kind+"."+method, tracing.KindClient,
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement.name", statement),
+	)
+
+	return ctx, func(err error) {
+		span.RecordError(err)
+		span.End()
+
+		if durations != nil {
+			durations.Observe(time.Since(started).Seconds(), store, method)
+		}
+	}
+}
+
+func (s UserStore) instrument(ctx context.Context, method, statement string) (context.Context, func(error)) {
+	return instrument(ctx, s.durations, "users", "UserStore", method, statement)
+}
+
+func (s RoleStore) instrument(ctx context.Context, method, statement string) (context.Context, func(error)) {
+	return instrument(ctx, s.durations, "roles", "RoleStore", method, statement)
+}
+
+func (s RefreshTokenStore) instrument(ctx context.Context, method, statement string) (context.Context, func(error)) {
+	return instrument(ctx, s.durations, "refresh_tokens", "RefreshTokenStore", method, statement)
+}
+
+func (s OutboxStore) instrument(ctx context.Context, method, statement string) (context.Context, func(error)) {
+	return instrument(ctx, s.durations, "outbox", "OutboxStore", method, statement)
+}
+
+// WithDurations records the durations of the methods of the store.
+func (s *UserStore) WithDurations(durations Durations) *UserStore {
+	s.durations = durations
+
+	return s
+}
+
+func (s *RoleStore) WithDurations(durations Durations) *RoleStore {
+	s.durations = durations
+
+	return s
+}
+
+func (s *RefreshTokenStore) WithDurations(durations Durations) *RefreshTokenStore {
+	s.durations = durations
+
+	return s
+}
+
+func (s *OutboxStore) WithDurations(durations Durations) *OutboxStore {
+	s.durations = durations
+
+	return s
+}
@@ -0,0 +1,54 @@
+//+build unit
+
+package postgresql
+
+import (
+	"code/tech-test/domain/tracing"
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// spans keeps the exported spans.
+type spans []tracing.SpanData
+
+func (s *spans) Export(ctx context.Context, service string, data []tracing.SpanData) error {
+	*s = append(*s, data...)
+
+	return nil
+}
+
+// observed counts the recorded durations by store and method.
+type observed map[string]int
+
+func (o observed) Observe(seconds float64, labels ...string) {
+	o[labels[0]+"."+labels[1]]++
+}
+
+func Test_Instrument(t *testing.T) {
+	g := NewWithT(t)
+
+	exported := &spans{}
+	tracer := tracing.NewTracer(exported, tracing.DefaultConfig())
+	ctx := tracing.WithTracer(context.Background(), tracer)
+	durations := observed{}
+
+	_, end := instrument(ctx, durations, "users", "UserStore", "Get", "select_user")
+	end(nil)
+
+	_, end = instrument(ctx, durations, "users", "UserStore", "Delete", "delete_user")
+	end(errors.New("connection refused"))
+
+	g.Expect(tracer.Flush(context.Background())).To(Succeed())
+	g.Expect(*exported).To(HaveLen(2), "should end the spans")
+
+	g.Expect((*exported)[0].Name).To(Equal("UserStore.Get"))
+	g.Expect((*exported)[0].Status).To(Equal(tracing.StatusUnset), "should not mark the successful calls failed")
+	g.Expect((*exported)[1].Name).To(Equal("UserStore.Delete"))
+	g.Expect((*exported)[1].Status).To(Equal(tracing.StatusError), "should record the error of the call")
+	g.Expect((*exported)[1].StatusMessage).To(Equal("connection refused"))
+
+	g.Expect(durations).To(Equal(observed{"users.Get": 1, "users.Delete": 1}), "should record the duration of each call")
+}
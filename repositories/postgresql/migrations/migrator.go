@@ -0,0 +1,277 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrating so that two
+// instances starting at the same time do not apply the same migration twice.
+const lockKey int64 = 7245340411
+
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	pool       *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(pool *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		pool:       pool,
+		migrations: migrations,
+	}
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	var result []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+
+			if err := m.revert(ctx, conn, m.migrations[i]); err != nil {
+				return err
+			}
+			result = append(result, m.migrations[i])
+
+			return nil
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// To migrates the schema up or down until version is the latest applied
+// migration. Version 0 reverts every migration.
+func (m *Migrator) To(ctx context.Context, version int64) ([]Migration, error) {
+	if version != 0 && !m.known(version) {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+
+	var result []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			result = append(result, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			result = append(result, migration)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// Status lists every known migration and whether it has been applied. It
+// takes no lock, so it answers while another instance migrates, listing the
+// migrations committed so far.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var result []Status
+
+	conn, err := m.pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to acquire connection", err)
+	}
+	defer conn.Close()
+
+	var created bool
+
+	row := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err := row.Scan(&created); err != nil {
+		return nil, fmt.Errorf("%w failed to find schema_migrations table", err)
+	}
+
+	// nothing was ever migrated
+	applied := make(map[int64]time.Time)
+
+	if created {
+		applied, err = m.applied(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+
+		result = append(result, Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.pool.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("%w failed to acquire connection", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return fmt.Errorf("%w failed to acquire migration lock", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     BIGINT NOT NULL,
+			name        TEXT NOT NULL,
+			applied_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+
+			PRIMARY KEY(version)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("%w failed to create schema_migrations table", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT version, applied_at
+		FROM schema_migrations
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to query applied migrations", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("%w failed to scan applied migration", err)
+		}
+
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w rows returned error", err)
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%w failed to apply migration %d_%s", err, migration.Version, migration.Name)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations(version, name)
+		VALUES ($1, $2)
+	`, migration.Version, migration.Name)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%w failed to record migration %d_%s", err, migration.Version, migration.Name)
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("%w %d_%s", ErrIrreversible, migration.Version, migration.Name)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%w failed to revert migration %d_%s", err, migration.Version, migration.Name)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM schema_migrations
+		WHERE version = $1
+	`, migration.Version)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%w failed to unrecord migration %d_%s", err, migration.Version, migration.Name)
+	}
+
+	return tx.Commit()
+}
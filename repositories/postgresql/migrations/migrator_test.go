@@ -0,0 +1,41 @@
+// +build integrationdb
+
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+func Test_Migrator_Status(t *testing.T) {
+	g := NewWithT(t)
+
+	pool, err := sql.Open("pgx", "host=localhost port=5434 user=postgres password=postgres dbname=postgres sslmode=disable")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer pool.Close()
+
+	loaded, err := Load("../../../assets/sql/postgresql/migrations")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// another instance migrating holds the lock
+	conn, err := pool.Conn(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	defer conn.Close()
+
+	_, err = conn.ExecContext(context.TODO(), `SELECT pg_advisory_lock($1)`, lockKey)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer conn.ExecContext(context.TODO(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	statuses, err := NewMigrator(pool, loaded).Status(ctx)
+	g.Expect(err).ToNot(HaveOccurred(), "should not wait for the migration in progress")
+	g.Expect(statuses).To(HaveLen(len(loaded)), "should list every migration")
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrMissingUp        = errors.New("migration has no up file")
+	ErrIrreversible     = errors.New("migration has no down file")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change. Down is empty when the
+// migration cannot be reverted.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads every `<version>_<name>.(up|down).sql` file in dir and returns
+// the migrations ordered by version. Files not following the pattern are ignored.
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to read migrations directory", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		match := fileNamePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to parse version of %s", err, file.Name())
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%w failed to read %s", err, file.Name())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w %d (%s, %s)", ErrDuplicateVersion, version, migration.Name, match[2])
+		}
+
+		switch match[3] {
+		case "up":
+			migration.Up = string(content)
+		case "down":
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w %d_%s", ErrMissingUp, migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,106 @@
+//+build unit
+
+package migrations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupMigrationsDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func Test_Load(t *testing.T) {
+
+	type testExpectation struct {
+		err        error
+		migrations []Migration
+	}
+
+	testCases := []struct {
+		description string
+		input       map[string]string
+		expected    testExpectation
+	}{
+		{
+			description: "when the migrations are ordered by version",
+			input: map[string]string{
+				"0002_add_index.up.sql":      "CREATE INDEX",
+				"0002_add_index.down.sql":    "DROP INDEX",
+				"0001_create_users.up.sql":   "CREATE TABLE",
+				"0001_create_users.down.sql": "DROP TABLE",
+				"README.md":                  "ignored",
+			},
+			expected: testExpectation{
+				migrations: []Migration{
+					{Version: 1, Name: "create_users", Up: "CREATE TABLE", Down: "DROP TABLE"},
+					{Version: 2, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+				},
+			},
+		},
+		{
+			description: "when a migration has no down file",
+			input: map[string]string{
+				"0001_create_users.up.sql": "CREATE TABLE",
+			},
+			expected: testExpectation{
+				migrations: []Migration{
+					{Version: 1, Name: "create_users", Up: "CREATE TABLE"},
+				},
+			},
+		},
+		{
+			description: "when a migration has no up file",
+			input: map[string]string{
+				"0001_create_users.down.sql": "DROP TABLE",
+			},
+			expected: testExpectation{
+				err: ErrMissingUp,
+			},
+		},
+		{
+			description: "when two migrations share a version",
+			input: map[string]string{
+				"0001_create_users.up.sql": "CREATE TABLE",
+				"0001_create_roles.up.sql": "CREATE TABLE",
+			},
+			expected: testExpectation{
+				err: ErrDuplicateVersion,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dir := setupMigrationsDir(t, tc.input)
+			defer os.RemoveAll(dir)
+
+			result, err := Load(dir)
+
+			if tc.expected.err != nil {
+				g.Expect(err).To(MatchError(tc.expected.err), "should return the expected error")
+			} else {
+				g.Expect(err).ToNot(HaveOccurred(), "should not return an error")
+				g.Expect(result).To(Equal(tc.expected.migrations), "should return the expected migrations")
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package postgresql
+
+import (
+	"code/tech-test/domain/outbox"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type OutboxStore struct {
+	pool      *sql.DB
+	durations Durations
+}
+
+func NewOutboxStore(pool *sql.DB) *OutboxStore {
+	return &OutboxStore{pool: pool}
+}
+
+// Claim pushes the next attempt of the claimed messages past the lease, the
+// row locks are skipped so concurrent relays claim different messages.
+func (s OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) (_ []outbox.Message, err error) {
+	ctx, end := s.instrument(ctx, "Claim", "claim_messages")
+	defer func() { end(err) }()
+
+	var messages []outbox.Message = make([]outbox.Message, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		UPDATE outbox
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id
+			FROM outbox o
+			WHERE sent_at IS NULL AND next_attempt_at <= NOW()
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox p
+				WHERE p.aggregate_id = o.aggregate_id AND p.sent_at IS NULL AND p.id < o.id
+			)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate_id, payload, created_at, attempts, COALESCE(trace_parent, '')
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to claim messages", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var message outbox.Message
+
+		if err := rows.Scan(&message.ID, &message.AggregateID, &message.Payload, &message.CreatedAt, &message.Attempts, &message.TraceParent); err != nil {
+			return nil, fmt.Errorf("%w error scan message", err)
+		}
+
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w rows returned error", err)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+
+	return messages, nil
+}
+
+func (s OutboxStore) MarkSent(ctx context.Context, id int64) (err error) {
+	ctx, end := s.instrument(ctx, "MarkSent", "mark_message_sent")
+	defer func() { end(err) }()
+
+	_, err = s.pool.ExecContext(ctx, `
+		UPDATE outbox
+		SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("%w failed to mark message sent", err)
+	}
+
+	return nil
+}
+
+func (s OutboxStore) MarkFailed(ctx context.Context, id int64, retryAt time.Time, reason string) (err error) {
+	ctx, end := s.instrument(ctx, "MarkFailed", "mark_message_failed")
+	defer func() { end(err) }()
+
+	_, err = s.pool.ExecContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3
+		WHERE id = $1
+	`, id, retryAt.UTC(), reason)
+	if err != nil {
+		return fmt.Errorf("%w failed to mark message failed", err)
+	}
+
+	return nil
+}
+
+func (s OutboxStore) Stats(ctx context.Context) (_ outbox.Stats, err error) {
+	ctx, end := s.instrument(ctx, "Stats", "select_outbox_stats")
+	defer func() { end(err) }()
+
+	var (
+		stats  outbox.Stats
+		oldest sql.NullTime
+	)
+
+	row := s.pool.QueryRowContext(ctx, `
+		SELECT COUNT(*), MIN(created_at)
+		FROM outbox
+		WHERE sent_at IS NULL
+	`)
+
+	if err := row.Scan(&stats.Pending, &oldest); err != nil {
+		return outbox.Stats{}, fmt.Errorf("%w failed to get outbox stats", err)
+	}
+
+	stats.OldestUnsent = oldest.Time
+
+	return stats, nil
+}
+
+// Prune deletes the messages sent before the time. The unsent ones are kept
+// whatever their age.
+func (s OutboxStore) Prune(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, end := s.instrument(ctx, "Prune", "prune_messages")
+	defer func() { end(err) }()
+
+	result, err := s.pool.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE sent_at < $1
+	`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%w failed to prune messages", err)
+	}
+
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w failed to count pruned messages", err)
+	}
+
+	return int(pruned), nil
+}
+
+// Messages returns the messages of the aggregate, sent or not, oldest first.
+func (s OutboxStore) Messages(ctx context.Context, aggregateID int) (_ []outbox.Message, err error) {
+	ctx, end := s.instrument(ctx, "Messages", "select_messages")
+	defer func() { end(err) }()
+
+	var messages []outbox.Message = make([]outbox.Message, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		SELECT id, aggregate_id, payload, created_at, attempts, sent_at
+		FROM outbox
+		WHERE aggregate_id = $1
+		ORDER BY id
+	`, aggregateID)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list messages", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			message outbox.Message
+			sentAt  sql.NullTime
+		)
+
+		if err := rows.Scan(&message.ID, &message.AggregateID, &message.Payload, &message.CreatedAt, &message.Attempts, &sentAt); err != nil {
+			return nil, fmt.Errorf("%w error scan message", err)
+		}
+		message.SentAt = sentAt.Time
+
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w rows returned error", err)
+	}
+
+	return messages, nil
+}
+
+// insertOutbox writes the message within the transaction of the change.
+func insertOutbox(ctx context.Context, tx *sql.Tx, message outbox.Message) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox(aggregate_id, payload, trace_parent)
+		VALUES ($1, $2, NULLIF($3, ''))
+	`, message.AggregateID, string(message.Payload), message.TraceParent)
+	if err != nil {
+		return fmt.Errorf("%w failed to insert outbox message", err)
+	}
+
+	return nil
+}
+
+// deleteOutbox removes the messages of the aggregate, sent or not, within the
+// transaction erasing it, so the data they hold is neither kept nor published.
+func deleteOutbox(ctx context.Context, tx *sql.Tx, aggregateID int) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE aggregate_id = $1`, aggregateID); err != nil {
+		return fmt.Errorf("%w failed to delete outbox messages", err)
+	}
+
+	return nil
+}
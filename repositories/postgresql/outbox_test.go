@@ -0,0 +1,54 @@
+// +build integrationdb
+
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_OutboxStore_Prune(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	for _, id := range []int{1, 1, 2} {
+		user, err := repo.Get(ctx, id)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		user.SetCountry(user.Country + "x")
+		_, err = repo.Store(ctx, user, user.Meta.GetVersion())
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	store := NewOutboxStore(repo.pool)
+
+	claimed, err := store.Claim(ctx, 10, time.Minute)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(claimed).To(HaveLen(2), "should claim the first change of each user")
+	g.Expect(store.MarkSent(ctx, claimed[0].ID)).To(Succeed())
+
+	pruned, err := store.Prune(ctx, time.Now().Add(-time.Hour))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(BeZero(), "should keep the messages sent within the retention")
+
+	pruned, err = store.Prune(ctx, time.Now().Add(time.Hour))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pruned).To(Equal(1), "should delete the sent messages")
+
+	messages, err := store.Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(1), "should keep the unsent messages")
+
+	next, err := store.Claim(ctx, 10, time.Minute)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(next).To(HaveLen(1), "should still release the next change of the user")
+	g.Expect(next[0].ID).To(Equal(messages[0].ID))
+}
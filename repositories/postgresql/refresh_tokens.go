@@ -0,0 +1,195 @@
+package postgresql
+
+import (
+	"code/tech-test/domain/auth/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenRotated  = errors.New("refresh token already rotated")
+)
+
+type RefreshTokenStore struct {
+	pool      *sql.DB
+	durations Durations
+}
+
+func NewRefreshTokenStore(pool *sql.DB) *RefreshTokenStore {
+	return &RefreshTokenStore{pool: pool}
+}
+
+func (s RefreshTokenStore) Get(ctx context.Context, id string) (_ models.RefreshToken, err error) {
+	ctx, end := s.instrument(ctx, "Get", "select_refresh_token")
+	defer func() { end(err) }()
+
+	var (
+		token     models.RefreshToken
+		rotatedAt sql.NullTime
+		revokedAt sql.NullTime
+	)
+
+	row := s.pool.QueryRowContext(ctx, `
+		SELECT id, family_id, user_id, expires_at, created_at, rotated_at, revoked_at
+		FROM refresh_tokens
+		WHERE id = $1
+	`, id)
+
+	err = row.Scan(&token.ID, &token.FamilyID, &token.UserID, &token.ExpiresAt, &token.CreatedAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.RefreshToken{}, ErrTokenNotFound
+		}
+
+		return models.RefreshToken{}, err
+	}
+
+	token.RotatedAt = rotatedAt.Time
+	token.RevokedAt = revokedAt.Time
+
+	return token, nil
+}
+
+func (s RefreshTokenStore) Create(ctx context.Context, token models.RefreshToken) (err error) {
+	ctx, end := s.instrument(ctx, "Create", "insert_refresh_token")
+	defer func() { end(err) }()
+
+	return s.create(ctx, s.pool, token)
+}
+
+func (s RefreshTokenStore) Rotate(ctx context.Context, id string, next models.RefreshToken) (err error) {
+	ctx, end := s.instrument(ctx, "Rotate", "rotate_refresh_token")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET rotated_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%w failed to rotate refresh token", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if affected == 0 {
+		tx.Rollback()
+		return ErrTokenRotated
+	}
+
+	if err := s.create(ctx, tx, next); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) (err error) {
+	ctx, end := s.instrument(ctx, "RevokeFamily", "revoke_refresh_token_family")
+	defer func() { end(err) }()
+
+	_, err = s.pool.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	if err != nil {
+		return fmt.Errorf("%w failed to revoke refresh tokens", err)
+	}
+
+	return nil
+}
+
+// ListByUser returns the refresh tokens of the user, oldest first.
+func (s RefreshTokenStore) ListByUser(ctx context.Context, userID int) (_ []models.RefreshToken, err error) {
+	ctx, end := s.instrument(ctx, "ListByUser", "select_user_refresh_tokens")
+	defer func() { end(err) }()
+
+	var tokens []models.RefreshToken = make([]models.RefreshToken, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		SELECT id, family_id, user_id, expires_at, created_at, rotated_at, revoked_at
+		FROM refresh_tokens
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to list refresh tokens", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			token     models.RefreshToken
+			rotatedAt sql.NullTime
+			revokedAt sql.NullTime
+		)
+
+		if err := rows.Scan(&token.ID, &token.FamilyID, &token.UserID, &token.ExpiresAt, &token.CreatedAt, &rotatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("%w failed to scan refresh token", err)
+		}
+
+		token.RotatedAt = rotatedAt.Time
+		token.RevokedAt = revokedAt.Time
+
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w failed to list refresh tokens", err)
+	}
+
+	return tokens, nil
+}
+
+// DeleteByUser removes the refresh tokens of the user, which can no longer
+// refresh its access tokens.
+func (s RefreshTokenStore) DeleteByUser(ctx context.Context, userID int) (err error) {
+	ctx, end := s.instrument(ctx, "DeleteByUser", "delete_user_refresh_tokens")
+	defer func() { end(err) }()
+
+	_, err = s.pool.ExecContext(ctx, `
+		DELETE FROM refresh_tokens
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("%w failed to delete refresh tokens", err)
+	}
+
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s RefreshTokenStore) create(ctx context.Context, db execer, token models.RefreshToken) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens(id, family_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`,
+		token.ID,
+		token.FamilyID,
+		token.UserID,
+		token.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w failed to insert refresh token", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package postgresql
+
+import (
+	"code/tech-test/domain/users/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	pgerr "github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleInUse    = errors.New("role in use")
+)
+
+type RoleStore struct {
+	pool      *sql.DB
+	durations Durations
+}
+
+func NewRoleStore(pool *sql.DB) *RoleStore {
+	return &RoleStore{pool: pool}
+}
+
+func (s RoleStore) Get(ctx context.Context, name string) (_ models.Role, err error) {
+	ctx, end := s.instrument(ctx, "Get", "select_role")
+	defer func() { end(err) }()
+
+	row := s.pool.QueryRowContext(ctx, `
+		SELECT name, description, permissions, version, created_at, updated_at
+		FROM roles
+		WHERE name = $1
+	`, name)
+
+	return s.scan(row)
+}
+
+func (s RoleStore) List(ctx context.Context) (_ []models.Role, err error) {
+	ctx, end := s.instrument(ctx, "List", "select_roles")
+	defer func() { end(err) }()
+
+	var roles []models.Role = make([]models.Role, 0)
+
+	rows, err := s.pool.QueryContext(ctx, `
+		SELECT name, description, permissions, version, created_at, updated_at
+		FROM roles
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to query context", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		role, err := s.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w error scan role", err)
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w rows returned error", err)
+	}
+
+	return roles, nil
+}
+
+func (s RoleStore) Store(ctx context.Context, role models.Role, version uint32) (_ models.Role, err error) {
+	ctx, end := s.instrument(ctx, "Store", "upsert_role")
+	defer func() { end(err) }()
+
+	var (
+		current uint32
+		result  models.Role
+	)
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return models.Role{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT version
+		FROM roles
+		WHERE name = $1 FOR UPDATE NOWAIT
+	`, role.Name).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return models.Role{}, err
+	}
+
+	if current != version {
+		tx.Rollback()
+		return models.Role{}, ErrWrongVersion
+	}
+
+	if current == 0 {
+		result, err = s.scan(tx.QueryRowContext(ctx, `
+			INSERT INTO roles(name, description, permissions)
+			VALUES ($1, $2, $3)
+			RETURNING name, description, permissions, version, created_at, updated_at
+		`, role.Name, role.Description, textArray(role.Permissions)))
+	} else {
+		result, err = s.scan(tx.QueryRowContext(ctx, `
+			UPDATE roles
+			SET description = $1, permissions = $2, version = $3, updated_at = NOW()
+			WHERE name = $4 AND version = $5
+			RETURNING name, description, permissions, version, created_at, updated_at
+		`, role.Description, textArray(role.Permissions), version+1, role.Name, version))
+	}
+	if err != nil {
+		tx.Rollback()
+		return models.Role{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Role{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return result, nil
+}
+
+// Delete removes a role, failing with ErrRoleInUse while it is assigned.
+func (s RoleStore) Delete(ctx context.Context, name string) (err error) {
+	ctx, end := s.instrument(ctx, "Delete", "delete_role")
+	defer func() { end(err) }()
+
+	result, err := s.pool.ExecContext(ctx, `
+		DELETE FROM roles
+		WHERE name = $1
+	`, name)
+	if err != nil {
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == pgerr.ForeignKeyViolation {
+			return ErrRoleInUse
+		}
+
+		return fmt.Errorf("%w failed to delete role", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s RoleStore) scan(row scanner) (models.Role, error) {
+	var (
+		name        string
+		description string
+		permissions pgtype.TextArray
+		version     uint32
+		createdAt   time.Time
+		updatedAt   time.Time
+	)
+
+	if err := row.Scan(&name, &description, &permissions, &version, &createdAt, &updatedAt); err != nil {
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == pgerr.UniqueViolation {
+			return models.Role{}, ErrUniqueViolation
+		}
+
+		if err == sql.ErrNoRows {
+			return models.Role{}, ErrRoleNotFound
+		}
+
+		return models.Role{}, err
+	}
+
+	role := models.NewRole(name, description, fromTextArray(permissions))
+	role.Meta.HydrateMeta(version, createdAt, updatedAt, false)
+
+	return role, nil
+}
+
+func textArray(values []string) *pgtype.TextArray {
+	var array pgtype.TextArray
+
+	if values == nil {
+		values = make([]string, 0)
+	}
+	array.Set(values)
+
+	return &array
+}
+
+// fromTextArray returns nil for empty arrays, like a user or role built
+// without any.
+func fromTextArray(array pgtype.TextArray) []string {
+	var values []string
+
+	if len(array.Elements) == 0 {
+		return nil
+	}
+
+	array.AssignTo(&values)
+
+	return values
+}
@@ -1,7 +1,11 @@
 package postgresql
 
 import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/outbox"
+	"code/tech-test/domain/tracing"
 	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
 	"context"
 	"database/sql"
 	"errors"
@@ -11,26 +15,38 @@ import (
 
 	pgerr "github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
 )
 
 var (
 	ErrWrongVersion    = errors.New("wrong version")
 	ErrUniqueViolation = errors.New("unique constraint violation")
 	ErrUserNotFound    = errors.New("user not found")
+	ErrUserActive      = errors.New("user is not deleted")
+	ErrUserExists      = errors.New("user already exists")
 )
 
 type UserStore struct {
-	pool *sql.DB
+	pool      *sql.DB
+	durations Durations
 }
 
 func NewUserStore(pool *sql.DB) *UserStore {
-	return &UserStore{pool}
+	return &UserStore{pool: pool}
 }
 
-func (s UserStore) Get(ctx context.Context, id int) (models.User, error) {
+// Ping checks the database answers, for the readiness of the API.
+func (s UserStore) Ping(ctx context.Context) error {
+	return s.pool.PingContext(ctx)
+}
+
+func (s UserStore) Get(ctx context.Context, id int) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Get", "select_user")
+	defer func() { end(err) }()
 
 	row := s.pool.QueryRowContext(ctx, `
-		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at
+		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
 		FROM users
 		WHERE id = $1 AND disabled = 'f' 
 	`, id)
@@ -38,35 +54,215 @@ func (s UserStore) Get(ctx context.Context, id int) (models.User, error) {
 	return s.scan(row)
 }
 
-func queryComposer(terms map[string]string) (string, []interface{}) {
-	if len(terms) == 0 {
-		return "", nil
+// GetByLogin finds the active user whose nickname or email is the login,
+// preferring a nickname match.
+func (s UserStore) GetByLogin(ctx context.Context, login string) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "GetByLogin", "select_user_by_login")
+	defer func() { end(err) }()
+
+	row := s.pool.QueryRowContext(ctx, `
+		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
+		FROM users
+		WHERE (nickname = $1 OR email = $1) AND disabled = 'f'
+		ORDER BY nickname = $1 DESC
+		LIMIT 1
+	`, login)
+
+	return s.scan(row)
+}
+
+// queryComposer compiles the filter into a parameterized condition, the
+// field names come from the query whitelist.
+func queryComposer(filter query.Filter, filterParams []interface{}) (string, []interface{}, error) {
+	if filter == nil {
+		return "", filterParams, nil
+	}
+
+	expression, filterParams, err := filterComposer(filter, filterParams)
+	if err != nil {
+		return "", nil, err
 	}
 
-	var expressions []string = make([]string, 0)
-	var index int = 1
-	filterParams := make([]interface{}, 0)
+	return expression + " AND", filterParams, nil
+}
+
+func filterComposer(filter query.Filter, filterParams []interface{}) (string, []interface{}, error) {
+	var (
+		expressions []string = make([]string, 0)
+		expression  string
+		err         error
+	)
+
+	switch f := filter.(type) {
+	case query.Condition:
+		return conditionComposer(f, filterParams)
+	case query.Not:
+		expression, filterParams, err = filterComposer(f.Filter, filterParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return fmt.Sprintf("NOT %s", expression), filterParams, nil
+	case query.And:
+		for _, child := range f {
+			expression, filterParams, err = filterComposer(child, filterParams)
+			if err != nil {
+				return "", nil, err
+			}
+			expressions = append(expressions, expression)
+		}
+
+		return "(" + strings.Join(expressions, " AND ") + ")", filterParams, nil
+	case query.Or:
+		for _, child := range f {
+			expression, filterParams, err = filterComposer(child, filterParams)
+			if err != nil {
+				return "", nil, err
+			}
+			expressions = append(expressions, expression)
+		}
+
+		return "(" + strings.Join(expressions, " OR ") + ")", filterParams, nil
+	}
+
+	return "", nil, fmt.Errorf("%w: unknown node %T", query.ErrInvalidFilter, filter)
+}
+
+func conditionComposer(c query.Condition, filterParams []interface{}) (string, []interface{}, error) {
+	switch c.Field {
+	case "created_at", "updated_at":
+		value, err := c.Time()
+		if err != nil {
+			return "", nil, err
+		}
 
-	for key, value := range terms {
-		expressions = append(expressions, fmt.Sprintf(" %s = $%d ", key, index))
 		filterParams = append(filterParams, value)
-		index++
+
+		return fmt.Sprintf("(%s %s $%d)", c.Field, c.Operator, len(filterParams)), filterParams, nil
+	case "id":
+		values, err := c.Numbers()
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, v := range values {
+			filterParams = append(filterParams, v)
+		}
+	default:
+		for _, v := range c.Values {
+			filterParams = append(filterParams, v)
+		}
 	}
 
-	return strings.Join(expressions, "AND") + " AND", filterParams
+	last := len(filterParams)
+
+	switch c.Operator {
+	case query.OpEqual, query.OpNotEqual:
+		return fmt.Sprintf("(%s %s $%d)", c.Field, c.Operator, last), filterParams, nil
+	case query.OpPrefix:
+		filterParams[last-1] = likeEscaper.Replace(c.Values[0]) + "%"
+
+		return fmt.Sprintf("(%s LIKE $%d)", c.Field, last), filterParams, nil
+	case query.OpLike:
+		filterParams[last-1] = strings.Replace(likeEscaper.Replace(c.Values[0]), "*", "%", -1)
+
+		return fmt.Sprintf("(%s ILIKE $%d)", c.Field, last), filterParams, nil
+	case query.OpIn:
+		placeholders := make([]string, 0, len(c.Values))
+		for i := last - len(c.Values) + 1; i <= last; i++ {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
+		}
+
+		return fmt.Sprintf("(%s IN (%s))", c.Field, strings.Join(placeholders, ", ")), filterParams, nil
+	}
+
+	return "", nil, fmt.Errorf("%w: operator %q not supported on %q", query.ErrInvalidFilter, c.Operator, c.Field)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// keysetComposer restricts the rows to the ones after the cursor, the sort
+// field name comes from the query whitelist.
+func keysetComposer(cursor *query.Cursor, filterParams []interface{}) (string, []interface{}) {
+	if cursor == nil {
+		return "", filterParams
+	}
+
+	operator := ">"
+	if cursor.Sort.Descending {
+		operator = "<"
+	}
+
+	if cursor.Sort.Field == "id" {
+		filterParams = append(filterParams, cursor.ID)
+		return fmt.Sprintf(" id %s $%d AND", operator, len(filterParams)), filterParams
+	}
+
+	filterParams = append(filterParams, cursor.Value, cursor.ID)
+
+	return fmt.Sprintf(" (%s, id) %s ($%d, $%d) AND", cursor.Sort.Field, operator, len(filterParams)-1, len(filterParams)), filterParams
+}
+
+func orderComposer(sort query.Sort) string {
+	direction := "ASC"
+	if sort.Descending {
+		direction = "DESC"
+	}
+
+	if sort.Field == "id" {
+		return fmt.Sprintf("ORDER BY id %s", direction)
+	}
+
+	return fmt.Sprintf("ORDER BY %s %s, id %s", sort.Field, direction, direction)
 }
 
-func (s UserStore) List(ctx context.Context, queryTerm map[string]string) ([]models.User, error) {
+// disabledComposer ends the WHERE clause, which the other composers leave
+// open with an AND.
+func disabledComposer(q query.Query) string {
+	if q.IncludeDisabled {
+		return "TRUE"
+	}
+
+	return "disabled = 'f'"
+}
+
+func pageComposer(q query.Query, filterParams []interface{}) (string, []interface{}) {
+	var clauses []string = make([]string, 0)
+
+	if q.Limit > 0 {
+		filterParams = append(filterParams, q.Limit)
+		clauses = append(clauses, fmt.Sprintf("LIMIT $%d", len(filterParams)))
+	}
+	if q.Offset > 0 {
+		filterParams = append(filterParams, q.Offset)
+		clauses = append(clauses, fmt.Sprintf("OFFSET $%d", len(filterParams)))
+	}
+
+	return strings.Join(clauses, " "), filterParams
+}
+
+func (s UserStore) List(ctx context.Context, q query.Query) (_ []models.User, err error) {
+	ctx, end := s.instrument(ctx, "List", "select_users")
+	defer func() { end(err) }()
 
 	var users []models.User = make([]models.User, 0)
 
-	filterArguments, filterParams := queryComposer(queryTerm)
+	filterArguments, filterParams, err := queryComposer(q.Filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	keysetArguments, filterParams := keysetComposer(q.After, filterParams)
+	pageArguments, filterParams := pageComposer(q, filterParams)
 
 	rows, err := s.pool.QueryContext(ctx, fmt.Sprintf(`
-		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at
+		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
 		FROM users
-		WHERE %s disabled = 'f' 
-	`, filterArguments), filterParams...)
+		WHERE %s %s %s
+		%s
+		%s
+	`, filterArguments, keysetArguments, disabledComposer(q), orderComposer(q.Sort), pageArguments), filterParams...)
 	if err != nil {
 		return nil, fmt.Errorf("%w failed to query context", err)
 	}
@@ -86,7 +282,34 @@ func (s UserStore) List(ctx context.Context, queryTerm map[string]string) ([]mod
 
 }
 
-func (s UserStore) Store(ctx context.Context, user models.User, version uint32) (models.User, error) {
+func (s UserStore) Count(ctx context.Context, q query.Query) (_ int, err error) {
+	ctx, end := s.instrument(ctx, "Count", "count_users")
+	defer func() { end(err) }()
+
+	var total int
+
+	filterArguments, filterParams, err := queryComposer(q.Filter, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	row := s.pool.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM users
+		WHERE %s %s
+	`, filterArguments, disabledComposer(q)), filterParams...)
+
+	if err := row.Scan(&total); err != nil {
+		return 0, fmt.Errorf("%w failed to count users", err)
+	}
+
+	return total, nil
+}
+
+func (s UserStore) Store(ctx context.Context, user models.User, version uint32) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Store", "upsert_user")
+	defer func() { end(err) }()
+
 	var result models.User
 
 	tx, err := s.pool.Begin()
@@ -100,7 +323,11 @@ func (s UserStore) Store(ctx context.Context, user models.User, version uint32)
 		return models.User{}, err
 	}
 
-	if current != version {
+	switch {
+	case current != version && version == 0:
+		tx.Rollback()
+		return models.User{}, ErrUserExists
+	case current != version:
 		tx.Rollback()
 		return models.User{}, ErrWrongVersion
 	}
@@ -115,13 +342,81 @@ func (s UserStore) Store(ctx context.Context, user models.User, version uint32)
 		return models.User{}, err
 	}
 
-	tx.Commit()
+	if err := s.announce(ctx, tx, result, user.Meta.Changes()); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	// an update without events, like a rehashed password, keeps the version
+	// so it is neither a new version of the history nor a conflict for
+	// the clients holding the current one
+	if current == 0 || len(user.Meta.Changes()) > 0 {
+		if err := s.record(ctx, tx, result, user.Meta.Changes()); err != nil {
+			tx.Rollback()
+			return models.User{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return result, nil
+}
 
+// Snapshot writes the snapshot of the user to the outbox. The row is locked
+// so the snapshot is ordered after the changes of the user already written
+// and before the following ones. It is not a change, the version is kept.
+func (s UserStore) Snapshot(ctx context.Context, id int, snapshot models.UserSnapshot) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Snapshot", "snapshot_user")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
 	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`, id)
+
+	user, err := s.scan(row)
+	if err != nil {
+		tx.Rollback()
 		return models.User{}, err
 	}
 
-	return result, nil
+	if err := s.announce(ctx, tx, user, []domain.Event{snapshot}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return user, nil
+}
+
+// announce writes the outbox message of the change, so it is published if
+// and only if the transaction commits. Changes without events, like a
+// rehashed password, are not announced.
+func (s UserStore) announce(ctx context.Context, tx *sql.Tx, user models.User, events []domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	message, err := outbox.NewUserMessage(user, events)
+	if err != nil {
+		return err
+	}
+	message.TraceParent = tracing.TraceParent(ctx)
+
+	return insertOutbox(ctx, tx, message)
 }
 
 func (s UserStore) lockForUpdate(ctx context.Context, tx *sql.Tx, id int) (uint32, error) {
@@ -141,24 +436,280 @@ func (s UserStore) lockForUpdate(ctx context.Context, tx *sql.Tx, id int) (uint3
 	return version, nil
 }
 
-func (s UserStore) Delete(ctx context.Context, id int) (models.User, error) {
-	row := s.pool.QueryRowContext(ctx, `
+// Delete hides the user. It is a change like any other, so it makes a new
+// version of the user. A user already deleted, or erased, is not found, so
+// deleting it again publishes nothing. A version of 0 deletes whatever the
+// current version.
+func (s UserStore) Delete(ctx context.Context, id int, version uint32) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Delete", "delete_user")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	current, disabled, err := s.lockUser(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	switch {
+	case disabled:
+		tx.Rollback()
+		return models.User{}, ErrUserNotFound
+	case version != 0 && current != version:
+		tx.Rollback()
+		return models.User{}, ErrWrongVersion
+	}
+
+	row := tx.QueryRowContext(ctx, `
 		UPDATE users
-		SET disabled = 't', updated_at = NOW()
+		SET disabled = 't', version = version + 1, updated_at = NOW()
 		WHERE id = $1
-		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
 	`, id)
 
-	return s.scan(row)
+	result, err := s.scan(row)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	deactivated := models.UserDeactivated{At: result.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, tx, result, []domain.Event{deactivated}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := s.record(ctx, tx, result, []domain.Event{deactivated}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return result, nil
+}
+
+// Restore brings back the deleted user, checking the version like Delete.
+func (s UserStore) Restore(ctx context.Context, id int, version uint32) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Restore", "restore_user")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	current, disabled, err := s.lockUser(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	switch {
+	case version != 0 && current != version:
+		tx.Rollback()
+		return models.User{}, ErrWrongVersion
+	case !disabled:
+		tx.Rollback()
+		return models.User{}, ErrUserActive
+	}
+
+	erased, err := s.erased(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+	if erased {
+		tx.Rollback()
+		return models.User{}, ErrUserErased
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET disabled = 'f', version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
+	`, id)
+
+	// the unique_active_* indexes reject the user if its nickname or email
+	// was taken
+	result, err := s.scan(row)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	restored := models.UserRestored{At: result.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, tx, result, []domain.Event{restored}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := s.record(ctx, tx, result, []domain.Event{restored}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return result, nil
+}
+
+// Purge erases the user for good, along with its roles, history and outbox
+// messages, sent or not. The erasure is the last version of the user, it is
+// published and kept in the history without the data of the user, and its
+// proof is recorded like for Erase. A version of 0 purges whatever the current
+// version.
+func (s UserStore) Purge(ctx context.Context, id int, version uint32) (_ models.User, err error) {
+	ctx, end := s.instrument(ctx, "Purge", "purge_user")
+	defer func() { end(err) }()
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w failed to begin transaction", err)
+	}
+
+	current, _, err := s.lockUser(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if version != 0 && current != version {
+		tx.Rollback()
+		return models.User{}, ErrWrongVersion
+	}
+
+	if err := deleteOutbox(ctx, tx, id); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		DELETE FROM users
+		WHERE id = $1
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
+	`, id)
+
+	purged, err := s.scan(row)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	result := purged.Erased()
+	result.Meta.HydrateMeta(current+1, purged.Meta.GetCreatedAt(), time.Now().UTC().Truncate(time.Microsecond), true)
+
+	deleted, err := tx.ExecContext(ctx, `DELETE FROM user_history WHERE user_id = $1`, id)
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, fmt.Errorf("%w failed to delete history", err)
+	}
+
+	entries, err := deleted.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	erased := models.UserErased{At: result.Meta.GetUpdatedAt()}
+
+	if err := s.announce(ctx, tx, result, []domain.Event{erased}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := s.record(ctx, tx, result, []domain.Event{erased}); err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	err = insertErasure(ctx, tx, models.Erasure{
+		UserID:         id,
+		Version:        result.Meta.GetVersion(),
+		Fields:         models.ChangedFields([]domain.Event{erased}),
+		HistoryEntries: int(entries),
+		Actor:          domain.ActorFrom(ctx),
+		RequestID:      domain.RequestIDFrom(ctx),
+		At:             erased.At,
+	})
+	if err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("%w failed to commit transaction", err)
+	}
+
+	return result, nil
 }
 
+// lockUser locks the user, deleted or not, for the rest of the transaction.
+func (s UserStore) lockUser(ctx context.Context, tx *sql.Tx, id int) (uint32, bool, error) {
+	var (
+		version  uint32
+		disabled bool
+	)
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT version, disabled
+		FROM users
+		WHERE id = $1 FOR UPDATE NOWAIT
+	`, id)
+
+	if err := row.Scan(&version, &disabled); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrUserNotFound
+		}
+
+		return 0, false, err
+	}
+
+	return version, disabled, nil
+}
+
+// create inserts the user under the id the database assigns, or the one it
+// is given. A given id is moved past by the sequence so the database never
+// assigns it again, and is refused once erased so a create delivered again
+// does not bring a purged user back.
 func (s UserStore) create(ctx context.Context, tx *sql.Tx, user models.User) (models.User, error) {
+	if user.ID != 0 {
+		erased, err := s.erased(ctx, tx, user.ID)
+		if err != nil {
+			return models.User{}, err
+		}
+		if erased {
+			return models.User{}, ErrUserErased
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			SELECT setval('users_id_seq', GREATEST($1, last_value)) FROM users_id_seq
+		`, user.ID); err != nil {
+			return models.User{}, fmt.Errorf("%w failed to move the user id sequence", err)
+		}
+	}
 
 	row := tx.QueryRowContext(ctx, `
-		INSERT INTO users(first_name, last_name, nickname, password, email, country)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at
+		INSERT INTO users(id, first_name, last_name, nickname, password, email, country)
+		VALUES (COALESCE(NULLIF($1, 0), nextval('users_id_seq')), $2, $3, $4, $5, $6, $7)
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
 	`,
+		user.ID,
 		user.FirstName,
 		user.LastName,
 		user.Nickname,
@@ -166,17 +717,43 @@ func (s UserStore) create(ctx context.Context, tx *sql.Tx, user models.User) (mo
 		user.Email,
 		user.Country,
 	)
-	return s.scan(row)
+
+	result, err := s.scan(row)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if len(user.Roles) == 0 {
+		return result, nil
+	}
+
+	if err := s.storeRoles(ctx, tx, result.ID, user.Roles); err != nil {
+		return models.User{}, err
+	}
+	result.Roles = user.Roles
+
+	return result, nil
 }
 
 func (s UserStore) update(ctx context.Context, tx *sql.Tx, user models.User, version uint32) (models.User, error) {
+	next := version
+	if len(user.Meta.Changes()) > 0 {
+		next++
+	}
+
+	// the roles go first so the returned user holds them
+	if err := s.storeRoles(ctx, tx, user.ID, user.Roles); err != nil {
+		return models.User{}, err
+	}
 
 	row := tx.QueryRowContext(ctx, `
 		UPDATE users
 		SET first_name = $1, last_name = $2, nickname = $3, password = $4,
-		email = $5, country = $6, version = $7, updated_at = NOW()
+		email = $5, country = $6, version = $7,
+		updated_at = CASE WHEN version = $7 THEN updated_at ELSE NOW() END
 		WHERE id = $8 AND version = $9
-		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at
+		RETURNING id, first_name, last_name, nickname, password, email, country, disabled, version, created_at, updated_at,
+		ARRAY(SELECT role FROM user_roles WHERE user_id = users.id ORDER BY role)
 	`,
 		user.FirstName,
 		user.LastName,
@@ -184,13 +761,40 @@ func (s UserStore) update(ctx context.Context, tx *sql.Tx, user models.User, ver
 		user.Password,
 		user.Email,
 		user.Country,
-		user.Meta.GetVersion()+1,
+		next,
 		user.ID,
 		version,
 	)
 	return s.scan(row)
 }
 
+// storeRoles replaces the roles of the user, keeping the assignments that
+// did not change.
+func (s UserStore) storeRoles(ctx context.Context, tx *sql.Tx, id int, roles []string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role <> ALL($2)
+	`, id, textArray(roles))
+	if err != nil {
+		return fmt.Errorf("%w failed to delete roles", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_roles(user_id, role)
+		SELECT $1, unnest($2::TEXT[])
+		ON CONFLICT DO NOTHING
+	`, id, textArray(roles))
+	if err != nil {
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == pgerr.ForeignKeyViolation {
+			return ErrRoleNotFound
+		}
+
+		return fmt.Errorf("%w failed to insert roles", err)
+	}
+
+	return nil
+}
+
 func (s UserStore) scan(row *sql.Row) (models.User, error) {
 	var (
 		id        int
@@ -204,6 +808,7 @@ func (s UserStore) scan(row *sql.Row) (models.User, error) {
 		version   uint32
 		createdAt time.Time
 		updatedAt time.Time
+		roles     pgtype.TextArray
 	)
 
 	if err := row.Scan(
@@ -213,7 +818,7 @@ func (s UserStore) scan(row *sql.Row) (models.User, error) {
 		&nickname,
 		&password,
 		&email,
-		&country, &disabled, &version, &createdAt, &updatedAt); err != nil {
+		&country, &disabled, &version, &createdAt, &updatedAt, &roles); err != nil {
 		if pgErr, ok := err.(pgx.PgError); ok {
 			if pgErr.Code == pgerr.UniqueViolation {
 				return models.User{}, ErrUniqueViolation
@@ -227,7 +832,7 @@ func (s UserStore) scan(row *sql.Row) (models.User, error) {
 		return models.User{}, err
 	}
 
-	return s.hydrateUser(id, firstname, lastname, nickname, password, email, country, disabled, version, createdAt, updatedAt), nil
+	return s.hydrateUser(id, firstname, lastname, nickname, password, email, country, fromTextArray(roles), disabled, version, createdAt, updatedAt), nil
 }
 
 func (s UserStore) scanMultipleRows(rows *sql.Rows) ([]models.User, error) {
@@ -247,6 +852,7 @@ func (s UserStore) scanMultipleRows(rows *sql.Rows) ([]models.User, error) {
 		version   uint32
 		createdAt time.Time
 		updatedAt time.Time
+		roles     pgtype.TextArray
 	}
 
 	for rows.Next() {
@@ -258,7 +864,7 @@ func (s UserStore) scanMultipleRows(rows *sql.Rows) ([]models.User, error) {
 			&scannedUser.nickname,
 			&scannedUser.password,
 			&scannedUser.email,
-			&scannedUser.country, &scannedUser.disabled, &scannedUser.version, &scannedUser.createdAt, &scannedUser.updatedAt); err != nil {
+			&scannedUser.country, &scannedUser.disabled, &scannedUser.version, &scannedUser.createdAt, &scannedUser.updatedAt, &scannedUser.roles); err != nil {
 			if pgErr, ok := err.(pgx.PgError); ok {
 				if pgErr.Code == pgerr.UniqueViolation {
 					return nil, ErrUniqueViolation
@@ -274,7 +880,7 @@ func (s UserStore) scanMultipleRows(rows *sql.Rows) ([]models.User, error) {
 
 		user := s.hydrateUser(scannedUser.id, scannedUser.firstname, scannedUser.lastname,
 			scannedUser.nickname, scannedUser.password, scannedUser.email, scannedUser.country,
-			scannedUser.disabled, scannedUser.version, scannedUser.createdAt, scannedUser.updatedAt)
+			fromTextArray(scannedUser.roles), scannedUser.disabled, scannedUser.version, scannedUser.createdAt, scannedUser.updatedAt)
 
 		users = append(users, user)
 	}
@@ -282,8 +888,9 @@ func (s UserStore) scanMultipleRows(rows *sql.Rows) ([]models.User, error) {
 	return users, nil
 }
 
-func (s UserStore) hydrateUser(id int, fn, ln, nickname, password, email, country string, disabled bool, version uint32, createdAt, updatedAt time.Time) models.User {
+func (s UserStore) hydrateUser(id int, fn, ln, nickname, password, email, country string, roles []string, disabled bool, version uint32, createdAt, updatedAt time.Time) models.User {
 	user := models.NewUser(id, fn, ln, nickname, password, email, country)
+	user.Roles = roles
 
 	user.Meta.HydrateMeta(version, createdAt, updatedAt, disabled)
 
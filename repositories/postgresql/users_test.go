@@ -5,9 +5,11 @@ package postgresql
 import (
 	"code/tech-test/domain"
 	"code/tech-test/domain/users/models"
+	"code/tech-test/domain/users/query"
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,6 +42,9 @@ func initUserStore() (*UserStore, error) {
 	}
 
 	_, err = pool.Exec(`delete from users;
+		delete from user_history;
+		delete from erasures;
+		delete from outbox;
 		ALTER SEQUENCE users_id_seq RESTART WITH 1;
 		INSERT INTO users(first_name, last_name, nickname, password, email, country, created_at, updated_at, version)
 		VALUES ('Test', 'Test', 'testuser', 'qwerty', 'example@example.qqq', 'uk', '2020-01-01 00:00:00', '2020-01-01 00:00:00', 1),
@@ -62,6 +67,18 @@ func Test_UserStore_Store(t *testing.T) {
 	sampleMeta.HydrateMeta(1, time.Now(), time.Now(), false)
 	sampleMeta2.HydrateMeta(2, time.Now(), time.Now(), false)
 
+	updated := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	updated.Meta.HydrateMeta(1, time.Now(), time.Now(), false)
+	updated.SetCountry("uk-Updated")
+	updated.SetEmail("example@example.qqq-Updated")
+	updated.SetFirstName("Test-Updated")
+	updated.SetLastName("Test-Updated")
+	updated.SetPassword("qwerty-Updated")
+
+	rehashed := models.NewUser(1, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	rehashed.Meta.HydrateMeta(1, time.Now(), time.Now(), false)
+	rehashed.RehashPassword("qwerty-Rehashed")
+
 	type testInput struct {
 		user models.User
 	}
@@ -107,26 +124,36 @@ func Test_UserStore_Store(t *testing.T) {
 		{
 			description: "when updating a user",
 			input: testInput{
-				user: models.User{
+				user: updated,
+			},
+			expected: testExpectation{
+				result: models.User{
 					Nickname:  "testuser",
 					Country:   "uk-Updated",
 					Email:     "example@example.qqq-Updated",
 					FirstName: "Test-Updated",
 					LastName:  "Test-Updated",
 					Password:  "qwerty-Updated",
-					Meta:      sampleMeta,
+					Meta:      sampleMeta2,
 					ID:        1,
 				},
+				err: nil,
+			},
+		},
+		{
+			description: "when storing a user without changes",
+			input: testInput{
+				user: rehashed,
 			},
 			expected: testExpectation{
 				result: models.User{
 					Nickname:  "testuser",
-					Country:   "uk-Updated",
-					Email:     "example@example.qqq-Updated",
-					FirstName: "Test-Updated",
-					LastName:  "Test-Updated",
-					Password:  "qwerty-Updated",
-					Meta:      sampleMeta2,
+					Country:   "uk",
+					Email:     "example@example.qqq",
+					FirstName: "Test",
+					LastName:  "Test",
+					Password:  "qwerty-Rehashed",
+					Meta:      sampleMeta,
 					ID:        1,
 				},
 				err: nil,
@@ -211,10 +238,45 @@ func Test_UserStore_Store(t *testing.T) {
 	}
 }
 
+func Test_UserStore_Store_Unchanged(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	stored, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user := stored
+	user.RehashPassword("qwerty-Rehashed")
+
+	result, err := repo.Store(ctx, user, stored.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should store the user")
+	g.Expect(result.Password).To(Equal("qwerty-Rehashed"), "should store the new hash")
+	g.Expect(result.Meta.GetVersion()).To(Equal(stored.Meta.GetVersion()), "should keep the version")
+	g.Expect(result.Meta.GetUpdatedAt()).To(BeTemporally("==", stored.Meta.GetUpdatedAt()), "should keep the time of the last change")
+
+	history, err := repo.History(ctx, 1, 0, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(history).To(BeEmpty(), "should record no version")
+
+	messages, err := NewOutboxStore(repo.pool).Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(BeEmpty(), "should publish nothing")
+
+	_, err = repo.Store(ctx, stored, stored.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred(), "should still accept the version the clients hold")
+}
+
 func Test_UserStore_Delete(t *testing.T) {
 
 	type testInput struct {
-		id int
+		id      int
+		version uint32
+		deleted bool
 	}
 
 	type testExpectation struct {
@@ -242,6 +304,48 @@ func Test_UserStore_Delete(t *testing.T) {
 				err: nil,
 			},
 		},
+		{
+			description: "when deleting the current version of a user",
+			input: testInput{
+				id:      1,
+				version: 1,
+			},
+			expected: testExpectation{
+				result: models.User{
+					Meta: expectedMeta,
+				},
+				err: nil,
+			},
+		},
+		{
+			description: "when deleting an outdated version of a user",
+			input: testInput{
+				id:      1,
+				version: 2,
+			},
+			expected: testExpectation{
+				err: ErrWrongVersion,
+			},
+		},
+		{
+			description: "when deleting a deleted user",
+			input: testInput{
+				id:      1,
+				deleted: true,
+			},
+			expected: testExpectation{
+				err: ErrUserNotFound,
+			},
+		},
+		{
+			description: "when deleting an unknown user",
+			input: testInput{
+				id: 100,
+			},
+			expected: testExpectation{
+				err: ErrUserNotFound,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -255,7 +359,12 @@ func Test_UserStore_Delete(t *testing.T) {
 			defer repo.pool.Close()
 			g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
 
-			user, err := repo.Delete(ctx, tc.input.id)
+			if tc.input.deleted {
+				_, err = repo.Delete(ctx, tc.input.id, 0)
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			user, err := repo.Delete(ctx, tc.input.id, tc.input.version)
 
 			if tc.expected.err != nil {
 				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
@@ -335,7 +444,7 @@ func Test_UserStore_Get(t *testing.T) {
 func Test_UserStore_List(t *testing.T) {
 
 	type testInput struct {
-		queryTerms map[string]string
+		filter query.Filter
 	}
 
 	type testExpectation struct {
@@ -351,9 +460,7 @@ func Test_UserStore_List(t *testing.T) {
 		{
 			description: "when searching for users with country uk",
 			input: testInput{
-				queryTerms: map[string]string{
-					"country": "uk",
-				},
+				filter: query.Equal("country", "uk"),
 			},
 			expected: testExpectation{
 				result: []models.User{
@@ -373,7 +480,7 @@ func Test_UserStore_List(t *testing.T) {
 		{
 			description: "when listing users",
 			input: testInput{
-				queryTerms: nil,
+				filter: nil,
 			},
 			expected: testExpectation{
 				result: []models.User{
@@ -412,7 +519,7 @@ func Test_UserStore_List(t *testing.T) {
 			defer repo.pool.Close()
 			g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
 
-			result, err := repo.List(ctx, tc.input.queryTerms)
+			result, err := repo.List(ctx, query.Query{Filter: tc.input.filter, Sort: query.Sort{Field: "id"}})
 
 			if tc.expected.err != nil {
 				g.Expect(err).To(Equal(tc.expected.err), "should return the expected error")
@@ -431,3 +538,100 @@ func Test_UserStore_List(t *testing.T) {
 		})
 	}
 }
+
+func Test_UserStore_Ping(t *testing.T) {
+	g := NewWithT(t)
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	g.Expect(repo.Ping(context.TODO())).To(Succeed(), "should reach the database")
+}
+
+type durations map[string]int
+
+func (d durations) Observe(seconds float64, labels ...string) {
+	d[strings.Join(labels, ".")]++
+}
+
+func Test_UserStore_WithDurations(t *testing.T) {
+	g := NewWithT(t)
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	recorded := durations{}
+	repo.WithDurations(recorded)
+
+	_, _ = repo.Get(context.TODO(), 1)
+	_, _ = repo.Get(context.TODO(), 2)
+	_, _ = repo.List(context.TODO(), query.Query{})
+
+	g.Expect(recorded).To(Equal(durations{"users.Get": 2, "users.List": 1}), "should record the duration of each call by method")
+}
+
+func Test_UserStore_Store_ID(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	user := models.CreateUser("Test", "Test", "upstream", "qwerty", "upstream@example.qqq", "uk")
+	user.ID = 1000
+
+	created, err := repo.Store(ctx, user, 0)
+	g.Expect(err).ToNot(HaveOccurred(), "should create the user")
+	g.Expect(created.ID).To(Equal(1000), "should keep the given id")
+
+	_, err = repo.Store(ctx, user, 0)
+	g.Expect(err).To(Equal(ErrUserExists), "should not create the user twice")
+
+	next, err := repo.Store(ctx, models.CreateUser("Test", "Test", "next", "qwerty", "next@example.qqq", "uk"), 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(next.ID).To(BeNumerically(">", 1000), "should assign the ids after the given one")
+
+	_, err = repo.Purge(ctx, 1000, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = repo.Store(ctx, user, 0)
+	g.Expect(err).To(Equal(ErrUserErased), "should not bring a purged user back")
+}
+
+func Test_UserStore_Snapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx := context.TODO()
+
+	repo, err := initUserStore()
+	g.Expect(err).ToNot(HaveOccurred(), "should not return an error setting up the repository")
+	defer repo.pool.Close()
+
+	user, err := repo.Get(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	user.SetEmail("changed@example.qqq")
+	changed, err := repo.Store(ctx, user, user.Meta.GetVersion())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	snapshotted, err := repo.Snapshot(ctx, 1, models.UserSnapshot{})
+	g.Expect(err).ToNot(HaveOccurred(), "should snapshot the user")
+	g.Expect(snapshotted.Meta.GetVersion()).To(Equal(changed.Meta.GetVersion()), "should keep the version")
+
+	messages, err := NewOutboxStore(repo.pool).Messages(ctx, 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(messages).To(HaveLen(2), "should write the snapshot to the outbox")
+
+	events, err := messages[1].Events()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(events).To(HaveLen(1))
+	g.Expect(events[0]).To(BeAssignableToTypeOf(models.UserSnapshot{}), "should write the snapshot after the changes")
+	g.Expect(string(messages[1].Payload)).To(ContainSubstring("changed@example.qqq"), "should hold the current state")
+
+	_, err = repo.Snapshot(ctx, 100, models.UserSnapshot{})
+	g.Expect(err).To(Equal(ErrUserNotFound), "should not find unknown users")
+}
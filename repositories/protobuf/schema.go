@@ -0,0 +1,347 @@
+package protobuf
+
+import (
+	"code/tech-test/repositories/schemas"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Schema is the schema of the user events, which are encoded as its first
+// message. The encoder writes the fields by these numbers, so both change
+// together. Timestamps are microseconds since the epoch.
+const Schema = `syntax = "proto3";
+
+package users;
+
+message UserEvent {
+  string type = 1;
+  int64 user_id = 2;
+  uint32 version = 3;
+  int64 occurred_at = 4;
+  // old and new are set for the changes to a field
+  string old = 5;
+  string new = 6;
+  // role is set when a role is assigned or revoked
+  string role = 7;
+  // user is set when the user is created
+  User user = 8;
+}
+
+message User {
+  int64 id = 1;
+  string first_name = 2;
+  string last_name = 3;
+  string nickname = 4;
+  string email = 5;
+  string country = 6;
+  repeated string roles = 7;
+  int64 created_at = 8;
+  int64 updated_at = 9;
+  bool active = 10;
+  uint32 version = 11;
+}
+`
+
+// Definition is a Protobuf schema for the registry.
+type Definition struct {
+	schema string
+}
+
+func NewDefinition(schema string) Definition {
+	return Definition{
+		schema: schema,
+	}
+}
+
+func (d Definition) SchemaType() string {
+	return "PROTOBUF"
+}
+
+func (d Definition) Schema() string {
+	return d.schema
+}
+
+// CheckBackward compares the messages by name and their fields by number. A
+// field may be added or removed, but a number kept must keep a type with the
+// same wire encoding and the same cardinality.
+func (d Definition) CheckBackward(previous string) error {
+	reader, err := parse(d.schema)
+	if err != nil {
+		return err
+	}
+
+	writer, err := parse(previous)
+	if err != nil {
+		return err
+	}
+
+	if len(writer.order) > 0 && (len(reader.order) == 0 || reader.order[0] != writer.order[0]) {
+		return fmt.Errorf("%w message %s is no longer the first one", schemas.ErrIncompatibleSchema, writer.order[0])
+	}
+
+	for _, name := range writer.order {
+		old := writer.messages[name]
+
+		current, ok := reader.messages[name]
+		if !ok {
+			continue
+		}
+
+		for number, f := range old {
+			n, ok := current[number]
+			if !ok {
+				continue
+			}
+
+			if n.repeated != f.repeated || !compatible(n.kind, f.kind) {
+				return fmt.Errorf("%w field %d of %s changed from %s to %s", schemas.ErrIncompatibleSchema, number, name, f, n)
+			}
+		}
+	}
+
+	return nil
+}
+
+type protoField struct {
+	name     string
+	kind     string
+	repeated bool
+}
+
+func (f protoField) String() string {
+	if f.repeated {
+		return "repeated " + f.kind
+	}
+
+	return f.kind
+}
+
+type file struct {
+	messages map[string]map[int]protoField
+	order    []string
+}
+
+// wireTypes groups the scalar types by their encoding, a type can be read as
+// another of its group.
+var wireTypes = map[string]string{
+	"int32": "varint", "int64": "varint", "uint32": "varint", "uint64": "varint", "bool": "varint",
+	"sint32": "zigzag", "sint64": "zigzag",
+	"fixed32": "fixed32", "sfixed32": "fixed32", "float": "float",
+	"fixed64": "fixed64", "sfixed64": "fixed64", "double": "double",
+	"string": "bytes", "bytes": "bytes",
+}
+
+func compatible(reader, writer string) bool {
+	if reader == writer {
+		return true
+	}
+
+	r, ok := wireTypes[reader]
+	w, ok2 := wireTypes[writer]
+
+	return ok && ok2 && r == w
+}
+
+// parse reads the messages of a proto file, enough of the language for the
+// compatibility checks: options, imports and enums are skipped.
+func parse(schema string) (file, error) {
+	f := file{messages: make(map[string]map[int]protoField)}
+	p := parser{tokens: tokenize(schema)}
+
+	for !p.done() {
+		switch p.next() {
+		case "message":
+			if err := p.message("", &f); err != nil {
+				return file{}, err
+			}
+		case "enum", "service":
+			p.next()
+			p.skipBlock()
+		default:
+			p.skipStatement()
+		}
+	}
+
+	return f, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) next() string {
+	if p.done() {
+		return ""
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+
+	return t
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) skipStatement() {
+	for !p.done() {
+		t := p.next()
+		if t == ";" {
+			return
+		}
+		if t == "{" {
+			p.pos--
+			p.skipBlock()
+			return
+		}
+	}
+}
+
+func (p *parser) skipBlock() {
+	depth := 0
+
+	for !p.done() {
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *parser) message(parent string, f *file) error {
+	name := p.next()
+	if parent != "" {
+		name = parent + "." + name
+	}
+
+	if p.next() != "{" {
+		return fmt.Errorf("invalid protobuf message %s", name)
+	}
+
+	fields := make(map[int]protoField)
+	f.messages[name] = fields
+	f.order = append(f.order, name)
+
+	oneofs := 0
+
+	for !p.done() {
+		switch t := p.next(); t {
+		case "}":
+			if oneofs == 0 {
+				return nil
+			}
+			oneofs--
+		case "message":
+			if err := p.message(name, f); err != nil {
+				return err
+			}
+		case "enum":
+			p.next()
+			p.skipBlock()
+		case "oneof":
+			// the fields of a oneof are fields of the message
+			p.next()
+			p.next()
+			oneofs++
+		case "option", "reserved", "extensions":
+			p.skipStatement()
+		case ";":
+		default:
+			field := protoField{kind: t}
+			if t == "repeated" || t == "optional" || t == "required" {
+				field.repeated = t == "repeated"
+				field.kind = p.next()
+			}
+
+			if field.kind == "map" {
+				// map<key, value>
+				for p.peek() != ">" && !p.done() {
+					field.kind += p.next()
+				}
+				field.kind += p.next()
+			}
+
+			field.name = p.next()
+			if p.next() != "=" {
+				return fmt.Errorf("invalid protobuf field %s.%s", name, field.name)
+			}
+
+			number, err := strconv.Atoi(p.next())
+			if err != nil {
+				return fmt.Errorf("invalid number of protobuf field %s.%s", name, field.name)
+			}
+
+			fields[number] = field
+			p.skipStatement()
+		}
+	}
+
+	return fmt.Errorf("unterminated protobuf message %s", name)
+}
+
+// tokenize splits the schema into words and punctuation, dropping comments
+// and the contents of strings.
+func tokenize(schema string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+	)
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	runes := []rune(schema)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			flush()
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			flush()
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+		case r == '"' || r == '\'':
+			flush()
+			for i++; i < len(runes) && runes[i] != r; i++ {
+			}
+			tokens = append(tokens, `""`)
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("{}[]()<>=;,", r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
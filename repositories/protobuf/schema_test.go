@@ -0,0 +1,90 @@
+//+build unit
+
+package protobuf
+
+import (
+	"code/tech-test/repositories/schemas"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Definition_CheckBackward(t *testing.T) {
+	testCases := []struct {
+		description string
+		current     string
+		compatible  bool
+	}{
+		{
+			description: "when the schema is unchanged",
+			current:     Schema,
+			compatible:  true,
+		},
+		{
+			description: "when a field is added",
+			current:     strings.Replace(Schema, "User user = 8;", "User user = 8;\n  string actor = 9;", 1),
+			compatible:  true,
+		},
+		{
+			description: "when a field is removed",
+			current:     strings.Replace(Schema, "string role = 7;", "reserved 7;", 1),
+			compatible:  true,
+		},
+		{
+			description: "when a field keeps its wire type",
+			current:     strings.Replace(Schema, "uint32 version = 3;", "uint64 version = 3;", 1),
+			compatible:  true,
+		},
+		{
+			description: "when a field is renamed",
+			current:     strings.Replace(Schema, "string old = 5;", "string previous = 5;", 1),
+			compatible:  true,
+		},
+		{
+			description: "when a field changes its wire type",
+			current:     strings.Replace(Schema, "int64 user_id = 2;", "string user_id = 2;", 1),
+		},
+		{
+			description: "when a nested field becomes repeated",
+			current:     strings.Replace(Schema, "string email = 5;", "repeated string email = 5;", 1),
+		},
+		{
+			description: "when a number is reused",
+			current:     strings.Replace(Schema, "string role = 7;", "int64 role_id = 7;", 1),
+		},
+		{
+			description: "when the first message changes",
+			current:     strings.Replace(Schema, "message UserEvent {", "message Header {\n  string id = 1;\n}\n\nmessage UserEvent {", 1),
+		},
+		{
+			description: "when fields move into a oneof",
+			current:     strings.Replace(Schema, "string role = 7;\n", "oneof change {\n    string role = 7;\n  }\n", 1),
+			compatible:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := NewDefinition(tc.current).CheckBackward(Schema)
+
+			if tc.compatible {
+				g.Expect(err).ToNot(HaveOccurred(), "should read the data of the previous schema")
+			} else {
+				g.Expect(errors.Is(err, schemas.ErrIncompatibleSchema)).To(BeTrue(), "should reject the schema")
+			}
+		})
+	}
+}
+
+func Test_Schema(t *testing.T) {
+	g := NewWithT(t)
+
+	f, err := parse(Schema)
+	g.Expect(err).ToNot(HaveOccurred(), "should be a valid schema")
+	g.Expect(f.order).To(Equal([]string{"UserEvent", "User"}), "should read the messages in order")
+	g.Expect(f.messages["User"][7]).To(Equal(protoField{name: "roles", kind: "string", repeated: true}), "should read the fields")
+}
@@ -0,0 +1,276 @@
+package protobuf
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	jsonSerializer "code/tech-test/repositories/json"
+	"code/tech-test/repositories/schemas"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const ContentType = "application/x-protobuf"
+
+var ErrInvalidData = errors.New("invalid protobuf data")
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type Registry interface {
+	Register(subject string, definition schemas.Definition) (schemas.Schema, error)
+}
+
+// Serializer writes the user events in the Protobuf encoding, framed in the
+// Confluent wire format with the id of the schema.
+type Serializer struct {
+	schemaID int
+}
+
+// NewSerializer registers the schema for the subject, failing when it breaks
+// the backward compatibility with the registered one.
+func NewSerializer(registry Registry, subject string) (Serializer, error) {
+	schema, err := registry.Register(subject, NewDefinition(Schema))
+	if err != nil {
+		return Serializer{}, err
+	}
+
+	return Serializer{
+		schemaID: schema.ID,
+	}, nil
+}
+
+func (s Serializer) ContentType() string {
+	return ContentType
+}
+
+// Serialize frames the message after the message indexes of the Confluent
+// format, a single 0 for the first message of the schema.
+func (s Serializer) Serialize(user models.User, event domain.Event) ([]byte, error) {
+	message := jsonSerializer.UserSerializer{}.SerializeEvent(user, event)
+
+	return schemas.Frame(s.schemaID, append([]byte{0}, Encode(message)...)), nil
+}
+
+// Encode writes the message as a UserEvent. As in proto3, fields holding the
+// zero value are left out.
+func Encode(message jsonSerializer.EventMessage) []byte {
+	var e encoder
+
+	e.string(1, message.Type)
+	e.varint(2, uint64(message.UserID))
+	e.varint(3, uint64(message.Version))
+	e.varint(4, uint64(micros(message.OccurredAt)))
+
+	switch data := message.Data.(type) {
+	case jsonSerializer.ChangeMessage:
+		e.string(5, data.Old)
+		e.string(6, data.New)
+	case jsonSerializer.RoleMessage:
+		e.string(7, data.Role)
+	case jsonSerializer.UserMessage:
+		var u encoder
+
+		u.varint(1, uint64(data.ID))
+		u.string(2, data.FirstName)
+		u.string(3, data.LastName)
+		u.string(4, data.Nickname)
+		u.string(5, data.Email)
+		u.string(6, data.Country)
+		for _, r := range data.Roles {
+			u.bytes(7, []byte(r))
+		}
+		u.varint(8, uint64(micros(data.CreatedAt)))
+		u.varint(9, uint64(micros(data.UpdatedAt)))
+		if data.Active {
+			u.varint(10, 1)
+		}
+		u.varint(11, uint64(data.Version))
+
+		e.bytes(8, u.buf)
+	}
+
+	return e.buf
+}
+
+// Decode reads a UserEvent, skipping unknown fields.
+func Decode(payload []byte) (jsonSerializer.EventMessage, error) {
+	var (
+		message     jsonSerializer.EventMessage
+		change      jsonSerializer.ChangeMessage
+		role        string
+		user        *jsonSerializer.UserMessage
+		occurredAt  int64
+		changed     bool
+		roleChanged bool
+	)
+
+	err := fields(payload, func(number int, v uint64, b []byte) error {
+		switch number {
+		case 1:
+			message.Type = string(b)
+		case 2:
+			message.UserID = int(v)
+		case 3:
+			message.Version = uint32(v)
+		case 4:
+			occurredAt = int64(v)
+		case 5:
+			change.Old, changed = string(b), true
+		case 6:
+			change.New, changed = string(b), true
+		case 7:
+			role, roleChanged = string(b), true
+		case 8:
+			decoded, err := decodeUser(b)
+			if err != nil {
+				return err
+			}
+			user = &decoded
+		}
+
+		return nil
+	})
+	if err != nil {
+		return jsonSerializer.EventMessage{}, err
+	}
+
+	message.OccurredAt = fromMicros(occurredAt)
+
+	switch {
+	case user != nil:
+		message.Data = *user
+	case roleChanged:
+		message.Data = jsonSerializer.RoleMessage{Role: role}
+	case changed:
+		message.Data = change
+	}
+
+	return message, nil
+}
+
+func decodeUser(payload []byte) (jsonSerializer.UserMessage, error) {
+	var (
+		user                 = jsonSerializer.UserMessage{Roles: make([]string, 0)}
+		createdAt, updatedAt int64
+	)
+
+	err := fields(payload, func(number int, v uint64, b []byte) error {
+		switch number {
+		case 1:
+			user.ID = int(v)
+		case 2:
+			user.FirstName = string(b)
+		case 3:
+			user.LastName = string(b)
+		case 4:
+			user.Nickname = string(b)
+		case 5:
+			user.Email = string(b)
+		case 6:
+			user.Country = string(b)
+		case 7:
+			user.Roles = append(user.Roles, string(b))
+		case 8:
+			createdAt = int64(v)
+		case 9:
+			updatedAt = int64(v)
+		case 10:
+			user.Active = v != 0
+		case 11:
+			user.Version = uint32(v)
+		}
+
+		return nil
+	})
+
+	user.CreatedAt = fromMicros(createdAt)
+	user.UpdatedAt = fromMicros(updatedAt)
+
+	return user, err
+}
+
+// fields calls fn with the number and the value of every field, v for the
+// varints and b for the length delimited ones.
+func fields(payload []byte, fn func(number int, v uint64, b []byte) error) error {
+	for len(payload) > 0 {
+		key, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return ErrInvalidData
+		}
+		payload = payload[n:]
+
+		var (
+			v uint64
+			b []byte
+		)
+
+		switch key & 7 {
+		case wireVarint:
+			v, n = binary.Uvarint(payload)
+			if n <= 0 {
+				return ErrInvalidData
+			}
+			payload = payload[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(payload)
+			if n <= 0 || uint64(len(payload)-n) < length {
+				return ErrInvalidData
+			}
+			b = payload[n : n+int(length)]
+			payload = payload[n+int(length):]
+		default:
+			return ErrInvalidData
+		}
+
+		if err := fn(int(key>>3), v, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) varint(number int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	e.uvarint(uint64(number)<<3 | wireVarint)
+	e.uvarint(v)
+}
+
+func (e *encoder) string(number int, s string) {
+	if s == "" {
+		return
+	}
+
+	e.bytes(number, []byte(s))
+}
+
+func (e *encoder) bytes(number int, b []byte) {
+	e.uvarint(uint64(number)<<3 | wireBytes)
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func micros(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+func fromMicros(v int64) time.Time {
+	return time.Unix(0, v*int64(time.Microsecond)).UTC()
+}
@@ -0,0 +1,53 @@
+//+build unit
+
+package protobuf
+
+import (
+	"code/tech-test/domain"
+	"code/tech-test/domain/users/models"
+	jsonSerializer "code/tech-test/repositories/json"
+	"code/tech-test/repositories/schemas"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_Serializer(t *testing.T) {
+	at := time.Date(2021, time.May, 1, 1, 0, 0, 0, time.UTC)
+
+	user := models.NewUser(7, "Test", "Test", "testuser", "qwerty", "example@example.qqq", "uk")
+	user.Roles = []string{"admin", "support"}
+	user.Meta.HydrateMeta(2, at, at, false)
+
+	testCases := []struct {
+		description string
+		event       domain.Event
+	}{
+		{description: "when the user is created", event: models.UserCreated{At: at}},
+		{description: "when the email changes", event: models.EmailChanged{Old: "", New: "example@example.qqq", At: at}},
+		{description: "when a role is assigned", event: models.RoleAssigned{Role: "admin", At: at}},
+		{description: "when the user is deactivated", event: models.UserDeactivated{At: at}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			g := NewWithT(t)
+
+			serializer := Serializer{schemaID: 3}
+
+			framed, err := serializer.Serialize(user, tc.event)
+			g.Expect(err).ToNot(HaveOccurred(), "should serialize the event")
+
+			id, payload, err := schemas.Unframe(framed)
+			g.Expect(err).ToNot(HaveOccurred(), "should use the confluent wire format")
+			g.Expect(id).To(Equal(3), "should embed the schema id")
+
+			g.Expect(payload[0]).To(Equal(byte(0)), "should index the first message of the schema")
+
+			decoded, err := Decode(payload[1:])
+			g.Expect(err).ToNot(HaveOccurred(), "should decode the event")
+			g.Expect(decoded).To(Equal(jsonSerializer.UserSerializer{}.SerializeEvent(user, tc.event)), "should hold the same message as the json serializer")
+		})
+	}
+}
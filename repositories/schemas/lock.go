@@ -0,0 +1,29 @@
+//+build !windows
+
+package schemas
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock on the lock file of the registry, so the
+// processes sharing the registry file change it one at a time. The lock is
+// released by the returned function, or when the process exits.
+func (r *FileRegistry) lock() (func(), error) {
+	f, err := os.OpenFile(r.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w failed to open schema registry lock", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w failed to lock schema registry", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
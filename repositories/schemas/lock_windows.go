@@ -0,0 +1,30 @@
+//+build windows
+
+package schemas
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lock creates the lock file of the registry, waiting while another process
+// holds it, so the processes sharing the registry file change it one at a
+// time. The lock is released by the returned function.
+func (r *FileRegistry) lock() (func(), error) {
+	path := r.path + ".lock"
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		if err == nil {
+			f.Close()
+
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("%w failed to lock schema registry", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
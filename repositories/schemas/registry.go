@@ -0,0 +1,176 @@
+package schemas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+var (
+	ErrIncompatibleSchema = errors.New("incompatible schema")
+	ErrSchemaNotFound     = errors.New("schema not found")
+)
+
+// Definition is a schema along with the rules of its language.
+type Definition interface {
+	// SchemaType is AVRO or PROTOBUF, as in the Confluent schema registry.
+	SchemaType() string
+	Schema() string
+	// CheckBackward returns an error when data written with the previous
+	// schema cannot be read with this one.
+	CheckBackward(previous string) error
+}
+
+// Schema is a version of the schema of a subject. The id is unique across
+// subjects and is the one embedded in the messages.
+type Schema struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+}
+
+type registryFile struct {
+	Schemas []Schema `json:"schemas"`
+}
+
+// FileRegistry stands in for the Confluent schema registry, keeping the
+// schemas in a JSON file. Like the registry with the BACKWARD compatibility
+// level, a new version is only registered when it can read the data written
+// with the latest one.
+type FileRegistry struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{
+		path: path,
+	}
+}
+
+// Register returns the schema of the subject matching the definition,
+// registering it as a new version when it differs from the latest one. The
+// file is locked from its read to its write, so the instances starting at
+// the same time neither assign the same id nor lose a version.
+func (r *FileRegistry) Register(subject string, definition Definition) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Schema{}, err
+	}
+	defer unlock()
+
+	file, err := r.read()
+	if err != nil {
+		return Schema{}, err
+	}
+
+	var (
+		latest Schema
+		lastID int
+	)
+
+	for _, s := range file.Schemas {
+		if s.ID > lastID {
+			lastID = s.ID
+		}
+
+		if s.Subject == subject && s.Version > latest.Version {
+			latest = s
+		}
+	}
+
+	if latest.Version > 0 {
+		if latest.SchemaType == definition.SchemaType() && latest.Schema == definition.Schema() {
+			return latest, nil
+		}
+
+		if latest.SchemaType != definition.SchemaType() {
+			return Schema{}, fmt.Errorf("%w %s schema of %s replaced by %s", ErrIncompatibleSchema, latest.SchemaType, subject, definition.SchemaType())
+		}
+
+		if err := definition.CheckBackward(latest.Schema); err != nil {
+			return Schema{}, fmt.Errorf("%w failed to register version %d of %s", err, latest.Version+1, subject)
+		}
+	}
+
+	schema := Schema{
+		ID:         lastID + 1,
+		Subject:    subject,
+		Version:    latest.Version + 1,
+		SchemaType: definition.SchemaType(),
+		Schema:     definition.Schema(),
+	}
+
+	file.Schemas = append(file.Schemas, schema)
+
+	if err := r.write(file); err != nil {
+		return Schema{}, err
+	}
+
+	return schema, nil
+}
+
+// Get returns the schema with the id, for consumers to decode the messages.
+func (r *FileRegistry) Get(id int) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := r.read()
+	if err != nil {
+		return Schema{}, err
+	}
+
+	for _, s := range file.Schemas {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+
+	return Schema{}, ErrSchemaNotFound
+}
+
+func (r *FileRegistry) read() (registryFile, error) {
+	var file registryFile
+
+	b, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("%w failed to read schema registry", err)
+	}
+
+	if err := json.Unmarshal(b, &file); err != nil {
+		return file, fmt.Errorf("%w failed to parse schema registry", err)
+	}
+
+	return file, nil
+}
+
+// write replaces the file through a rename so a crash cannot leave it half
+// written.
+func (r *FileRegistry) write(file registryFile) error {
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w failed to marshal schema registry", err)
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("%w failed to write schema registry", err)
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("%w failed to write schema registry", err)
+	}
+
+	return nil
+}
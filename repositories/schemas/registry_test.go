@@ -0,0 +1,113 @@
+//+build unit
+
+package schemas
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// definition accepts any schema but those containing "breaking".
+type definition struct {
+	schemaType string
+	schema     string
+}
+
+func (d definition) SchemaType() string { return d.schemaType }
+func (d definition) Schema() string     { return d.schema }
+func (d definition) CheckBackward(previous string) error {
+	if strings.Contains(d.schema, "breaking") {
+		return ErrIncompatibleSchema
+	}
+	return nil
+}
+
+func Test_FileRegistry_Register(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "schemas")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	registry := NewFileRegistry(filepath.Join(dir, "schemas.json"))
+
+	first, err := registry.Register("users-value", definition{"AVRO", "v1"})
+	g.Expect(err).ToNot(HaveOccurred(), "should register the first version")
+	g.Expect(first.ID).To(Equal(1), "should assign the first id")
+	g.Expect(first.Version).To(Equal(1), "should register the first version")
+
+	other, err := registry.Register("roles-value", definition{"AVRO", "v1"})
+	g.Expect(err).ToNot(HaveOccurred(), "should register another subject")
+	g.Expect(other.ID).To(Equal(2), "should assign ids across subjects")
+	g.Expect(other.Version).To(Equal(1), "should version the subjects apart")
+
+	same, err := NewFileRegistry(filepath.Join(dir, "schemas.json")).Register("users-value", definition{"AVRO", "v1"})
+	g.Expect(err).ToNot(HaveOccurred(), "should find the registered schema")
+	g.Expect(same).To(Equal(first), "should keep the schemas in the file")
+
+	second, err := registry.Register("users-value", definition{"AVRO", "v2"})
+	g.Expect(err).ToNot(HaveOccurred(), "should register a compatible version")
+	g.Expect(second.ID).To(Equal(3), "should assign a new id")
+	g.Expect(second.Version).To(Equal(2), "should register the next version")
+
+	_, err = registry.Register("users-value", definition{"AVRO", "breaking"})
+	g.Expect(errors.Is(err, ErrIncompatibleSchema)).To(BeTrue(), "should reject an incompatible version")
+
+	_, err = registry.Register("users-value", definition{"PROTOBUF", "v3"})
+	g.Expect(errors.Is(err, ErrIncompatibleSchema)).To(BeTrue(), "should reject a change of schema type")
+
+	found, err := registry.Get(2)
+	g.Expect(err).ToNot(HaveOccurred(), "should get a schema by id")
+	g.Expect(found).To(Equal(other), "should get the schema with the id")
+
+	_, err = registry.Get(4)
+	g.Expect(err).To(Equal(ErrSchemaNotFound), "should not find rejected schemas")
+}
+
+func Test_FileRegistry_Register_Lock(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "schemas")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "schemas.json")
+
+	// another registry stands for another instance, with its own mutex
+	unlock, err := NewFileRegistry(path).lock()
+	g.Expect(err).ToNot(HaveOccurred(), "should lock the registry")
+
+	registered := make(chan error, 1)
+	go func() {
+		_, err := NewFileRegistry(path).Register("users-value", definition{"AVRO", "v1"})
+		registered <- err
+	}()
+
+	g.Consistently(registered, 100*time.Millisecond).ShouldNot(Receive(), "should wait for the other instance")
+
+	unlock()
+
+	g.Eventually(registered).Should(Receive(BeNil()), "should register once the file is unlocked")
+}
+
+func Test_Frame(t *testing.T) {
+	g := NewWithT(t)
+
+	framed := Frame(258, []byte("payload"))
+	g.Expect(framed[:5]).To(Equal([]byte{0, 0, 0, 1, 2}), "should prefix the magic byte and the schema id")
+
+	id, payload, err := Unframe(framed)
+	g.Expect(err).ToNot(HaveOccurred(), "should unframe the message")
+	g.Expect(id).To(Equal(258), "should read the schema id")
+	g.Expect(payload).To(Equal([]byte("payload")), "should return the payload")
+
+	_, _, err = Unframe([]byte(`{"id":1}`))
+	g.Expect(err).To(Equal(ErrInvalidFrame), "should reject other messages")
+}
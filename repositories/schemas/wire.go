@@ -0,0 +1,29 @@
+package schemas
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidFrame = errors.New("not in the confluent wire format")
+
+const magicByte = 0
+
+// Frame prefixes the payload with the magic byte and the big endian schema
+// id, the Confluent wire format the Kafka clients of the registry expect.
+func Frame(id int, payload []byte) []byte {
+	framed := make([]byte, 5, 5+len(payload))
+	framed[0] = magicByte
+	binary.BigEndian.PutUint32(framed[1:], uint32(id))
+
+	return append(framed, payload...)
+}
+
+// Unframe returns the schema id and the payload of a framed message.
+func Unframe(framed []byte) (int, []byte, error) {
+	if len(framed) < 5 || framed[0] != magicByte {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	return int(binary.BigEndian.Uint32(framed[1:5])), framed[5:], nil
+}